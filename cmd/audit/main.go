@@ -0,0 +1,57 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"time"
+
+	"dinoc2/pkg/audit"
+)
+
+func main() {
+	// Parse command line flags
+	auditFile := flag.String("file", "audit.log", "Path to the audit log file")
+	verify := flag.Bool("verify", true, "Verify the hash chain of the audit log")
+	dump := flag.Bool("dump", false, "Print the entries of the audit log")
+	operator := flag.String("operator", "", "Only print entries for this operator (with -dump)")
+	since := flag.String("since", "", "Only print entries at or after this RFC3339 time (with -dump)")
+	flag.Parse()
+
+	if *verify {
+		result, err := audit.Verify(*auditFile)
+		if err != nil {
+			fmt.Printf("Audit log verification FAILED: %v\n", err)
+			fmt.Printf("Entries verified before the failure: %d\n", result.Entries)
+			os.Exit(1)
+		}
+
+		fmt.Println("Audit log verification passed.")
+		fmt.Println("- Entries:", result.Entries)
+		fmt.Println("- Head hash:", result.HeadHash)
+	}
+
+	if *dump {
+		filter := audit.Filter{Operator: *operator}
+		if *since != "" {
+			t, err := time.Parse(time.RFC3339, *since)
+			if err != nil {
+				fmt.Printf("Error: invalid -since time: %v\n", err)
+				os.Exit(1)
+			}
+			filter.Since = t
+		}
+
+		entries, err := audit.ReadFile(*auditFile, filter)
+		if err != nil {
+			fmt.Printf("Error: %v\n", err)
+			os.Exit(1)
+		}
+
+		encoder := json.NewEncoder(os.Stdout)
+		for _, entry := range entries {
+			encoder.Encode(entry)
+		}
+	}
+}
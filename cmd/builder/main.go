@@ -36,6 +36,7 @@ type BuildConfig struct {
 	MaxRetries       int
 	ActiveSwitching  bool
 	PassiveSwitching bool
+	KillDate         string // RFC3339, empty for no kill date
 	BuildDir         string
 	SourceDir        string
 }
@@ -94,6 +95,7 @@ var BuildConfig = struct {
 	MaxRetries        int
 	ActiveSwitching   bool
 	PassiveSwitching  bool
+	KillDate          string
 }{
 	ServerAddr:        "{{.ServerAddr}}",
 	Protocols:         []string{{"{"}}{{range $index, $protocol := .Protocols}}{{if $index}}, {{end}}"{{$protocol}}"{{end}}{{"}"}},
@@ -108,6 +110,7 @@ var BuildConfig = struct {
 	MaxRetries:        {{.MaxRetries}},
 	ActiveSwitching:   {{.ActiveSwitching}},
 	PassiveSwitching:  {{.PassiveSwitching}},
+	KillDate:          "{{.KillDate}}",
 }
 `
 
@@ -129,6 +132,7 @@ func main() {
 	maxRetries := flag.Int("max-retries", 5, "Maximum number of connection retries")
 	activeSwitching := flag.Bool("active-switch", true, "Enable active protocol switching")
 	passiveSwitching := flag.Bool("passive-switch", true, "Enable passive protocol switching")
+	killDateStr := flag.String("kill-date", "", "Date after which the client shuts down and exits (RFC3339 or YYYY-MM-DD)")
 	verbose := flag.Bool("verbose", false, "Enable verbose output")
 	flag.Parse()
 
@@ -189,6 +193,21 @@ func main() {
 		os.Exit(1)
 	}
 
+	// Validate kill date
+	killDate := ""
+	if *killDateStr != "" {
+		t, err := parseKillDate(*killDateStr)
+		if err != nil {
+			fmt.Printf("Error: %v\n", err)
+			os.Exit(1)
+		}
+		if !t.After(time.Now()) {
+			fmt.Printf("Error: Kill date %s has already passed\n", t.Format(time.RFC3339))
+			os.Exit(1)
+		}
+		killDate = t.UTC().Format(time.RFC3339)
+	}
+
 	// Ensure output file has proper extension based on target OS
 	if filepath.Ext(*outputFile) == "" {
 		if *targetOS == "windows" {
@@ -214,6 +233,7 @@ func main() {
 		MaxRetries:       *maxRetries,
 		ActiveSwitching:  *activeSwitching,
 		PassiveSwitching: *passiveSwitching,
+		KillDate:         killDate,
 		BuildDir:         filepath.Join(os.TempDir(), fmt.Sprintf("dinoc2-build-%d", time.Now().UnixNano())),
 		SourceDir:        getSourceDir(),
 	}
@@ -232,6 +252,9 @@ func main() {
 	fmt.Println("- Jitter:", config.EnableJitter)
 	fmt.Println("- Active Protocol Switching:", config.ActiveSwitching)
 	fmt.Println("- Passive Protocol Switching:", config.PassiveSwitching)
+	if config.KillDate != "" {
+		fmt.Println("- Kill Date:", config.KillDate)
+	}
 
 	// Build the client
 	err := buildClient(config, *verbose)
@@ -262,6 +285,18 @@ func parseList(list string) []string {
 	return result
 }
 
+// parseKillDate parses a kill date given as RFC3339 or as a date in UTC
+func parseKillDate(value string) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, nil
+	}
+	t, err := time.Parse("2006-01-02", value)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid kill date %q, expected RFC3339 or YYYY-MM-DD", value)
+	}
+	return t, nil
+}
+
 // getAvailableNames returns a comma-separated list of available names
 func getAvailableNames(items interface{}) string {
 	var names []string
@@ -450,6 +485,7 @@ func generateConfigFile(config BuildConfig, clientDir string) error {
 		MaxRetries        int
 		ActiveSwitching   bool
 		PassiveSwitching  bool
+		KillDate          string
 	}{
 		Timestamp:         time.Now().Format(time.RFC3339),
 		ServerAddr:        config.ServerAddr,
@@ -465,6 +501,7 @@ func generateConfigFile(config BuildConfig, clientDir string) error {
 		MaxRetries:        config.MaxRetries,
 		ActiveSwitching:   config.ActiveSwitching,
 		PassiveSwitching:  config.PassiveSwitching,
+		KillDate:          config.KillDate,
 	}
 
 	err = tmpl.Execute(file, data)
@@ -980,6 +1017,14 @@ func copyModuleFiles(config BuildConfig, clientDir string) error {
 		return fmt.Errorf("failed to copy module.go: %w", err)
 	}
 
+	// Copy command schema file, which the modules declare their commands with
+	srcSchemaFile := filepath.Join(config.SourceDir, "pkg", "module", "schema.go")
+	dstSchemaFile := filepath.Join(modulesDir, "schema.go")
+	err = copyFile(srcSchemaFile, dstSchemaFile)
+	if err != nil {
+		return fmt.Errorf("failed to copy schema.go: %w", err)
+	}
+
 	// Copy registry file
 	srcRegistryFile := filepath.Join(config.SourceDir, "pkg", "module", "registry.go")
 	dstRegistryFile := filepath.Join(modulesDir, "registry.go")
@@ -0,0 +1,162 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"dinoc2/pkg/security"
+)
+
+const usage = `Usage: ca [-dir DIR] COMMAND [OPTIONS]
+
+Issues and revokes the client certificates operators present to the API.
+
+Commands:
+  init                          Create a new CA
+  issue -username NAME          Issue a certificate for an operator
+  revoke -serial SERIAL         Revoke a certificate
+  revoke -username NAME         Revoke every certificate of an operator
+  list                          List issued certificates
+`
+
+func main() {
+	// Parse command line flags
+	dir := flag.String("dir", "ca", "Directory that holds the CA")
+	flag.Usage = func() {
+		fmt.Fprint(os.Stderr, usage)
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	if flag.NArg() == 0 {
+		flag.Usage()
+		os.Exit(1)
+	}
+
+	var err error
+	switch flag.Arg(0) {
+	case "init":
+		err = initCA(*dir)
+	case "issue":
+		err = issue(*dir, flag.Args()[1:])
+	case "revoke":
+		err = revoke(*dir, flag.Args()[1:])
+	case "list":
+		err = list(*dir)
+	default:
+		flag.Usage()
+		os.Exit(1)
+	}
+
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		os.Exit(1)
+	}
+}
+
+// initCA creates a new CA
+func initCA(dir string) error {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return err
+	}
+
+	ca, err := security.InitOperatorCA(dir)
+	if err != nil {
+		return err
+	}
+
+	fmt.Println("CA created in", dir)
+	fmt.Println("Add these settings to the api section of the server configuration:")
+	fmt.Printf("  \"client_ca_file\": %q,\n", filepath.Join(dir, security.OperatorCACertFile))
+	fmt.Printf("  \"client_crl_file\": %q\n", ca.CRLFile())
+	return nil
+}
+
+// issue issues a certificate for an operator
+func issue(dir string, args []string) error {
+	flags := flag.NewFlagSet("issue", flag.ExitOnError)
+	username := flags.String("username", "", "Username of the operator, used as the certificate's common name")
+	days := flags.Int("days", 90, "Number of days the certificate is valid")
+	out := flags.String("out", "", "Path prefix of the certificate and key files (defaults to the username)")
+	flags.Parse(args)
+
+	if *username == "" {
+		return errors.New("-username is required")
+	}
+	if *out == "" {
+		*out = *username
+	}
+
+	ca, err := security.OpenOperatorCA(dir)
+	if err != nil {
+		return err
+	}
+
+	certFile, keyFile := *out+".pem", *out+"-key.pem"
+	cert, err := ca.Issue(*username, *days, certFile, keyFile)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("Issued certificate %s for %s, valid until %s\n", cert.Serial, cert.Username, cert.ExpiresAt.Format(time.RFC3339))
+	fmt.Println("- Certificate:", certFile)
+	fmt.Println("- Key:", keyFile)
+	return nil
+}
+
+// revoke revokes a certificate, or every certificate of an operator
+func revoke(dir string, args []string) error {
+	flags := flag.NewFlagSet("revoke", flag.ExitOnError)
+	serial := flags.String("serial", "", "Serial number of the certificate to revoke")
+	username := flags.String("username", "", "Revoke every certificate of this operator")
+	flags.Parse(args)
+
+	if (*serial == "") == (*username == "") {
+		return errors.New("exactly one of -serial and -username is required")
+	}
+
+	ca, err := security.OpenOperatorCA(dir)
+	if err != nil {
+		return err
+	}
+
+	if *serial != "" {
+		if err := ca.Revoke(*serial); err != nil {
+			return err
+		}
+		fmt.Println("Revoked certificate", *serial)
+	} else {
+		count, err := ca.RevokeUser(*username)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("Revoked %d certificate(s) of %s\n", count, *username)
+	}
+
+	fmt.Println("The server rejects revoked certificates as soon as it reads", ca.CRLFile())
+	return nil
+}
+
+// list prints the issued certificates
+func list(dir string) error {
+	ca, err := security.OpenOperatorCA(dir)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("%-20s %-16s %-25s %s\n", "SERIAL", "USERNAME", "EXPIRES", "STATUS")
+	for _, cert := range ca.Certificates() {
+		status := "valid"
+		if cert.RevokedAt != nil {
+			status = "revoked " + cert.RevokedAt.Format(time.RFC3339)
+		} else if time.Now().After(cert.ExpiresAt) {
+			status = "expired"
+		}
+		fmt.Printf("%-20s %-16s %-25s %s\n", cert.Serial, cert.Username, cert.ExpiresAt.Format(time.RFC3339), status)
+	}
+	return nil
+}
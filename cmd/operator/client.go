@@ -0,0 +1,346 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"dinoc2/pkg/api"
+)
+
+// refreshMargin is how long before it expires a token is refreshed
+const refreshMargin = time.Minute
+
+// errUnauthorized is returned when the server rejects the operator's token
+var errUnauthorized = errors.New("unauthorized")
+
+// APIClient calls the server's REST API, logging in and refreshing its token as needed
+type APIClient struct {
+	baseURL    string
+	username   string
+	password   string
+	httpClient *http.Client
+
+	token        string
+	refreshToken string
+	expiresAt    time.Time
+	mutex        sync.Mutex
+}
+
+// NewAPIClient creates an API client for the server at baseURL. If certFile
+// and keyFile are set, the client presents that certificate to the server.
+func NewAPIClient(baseURL, username, password, caFile, certFile, keyFile string, insecure bool) (*APIClient, error) {
+	tlsConfig := &tls.Config{InsecureSkipVerify: insecure}
+	if certFile != "" || keyFile != "" {
+		cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load client certificate: %w", err)
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+	if caFile != "" {
+		caData, err := os.ReadFile(caFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read CA file: %w", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(caData) {
+			return nil, errors.New("no certificates found in CA file")
+		}
+		tlsConfig.RootCAs = pool
+	}
+
+	return &APIClient{
+		baseURL:  strings.TrimRight(baseURL, "/"),
+		username: username,
+		password: password,
+		httpClient: &http.Client{
+			Transport: &http.Transport{TLSClientConfig: tlsConfig},
+		},
+	}, nil
+}
+
+// Login obtains a new token with the operator's credentials
+func (c *APIClient) Login() error {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return c.login()
+}
+
+// login obtains a new token. The caller must hold the mutex.
+func (c *APIClient) login() error {
+	body, err := json.Marshal(api.LoginRequest{Username: c.username, Password: c.password})
+	if err != nil {
+		return err
+	}
+
+	return c.requestToken("/api/v1/auth/login", body)
+}
+
+// refresh exchanges the refresh token for a new token pair. The caller must hold the mutex.
+func (c *APIClient) refresh() error {
+	if c.refreshToken == "" {
+		return errUnauthorized
+	}
+
+	body, err := json.Marshal(api.RefreshRequest{RefreshToken: c.refreshToken})
+	if err != nil {
+		return err
+	}
+
+	// A refresh token can only be used once, whether or not the request succeeds
+	c.refreshToken = ""
+	return c.requestToken("/api/v1/auth/refresh", body)
+}
+
+// requestToken sends a login or refresh request and stores the returned tokens
+func (c *APIClient) requestToken(path string, body []byte) error {
+	req, err := http.NewRequest(http.MethodPost, c.baseURL+path, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("%w: %s", errUnauthorized, readError(resp))
+	}
+
+	var tokenResp api.TokenResponse
+	if err := json.NewDecoder(resp.Body).Decode(&tokenResp); err != nil {
+		return fmt.Errorf("invalid token response: %w", err)
+	}
+
+	c.token = tokenResp.Token
+	c.refreshToken = tokenResp.RefreshToken
+	c.expiresAt = tokenResp.ExpiresAt
+	return nil
+}
+
+// Logout ends the operator's session on the server, revoking its tokens
+func (c *APIClient) Logout() error {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if c.token == "" {
+		return nil
+	}
+
+	req, err := http.NewRequest(http.MethodPost, c.baseURL+"/api/v1/auth/logout", nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+c.token)
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	c.token = ""
+	c.refreshToken = ""
+	if resp.StatusCode != http.StatusOK {
+		return errors.New(readError(resp))
+	}
+	return nil
+}
+
+// currentToken returns a token that is valid for at least refreshMargin,
+// refreshing it or logging in again if needed
+func (c *APIClient) currentToken() (string, error) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if c.token == "" {
+		if err := c.login(); err != nil {
+			return "", err
+		}
+	} else if !c.expiresAt.IsZero() && time.Until(c.expiresAt) < refreshMargin {
+		// An expired or reused refresh token cannot be refreshed, so fall back to logging in
+		if err := c.refresh(); err != nil {
+			if err := c.login(); err != nil {
+				return "", err
+			}
+		}
+	}
+
+	return c.token, nil
+}
+
+// invalidate discards the current token so that the next request logs in again
+func (c *APIClient) invalidate() {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.token = ""
+}
+
+// Do sends a request to the versioned API and decodes the response into result.
+// A request rejected as unauthorized is retried once with a new token.
+func (c *APIClient) Do(method, path string, body, result interface{}) error {
+	var data []byte
+	if body != nil {
+		var err error
+		if data, err = json.Marshal(body); err != nil {
+			return err
+		}
+	}
+
+	for attempt := 0; ; attempt++ {
+		err := c.do(method, path, data, result)
+		if errors.Is(err, errUnauthorized) && attempt == 0 {
+			c.invalidate()
+			continue
+		}
+		return err
+	}
+}
+
+// do sends a single request
+func (c *APIClient) do(method, path string, data []byte, result interface{}) error {
+	token, err := c.currentToken()
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequest(method, c.baseURL+"/api/v1"+path, bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+	if data != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusUnauthorized {
+		return fmt.Errorf("%w: %s", errUnauthorized, readError(resp))
+	}
+	if resp.StatusCode >= http.StatusBadRequest {
+		return errors.New(readError(resp))
+	}
+
+	if result == nil {
+		return nil
+	}
+	return json.NewDecoder(resp.Body).Decode(result)
+}
+
+// StreamEvent is an event received from the server's event stream
+type StreamEvent struct {
+	ID   uint64          `json:"id"`
+	Type string          `json:"type"`
+	Data json.RawMessage `json:"data"`
+}
+
+// StreamEvents delivers events of the given types to handle until ctx is
+// cancelled, reconnecting and resuming after the last event if the stream drops
+func (c *APIClient) StreamEvents(ctx context.Context, types []string, handle func(StreamEvent)) {
+	var lastID uint64
+	for {
+		err := c.streamEvents(ctx, types, &lastID, handle)
+		if ctx.Err() != nil {
+			return
+		}
+		if errors.Is(err, errUnauthorized) {
+			c.invalidate()
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(2 * time.Second):
+		}
+	}
+}
+
+// streamEvents reads the event stream until it ends
+func (c *APIClient) streamEvents(ctx context.Context, types []string, lastID *uint64, handle func(StreamEvent)) error {
+	token, err := c.currentToken()
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.baseURL+"/api/v1/events?types="+strings.Join(types, ","), nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+	if *lastID > 0 {
+		req.Header.Set("Last-Event-ID", strconv.FormatUint(*lastID, 10))
+	}
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusUnauthorized {
+		return errUnauthorized
+	}
+	if resp.StatusCode != http.StatusOK {
+		return errors.New(readError(resp))
+	}
+
+	// Only the data lines are needed, as the event carries its own ID and type
+	scanner := bufio.NewScanner(resp.Body)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if !strings.HasPrefix(line, "data: ") {
+			continue
+		}
+
+		var event StreamEvent
+		if err := json.Unmarshal([]byte(strings.TrimPrefix(line, "data: ")), &event); err != nil {
+			continue
+		}
+		*lastID = event.ID
+		handle(event)
+	}
+
+	return scanner.Err()
+}
+
+// readError returns the error message from an error response
+func readError(resp *http.Response) string {
+	data, _ := io.ReadAll(io.LimitReader(resp.Body, 64*1024))
+
+	var v1 api.ErrorResponse
+	if json.Unmarshal(data, &v1) == nil && v1.Error.Message != "" {
+		return v1.Error.Message
+	}
+	var legacy struct {
+		Error string `json:"error"`
+	}
+	if json.Unmarshal(data, &legacy) == nil && legacy.Error != "" {
+		return legacy.Error
+	}
+	if message := strings.TrimSpace(string(data)); message != "" {
+		return message
+	}
+	return resp.Status
+}
@@ -0,0 +1,1270 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"text/tabwriter"
+	"time"
+
+	"dinoc2/pkg/api"
+	"dinoc2/pkg/client"
+	"dinoc2/pkg/engagement"
+	"dinoc2/pkg/events"
+	"dinoc2/pkg/listener"
+	"dinoc2/pkg/module"
+	"dinoc2/pkg/module/loader"
+	"dinoc2/pkg/module/manager"
+	"dinoc2/pkg/task"
+)
+
+// command is a console command
+type command struct {
+	name        string
+	usage       string
+	description string
+	run         func(c *Console, args []string) error
+	// complete returns the candidates for the argument at index n, if any
+	complete func(c *Console, args []string, n int) []string
+}
+
+// commands lists the console commands in the order they are shown by help
+var commands []command
+
+func init() {
+	commands = []command{
+		{name: "help", usage: "help", description: "Show this help", run: (*Console).help},
+		{name: "listeners", usage: "listeners", description: "List listeners and their status", run: (*Console).listListeners},
+		{name: "listener", usage: "listener <create|show|start|stop|delete> <id> [type address port]", description: "Manage a listener",
+			run: (*Console).manageListener, complete: completeListener},
+		{name: "reload", usage: "reload", description: "Reload the listeners from the server's configuration file", run: (*Console).reloadConfig},
+		{name: "clients", usage: "clients [active|late|stale|lost|exited...] [field=value...]", description: "List clients, optionally only those in the given lifecycle states or matching filters such as os=linux listener=dns sort=hostname",
+			run: (*Console).listClients, complete: completeWords("active", "late", "stale", "lost", "exited")},
+		{name: "use", usage: "use <client>", description: "Select the client that exec, tasks and tail act on",
+			run: (*Console).useClient, complete: completeClients},
+		{name: "exec", usage: "exec <command...>", description: "Run a command on the selected client", run: (*Console).execCommand},
+		{name: "bulk", usage: "bulk <selector> <command...>", description: "Run a command on every client whose tags match a selector, such as os=linux,segment=dmz",
+			run: (*Console).bulkCommand},
+		{name: "tag", usage: "tag <client> [key=value...] [key=...]", description: "Show or change the tags of a client; an empty value removes the tag",
+			run: (*Console).tagClient, complete: completeClients},
+		{name: "note", usage: "note <client> [text...]", description: "Show the notes on a client, or attach a note to it",
+			run: (*Console).noteClient, complete: completeClients},
+		{name: "lock", usage: "lock <client> [duration] [reason...]", description: "Show the lock on a client, or take or renew a lock for a duration such as 2h (30m by default)",
+			run: (*Console).lockClient, complete: completeClients},
+		{name: "unlock", usage: "unlock <client> [force]", description: "Release your lock on a client; force releases another operator's lock",
+			run: (*Console).unlockClient, complete: completeClients},
+		{name: "cleanup", usage: "cleanup [client]", description: "Tell a client to remove its artifacts and exit, or show which clients have cleaned up",
+			run: (*Console).cleanupClient, complete: completeClients},
+		{name: "tasks", usage: "tasks [client]", description: "List the tasks of a client, or all tasks if none is selected",
+			run: (*Console).listTasks, complete: completeClients},
+		{name: "task", usage: "task <id>", description: "Show a task and its result",
+			run: (*Console).showTask, complete: completeTasks},
+		{name: "cancel", usage: "cancel <id> [reason...]", description: "Cancel a pending or running task",
+			run: (*Console).cancelTask, complete: completeTasks},
+		{name: "approvals", usage: "approvals", description: "List the tasks awaiting approval", run: (*Console).listApprovals},
+		{name: "approve", usage: "approve <id>", description: "Approve a task created by another operator",
+			run: (*Console).approveTask, complete: completeApprovals},
+		{name: "reject", usage: "reject <id> [reason...]", description: "Reject a task awaiting approval",
+			run: (*Console).rejectTask, complete: completeApprovals},
+		{name: "playbook", usage: "playbook <run|list|show|cancel> [file [name=value...] | id]", description: "Run a playbook file on the selected client, or list, show or cancel runs",
+			run: (*Console).managePlaybook, complete: completeWords("run", "list", "show", "cancel")},
+		{name: "schedule", usage: "schedule <every|cron|list|pause|resume|delete> [interval | minute hour day month weekday] [command... | id]",
+			description: "Run a command on the selected client at an interval such as 1h or on a cron expression, or manage schedules", run: (*Console).manageSchedule,
+			complete: completeWords("every", "cron", "list", "pause", "resume", "delete")},
+		{name: "tail", usage: "tail [on|off]", description: "Print task results for the selected client as they arrive",
+			run: (*Console).tail, complete: completeWords("on", "off")},
+		{name: "modules", usage: "modules", description: "List loaded modules", run: (*Console).listModules},
+		{name: "module", usage: "module <load|exec> <name> [path [loader] | command [args...]]", description: "Load or execute a module",
+			run: (*Console).manageModule, complete: completeModule},
+		{name: "engagement", usage: "engagement", description: "Show the engagement window", run: (*Console).showEngagement},
+		{name: "exit", usage: "exit", description: "Leave the console"},
+	}
+}
+
+// Console runs operator commands against the server
+type Console struct {
+	client   *APIClient
+	out      io.Writer
+	selected string
+
+	tailCancel context.CancelFunc
+	tailClient string
+	mutex      sync.Mutex
+}
+
+// NewConsole creates a console that writes its output to out
+func NewConsole(client *APIClient, out io.Writer) *Console {
+	return &Console{client: client, out: out}
+}
+
+// Prompt returns the prompt, which shows the selected client
+func (c *Console) Prompt() string {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if c.selected == "" {
+		return "dinoc2> "
+	}
+	return fmt.Sprintf("dinoc2 (%s)> ", c.selected)
+}
+
+// Execute runs a command line. It returns false if the console should exit.
+func (c *Console) Execute(line string) bool {
+	fields := strings.Fields(line)
+	if len(fields) == 0 {
+		return true
+	}
+	if fields[0] == "exit" || fields[0] == "quit" {
+		return false
+	}
+
+	for _, cmd := range commands {
+		if cmd.name == fields[0] {
+			if err := cmd.run(c, fields[1:]); err != nil {
+				fmt.Fprintf(c.out, "Error: %v\n", err)
+			}
+			return true
+		}
+	}
+
+	fmt.Fprintf(c.out, "Unknown command %q, type help for a list of commands\n", fields[0])
+	return true
+}
+
+// Close stops tailing task results
+func (c *Console) Close() {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.stopTail()
+}
+
+// Complete implements tab completion for term.Terminal.AutoCompleteCallback
+func (c *Console) Complete(line string, pos int, key rune) (string, int, bool) {
+	if key != '\t' {
+		return "", 0, false
+	}
+
+	// Complete the word that ends at the cursor
+	prefix := line[:pos]
+	fields := strings.Fields(prefix)
+	word := ""
+	if len(fields) > 0 && !strings.HasSuffix(prefix, " ") {
+		word = fields[len(fields)-1]
+		fields = fields[:len(fields)-1]
+	}
+
+	var candidates []string
+	if len(fields) == 0 {
+		for _, cmd := range commands {
+			candidates = append(candidates, cmd.name)
+		}
+	} else {
+		for _, cmd := range commands {
+			if cmd.name == fields[0] && cmd.complete != nil {
+				candidates = cmd.complete(c, fields[1:], len(fields)-1)
+			}
+		}
+	}
+
+	var matches []string
+	for _, candidate := range candidates {
+		if strings.HasPrefix(candidate, word) {
+			matches = append(matches, candidate)
+		}
+	}
+
+	switch len(matches) {
+	case 0:
+		return "", 0, false
+	case 1:
+		completed := prefix[:len(prefix)-len(word)] + matches[0] + " "
+		return completed + line[pos:], len(completed), true
+	}
+
+	// Extend the word to the longest common prefix of the matches, or list them
+	common := matches[0]
+	for _, match := range matches[1:] {
+		for !strings.HasPrefix(match, common) {
+			common = common[:len(common)-1]
+		}
+	}
+	if len(common) > len(word) {
+		completed := prefix[:len(prefix)-len(word)] + common
+		return completed + line[pos:], len(completed), true
+	}
+
+	fmt.Fprintln(c.out, strings.Join(matches, "  "))
+	return "", 0, false
+}
+
+// completeWords returns a completer that offers fixed words for the first argument
+func completeWords(words ...string) func(c *Console, args []string, n int) []string {
+	return func(c *Console, args []string, n int) []string {
+		if n == 0 {
+			return words
+		}
+		return nil
+	}
+}
+
+// completeListener completes the listener subcommands and listener IDs
+func completeListener(c *Console, args []string, n int) []string {
+	switch n {
+	case 0:
+		return []string{"create", "show", "start", "stop", "delete"}
+	case 1:
+		if args[0] != "create" {
+			return c.listenerIDs()
+		}
+	case 2:
+		if args[0] == "create" {
+			return c.listenerTypes()
+		}
+	}
+	return nil
+}
+
+// completeClients completes client IDs
+func completeClients(c *Console, args []string, n int) []string {
+	if n == 0 {
+		return c.clientIDs()
+	}
+	return nil
+}
+
+// completeTasks completes the IDs of the selected client's tasks
+func completeTasks(c *Console, args []string, n int) []string {
+	if n != 0 {
+		return nil
+	}
+
+	tasks, err := c.tasks(c.selectedClient())
+	if err != nil {
+		return nil
+	}
+	ids := make([]string, 0, len(tasks))
+	for _, t := range tasks {
+		ids = append(ids, strconv.FormatUint(uint64(t.ID), 10))
+	}
+	return ids
+}
+
+// completeApprovals completes the IDs of tasks awaiting approval
+func completeApprovals(c *Console, args []string, n int) []string {
+	if n != 0 {
+		return nil
+	}
+
+	var tasks []task.Task
+	if err := c.client.Do(http.MethodGet, "/tasks?status="+string(task.TaskStatusAwaitingApproval), nil, &tasks); err != nil {
+		return nil
+	}
+	ids := make([]string, 0, len(tasks))
+	for _, t := range tasks {
+		ids = append(ids, strconv.FormatUint(uint64(t.ID), 10))
+	}
+	return ids
+}
+
+// completeModule completes the module subcommands and module names
+func completeModule(c *Console, args []string, n int) []string {
+	switch n {
+	case 0:
+		return []string{"load", "exec"}
+	case 1:
+		if args[0] == "exec" {
+			return c.moduleNames()
+		}
+	case 2:
+		if args[0] == "exec" {
+			var names []string
+			for _, command := range c.moduleCommands(args[1]) {
+				if command.Name != module.AnyCommand {
+					names = append(names, command.Name)
+				}
+			}
+			return names
+		}
+	case 3:
+		if args[0] == "load" {
+			return []string{string(loader.LoaderTypeNative), string(loader.LoaderTypePlugin),
+				string(loader.LoaderTypeDLL), string(loader.LoaderTypeWasm), string(loader.LoaderTypeRPC)}
+		}
+	}
+	return nil
+}
+
+// selectedClient returns the ID of the selected client
+func (c *Console) selectedClient() string {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return c.selected
+}
+
+// help prints the list of commands
+func (c *Console) help(args []string) error {
+	w := tabwriter.NewWriter(c.out, 0, 4, 2, ' ', 0)
+	for _, cmd := range commands {
+		fmt.Fprintf(w, "  %s\t%s\n", cmd.usage, cmd.description)
+	}
+	fmt.Fprintln(w, "\nPress Tab to complete commands, listeners, clients, tasks and modules.")
+	return w.Flush()
+}
+
+// listenerIDs returns the sorted IDs of all listeners
+func (c *Console) listenerIDs() []string {
+	var listeners map[string]listener.ListenerStatus
+	if err := c.client.Do(http.MethodGet, "/listeners", nil, &listeners); err != nil {
+		return nil
+	}
+
+	ids := make([]string, 0, len(listeners))
+	for id := range listeners {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	return ids
+}
+
+// listenerTypes returns the listener types the server has registered, for completion
+func (c *Console) listenerTypes() []string {
+	var registrations []listener.Registration
+	if err := c.client.Do(http.MethodGet, "/listeners/types", nil, &registrations); err != nil {
+		return nil
+	}
+
+	types := make([]string, 0, len(registrations))
+	for _, registration := range registrations {
+		types = append(types, string(registration.Type))
+	}
+	return types
+}
+
+// listListeners prints all listeners
+func (c *Console) listListeners(args []string) error {
+	var listeners map[string]listener.ListenerStatus
+	if err := c.client.Do(http.MethodGet, "/listeners", nil, &listeners); err != nil {
+		return err
+	}
+
+	ids := make([]string, 0, len(listeners))
+	for id := range listeners {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+
+	w := tabwriter.NewWriter(c.out, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "ID\tSTATUS")
+	for _, id := range ids {
+		fmt.Fprintf(w, "%s\t%s\n", id, listeners[id])
+	}
+	return w.Flush()
+}
+
+// manageListener creates, shows, starts, stops or deletes a listener
+func (c *Console) manageListener(args []string) error {
+	if len(args) < 2 {
+		return fmt.Errorf("usage: listener <create|show|start|stop|delete> <id>")
+	}
+	action, id := args[0], args[1]
+	path := "/listeners/" + url.PathEscape(id)
+
+	var response api.MessageResponse
+	switch action {
+	case "create":
+		if len(args) != 5 {
+			return fmt.Errorf("usage: listener create <id> <type> <address> <port>")
+		}
+		port, err := strconv.Atoi(args[4])
+		if err != nil {
+			return fmt.Errorf("invalid port: %s", args[4])
+		}
+		request := api.ListenerRequest{ID: id, Type: args[2], Address: args[3], Port: port}
+		if err := c.client.Do(http.MethodPost, "/listeners", request, &response); err != nil {
+			return err
+		}
+	case "show":
+		var info api.ListenerInfo
+		if err := c.client.Do(http.MethodGet, path, nil, &info); err != nil {
+			return err
+		}
+		fmt.Fprintf(c.out, "%s (%s): %s\n", info.ID, info.Type, info.Status)
+		fmt.Fprintf(c.out, "Restart policy: %s, %d of %d restarts in a row\n", info.Restart.Policy, info.Restart.Restarts, info.Restart.MaxRestarts)
+		if info.Restart.CrashLoop {
+			fmt.Fprintln(c.out, "Crash looping: start the listener to try again")
+		} else if !info.Restart.NextRestart.IsZero() {
+			fmt.Fprintf(c.out, "Next restart: %s\n", info.Restart.NextRestart.Local().Format("2006-01-02 15:04:05"))
+		}
+		return nil
+	case "start", "stop":
+		if err := c.client.Do(http.MethodPost, path+"/"+action, nil, &response); err != nil {
+			return err
+		}
+	case "delete":
+		if err := c.client.Do(http.MethodDelete, path, nil, &response); err != nil {
+			return err
+		}
+	default:
+		return fmt.Errorf("unknown listener action: %s", action)
+	}
+
+	fmt.Fprintln(c.out, response.Message)
+	return nil
+}
+
+// reloadConfig reloads the listeners from the server's configuration file and
+// prints what changed
+func (c *Console) reloadConfig(args []string) error {
+	var result listener.ReloadResult
+	if err := c.client.Do(http.MethodPost, "/config/reload", nil, &result); err != nil {
+		return err
+	}
+
+	for _, change := range []struct {
+		name string
+		ids  []string
+	}{
+		{"Created", result.Created},
+		{"Reconfigured", result.Reconfigured},
+		{"Removed", result.Removed},
+		{"Unchanged", result.Unchanged},
+	} {
+		if len(change.ids) > 0 {
+			fmt.Fprintf(c.out, "%s: %s\n", change.name, strings.Join(change.ids, ", "))
+		}
+	}
+	ids := make([]string, 0, len(result.Failed))
+	for id := range result.Failed {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	for _, id := range ids {
+		fmt.Fprintf(c.out, "Failed: %s: %s\n", id, result.Failed[id])
+	}
+	return nil
+}
+
+// clients returns all clients
+func (c *Console) clients() ([]api.ClientInfo, error) {
+	var clients []api.ClientInfo
+	err := c.client.Do(http.MethodGet, "/clients", nil, &clients)
+	return clients, err
+}
+
+// clientIDs returns the IDs of all clients
+func (c *Console) clientIDs() []string {
+	clients, err := c.clients()
+	if err != nil {
+		return nil
+	}
+
+	ids := make([]string, 0, len(clients))
+	for _, client := range clients {
+		ids = append(ids, client.ID)
+	}
+	sort.Strings(ids)
+	return ids
+}
+
+// listClients prints the clients, filtered by lifecycle states and by
+// field=value arguments that are passed on as query parameters
+func (c *Console) listClients(args []string) error {
+	query := url.Values{}
+	var states []string
+	for _, arg := range args {
+		if field, value, ok := strings.Cut(arg, "="); ok {
+			query.Set(field, value)
+		} else {
+			states = append(states, arg)
+		}
+	}
+	if len(states) > 0 {
+		query.Set("lifecycle", strings.Join(states, ","))
+	}
+
+	var clients []api.ClientInfo
+	if err := c.client.Do(http.MethodGet, "/clients?"+query.Encode(), nil, &clients); err != nil {
+		return err
+	}
+
+	w := tabwriter.NewWriter(c.out, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "ID\tPROTOCOL\tSTATE\tLIFECYCLE\tREMOTE ADDRESS\tHOSTNAME\tOS\tUSER\tLAST HEARTBEAT\tTAGS\tQUARANTINED")
+	for _, client := range clients {
+		quarantined := "no"
+		if client.Quarantined {
+			quarantined = "yes: " + client.QuarantineReason
+		} else if client.ScopePending {
+			quarantined = "pending: no hostname reported"
+		}
+		platform := client.OS
+		if client.Architecture != "" {
+			platform += "/" + client.Architecture
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\t%s\t%s\t%s\t%s\t%s\n", client.ID, client.Protocol, client.State, client.Lifecycle,
+			client.RemoteAddress, client.Hostname, platform, client.User, client.LastHeartbeat, formatTags(client.Tags), quarantined)
+	}
+	return w.Flush()
+}
+
+// useClient selects the client that exec, tasks and tail act on
+func (c *Console) useClient(args []string) error {
+	if len(args) != 1 {
+		return fmt.Errorf("usage: use <client>")
+	}
+
+	clients, err := c.clients()
+	if err != nil {
+		return err
+	}
+	for _, client := range clients {
+		if client.ID == args[0] {
+			c.mutex.Lock()
+			c.selected = client.ID
+			c.mutex.Unlock()
+			return nil
+		}
+	}
+	return fmt.Errorf("client not found: %s", args[0])
+}
+
+// execCommand creates a command task for the selected client
+func (c *Console) execCommand(args []string) error {
+	clientID := c.selectedClient()
+	if clientID == "" {
+		return fmt.Errorf("no client selected, use the use command first")
+	}
+	if len(args) == 0 {
+		return fmt.Errorf("usage: exec <command...>")
+	}
+
+	request := api.TaskRequest{
+		Type:     string(task.TaskTypeCommand),
+		ClientID: clientID,
+		Data:     []byte(strings.Join(args, " ")),
+		Priority: task.TaskPriorityNormal,
+	}
+	var created task.Task
+	if err := c.client.Do(http.MethodPost, "/tasks", request, &created); err != nil {
+		return err
+	}
+
+	fmt.Fprintf(c.out, "Task %d created (%s)\n", created.ID, created.Status)
+	return nil
+}
+
+// cleanupClient creates an exit_cleanup task for a client, or prints the cleanup report
+func (c *Console) cleanupClient(args []string) error {
+	if len(args) > 1 {
+		return fmt.Errorf("usage: cleanup [client]")
+	}
+
+	if len(args) == 1 {
+		request := api.TaskRequest{
+			Type:     string(task.TaskTypeExitCleanup),
+			ClientID: args[0],
+			Priority: task.TaskPriorityHigh,
+		}
+		var created task.Task
+		if err := c.client.Do(http.MethodPost, "/tasks", request, &created); err != nil {
+			return err
+		}
+		fmt.Fprintf(c.out, "Task %d created (%s)\n", created.ID, created.Status)
+		return nil
+	}
+
+	var report task.CleanupReport
+	if err := c.client.Do(http.MethodGet, "/tasks/cleanup", nil, &report); err != nil {
+		return err
+	}
+
+	w := tabwriter.NewWriter(c.out, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "CLIENT\tSTATUS\tTASK\tANSWERED\tREMOVED\tERROR")
+	for _, client := range report.Clients {
+		answered := "-"
+		if !client.AnsweredAt.IsZero() {
+			answered = client.AnsweredAt.Local().Format("2006-01-02 15:04:05")
+		}
+		removed := 0
+		for _, artifact := range client.Artifacts {
+			if artifact.Removed {
+				removed++
+			}
+		}
+		fmt.Fprintf(w, "%s\t%s\t%d\t%s\t%d/%d\t%s\n", client.ClientID, client.Status, client.TaskID, answered,
+			removed, len(client.Artifacts), client.Error)
+		for _, artifact := range client.Artifacts {
+			if !artifact.Removed {
+				fmt.Fprintf(w, "\t\t\t\t%s\t%s\n", artifact.Path, artifact.Error)
+			}
+		}
+	}
+	return w.Flush()
+}
+
+// bulkCommand runs a command on every client whose tags match a selector
+func (c *Console) bulkCommand(args []string) error {
+	if len(args) < 2 {
+		return fmt.Errorf("usage: bulk <selector> <command...>")
+	}
+
+	request := api.TaskRequest{
+		Type:     string(task.TaskTypeCommand),
+		Selector: args[0],
+		Data:     []byte(strings.Join(args[1:], " ")),
+		Priority: task.TaskPriorityNormal,
+	}
+	var created task.Task
+	if err := c.client.Do(http.MethodPost, "/tasks", request, &created); err != nil {
+		return err
+	}
+
+	fmt.Fprintf(c.out, "Task %d created with %d child tasks (%s)\n", created.ID, len(created.Children), created.Status)
+	return nil
+}
+
+// tagClient shows or changes the tags of a client
+func (c *Console) tagClient(args []string) error {
+	if len(args) < 1 {
+		return fmt.Errorf("usage: tag <client> [key=value...]")
+	}
+
+	path := "/clients/" + url.PathEscape(args[0]) + "/tags"
+	var tags map[string]string
+	if len(args) == 1 {
+		if err := c.client.Do(http.MethodGet, path, nil, &tags); err != nil {
+			return err
+		}
+	} else {
+		changes := make(map[string]string)
+		for _, arg := range args[1:] {
+			key, value, ok := strings.Cut(arg, "=")
+			if !ok {
+				return fmt.Errorf("invalid tag %q, expected key=value", arg)
+			}
+			changes[key] = value
+		}
+		if err := c.client.Do(http.MethodPatch, path, changes, &tags); err != nil {
+			return err
+		}
+	}
+
+	fmt.Fprintf(c.out, "%s: %s\n", args[0], formatTags(tags))
+	return nil
+}
+
+// formatTags formats tags as a sorted, comma-separated list of key=value pairs
+func formatTags(tags map[string]string) string {
+	if len(tags) == 0 {
+		return "-"
+	}
+	pairs := make([]string, 0, len(tags))
+	for key, value := range tags {
+		pairs = append(pairs, key+"="+value)
+	}
+	sort.Strings(pairs)
+	return strings.Join(pairs, ",")
+}
+
+// noteClient shows the notes on a client, or attaches a note to it
+func (c *Console) noteClient(args []string) error {
+	if len(args) < 1 {
+		return fmt.Errorf("usage: note <client> [text...]")
+	}
+
+	path := "/clients/" + url.PathEscape(args[0]) + "/notes"
+	if len(args) > 1 {
+		var note client.Note
+		if err := c.client.Do(http.MethodPost, path, api.NoteRequest{Text: strings.Join(args[1:], " ")}, &note); err != nil {
+			return err
+		}
+		fmt.Fprintf(c.out, "Note %d added to %s\n", note.ID, args[0])
+		return nil
+	}
+
+	var notes []client.Note
+	if err := c.client.Do(http.MethodGet, path, nil, &notes); err != nil {
+		return err
+	}
+	if len(notes) == 0 {
+		fmt.Fprintf(c.out, "No notes on %s\n", args[0])
+		return nil
+	}
+	for _, note := range notes {
+		fmt.Fprintf(c.out, "%s  %s: %s\n", note.CreatedAt.Local().Format("2006-01-02 15:04:05"), note.Operator, note.Text)
+	}
+	return nil
+}
+
+// lockClient shows the lock on a client, or takes or renews a lock on it
+func (c *Console) lockClient(args []string) error {
+	if len(args) < 1 {
+		return fmt.Errorf("usage: lock <client> [duration] [reason...]")
+	}
+
+	path := "/clients/" + url.PathEscape(args[0]) + "/lock"
+	var lock client.Lock
+	if len(args) == 1 {
+		if err := c.client.Do(http.MethodGet, path, nil, &lock); err != nil {
+			return err
+		}
+	} else {
+		var lockReq api.LockRequest
+		reason := args[1:]
+		if duration, err := time.ParseDuration(args[1]); err == nil {
+			if duration < time.Second {
+				return fmt.Errorf("invalid duration %q, expected a duration such as 30m or 2h", args[1])
+			}
+			lockReq.Duration = int(duration / time.Second)
+			reason = args[2:]
+		}
+		lockReq.Reason = strings.Join(reason, " ")
+		if err := c.client.Do(http.MethodPost, path, lockReq, &lock); err != nil {
+			return err
+		}
+	}
+
+	fmt.Fprintf(c.out, "%s is locked by %s until %s", args[0], lock.Operator, lock.ExpiresAt.Local().Format("2006-01-02 15:04:05"))
+	if lock.Reason != "" {
+		fmt.Fprintf(c.out, ": %s", lock.Reason)
+	}
+	fmt.Fprintln(c.out)
+	return nil
+}
+
+// unlockClient releases a lock on a client
+func (c *Console) unlockClient(args []string) error {
+	if len(args) < 1 || len(args) > 2 || (len(args) == 2 && args[1] != "force") {
+		return fmt.Errorf("usage: unlock <client> [force]")
+	}
+
+	path := "/clients/" + url.PathEscape(args[0]) + "/lock"
+	if len(args) == 2 {
+		path += "?force=true"
+	}
+	if err := c.client.Do(http.MethodDelete, path, nil, nil); err != nil {
+		return err
+	}
+	fmt.Fprintf(c.out, "%s unlocked\n", args[0])
+	return nil
+}
+
+// tasks returns the tasks of a client, or all tasks if clientID is empty
+func (c *Console) tasks(clientID string) ([]task.Task, error) {
+	path := "/tasks"
+	if clientID != "" {
+		path += "?client_id=" + url.QueryEscape(clientID)
+	}
+
+	var tasks []task.Task
+	err := c.client.Do(http.MethodGet, path, nil, &tasks)
+	return tasks, err
+}
+
+// listTasks prints the tasks of a client
+func (c *Console) listTasks(args []string) error {
+	clientID := c.selectedClient()
+	if len(args) > 0 {
+		clientID = args[0]
+	}
+
+	tasks, err := c.tasks(clientID)
+	if err != nil {
+		return err
+	}
+	sort.Slice(tasks, func(i, j int) bool { return tasks[i].ID < tasks[j].ID })
+
+	w := tabwriter.NewWriter(c.out, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "ID\tCLIENT\tTYPE\tSTATUS\tCREATED\tDATA")
+	for _, t := range tasks {
+		fmt.Fprintf(w, "%d\t%s\t%s\t%s\t%s\t%s\n", t.ID, t.ClientID, t.Type, t.Status,
+			t.CreatedAt.Local().Format("2006-01-02 15:04:05"), summarize(t.Data))
+	}
+	return w.Flush()
+}
+
+// showTask prints a task and its result
+func (c *Console) showTask(args []string) error {
+	if len(args) != 1 {
+		return fmt.Errorf("usage: task <id>")
+	}
+
+	var t task.Task
+	if err := c.client.Do(http.MethodGet, "/tasks/"+url.PathEscape(args[0]), nil, &t); err != nil {
+		return err
+	}
+
+	c.printResult(t)
+	return nil
+}
+
+// cancelTask cancels a task
+func (c *Console) cancelTask(args []string) error {
+	if len(args) < 1 {
+		return fmt.Errorf("usage: cancel <id> [reason...]")
+	}
+
+	var t task.Task
+	body := api.TaskCancelReason{Reason: strings.Join(args[1:], " ")}
+	if err := c.client.Do(http.MethodPost, "/tasks/"+url.PathEscape(args[0])+"/cancel", body, &t); err != nil {
+		return err
+	}
+
+	fmt.Fprintf(c.out, "Task %d cancelled\n", t.ID)
+	return nil
+}
+
+// listApprovals prints the tasks awaiting approval and who created them
+func (c *Console) listApprovals(args []string) error {
+	var tasks []task.Task
+	if err := c.client.Do(http.MethodGet, "/tasks?status="+string(task.TaskStatusAwaitingApproval), nil, &tasks); err != nil {
+		return err
+	}
+	sort.Slice(tasks, func(i, j int) bool { return tasks[i].ID < tasks[j].ID })
+
+	w := tabwriter.NewWriter(c.out, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "ID\tCLIENT\tTYPE\tCREATED BY\tCREATED\tDATA")
+	for _, t := range tasks {
+		fmt.Fprintf(w, "%d\t%s\t%s\t%s\t%s\t%s\n", t.ID, t.ClientID, t.Type, t.CreatedBy,
+			t.CreatedAt.Local().Format("2006-01-02 15:04:05"), summarize(t.Data))
+	}
+	return w.Flush()
+}
+
+// approveTask approves a task awaiting approval
+func (c *Console) approveTask(args []string) error {
+	if len(args) != 1 {
+		return fmt.Errorf("usage: approve <id>")
+	}
+
+	var t task.Task
+	if err := c.client.Do(http.MethodPost, "/tasks/"+url.PathEscape(args[0])+"/approve", nil, &t); err != nil {
+		return err
+	}
+
+	fmt.Fprintf(c.out, "Task %d approved (%s)\n", t.ID, t.Status)
+	return nil
+}
+
+// rejectTask rejects a task awaiting approval
+func (c *Console) rejectTask(args []string) error {
+	if len(args) < 1 {
+		return fmt.Errorf("usage: reject <id> [reason...]")
+	}
+
+	var t task.Task
+	body := api.TaskCancelReason{Reason: strings.Join(args[1:], " ")}
+	if err := c.client.Do(http.MethodPost, "/tasks/"+url.PathEscape(args[0])+"/reject", body, &t); err != nil {
+		return err
+	}
+
+	fmt.Fprintf(c.out, "Task %d rejected\n", t.ID)
+	return nil
+}
+
+// managePlaybook runs a playbook file, or lists, shows or cancels playbook runs
+func (c *Console) managePlaybook(args []string) error {
+	if len(args) == 0 {
+		return fmt.Errorf("usage: playbook <run|list|show|cancel>")
+	}
+
+	var run task.PlaybookRun
+	switch args[0] {
+	case "run":
+		clientID := c.selectedClient()
+		if clientID == "" {
+			return fmt.Errorf("no client selected, use the use command first")
+		}
+		if len(args) < 2 {
+			return fmt.Errorf("usage: playbook run <file> [name=value...]")
+		}
+
+		data, err := os.ReadFile(args[1])
+		if err != nil {
+			return err
+		}
+		request := api.PlaybookRequest{ClientID: clientID, Params: make(map[string]string)}
+		if err := json.Unmarshal(data, &request.Playbook); err != nil {
+			return fmt.Errorf("invalid playbook: %v", err)
+		}
+		for _, param := range args[2:] {
+			name, value, ok := strings.Cut(param, "=")
+			if !ok {
+				return fmt.Errorf("invalid parameter %q, expected name=value", param)
+			}
+			request.Params[name] = value
+		}
+
+		if err := c.client.Do(http.MethodPost, "/playbooks", request, &run); err != nil {
+			return err
+		}
+		fmt.Fprintf(c.out, "Playbook run %d started with %d steps\n", run.ID, len(run.Steps))
+		return nil
+	case "list":
+		var runs []task.PlaybookRun
+		if err := c.client.Do(http.MethodGet, "/playbooks", nil, &runs); err != nil {
+			return err
+		}
+
+		w := tabwriter.NewWriter(c.out, 0, 4, 2, ' ', 0)
+		fmt.Fprintln(w, "ID\tPLAYBOOK\tCLIENT\tSTATUS\tSTEPS\tCREATED")
+		for _, run := range runs {
+			fmt.Fprintf(w, "%d\t%s\t%s\t%s\t%d/%d\t%s\n", run.ID, run.Playbook, run.ClientID, run.Status,
+				run.Finished, len(run.Steps), run.CreatedAt.Local().Format("2006-01-02 15:04:05"))
+		}
+		return w.Flush()
+	case "show", "cancel":
+		if len(args) != 2 {
+			return fmt.Errorf("usage: playbook %s <id>", args[0])
+		}
+		path := "/playbooks/" + url.PathEscape(args[1])
+		if args[0] == "show" {
+			if err := c.client.Do(http.MethodGet, path, nil, &run); err != nil {
+				return err
+			}
+		} else if err := c.client.Do(http.MethodPost, path+"/cancel", nil, &run); err != nil {
+			return err
+		}
+
+		fmt.Fprintf(c.out, "Playbook run %d (%s) on %s: %s, %d of %d steps finished\n", run.ID, run.Playbook, run.ClientID,
+			run.Status, run.Finished, len(run.Steps))
+		if run.Error != "" {
+			fmt.Fprintf(c.out, "Error: %s\n", run.Error)
+		}
+		w := tabwriter.NewWriter(c.out, 0, 4, 2, ' ', 0)
+		fmt.Fprintln(w, "STEP\tTASK\tSTATUS")
+		for _, step := range run.Steps {
+			fmt.Fprintf(w, "%s\t%d\t%s\n", step.Step, step.TaskID, step.Status)
+		}
+		return w.Flush()
+	default:
+		return fmt.Errorf("unknown playbook action: %s", args[0])
+	}
+}
+
+// manageSchedule creates a schedule for the selected client, or lists, pauses, resumes or deletes schedules
+func (c *Console) manageSchedule(args []string) error {
+	if len(args) == 0 {
+		return fmt.Errorf("usage: schedule <every|cron|list|pause|resume|delete>")
+	}
+
+	var schedule task.Schedule
+	switch args[0] {
+	case "every", "cron":
+		clientID := c.selectedClient()
+		if clientID == "" {
+			return fmt.Errorf("no client selected, use the use command first")
+		}
+
+		// A cron expression is five fields, or a single @daily style shorthand
+		fields := 2
+		if args[0] == "cron" && len(args) > 1 && !strings.HasPrefix(args[1], "@") {
+			fields = 6
+		}
+		if len(args) <= fields {
+			return fmt.Errorf("usage: schedule every <interval> <command...> or schedule cron <minute hour day month weekday | @daily> <command...>")
+		}
+
+		request := task.Schedule{
+			ClientID: clientID,
+			Type:     task.TaskTypeCommand,
+			Data:     strings.Join(args[fields:], " "),
+			Priority: task.TaskPriorityNormal,
+		}
+		if args[0] == "every" {
+			interval, err := time.ParseDuration(args[1])
+			if err != nil || interval < time.Second {
+				return fmt.Errorf("invalid interval %q, expected a duration such as 30m or 24h", args[1])
+			}
+			request.Interval = int(interval / time.Second)
+		} else {
+			request.Cron = strings.Join(args[1:fields], " ")
+		}
+
+		if err := c.client.Do(http.MethodPost, "/schedules", request, &schedule); err != nil {
+			return err
+		}
+		fmt.Fprintf(c.out, "Schedule %d created, next run at %s\n", schedule.ID, schedule.NextRun.Local().Format("2006-01-02 15:04:05"))
+		return nil
+	case "list":
+		var schedules []task.Schedule
+		if err := c.client.Do(http.MethodGet, "/schedules", nil, &schedules); err != nil {
+			return err
+		}
+
+		w := tabwriter.NewWriter(c.out, 0, 4, 2, ' ', 0)
+		fmt.Fprintln(w, "ID\tCLIENT\tWHEN\tTASK\tNEXT RUN\tRUNS\tLAST ERROR")
+		for _, s := range schedules {
+			when := s.Cron
+			if s.Interval > 0 {
+				when = "every " + (time.Duration(s.Interval) * time.Second).String()
+			}
+			next := "paused"
+			if !s.Paused {
+				next = s.NextRun.Local().Format("2006-01-02 15:04:05")
+			}
+			fmt.Fprintf(w, "%d\t%s\t%s\t%s\t%s\t%d\t%s\n", s.ID, s.ClientID, when, summarize([]byte(s.Data)), next, s.Runs, s.LastError)
+		}
+		return w.Flush()
+	case "pause", "resume", "delete":
+		if len(args) != 2 {
+			return fmt.Errorf("usage: schedule %s <id>", args[0])
+		}
+		path := "/schedules/" + url.PathEscape(args[1])
+		if args[0] == "delete" {
+			if err := c.client.Do(http.MethodDelete, path, nil, nil); err != nil {
+				return err
+			}
+			fmt.Fprintf(c.out, "Schedule %s deleted\n", args[1])
+			return nil
+		}
+
+		if err := c.client.Do(http.MethodPost, path+"/"+args[0], nil, &schedule); err != nil {
+			return err
+		}
+		if schedule.Paused {
+			fmt.Fprintf(c.out, "Schedule %d paused\n", schedule.ID)
+		} else {
+			fmt.Fprintf(c.out, "Schedule %d resumed, next run at %s\n", schedule.ID, schedule.NextRun.Local().Format("2006-01-02 15:04:05"))
+		}
+		return nil
+	default:
+		return fmt.Errorf("unknown schedule action: %s", args[0])
+	}
+}
+
+// printResult prints a task's status and its result or error
+func (c *Console) printResult(t task.Task) {
+	fmt.Fprintf(c.out, "Task %d on %s: %s %s\n", t.ID, t.ClientID, t.Type, t.Status)
+	if len(t.Data) > 0 {
+		fmt.Fprintf(c.out, "Data: %s\n", summarize(t.Data))
+	}
+	if t.ApprovedBy != "" {
+		fmt.Fprintf(c.out, "Approved by: %s\n", t.ApprovedBy)
+	}
+	for _, flag := range t.Flags {
+		fmt.Fprintf(c.out, "Flagged: %s\n", flag)
+	}
+	if t.Error != "" {
+		fmt.Fprintf(c.out, "Error: %s\n", t.Error)
+	}
+	if len(t.Result) > 0 {
+		result := strings.TrimRight(string(t.Result), "\n")
+		fmt.Fprintf(c.out, "%s\n", result)
+	}
+}
+
+// tail starts or stops printing the results of the selected client's tasks
+func (c *Console) tail(args []string) error {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if len(args) > 0 && args[0] == "off" {
+		if c.tailCancel == nil {
+			return fmt.Errorf("not tailing")
+		}
+		fmt.Fprintf(c.out, "Stopped tailing %s\n", c.tailClient)
+		c.stopTail()
+		return nil
+	}
+
+	if c.selected == "" {
+		return fmt.Errorf("no client selected, use the use command first")
+	}
+	c.stopTail()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	c.tailCancel = cancel
+	c.tailClient = c.selected
+	clientID := c.selected
+
+	go c.client.StreamEvents(ctx, []string{string(events.TypeTaskStatus)}, func(event StreamEvent) {
+		var taskEvent events.TaskEvent
+		if err := json.Unmarshal(event.Data, &taskEvent); err != nil || taskEvent.ClientID != clientID {
+			return
+		}
+
+		switch task.TaskStatus(taskEvent.Status) {
+		case task.TaskStatusCompleted, task.TaskStatusFailed, task.TaskStatusCancelled, task.TaskStatusTimedOut, task.TaskStatusSkipped:
+			var t task.Task
+			if err := c.client.Do(http.MethodGet, fmt.Sprintf("/tasks/%d", taskEvent.TaskID), nil, &t); err != nil {
+				fmt.Fprintf(c.out, "Task %d %s, failed to get its result: %v\n", taskEvent.TaskID, taskEvent.Status, err)
+				return
+			}
+			c.printResult(t)
+		default:
+			fmt.Fprintf(c.out, "Task %d on %s: %s\n", taskEvent.TaskID, clientID, taskEvent.Status)
+		}
+	})
+
+	fmt.Fprintf(c.out, "Tailing task results for %s, type tail off to stop\n", clientID)
+	return nil
+}
+
+// stopTail stops tailing task results. The caller must hold the mutex.
+func (c *Console) stopTail() {
+	if c.tailCancel != nil {
+		c.tailCancel()
+		c.tailCancel = nil
+		c.tailClient = ""
+	}
+}
+
+// moduleNames returns the sorted names of the loaded modules
+func (c *Console) moduleNames() []string {
+	var modules map[string]manager.ModuleInfo
+	if err := c.client.Do(http.MethodGet, "/modules", nil, &modules); err != nil {
+		return nil
+	}
+
+	names := make([]string, 0, len(modules))
+	for name := range modules {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// moduleCommands returns the commands a module declares, if any
+func (c *Console) moduleCommands(name string) []module.Command {
+	var commands map[string][]module.Command
+	if err := c.client.Do(http.MethodGet, "/modules/commands", nil, &commands); err != nil {
+		return nil
+	}
+	return commands[name]
+}
+
+// moduleArgs converts command line arguments to the types the module command
+// declares for them, so that numbers and flags are not sent as strings
+func moduleArgs(commands []module.Command, command string, args []string) []interface{} {
+	var declared []module.Arg
+	for _, cmd := range commands {
+		if cmd.Name == command || cmd.Name == module.AnyCommand {
+			declared = cmd.Args
+			break
+		}
+	}
+
+	values := make([]interface{}, len(args))
+	for i, arg := range args {
+		values[i] = arg
+		if i >= len(declared) {
+			continue
+		}
+		switch declared[i].Type {
+		case module.ArgInt:
+			if n, err := strconv.Atoi(arg); err == nil {
+				values[i] = n
+			}
+		case module.ArgNumber:
+			if f, err := strconv.ParseFloat(arg, 64); err == nil {
+				values[i] = f
+			}
+		case module.ArgBool:
+			if b, err := strconv.ParseBool(arg); err == nil {
+				values[i] = b
+			}
+		}
+	}
+	return values
+}
+
+// listModules prints the loaded modules
+func (c *Console) listModules(args []string) error {
+	var modules map[string]manager.ModuleInfo
+	if err := c.client.Do(http.MethodGet, "/modules", nil, &modules); err != nil {
+		return err
+	}
+
+	names := make([]string, 0, len(modules))
+	for name := range modules {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	w := tabwriter.NewWriter(c.out, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "NAME\tLOADER\tPATH")
+	for _, name := range names {
+		fmt.Fprintf(w, "%s\t%s\t%s\n", name, modules[name].LoaderType, modules[name].Path)
+	}
+	return w.Flush()
+}
+
+// manageModule loads or executes a module
+func (c *Console) manageModule(args []string) error {
+	if len(args) < 2 {
+		return fmt.Errorf("usage: module <load|exec> <name> ...")
+	}
+	action, name := args[0], args[1]
+
+	switch action {
+	case "load":
+		if len(args) < 3 || len(args) > 4 {
+			return fmt.Errorf("usage: module load <name> <path> [loader]")
+		}
+		request := api.ModuleLoadRequest{Name: name, Path: args[2], LoaderType: loader.LoaderTypeNative}
+		if len(args) == 4 {
+			request.LoaderType = loader.LoaderType(args[3])
+		}
+		if err := c.client.Do(http.MethodPost, "/modules", request, nil); err != nil {
+			return err
+		}
+		fmt.Fprintf(c.out, "Module %s loaded\n", name)
+	case "exec":
+		if len(args) < 3 {
+			return fmt.Errorf("usage: module exec <name> <command> [args...]")
+		}
+		request := api.ModuleCommandRequest{
+			Command: args[2],
+			Args:    moduleArgs(c.moduleCommands(name), args[2], args[3:]),
+		}
+		var result interface{}
+		if err := c.client.Do(http.MethodPost, "/modules/"+url.PathEscape(name)+"/exec", request, &result); err != nil {
+			return err
+		}
+		data, _ := json.MarshalIndent(result, "", "  ")
+		fmt.Fprintln(c.out, string(data))
+	default:
+		return fmt.Errorf("unknown module action: %s", action)
+	}
+	return nil
+}
+
+// showEngagement prints the engagement window
+func (c *Console) showEngagement(args []string) error {
+	var status engagement.Status
+	if err := c.client.Do(http.MethodGet, "/engagement", nil, &status); err != nil {
+		return err
+	}
+
+	if status.Name != "" {
+		fmt.Fprintf(c.out, "Engagement: %s\n", status.Name)
+	}
+	fmt.Fprintf(c.out, "State: %s\n", status.State)
+	if status.Start != nil {
+		fmt.Fprintf(c.out, "Start: %s\n", status.Start.Local().Format("2006-01-02 15:04:05"))
+	}
+	if status.End != nil {
+		fmt.Fprintf(c.out, "End: %s\n", status.End.Local().Format("2006-01-02 15:04:05"))
+	}
+	if status.Remaining != "" {
+		fmt.Fprintf(c.out, "Remaining: %s\n", status.Remaining)
+	}
+	return nil
+}
+
+// summarize returns task data as a single line of at most 60 characters
+func summarize(data []byte) string {
+	s := strings.Join(strings.Fields(string(data)), " ")
+	if len(s) > 60 {
+		s = s[:57] + "..."
+	}
+	return s
+}
@@ -0,0 +1,122 @@
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+
+	"golang.org/x/term"
+)
+
+func main() {
+	// Parse command line flags
+	serverURL := flag.String("server", "https://127.0.0.1:8443", "URL of the server's API")
+	username := flag.String("username", "", "Operator username")
+	password := flag.String("password", "", "Operator password (prompted for if not set and DINOC2_PASSWORD is empty)")
+	caFile := flag.String("ca", "", "CA certificate used to verify the server")
+	certFile := flag.String("cert", "", "Client certificate presented to the server, if it requires one")
+	keyFile := flag.String("key", "", "Private key of the client certificate")
+	insecure := flag.Bool("insecure", false, "Do not verify the server's TLS certificate")
+	flag.Parse()
+
+	if *username == "" {
+		fmt.Println("Error: Username is required")
+		flag.Usage()
+		os.Exit(1)
+	}
+
+	interactive := term.IsTerminal(int(os.Stdin.Fd()))
+
+	if *password == "" {
+		*password = os.Getenv("DINOC2_PASSWORD")
+	}
+	if *password == "" {
+		if !interactive {
+			fmt.Println("Error: Password is required when not running in a terminal")
+			os.Exit(1)
+		}
+		fmt.Print("Password: ")
+		data, err := term.ReadPassword(int(os.Stdin.Fd()))
+		fmt.Println()
+		if err != nil {
+			fmt.Printf("Error reading password: %v\n", err)
+			os.Exit(1)
+		}
+		*password = string(data)
+	}
+
+	client, err := NewAPIClient(*serverURL, *username, *password, *caFile, *certFile, *keyFile, *insecure)
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	if err := client.Login(); err != nil {
+		fmt.Printf("Login failed: %v\n", err)
+		os.Exit(1)
+	}
+
+	if !interactive {
+		// Run the commands read from standard input, for use in scripts
+		console := NewConsole(client, os.Stdout)
+		scanner := bufio.NewScanner(os.Stdin)
+		for scanner.Scan() && console.Execute(scanner.Text()) {
+		}
+		console.Close()
+		logout(client)
+		return
+	}
+
+	err = runTerminal(client)
+	logout(client)
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		os.Exit(1)
+	}
+}
+
+// logout ends the session so that its tokens cannot be used after the console exits
+func logout(client *APIClient) {
+	if err := client.Logout(); err != nil {
+		fmt.Printf("Logout failed: %v\n", err)
+	}
+}
+
+// runTerminal runs the interactive console until the operator exits
+func runTerminal(client *APIClient) error {
+	fd := int(os.Stdin.Fd())
+	oldState, err := term.MakeRaw(fd)
+	if err != nil {
+		return err
+	}
+	defer term.Restore(fd, oldState)
+
+	terminal := term.NewTerminal(struct {
+		io.Reader
+		io.Writer
+	}{os.Stdin, os.Stdout}, "")
+	if width, height, err := term.GetSize(fd); err == nil {
+		terminal.SetSize(width, height)
+	}
+
+	console := NewConsole(client, terminal)
+	defer console.Close()
+	terminal.AutoCompleteCallback = console.Complete
+
+	fmt.Fprintln(terminal, "Connected to", client.baseURL, "as", client.username+". Type help for a list of commands.")
+	for {
+		terminal.SetPrompt(console.Prompt())
+		line, err := terminal.ReadLine()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if !console.Execute(line) {
+			return nil
+		}
+	}
+}
@@ -53,9 +53,9 @@ func main() {
 		log.Println("Starting with no listeners.")
 	}
 
-	// Setup signal handling for graceful shutdown
+	// Setup signal handling for graceful shutdown and configuration reloads
 	sigChan := make(chan os.Signal, 1)
-	signal.Notify(sigChan, syscall.SIGINT, syscall.SIGTERM)
+	signal.Notify(sigChan, syscall.SIGINT, syscall.SIGTERM, syscall.SIGHUP)
 
 	// Start the server
 	if err := srv.Start(); err != nil {
@@ -64,8 +64,13 @@ func main() {
 
 	fmt.Println("C2 Server started. Press Ctrl+C to exit.")
 
-	// Wait for termination signal
-	<-sigChan
+	// Reload the listeners from the configuration file on SIGHUP until a termination signal arrives
+	for sig := <-sigChan; sig == syscall.SIGHUP; sig = <-sigChan {
+		log.Println("Received SIGHUP, reloading configuration")
+		if _, err := srv.Reload(); err != nil {
+			log.Printf("Failed to reload configuration: %v", err)
+		}
+	}
 	fmt.Println("\nShutting down server...")
 
 	// Perform clean shutdown
@@ -9,6 +9,12 @@ import (
 	"dinoc2/pkg/listener"
 	"dinoc2/pkg/module/loader"
 	"dinoc2/pkg/module/manager"
+	
+	// Register the built-in listener types; TCP is registered by the listener package
+	_ "dinoc2/pkg/listener/dns"
+	_ "dinoc2/pkg/listener/http"
+	_ "dinoc2/pkg/listener/icmp"
+	_ "dinoc2/pkg/listener/websocket"
 )
 
 // ServerConfig holds the configuration for the C2 server
@@ -73,21 +79,10 @@ func (s *Server) Start() error {
 			continue
 		}
 
-		// Convert listener type string to ListenerType
-		var listenerType listener.ListenerType
-		switch lc.Type {
-		case "tcp":
-			listenerType = listener.ListenerTypeTCP
-		case "dns":
-			listenerType = listener.ListenerTypeDNS
-		case "icmp":
-			listenerType = listener.ListenerTypeICMP
-		case "http":
-			listenerType = listener.ListenerTypeHTTP
-		case "websocket":
-			listenerType = listener.ListenerTypeWebSocket
-		default:
-			return fmt.Errorf("unsupported listener type: %s", lc.Type)
+		// Only registered listener types can be created
+		listenerType := listener.ListenerType(lc.Type)
+		if _, err := listener.LookupType(listenerType); err != nil {
+			return fmt.Errorf("listener %s: %w", lc.ID, err)
 		}
 
 		// Create listener configuration
@@ -0,0 +1,263 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"dinoc2/pkg/audit"
+)
+
+// maxAuditBodySize limits how much of a request body is recorded in the audit log
+const maxAuditBodySize = 64 * 1024
+
+// redactedFields lists request fields that are never written to the audit log
+var redactedFields = map[string]bool{
+	"password":      true,
+	"token":         true,
+	"refresh_token": true,
+	"jwt_secret":    true,
+}
+
+// AuditQueryResponse is the response of an audit log query
+type AuditQueryResponse struct {
+	Entries  []audit.Entry `json:"entries"`
+	HeadSeq  uint64        `json:"head_seq"`
+	HeadHash string        `json:"head_hash"`
+}
+
+// auditQueryParams are the filters accepted by an audit log query
+var auditQueryParams = []param{
+	{name: "operator", description: "Only return requests made by this operator"},
+	{name: "path", description: "Only return requests to this path"},
+	{name: "outcome", description: "Only return requests with this outcome: success, failure or denied"},
+	{name: "since", description: "Only return requests made at or after this RFC3339 time"},
+	{name: "until", description: "Only return requests made before this RFC3339 time"},
+	{name: "limit", description: "Only return this many of the newest matching entries"},
+}
+
+// auditKey is the context key for the per-request audit information
+type auditKey struct{}
+
+// auditInfo is filled in while a request is handled and recorded once it completes
+type auditInfo struct {
+	operator string
+	role     string
+}
+
+// statusRecorder captures the status code and error body written by a handler
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+	body   bytes.Buffer
+}
+
+// WriteHeader implements http.ResponseWriter
+func (r *statusRecorder) WriteHeader(statusCode int) {
+	if r.status == 0 {
+		r.status = statusCode
+	}
+	r.ResponseWriter.WriteHeader(statusCode)
+}
+
+// Write implements http.ResponseWriter
+func (r *statusRecorder) Write(data []byte) (int, error) {
+	if r.status == 0 {
+		r.status = http.StatusOK
+	}
+	// Only error responses are kept, to record the failure reason
+	if r.status >= http.StatusBadRequest && r.body.Len() < 4096 {
+		r.body.Write(data)
+	}
+	return r.ResponseWriter.Write(data)
+}
+
+// Flush implements http.Flusher when the underlying writer supports it
+func (r *statusRecorder) Flush() {
+	if flusher, ok := r.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+// SetAuditLogger sets the audit log that records every API request
+func (r *Router) SetAuditLogger(logger *audit.Logger) {
+	r.auditLogger = logger
+}
+
+// serveAudited handles a request and records it in the audit log
+func (r *Router) serveAudited(w http.ResponseWriter, req *http.Request) {
+	// Capture the request body so it can be recorded and still read by the handler
+	var body []byte
+	if req.Body != nil {
+		body, _ = io.ReadAll(io.LimitReader(req.Body, maxAuditBodySize))
+		req.Body = io.NopCloser(io.MultiReader(bytes.NewReader(body), req.Body))
+	}
+
+	info := &auditInfo{}
+	req = req.WithContext(context.WithValue(req.Context(), auditKey{}, info))
+	recorder := &statusRecorder{ResponseWriter: w}
+
+	r.serveHTTP(recorder, req)
+
+	entry := audit.Entry{
+		Operator:   info.operator,
+		Role:       info.role,
+		Method:     req.Method,
+		Path:       req.URL.Path,
+		Query:      redactQuery(req.URL.Query()),
+		Request:    redactBody(body),
+		RemoteAddr: req.RemoteAddr,
+		Status:     recorder.status,
+	}
+	if entry.Status == 0 {
+		entry.Status = http.StatusOK
+	}
+
+	// Logins are attributed to the username in the request
+	if entry.Operator == "" && (req.URL.Path == "/api/auth/login" || req.URL.Path == "/api/v1/auth/login") {
+		var login struct {
+			Username string `json:"username"`
+		}
+		if json.Unmarshal(body, &login) == nil {
+			entry.Operator = login.Username
+		}
+	}
+	if entry.Operator == "" {
+		entry.Operator = "anonymous"
+	}
+
+	switch {
+	case entry.Status == http.StatusUnauthorized || entry.Status == http.StatusForbidden:
+		entry.Outcome = audit.OutcomeDenied
+	case entry.Status >= http.StatusBadRequest:
+		entry.Outcome = audit.OutcomeFailure
+	default:
+		entry.Outcome = audit.OutcomeSuccess
+	}
+	if entry.Outcome != audit.OutcomeSuccess {
+		entry.Error = errorMessage(recorder.body.Bytes())
+	}
+
+	if err := r.auditLogger.Log(entry); err != nil {
+		fmt.Printf("Failed to write audit log entry: %v\n", err)
+	}
+}
+
+// setAuditOperator records the authenticated operator for the current request
+func setAuditOperator(req *http.Request, operator, role string) {
+	if info, ok := req.Context().Value(auditKey{}).(*auditInfo); ok {
+		info.operator = operator
+		info.role = role
+	}
+}
+
+// redactBody returns the request body as JSON with sensitive fields removed
+func redactBody(body []byte) json.RawMessage {
+	body = bytes.TrimSpace(body)
+	if len(body) == 0 {
+		return nil
+	}
+
+	var fields map[string]interface{}
+	if err := json.Unmarshal(body, &fields); err != nil {
+		// Not a JSON object, record it as a string
+		data, _ := json.Marshal(string(body))
+		return data
+	}
+
+	for key := range fields {
+		if redactedFields[key] {
+			fields[key] = "[REDACTED]"
+		}
+	}
+
+	data, err := json.Marshal(fields)
+	if err != nil {
+		return nil
+	}
+	return data
+}
+
+// redactQuery returns the encoded query string with sensitive parameters removed
+func redactQuery(query url.Values) string {
+	for key := range query {
+		if redactedFields[key] {
+			query.Set(key, "[REDACTED]")
+		}
+	}
+	return query.Encode()
+}
+
+// errorMessage extracts the error message from a legacy or versioned error response body
+func errorMessage(body []byte) string {
+	var legacy struct {
+		Error string `json:"error"`
+	}
+	if json.Unmarshal(body, &legacy) == nil && legacy.Error != "" {
+		return legacy.Error
+	}
+	var response ErrorResponse
+	if json.Unmarshal(body, &response) == nil && response.Error.Message != "" {
+		return response.Error.Message
+	}
+	return string(bytes.TrimSpace(body))
+}
+
+// handleAuditQuery handles GET /api/audit
+func (r *Router) handleAuditQuery(w http.ResponseWriter, req *http.Request) {
+	if req.Method != http.MethodGet {
+		writeError(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	if r.auditLogger == nil {
+		writeError(w, "Audit logging is not enabled", http.StatusNotFound)
+		return
+	}
+
+	query := req.URL.Query()
+	filter := audit.Filter{
+		Operator: query.Get("operator"),
+		Path:     query.Get("path"),
+		Outcome:  audit.Outcome(query.Get("outcome")),
+	}
+
+	var err error
+	if since := query.Get("since"); since != "" {
+		if filter.Since, err = time.Parse(time.RFC3339, since); err != nil {
+			writeError(w, "Invalid since time, expected RFC3339", http.StatusBadRequest)
+			return
+		}
+	}
+	if until := query.Get("until"); until != "" {
+		if filter.Until, err = time.Parse(time.RFC3339, until); err != nil {
+			writeError(w, "Invalid until time, expected RFC3339", http.StatusBadRequest)
+			return
+		}
+	}
+	if limit := query.Get("limit"); limit != "" {
+		if filter.Limit, err = strconv.Atoi(limit); err != nil || filter.Limit < 0 {
+			writeError(w, "Invalid limit", http.StatusBadRequest)
+			return
+		}
+	}
+
+	entries, err := r.auditLogger.Query(filter)
+	if err != nil {
+		writeError(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	seq, hash := r.auditLogger.Head()
+	writeJSON(w, AuditQueryResponse{
+		Entries:  entries,
+		HeadSeq:  seq,
+		HeadHash: hash,
+	}, http.StatusOK)
+}
@@ -1,12 +1,270 @@
 package api
 
 import (
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
 	"dinoc2/pkg/api/middleware"
+	"dinoc2/pkg/auth"
 )
 
+// LoginRequest represents a request to log in
+type LoginRequest struct {
+	Username string `json:"username"`
+	Password string `json:"password"`
+}
+
+// TokenResponse carries a JWT token and, for versioned routes, the refresh token that replaces it
+type TokenResponse struct {
+	Token        string    `json:"token"`
+	RefreshToken string    `json:"refresh_token,omitempty"`
+	ExpiresAt    time.Time `json:"expires_at,omitempty"`
+}
+
+// RefreshRequest represents a request to exchange a refresh token for a new token pair
+type RefreshRequest struct {
+	RefreshToken string `json:"refresh_token"`
+}
+
+// RevokeRequest represents a request to revoke tokens. Exactly one field must be set.
+type RevokeRequest struct {
+	Username  string `json:"username,omitempty"`
+	SessionID string `json:"session_id,omitempty"`
+	TokenID   string `json:"token_id,omitempty"`
+}
+
 // RegisterAuthRoutes registers authentication routes
 func (r *Router) RegisterAuthRoutes(authMiddleware *middleware.AuthMiddleware) {
 	// Register login and refresh routes
-	r.routes["/api/auth/login"] = authMiddleware.HandleLogin
-	r.routes["/api/auth/refresh"] = authMiddleware.HandleRefresh
+	r.handle(route{method: http.MethodPost, path: "/api/v1/auth/login", public: true, tag: "auth",
+		summary: "Log in to get a JWT token and a refresh token", request: LoginRequest{}, response: TokenResponse{},
+		handler: r.handleLogin})
+	r.handle(route{method: http.MethodPost, path: "/api/v1/auth/refresh", public: true, tag: "auth",
+		summary: "Exchange a refresh token for a new token pair; each refresh token can only be used once",
+		request: RefreshRequest{}, response: TokenResponse{},
+		handler: r.handleRefresh})
+	r.handle(route{method: http.MethodPost, path: "/api/v1/auth/logout", tag: "auth",
+		summary: "End the current session, revoking its tokens", response: MessageResponse{},
+		handler: r.handleLogout})
+
+	// Register session and key management routes
+	r.handle(route{method: http.MethodGet, path: "/api/v1/auth/sessions", permission: auth.PermAuthManage, tag: "auth",
+		summary: "List active sessions", response: []middleware.Session{},
+		query:   []param{{name: "username", description: "Only list the sessions of this operator"}},
+		handler: r.handleListSessions})
+	r.handle(route{method: http.MethodPost, path: "/api/v1/auth/revoke", permission: auth.PermAuthManage, tag: "auth",
+		summary: "Revoke the tokens of an operator, a session or a single token", request: RevokeRequest{}, response: MessageResponse{},
+		handler: r.handleRevoke})
+	r.handle(route{method: http.MethodGet, path: "/api/v1/auth/keys", permission: auth.PermAuthManage, tag: "auth",
+		summary: "List signing keys", response: []middleware.KeyInfo{},
+		handler: r.handleListKeys})
+	r.handle(route{method: http.MethodPost, path: "/api/v1/auth/keys/rotate", permission: auth.PermAuthManage, tag: "auth",
+		summary:  "Sign new tokens with a new key; tokens signed with the previous key stay valid until they expire",
+		response: middleware.KeyInfo{},
+		handler:  r.handleRotateKey})
+	r.handle(route{method: http.MethodDelete, path: "/api/v1/auth/keys/{kid}", permission: auth.PermAuthManage, tag: "auth",
+		summary: "Delete a signing key, invalidating every token it signed", response: MessageResponse{},
+		handler: r.handleRetireKey})
+
+	r.handle(route{method: http.MethodPost, path: "/api/auth/login", public: true, legacy: true, tag: "auth",
+		summary: "Login to get a JWT token", request: LoginRequest{}, response: TokenResponse{},
+		handler: authMiddleware.HandleLogin})
+	r.handle(route{method: http.MethodPost, path: "/api/auth/refresh", public: true, legacy: true, tag: "auth",
+		summary: "Refresh a JWT token", response: TokenResponse{},
+		handler: authMiddleware.HandleRefresh})
+}
+
+// handleLogin handles POST /api/v1/auth/login
+func (r *Router) handleLogin(w http.ResponseWriter, req *http.Request) {
+	var loginReq LoginRequest
+	if err := json.NewDecoder(req.Body).Decode(&loginReq); err != nil {
+		writeError(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	if loginReq.Username == "" || loginReq.Password == "" {
+		writeError(w, "Username and password are required", http.StatusBadRequest)
+		return
+	}
+
+	if certUser := clientCertificateUser(req); certUser != "" && certUser != loginReq.Username {
+		writeError(w, "Client certificate does not belong to this operator", http.StatusUnauthorized)
+		return
+	}
+
+	role, valid := auth.ValidateUserCredentials(loginReq.Username, loginReq.Password)
+	if !valid {
+		writeError(w, "Invalid username or password", http.StatusUnauthorized)
+		return
+	}
+
+	tokens, err := r.authMiddleware.Login(loginReq.Username, role)
+	if err != nil {
+		writeError(w, "Failed to generate token", http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, tokenResponse(tokens), http.StatusOK)
+}
+
+// handleRefresh handles POST /api/v1/auth/refresh
+func (r *Router) handleRefresh(w http.ResponseWriter, req *http.Request) {
+	var refreshReq RefreshRequest
+	if err := json.NewDecoder(req.Body).Decode(&refreshReq); err != nil || refreshReq.RefreshToken == "" {
+		writeError(w, "A refresh token is required", http.StatusBadRequest)
+		return
+	}
+
+	tokens, err := r.authMiddleware.Refresh(refreshReq.RefreshToken)
+	if errors.Is(err, middleware.ErrRefreshTokenReused) {
+		writeError(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+	if err != nil {
+		writeError(w, "Failed to refresh token", http.StatusUnauthorized)
+		return
+	}
+
+	writeJSON(w, tokenResponse(tokens), http.StatusOK)
+}
+
+// handleLogout handles POST /api/v1/auth/logout
+func (r *Router) handleLogout(w http.ResponseWriter, req *http.Request) {
+	claims := getClaims(req)
+	if claims == nil {
+		writeError(w, "Authorization header with a bearer token required", http.StatusUnauthorized)
+		return
+	}
+
+	if err := r.authMiddleware.Logout(claims); err != nil {
+		writeError(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	writeMessage(w, "Logged out")
+}
+
+// handleListSessions handles GET /api/v1/auth/sessions
+func (r *Router) handleListSessions(w http.ResponseWriter, req *http.Request) {
+	writeJSON(w, r.authMiddleware.Sessions(req.URL.Query().Get("username")), http.StatusOK)
+}
+
+// handleRevoke handles POST /api/v1/auth/revoke
+func (r *Router) handleRevoke(w http.ResponseWriter, req *http.Request) {
+	var revokeReq RevokeRequest
+	if err := json.NewDecoder(req.Body).Decode(&revokeReq); err != nil {
+		writeError(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	var err error
+	switch {
+	case revokeReq.Username != "" && revokeReq.SessionID == "" && revokeReq.TokenID == "":
+		err = r.authMiddleware.RevokeUser(revokeReq.Username)
+	case revokeReq.SessionID != "" && revokeReq.Username == "" && revokeReq.TokenID == "":
+		err = r.authMiddleware.RevokeSession(revokeReq.SessionID)
+	case revokeReq.TokenID != "" && revokeReq.Username == "" && revokeReq.SessionID == "":
+		err = r.authMiddleware.RevokeTokenID(revokeReq.TokenID)
+	default:
+		writeError(w, "Exactly one of username, session_id and token_id is required", http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		writeError(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	writeMessage(w, "Tokens revoked")
+}
+
+// handleListKeys handles GET /api/v1/auth/keys
+func (r *Router) handleListKeys(w http.ResponseWriter, req *http.Request) {
+	writeJSON(w, r.authMiddleware.Keys(), http.StatusOK)
+}
+
+// handleRotateKey handles POST /api/v1/auth/keys/rotate
+func (r *Router) handleRotateKey(w http.ResponseWriter, req *http.Request) {
+	key, err := r.authMiddleware.RotateKey()
+	if err == middleware.ErrRotationUnsupported {
+		writeError(w, err.Error(), http.StatusConflict)
+		return
+	}
+	if err != nil {
+		writeError(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, key, http.StatusOK)
+}
+
+// handleRetireKey handles DELETE /api/v1/auth/keys/{kid}
+func (r *Router) handleRetireKey(w http.ResponseWriter, req *http.Request) {
+	err := r.authMiddleware.RetireKey(req.PathValue("kid"))
+	switch err {
+	case nil:
+		writeMessage(w, "Signing key deleted")
+	case middleware.ErrKeyNotFound:
+		writeError(w, err.Error(), http.StatusNotFound)
+	case middleware.ErrCurrentKey:
+		writeError(w, err.Error(), http.StatusConflict)
+	default:
+		writeError(w, err.Error(), http.StatusInternalServerError)
+	}
+}
+
+// SetClientCertificateRequired makes the router reject requests that do not
+// come with a verified client certificate. The certificate's common name is
+// the operator's username, and must match the operator a token was issued to.
+func (r *Router) SetClientCertificateRequired(required bool) {
+	r.requireClientCert = required
+}
+
+// SetRevocationCheck sets the function that reports whether a client
+// certificate has been revoked. It is checked on every request, so that
+// revoking a certificate also cuts off the connections already open with it.
+func (r *Router) SetRevocationCheck(isRevoked func(*x509.Certificate) bool) {
+	r.isRevoked = isRevoked
+}
+
+// checkClientCertificate checks the request's client certificate and returns
+// the operator it names. It writes an error and returns false if a required
+// certificate is missing, or if the certificate has been revoked.
+func (r *Router) checkClientCertificate(w http.ResponseWriter, req *http.Request) (string, bool) {
+	certUser := clientCertificateUser(req)
+	if r.requireClientCert && certUser == "" {
+		writeError(w, "Client certificate required", http.StatusUnauthorized)
+		return "", false
+	}
+	if certUser != "" && r.isRevoked != nil && r.isRevoked(req.TLS.VerifiedChains[0][0]) {
+		writeError(w, "Client certificate has been revoked", http.StatusUnauthorized)
+		return "", false
+	}
+	return certUser, true
+}
+
+// clientCertificateUser returns the operator named by the request's verified client certificate, if any
+func clientCertificateUser(req *http.Request) string {
+	if req.TLS == nil || len(req.TLS.VerifiedChains) == 0 || len(req.TLS.VerifiedChains[0]) == 0 {
+		return ""
+	}
+	return req.TLS.VerifiedChains[0][0].Subject.CommonName
+}
+
+// revokeUserTokens cuts off an operator whose account was disabled, deleted or given another role
+func (r *Router) revokeUserTokens(username string) {
+	if r.authMiddleware == nil {
+		return
+	}
+	if err := r.authMiddleware.RevokeUser(username); err != nil {
+		fmt.Printf("Failed to revoke the tokens of %s: %v\n", username, err)
+	}
+}
+
+// tokenResponse converts a token pair to a response
+func tokenResponse(tokens middleware.TokenPair) TokenResponse {
+	return TokenResponse{Token: tokens.Token, RefreshToken: tokens.RefreshToken, ExpiresAt: tokens.ExpiresAt}
 }
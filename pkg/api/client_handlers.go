@@ -1,9 +1,63 @@
 package api
 
 import (
+	"encoding/json"
+	"errors"
+	"fmt"
 	"net/http"
+	"time"
+	
+	"dinoc2/pkg/auth"
+	"dinoc2/pkg/client"
 )
 
+// ClientInfo describes a connected or restored client
+type ClientInfo struct {
+	ID                  string            `json:"id"`
+	Protocol            string            `json:"protocol"`
+	State               string            `json:"state"`
+	EncryptionAlgorithm string            `json:"encryption_algorithm"`
+	LastHeartbeat       string            `json:"last_heartbeat"`
+	RemoteAddress       string            `json:"remote_address"`
+	Hostname            string            `json:"hostname"`
+	OS                  string            `json:"os,omitempty"`
+	Architecture        string            `json:"arch,omitempty"`
+	User                string            `json:"user,omitempty"`
+	IPAddresses         []string          `json:"ip_addresses,omitempty"`
+	Quarantined         bool              `json:"quarantined"`
+	QuarantineReason    string            `json:"quarantine_reason,omitempty"`
+	ScopePending        bool              `json:"scope_pending,omitempty"` // the scope check waits for the client's hostname
+	Tags                map[string]string `json:"tags,omitempty"`
+	Lifecycle           client.Lifecycle  `json:"lifecycle"`       // active, late, stale, lost or exited
+	LifecycleSince      time.Time         `json:"lifecycle_since"` // when the client entered its lifecycle state
+	LastCheckIn         time.Time         `json:"last_check_in"`
+	Listener            string            `json:"listener,omitempty"`    // type of the listener the client last checked in through
+	ExitReason          string            `json:"exit_reason,omitempty"` // why the client exited
+	Lock                *client.Lock      `json:"lock,omitempty"`        // lock an operator holds on the client
+}
+
+// NoteRequest is the body of POST /api/v1/clients/{id}/notes
+type NoteRequest struct {
+	Text string `json:"text"`
+}
+
+// LockRequest is the body of POST /api/v1/clients/{id}/lock
+type LockRequest struct {
+	Duration int    `json:"duration,omitempty"` // in seconds, 0 for the default of 30 minutes
+	Reason   string `json:"reason,omitempty"`
+}
+
+// unlockQueryParams are the query parameters of DELETE /api/v1/clients/{id}/lock
+var unlockQueryParams = []param{
+	{name: "force", description: "Set to true to release a lock held by another operator, which requires the clients:unlock permission"},
+}
+
+// ClientListResponse is the response of GET /api/clients
+type ClientListResponse struct {
+	Status  string       `json:"status"`
+	Clients []ClientInfo `json:"clients"`
+}
+
 // handleListClients handles GET /api/clients
 func (r *Router) handleListClients(w http.ResponseWriter, req *http.Request) {
 	if req.Method != http.MethodGet {
@@ -11,25 +65,224 @@ func (r *Router) handleListClients(w http.ResponseWriter, req *http.Request) {
 		return
 	}
 	
-	// Get clients from client manager
+	infos, err := queryClients(r.clientInfos(), req.URL.Query())
+	if err != nil {
+		writeError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	
+	writeJSON(w, ClientListResponse{
+		Status:  "success",
+		Clients: infos,
+	}, http.StatusOK)
+}
+
+// handleListClientInfo handles GET /api/v1/clients
+func (r *Router) handleListClientInfo(w http.ResponseWriter, req *http.Request) {
+	infos, err := queryClients(r.clientInfos(), req.URL.Query())
+	if err != nil {
+		writeError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	
+	writeJSON(w, infos, http.StatusOK)
+}
+
+// handleGetClientCheckIns handles GET /api/v1/clients/{id}/checkins
+func (r *Router) handleGetClientCheckIns(w http.ResponseWriter, req *http.Request) {
+	checkIns, err := r.clientManager.CheckIns(req.PathValue("id"))
+	if err != nil {
+		writeError(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	
+	writeJSON(w, checkIns, http.StatusOK)
+}
+
+// handleGetClientTags handles GET /api/v1/clients/{id}/tags
+func (r *Router) handleGetClientTags(w http.ResponseWriter, req *http.Request) {
+	clientID := req.PathValue("id")
+	if _, err := r.clientManager.GetClient(clientID); err != nil {
+		writeError(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	
+	writeJSON(w, r.clientManager.Tags(clientID), http.StatusOK)
+}
+
+// handleSetClientTags handles PATCH /api/v1/clients/{id}/tags
+func (r *Router) handleSetClientTags(w http.ResponseWriter, req *http.Request) {
+	var tags map[string]string
+	if err := json.NewDecoder(req.Body).Decode(&tags); err != nil {
+		writeError(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	
+	r.setClientTags(w, req.PathValue("id"), tags)
+}
+
+// handleDeleteClientTag handles DELETE /api/v1/clients/{id}/tags/{key}
+func (r *Router) handleDeleteClientTag(w http.ResponseWriter, req *http.Request) {
+	r.setClientTags(w, req.PathValue("id"), map[string]string{req.PathValue("key"): ""})
+}
+
+// setClientTags changes the tags of a client and writes the tags it has afterwards
+func (r *Router) setClientTags(w http.ResponseWriter, clientID string, tags map[string]string) {
+	err := r.clientManager.SetTags(clientID, tags)
+	switch {
+	case errors.Is(err, client.ErrClientNotFound):
+		writeError(w, err.Error(), http.StatusNotFound)
+	case errors.Is(err, client.ErrInvalidTag):
+		writeError(w, err.Error(), http.StatusBadRequest)
+	case err != nil:
+		writeError(w, err.Error(), http.StatusInternalServerError)
+	default:
+		writeJSON(w, r.clientManager.Tags(clientID), http.StatusOK)
+	}
+}
+
+// handleGetClientNotes handles GET /api/v1/clients/{id}/notes
+func (r *Router) handleGetClientNotes(w http.ResponseWriter, req *http.Request) {
+	notes, err := r.clientManager.Notes(req.PathValue("id"))
+	if err != nil {
+		writeError(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	
+	writeJSON(w, notes, http.StatusOK)
+}
+
+// handleAddClientNote handles POST /api/v1/clients/{id}/notes
+func (r *Router) handleAddClientNote(w http.ResponseWriter, req *http.Request) {
+	var noteReq NoteRequest
+	if err := json.NewDecoder(req.Body).Decode(&noteReq); err != nil {
+		writeError(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	
+	note, err := r.clientManager.AddNote(req.PathValue("id"), requestOperator(req), noteReq.Text)
+	switch {
+	case errors.Is(err, client.ErrClientNotFound):
+		writeError(w, err.Error(), http.StatusNotFound)
+	case errors.Is(err, client.ErrInvalidNote):
+		writeError(w, err.Error(), http.StatusBadRequest)
+	case err != nil:
+		writeError(w, err.Error(), http.StatusInternalServerError)
+	default:
+		writeJSON(w, note, http.StatusCreated)
+	}
+}
+
+// handleGetClientLock handles GET /api/v1/clients/{id}/lock
+func (r *Router) handleGetClientLock(w http.ResponseWriter, req *http.Request) {
+	clientID := req.PathValue("id")
+	if _, err := r.clientManager.GetClient(clientID); err != nil {
+		writeError(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	
+	lock, held := r.clientManager.ClientLock(clientID)
+	if !held {
+		writeError(w, "Client is not locked", http.StatusNotFound)
+		return
+	}
+	writeJSON(w, lock, http.StatusOK)
+}
+
+// handleLockClient handles POST /api/v1/clients/{id}/lock
+func (r *Router) handleLockClient(w http.ResponseWriter, req *http.Request) {
+	var lockReq LockRequest
+	if err := json.NewDecoder(req.Body).Decode(&lockReq); err != nil {
+		writeError(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	
+	lock, err := r.clientManager.LockClient(req.PathValue("id"), requestOperator(req),
+		time.Duration(lockReq.Duration)*time.Second, lockReq.Reason)
+	switch {
+	case errors.Is(err, client.ErrClientNotFound):
+		writeError(w, err.Error(), http.StatusNotFound)
+	case errors.Is(err, client.ErrInvalidLock):
+		writeError(w, err.Error(), http.StatusBadRequest)
+	case errors.Is(err, client.ErrClientLocked):
+		writeErrorCode(w, ErrCodeClientLocked, err.Error(), http.StatusConflict)
+	case err != nil:
+		writeError(w, err.Error(), http.StatusInternalServerError)
+	default:
+		writeJSON(w, lock, http.StatusOK)
+	}
+}
+
+// handleUnlockClient handles DELETE /api/v1/clients/{id}/lock. With force=true,
+// an operator with the clients:unlock permission releases another operator's lock.
+func (r *Router) handleUnlockClient(w http.ResponseWriter, req *http.Request) {
+	force := req.URL.Query().Get("force") == "true"
+	if claims := getClaims(req); force && claims != nil && !auth.HasPermission(claims.Role, auth.PermClientsUnlock) {
+		writeError(w, fmt.Sprintf("Permission %s required", auth.PermClientsUnlock), http.StatusForbidden)
+		return
+	}
+	
+	clientID := req.PathValue("id")
+	err := r.clientManager.UnlockClient(clientID, requestOperator(req), force)
+	switch {
+	case errors.Is(err, client.ErrClientNotFound), errors.Is(err, client.ErrLockNotHeld):
+		writeError(w, err.Error(), http.StatusNotFound)
+	case errors.Is(err, client.ErrClientLocked):
+		writeErrorCode(w, ErrCodeClientLocked, err.Error(), http.StatusConflict)
+	case err != nil:
+		writeError(w, err.Error(), http.StatusInternalServerError)
+	default:
+		writeMessage(w, fmt.Sprintf("Client %s unlocked", clientID))
+	}
+}
+
+// clientInfos describes every client known to the client manager
+func (r *Router) clientInfos() []ClientInfo {
 	clients := r.clientManager.ListClients()
 	
-	// Convert to client info for response
-	clientInfos := make([]map[string]interface{}, 0, len(clients))
+	clientInfos := make([]ClientInfo, 0, len(clients))
 	for _, client := range clients {
-		clientInfos = append(clientInfos, map[string]interface{}{
-			"id":                 client.GetSessionID(),
-			"protocol":           client.GetCurrentProtocol(),
-			"state":              getStateString(int(client.GetState())),
-			"encryption_algorithm": client.GetEncryptionAlgorithm(),
-			"last_heartbeat":     client.GetLastHeartbeat().Format("2006-01-02 15:04:05"),
-		})
-	}
-	
-	writeJSON(w, map[string]interface{}{
-		"status":  "success",
-		"clients": clientInfos,
-	}, http.StatusOK)
+		tags := r.clientManager.Tags(client.GetSessionID())
+		if len(tags) == 0 {
+			tags = nil
+		}
+		info := ClientInfo{
+			ID:                  client.GetSessionID(),
+			Protocol:            client.GetCurrentProtocol(),
+			State:               getStateString(int(client.GetState())),
+			EncryptionAlgorithm: client.GetEncryptionAlgorithm(),
+			LastHeartbeat:       client.GetLastHeartbeat().Format("2006-01-02 15:04:05"),
+			RemoteAddress:       client.GetRemoteAddress(),
+			Hostname:            client.GetHostname(),
+			Tags:                tags,
+		}
+		if reason, quarantined := r.clientManager.QuarantineReason(client.GetSessionID()); quarantined {
+			info.Quarantined = true
+			info.QuarantineReason = reason
+		}
+		info.ScopePending = r.clientManager.ScopePending(client.GetSessionID())
+		if inventory, err := r.clientManager.Inventory(client.GetSessionID()); err == nil {
+			if inventory.Hostname != "" {
+				info.Hostname = inventory.Hostname
+			}
+			info.OS = inventory.OS
+			info.Architecture = inventory.Architecture
+			info.User = inventory.User
+			info.IPAddresses = inventory.IPAddresses
+		}
+		if status, err := r.clientManager.Lifecycle(client.GetSessionID()); err == nil {
+			info.Lifecycle = status.State
+			info.LifecycleSince = status.Since
+			info.LastCheckIn = status.LastCheckIn
+			info.Listener = status.Listener
+			info.ExitReason = status.Reason
+		}
+		if lock, held := r.clientManager.ClientLock(client.GetSessionID()); held {
+			info.Lock = &lock
+		}
+		clientInfos = append(clientInfos, info)
+	}
+	return clientInfos
 }
 
 // getStateString converts a ConnectionState to a string
@@ -66,3 +319,14 @@ func (r *Router) handleClientTasks(w http.ResponseWriter, req *http.Request) {
 	tasks := r.taskManager.ListClientTasks(clientID)
 	writeJSON(w, tasks, http.StatusOK)
 }
+
+// handleGetClientTasks handles GET /api/v1/clients/{id}/tasks
+func (r *Router) handleGetClientTasks(w http.ResponseWriter, req *http.Request) {
+	clientID := req.PathValue("id")
+	if _, err := r.clientManager.GetClient(clientID); err != nil {
+		writeError(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	
+	writeJSON(w, r.taskManager.ListClientTasks(clientID), http.StatusOK)
+}
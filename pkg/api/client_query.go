@@ -0,0 +1,156 @@
+package api
+
+import (
+	"fmt"
+	"net"
+	"net/url"
+	"path"
+	"sort"
+	"strings"
+
+	"dinoc2/pkg/client"
+)
+
+// clientQueryParams are the filters and sort order accepted by a client listing
+var clientQueryParams = []param{
+	{name: "selector", description: "Only list the clients whose tags match this selector, such as segment=dmz,os=linux"},
+	{name: "lifecycle", description: "Only list the clients in these comma-separated lifecycle states: active, late, stale, lost or exited"},
+	{name: "hostname", description: "Only list the clients whose hostname matches this pattern, such as web*.corp.example.com"},
+	{name: "os", description: "Only list the clients running one of these comma-separated operating systems, such as linux,macos"},
+	{name: "arch", description: "Only list the clients on one of these comma-separated architectures, such as amd64,arm64"},
+	{name: "user", description: "Only list the clients running as this user"},
+	{name: "ip", description: "Only list the clients with an IP address in this address or CIDR range"},
+	{name: "listener", description: "Only list the clients that last checked in through one of these comma-separated listener types, such as dns"},
+	{name: "sort", description: "Sort by id, hostname, os, arch, user, listener, lifecycle or last_check_in; prefix with - to sort in descending order"},
+}
+
+// clientSortKeys compares clients by each field they can be sorted on
+var clientSortKeys = map[string]func(a, b *ClientInfo) bool{
+	"id":            func(a, b *ClientInfo) bool { return a.ID < b.ID },
+	"hostname":      func(a, b *ClientInfo) bool { return a.Hostname < b.Hostname },
+	"os":            func(a, b *ClientInfo) bool { return a.OS < b.OS },
+	"arch":          func(a, b *ClientInfo) bool { return a.Architecture < b.Architecture },
+	"user":          func(a, b *ClientInfo) bool { return a.User < b.User },
+	"listener":      func(a, b *ClientInfo) bool { return a.Listener < b.Listener },
+	"lifecycle":     func(a, b *ClientInfo) bool { return a.Lifecycle < b.Lifecycle },
+	"last_check_in": func(a, b *ClientInfo) bool { return a.LastCheckIn.Before(b.LastCheckIn) },
+}
+
+// queryClients filters and sorts clients by the query parameters of a listing.
+// Clients are sorted by ID unless another order is requested, and by ID within
+// the requested order.
+func queryClients(infos []ClientInfo, query url.Values) ([]ClientInfo, error) {
+	var filters []func(*ClientInfo) bool
+
+	if value := query.Get("selector"); value != "" {
+		selector, err := client.ParseSelector(value)
+		if err != nil {
+			return nil, err
+		}
+		filters = append(filters, func(info *ClientInfo) bool { return selector.Matches(info.Tags) })
+	}
+	if value := query.Get("lifecycle"); value != "" {
+		states := splitQuery(value)
+		filters = append(filters, func(info *ClientInfo) bool { return states[string(info.Lifecycle)] })
+	}
+	if value := query.Get("hostname"); value != "" {
+		pattern := strings.ToLower(value)
+		if _, err := path.Match(pattern, ""); err != nil {
+			return nil, fmt.Errorf("invalid hostname pattern %q", value)
+		}
+		filters = append(filters, func(info *ClientInfo) bool {
+			matched, _ := path.Match(pattern, strings.ToLower(info.Hostname))
+			return matched
+		})
+	}
+	if value := query.Get("os"); value != "" {
+		systems := splitQuery(value)
+		filters = append(filters, func(info *ClientInfo) bool { return systems[info.OS] })
+	}
+	if value := query.Get("arch"); value != "" {
+		architectures := splitQuery(value)
+		filters = append(filters, func(info *ClientInfo) bool { return architectures[info.Architecture] })
+	}
+	if value := query.Get("user"); value != "" {
+		filters = append(filters, func(info *ClientInfo) bool { return strings.EqualFold(info.User, value) })
+	}
+	if value := query.Get("ip"); value != "" {
+		network, err := parseNetwork(value)
+		if err != nil {
+			return nil, err
+		}
+		filters = append(filters, func(info *ClientInfo) bool {
+			for _, address := range info.IPAddresses {
+				if ip := net.ParseIP(address); ip != nil && network.Contains(ip) {
+					return true
+				}
+			}
+			return false
+		})
+	}
+	if value := query.Get("listener"); value != "" {
+		listeners := splitQuery(value)
+		filters = append(filters, func(info *ClientInfo) bool { return listeners[info.Listener] })
+	}
+
+	matching := infos[:0]
+	for i := range infos {
+		matches := true
+		for _, filter := range filters {
+			if !filter(&infos[i]) {
+				matches = false
+				break
+			}
+		}
+		if matches {
+			matching = append(matching, infos[i])
+		}
+	}
+
+	order := query.Get("sort")
+	descending := strings.HasPrefix(order, "-")
+	order = strings.TrimPrefix(order, "-")
+	if order == "" {
+		order = "id"
+	}
+	less, ok := clientSortKeys[order]
+	if !ok {
+		return nil, fmt.Errorf("cannot sort clients by %q", order)
+	}
+
+	// Clients that compare equal stay in the order of their IDs
+	sort.Slice(matching, func(i, j int) bool { return matching[i].ID < matching[j].ID })
+	sort.SliceStable(matching, func(i, j int) bool {
+		if descending {
+			return less(&matching[j], &matching[i])
+		}
+		return less(&matching[i], &matching[j])
+	})
+	return matching, nil
+}
+
+// splitQuery returns the set of comma-separated values of a query parameter, in lower case
+func splitQuery(value string) map[string]bool {
+	values := make(map[string]bool)
+	for _, v := range strings.Split(value, ",") {
+		values[strings.ToLower(strings.TrimSpace(v))] = true
+	}
+	return values
+}
+
+// parseNetwork parses an IP address or CIDR range
+func parseNetwork(value string) (*net.IPNet, error) {
+	if _, network, err := net.ParseCIDR(value); err == nil {
+		return network, nil
+	}
+	ip := net.ParseIP(value)
+	if ip == nil {
+		return nil, fmt.Errorf("invalid IP address or CIDR range %q", value)
+	}
+	bits := 8 * net.IPv6len
+	if ip.To4() != nil {
+		ip = ip.To4()
+		bits = 8 * net.IPv4len
+	}
+	return &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)}, nil
+}
@@ -0,0 +1,51 @@
+package api
+
+import (
+	"net/url"
+	"reflect"
+	"testing"
+)
+
+func TestQueryClients(t *testing.T) {
+	clients := []ClientInfo{
+		{ID: "c1", Hostname: "web01.corp", OS: "linux", Architecture: "amd64", Listener: "dns", IPAddresses: []string{"10.0.1.5"}},
+		{ID: "c2", Hostname: "web02.corp", OS: "linux", Architecture: "arm64", Listener: "http", IPAddresses: []string{"10.0.2.5"}},
+		{ID: "c3", Hostname: "dc01.corp", OS: "windows", Architecture: "amd64", Listener: "dns", IPAddresses: []string{"10.0.1.9"}},
+		{ID: "c4", Hostname: "build.corp", OS: "linux", Architecture: "amd64", Listener: "dns", User: "root"},
+	}
+
+	tests := []struct {
+		query string
+		want  []string
+	}{
+		{"os=linux&listener=dns", []string{"c1", "c4"}},
+		{"hostname=web*&sort=-hostname", []string{"c2", "c1"}},
+		{"ip=10.0.1.0/24", []string{"c1", "c3"}},
+		{"ip=10.0.2.5", []string{"c2"}},
+		{"arch=amd64&sort=os", []string{"c1", "c4", "c3"}},
+		{"user=ROOT", []string{"c4"}},
+		{"", []string{"c1", "c2", "c3", "c4"}},
+	}
+	for _, test := range tests {
+		query, _ := url.ParseQuery(test.query)
+		infos, err := queryClients(append([]ClientInfo(nil), clients...), query)
+		if err != nil {
+			t.Errorf("%q: %v", test.query, err)
+			continue
+		}
+		var ids []string
+		for _, info := range infos {
+			ids = append(ids, info.ID)
+		}
+		if !reflect.DeepEqual(ids, test.want) {
+			t.Errorf("%q: expected %v, got %v", test.query, test.want, ids)
+		}
+	}
+
+	for _, query := range []string{"sort=memory", "ip=not-an-ip", "hostname=[", "selector=!"} {
+		values, _ := url.ParseQuery(query)
+		if _, err := queryClients(append([]ClientInfo(nil), clients...), values); err == nil {
+			t.Errorf("Expected %q to be refused", query)
+		}
+	}
+}
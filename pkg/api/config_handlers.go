@@ -0,0 +1,33 @@
+package api
+
+import (
+	"net/http"
+
+	"dinoc2/pkg/listener"
+)
+
+// SetConfigReloader sets the function that reloads the server configuration
+func (r *Router) SetConfigReloader(reload func() (*listener.ReloadResult, error)) {
+	r.configReloader = reload
+}
+
+// handleReloadConfig handles POST /api/config/reload
+func (r *Router) handleReloadConfig(w http.ResponseWriter, req *http.Request) {
+	if req.Method != http.MethodPost {
+		writeError(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	if r.configReloader == nil {
+		writeError(w, "Configuration reload is not available", http.StatusServiceUnavailable)
+		return
+	}
+
+	result, err := r.configReloader()
+	if err != nil {
+		writeError(w, "Failed to reload configuration: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, result, http.StatusOK)
+}
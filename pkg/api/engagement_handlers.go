@@ -0,0 +1,27 @@
+package api
+
+import (
+	"net/http"
+
+	"dinoc2/pkg/engagement"
+)
+
+// SetEngagement sets the engagement whose window is reported by the API
+func (r *Router) SetEngagement(e *engagement.Engagement) {
+	r.engagement = e
+}
+
+// handleEngagementStatus handles GET /api/engagement
+func (r *Router) handleEngagementStatus(w http.ResponseWriter, req *http.Request) {
+	if req.Method != http.MethodGet {
+		writeError(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	if r.engagement == nil {
+		writeJSON(w, engagement.Status{State: engagement.StateActive}, http.StatusOK)
+		return
+	}
+
+	writeJSON(w, r.engagement.Status(), http.StatusOK)
+}
@@ -0,0 +1,132 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"dinoc2/pkg/auth"
+	"dinoc2/pkg/events"
+)
+
+// eventKeepAlive is how often a comment is sent on an idle event stream
+const eventKeepAlive = 30 * time.Second
+
+// eventAuthCheckInterval is how often an open event stream checks that its
+// token has not expired or been revoked and its operator is still enabled
+var eventAuthCheckInterval = 10 * time.Second
+
+// eventQueryParams are the parameters accepted by the event stream
+var eventQueryParams = []param{
+	{name: "types", description: "Comma-separated event types to send, all types if omitted"},
+	{name: "token", description: "JWT token, for clients that cannot set the Authorization header"},
+}
+
+// SetEventBus sets the bus that the event stream is fed from
+func (r *Router) SetEventBus(bus *events.Bus) {
+	r.eventBus = bus
+}
+
+// handleEvents handles GET /api/events, streaming events as Server-Sent Events
+func (r *Router) handleEvents(w http.ResponseWriter, req *http.Request) {
+	if req.Method != http.MethodGet {
+		writeError(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	if r.eventBus == nil {
+		writeError(w, "Event stream is not enabled", http.StatusNotFound)
+		return
+	}
+
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		writeError(w, "Streaming is not supported", http.StatusInternalServerError)
+		return
+	}
+
+	// Only send the requested event types, or all of them if none are given
+	types := make(map[events.Type]bool)
+	if typeList := req.URL.Query().Get("types"); typeList != "" {
+		for _, t := range strings.Split(typeList, ",") {
+			types[events.Type(strings.TrimSpace(t))] = true
+		}
+	}
+
+	// Resume after the last event the operator received, if reconnecting
+	var lastID uint64
+	if id := req.Header.Get("Last-Event-ID"); id != "" {
+		lastID, _ = strconv.ParseUint(id, 10, 64)
+	}
+
+	stream, unsubscribe := r.eventBus.Subscribe(lastID, 64)
+	defer unsubscribe()
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	keepAlive := time.NewTicker(eventKeepAlive)
+	defer keepAlive.Stop()
+
+	// The stream outlives the check made when it was opened, so check again while it is open
+	var authCheck <-chan time.Time
+	if r.authMiddleware != nil && getClaims(req) != nil {
+		ticker := time.NewTicker(eventAuthCheckInterval)
+		defer ticker.Stop()
+		authCheck = ticker.C
+	}
+
+	for {
+		select {
+		case <-req.Context().Done():
+			return
+		case <-authCheck:
+			if err := r.checkStreamAuth(req); err != nil {
+				fmt.Fprintf(w, ": closing: %v\n\n", err)
+				flusher.Flush()
+				return
+			}
+		case <-keepAlive.C:
+			fmt.Fprint(w, ": keepalive\n\n")
+			flusher.Flush()
+		case event := <-stream:
+			if len(types) > 0 && !types[event.Type] {
+				continue
+			}
+
+			data, err := json.Marshal(event)
+			if err != nil {
+				continue
+			}
+			fmt.Fprintf(w, "id: %d\nevent: %s\ndata: %s\n\n", event.ID, event.Type, data)
+			flusher.Flush()
+		}
+	}
+}
+
+// checkStreamAuth checks that the token an event stream was opened with is
+// still valid, which covers expiry and revocation, and that its operator's
+// account is still enabled
+func (r *Router) checkStreamAuth(req *http.Request) error {
+	tokenString := strings.TrimPrefix(req.Header.Get("Authorization"), "Bearer ")
+	if tokenString == "" {
+		tokenString = req.URL.Query().Get("token")
+	}
+
+	_, claims, err := r.authMiddleware.ValidateToken(tokenString)
+	if err != nil {
+		return fmt.Errorf("invalid token: %w", err)
+	}
+	user, err := auth.GetUserStore().GetUser(claims.Username)
+	if err != nil || user.Disabled {
+		return errors.New("user account is not active")
+	}
+	return nil
+}
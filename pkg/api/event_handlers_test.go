@@ -0,0 +1,79 @@
+package api
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"dinoc2/pkg/api/middleware"
+	"dinoc2/pkg/auth"
+	"dinoc2/pkg/client"
+	"dinoc2/pkg/events"
+	"dinoc2/pkg/listener"
+	"dinoc2/pkg/store"
+	"dinoc2/pkg/task"
+)
+
+func TestEventStreamClosesWhenTokenIsRevoked(t *testing.T) {
+	previousStore := auth.GetUserStore()
+	defer auth.SetUserStore(previousStore)
+	users := auth.NewUserStore("")
+	if err := users.AddUser(auth.UserAuth{Username: "alice", Password: "secret", Role: auth.RoleOperator}); err != nil {
+		t.Fatalf("Failed to add user: %v", err)
+	}
+	auth.SetUserStore(users)
+
+	previousInterval := eventAuthCheckInterval
+	defer func() { eventAuthCheckInterval = previousInterval }()
+	eventAuthCheckInterval = 10 * time.Millisecond
+
+	am, err := middleware.NewAuthMiddleware(middleware.AuthConfig{Enabled: true, TokenExpiry: 60})
+	if err != nil {
+		t.Fatalf("Failed to create middleware: %v", err)
+	}
+	if err := am.SetStore(store.NewMemoryStore()); err != nil {
+		t.Fatalf("Failed to set store: %v", err)
+	}
+	clientManager := client.NewManager()
+	router := NewRouter(listener.NewManager(clientManager), nil, task.NewManager(), clientManager, am)
+	router.SetEventBus(events.NewBus())
+
+	server := httptest.NewServer(router)
+	defer server.Close()
+
+	pair, err := am.Login("alice", auth.RoleOperator)
+	if err != nil {
+		t.Fatalf("Failed to log in: %v", err)
+	}
+	req, _ := http.NewRequest(http.MethodGet, server.URL+"/api/v1/events", nil)
+	req.Header.Set("Authorization", "Bearer "+pair.Token)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("Failed to open event stream: %v", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("Expected 200, got %d", resp.StatusCode)
+	}
+
+	_, claims, err := am.ValidateToken(pair.Token)
+	if err != nil {
+		t.Fatalf("Failed to validate token: %v", err)
+	}
+	if err := am.Logout(claims); err != nil {
+		t.Fatalf("Failed to log out: %v", err)
+	}
+
+	closed := make(chan struct{})
+	go func() {
+		io.Copy(io.Discard, resp.Body)
+		close(closed)
+	}()
+	select {
+	case <-closed:
+	case <-time.After(2 * time.Second):
+		t.Fatal("Expected the event stream to close once its token was revoked")
+	}
+}
@@ -2,6 +2,7 @@ package api
 
 import (
 	"encoding/json"
+	"errors"
 	"net/http"
 	
 	"dinoc2/pkg/listener"
@@ -14,6 +15,20 @@ type ListenerRequest struct {
 	Address string                 `json:"address"`
 	Port    int                    `json:"port"`
 	Options map[string]interface{} `json:"options"`
+	Restart listener.RestartConfig `json:"restart,omitempty"`
+}
+
+// ListenerIDRequest identifies a listener in the body of a request
+type ListenerIDRequest struct {
+	ID string `json:"id"`
+}
+
+// ListenerInfo describes a listener
+type ListenerInfo struct {
+	ID      string                  `json:"id"`
+	Type    listener.ListenerType   `json:"type"`
+	Status  listener.ListenerStatus `json:"status"`
+	Restart listener.RestartState   `json:"restart"`
 }
 
 // handleListListeners handles GET /api/listeners
@@ -46,17 +61,34 @@ func (r *Router) handleCreateListener(w http.ResponseWriter, req *http.Request)
 		Address:  listenerReq.Address,
 		Port:     listenerReq.Port,
 		Options:  listenerReq.Options,
+		Restart:  listenerReq.Restart,
 	}
 	
-	// Create and start listener
+	// Unknown types and configurations that do not match the type's schema are the caller's mistake
 	listenerType := listener.ListenerType(listenerReq.Type)
+	if err := listener.ValidateListenerConfig(listenerType, config); err != nil {
+		writeError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	
+	// Create and start listener
 	err := r.listenerManager.CreateListener(listenerReq.ID, listenerType, config)
 	if err != nil {
 		writeError(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
 	
-	writeJSON(w, map[string]string{"status": "success", "message": "Listener created"}, http.StatusOK)
+	writeMessage(w, "Listener created")
+}
+
+// handleListenerTypes handles GET /api/listeners/types
+func (r *Router) handleListenerTypes(w http.ResponseWriter, req *http.Request) {
+	if req.Method != http.MethodGet {
+		writeError(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	
+	writeJSON(w, listener.ListTypes(), http.StatusOK)
 }
 
 // handleDeleteListener handles POST /api/listeners/delete
@@ -66,23 +98,33 @@ func (r *Router) handleDeleteListener(w http.ResponseWriter, req *http.Request)
 		return
 	}
 	
-	var request struct {
-		ID string `json:"id"`
-	}
-	
+	var request ListenerIDRequest
 	if err := json.NewDecoder(req.Body).Decode(&request); err != nil {
 		writeError(w, "Invalid request body", http.StatusBadRequest)
 		return
 	}
 	
-	// Delete listener
-	err := r.listenerManager.RemoveListener(request.ID)
+	r.removeListener(w, request.ID)
+}
+
+// handleRemoveListener handles DELETE /api/v1/listeners/{id}
+func (r *Router) handleRemoveListener(w http.ResponseWriter, req *http.Request) {
+	r.removeListener(w, req.PathValue("id"))
+}
+
+// removeListener deletes a listener and writes the result
+func (r *Router) removeListener(w http.ResponseWriter, id string) {
+	err := r.listenerManager.RemoveListener(id)
+	if errors.Is(err, listener.ErrListenerNotFound) {
+		writeError(w, err.Error(), http.StatusNotFound)
+		return
+	}
 	if err != nil {
-		writeError(w, err.Error(), http.StatusInternalServerError)
+		writeError(w, err.Error(), http.StatusConflict)
 		return
 	}
 	
-	writeJSON(w, map[string]string{"status": "success", "message": "Listener deleted"}, http.StatusOK)
+	writeMessage(w, "Listener deleted")
 }
 
 // handleListenerStatus handles GET /api/listeners/status
@@ -106,3 +148,58 @@ func (r *Router) handleListenerStatus(w http.ResponseWriter, req *http.Request)
 	
 	writeJSON(w, status, http.StatusOK)
 }
+
+// handleGetListener handles GET /api/v1/listeners/{id}
+func (r *Router) handleGetListener(w http.ResponseWriter, req *http.Request) {
+	id := req.PathValue("id")
+	
+	status, err := r.listenerManager.GetStatus(id)
+	if err != nil {
+		writeError(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	
+	listenerType, err := r.listenerManager.GetListenerType(id)
+	if err != nil {
+		writeError(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	
+	restart, err := r.listenerManager.GetRestartState(id)
+	if err != nil {
+		writeError(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	
+	writeJSON(w, ListenerInfo{ID: id, Type: listenerType, Status: status, Restart: restart}, http.StatusOK)
+}
+
+// handleStartListener handles POST /api/v1/listeners/{id}/start
+func (r *Router) handleStartListener(w http.ResponseWriter, req *http.Request) {
+	err := r.listenerManager.StartListener(req.PathValue("id"))
+	if errors.Is(err, listener.ErrListenerNotFound) {
+		writeError(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		writeError(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	
+	writeMessage(w, "Listener started")
+}
+
+// handleStopListener handles POST /api/v1/listeners/{id}/stop
+func (r *Router) handleStopListener(w http.ResponseWriter, req *http.Request) {
+	err := r.listenerManager.StopListener(req.PathValue("id"))
+	if errors.Is(err, listener.ErrListenerNotFound) {
+		writeError(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		writeError(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	
+	writeMessage(w, "Listener stopped")
+}
@@ -0,0 +1,257 @@
+package api
+
+import (
+	"crypto/subtle"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"dinoc2/pkg/auth"
+	"dinoc2/pkg/client"
+	"dinoc2/pkg/crypto"
+	"dinoc2/pkg/listener"
+	"dinoc2/pkg/metrics"
+	"dinoc2/pkg/task"
+)
+
+// newRequestMetrics creates the metrics the router records for each API request
+func newRequestMetrics() (*metrics.HistogramVec, *metrics.CounterVec) {
+	return metrics.NewHistogramVec("dinoc2_api_request_duration_seconds", "Time taken to serve API requests.",
+			metrics.DefaultBuckets, "method", "route"),
+		metrics.NewCounterVec("dinoc2_api_requests_total", "API requests served, by status code.",
+			"method", "route", "code")
+}
+
+// SetMetricsToken sets a static bearer token that scrapers can use for
+// /metrics instead of an operator's token. Operators with the metrics:read
+// permission can always read the metrics.
+func (r *Router) SetMetricsToken(token string) {
+	r.metricsToken = token
+}
+
+// observeRequest records how long a request took to serve. Event streams stay
+// open for as long as the operator watches them, so they are not recorded.
+func (r *Router) observeRequest(req *http.Request, recorder *statusRecorder, elapsed time.Duration) {
+	if strings.HasPrefix(recorder.Header().Get("Content-Type"), "text/event-stream") {
+		return
+	}
+	status := recorder.status
+	if status == 0 {
+		status = http.StatusOK
+	}
+	route := routeLabel(r.mux, req)
+	r.requestDuration.Observe(elapsed.Seconds(), req.Method, route)
+	r.requestsTotal.Inc(req.Method, route, strconv.Itoa(status))
+}
+
+// routeLabel returns the path pattern of the route that matches a request, so
+// that requests for different clients, tasks or listeners are counted together
+func routeLabel(mux *http.ServeMux, req *http.Request) string {
+	_, pattern := mux.Handler(req)
+	if pattern == "" {
+		return "unmatched"
+	}
+	// Versioned patterns start with the method, which has its own label
+	if i := strings.IndexByte(pattern, ' '); i >= 0 {
+		pattern = pattern[i+1:]
+	}
+	return pattern
+}
+
+// handleMetrics handles GET /metrics. Scrapers can authenticate with the
+// metrics token; otherwise the request needs the metrics:read permission.
+// With mutual TLS, scrapers need a client certificate as well.
+func (r *Router) handleMetrics(w http.ResponseWriter, req *http.Request) {
+	if r.metricsToken != "" {
+		token := strings.TrimPrefix(req.Header.Get("Authorization"), "Bearer ")
+		if subtle.ConstantTimeCompare([]byte(token), []byte(r.metricsToken)) == 1 {
+			if _, ok := r.checkClientCertificate(w, req); ok {
+				r.writeMetrics(w, req)
+			}
+			return
+		}
+	}
+	r.authorize(route{permission: auth.PermMetricsRead, handler: r.writeMetrics}).ServeHTTP(w, req)
+}
+
+// writeMetrics writes the server's metrics in the Prometheus text exposition format
+func (r *Router) writeMetrics(w http.ResponseWriter, req *http.Request) {
+	w.Header().Set("Content-Type", metrics.ContentType)
+	mw := metrics.NewWriter(w)
+
+	if r.listenerManager != nil {
+		writeListenerMetrics(mw, r.listenerManager)
+	}
+	if r.taskManager != nil {
+		writeTaskMetrics(mw, r.taskManager)
+	}
+	if r.clientManager != nil {
+		writeClientMetrics(mw, r.clientManager)
+	}
+
+	mw.Family("dinoc2_sessions_active", "Encryption sessions that are open.", metrics.TypeGauge)
+	mw.Sample("dinoc2_sessions_active", float64(crypto.ActiveSessionCount()))
+
+	r.requestDuration.Write(mw)
+	r.requestsTotal.Write(mw)
+	mw.Flush()
+}
+
+// listenerMetrics holds what the metrics report about one listener
+type listenerMetrics struct {
+	labels  []string
+	status  listener.ListenerStatus
+	stats   *listener.ListenerStats
+	restart listener.RestartState
+	traffic bool // whether the listener counts its traffic
+}
+
+// writeListenerMetrics writes the status, traffic and restarts of every listener
+func writeListenerMetrics(mw *metrics.Writer, manager *listener.Manager) {
+	statuses := manager.ListListeners()
+	ids := make([]string, 0, len(statuses))
+	for id := range statuses {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+
+	var listeners []listenerMetrics
+	for _, id := range ids {
+		listenerType, err := manager.GetListenerType(id)
+		if err != nil {
+			continue
+		}
+		stats, err := manager.GetStats(id)
+		if err != nil {
+			continue
+		}
+		restart, _ := manager.GetRestartState(id)
+		listeners = append(listeners, listenerMetrics{
+			labels:  []string{"listener", id, "type", string(listenerType)},
+			status:  statuses[id],
+			stats:   stats,
+			restart: restart,
+			traffic: manager.CountsTraffic(id),
+		})
+	}
+
+	gauge := func(name, help string, value func(l listenerMetrics) float64) {
+		mw.Family(name, help, metrics.TypeGauge)
+		for _, l := range listeners {
+			mw.Sample(name, value(l), l.labels...)
+		}
+	}
+	// Listeners that do not count their traffic are left out rather than reported as 0
+	counter := func(name, help string, value func(l listenerMetrics) int64) {
+		mw.Family(name, help, metrics.TypeCounter)
+		for _, l := range listeners {
+			if l.traffic {
+				mw.Sample(name, float64(value(l)), l.labels...)
+			}
+		}
+	}
+
+	gauge("dinoc2_listener_up", "Whether the listener is running.", func(l listenerMetrics) float64 {
+		return boolValue(l.status == listener.StatusRunning)
+	})
+	gauge("dinoc2_listener_crash_loop", "Whether the health monitor gave up restarting the listener.", func(l listenerMetrics) float64 {
+		return boolValue(l.restart.CrashLoop)
+	})
+	gauge("dinoc2_listener_restarts", "Restarts of the listener in a row by the health monitor.", func(l listenerMetrics) float64 {
+		return float64(l.restart.Restarts)
+	})
+	gauge("dinoc2_listener_start_time_seconds", "Unix time the listener was last started.", func(l listenerMetrics) float64 {
+		return unixTime(l.stats.StartTime)
+	})
+	gauge("dinoc2_listener_last_error_time_seconds", "Unix time of the listener's last error, 0 if it has had none.", func(l listenerMetrics) float64 {
+		return unixTime(l.stats.LastErrorTime)
+	})
+	counter("dinoc2_listener_connections_in_total", "Connections accepted by the listener.", func(l listenerMetrics) int64 {
+		return l.stats.ConnectionsIn
+	})
+	counter("dinoc2_listener_connections_out_total", "Connections made by the listener.", func(l listenerMetrics) int64 {
+		return l.stats.ConnectionsOut
+	})
+	counter("dinoc2_listener_received_bytes_total", "Bytes received by the listener.", func(l listenerMetrics) int64 {
+		return l.stats.BytesReceived
+	})
+	counter("dinoc2_listener_sent_bytes_total", "Bytes sent by the listener.", func(l listenerMetrics) int64 {
+		return l.stats.BytesSent
+	})
+}
+
+// writeTaskMetrics writes the task queue and the tasks by status and outcome
+func writeTaskMetrics(mw *metrics.Writer, manager *task.Manager) {
+	queue := manager.QueueStats()
+
+	priorities := make([]int, 0, len(queue.ByPriority))
+	for priority := range queue.ByPriority {
+		priorities = append(priorities, int(priority))
+	}
+	sort.Ints(priorities)
+	mw.Family("dinoc2_task_queue_depth", "Tasks waiting to be dispatched, by priority.", metrics.TypeGauge)
+	for _, priority := range priorities {
+		mw.Sample("dinoc2_task_queue_depth", float64(queue.ByPriority[task.TaskPriority(priority)]), "priority", strconv.Itoa(priority))
+	}
+
+	mw.Family("dinoc2_task_queue_clients", "Clients with tasks waiting to be dispatched.", metrics.TypeGauge)
+	mw.Sample("dinoc2_task_queue_clients", float64(queue.Clients))
+	mw.Family("dinoc2_task_queue_limit", "Tasks that can be queued per client.", metrics.TypeGauge)
+	mw.Sample("dinoc2_task_queue_limit", float64(queue.Limit))
+	mw.Family("dinoc2_tasks_dispatched_total", "Tasks dispatched to clients.", metrics.TypeCounter)
+	mw.Sample("dinoc2_tasks_dispatched_total", float64(queue.Dispatched))
+	mw.Family("dinoc2_tasks_rejected_total", "Tasks refused because a client's queue was full.", metrics.TypeCounter)
+	mw.Sample("dinoc2_tasks_rejected_total", float64(queue.Rejected))
+
+	counts := manager.StatusCounts()
+	mw.Family("dinoc2_tasks", "Tasks held by the server, by status.", metrics.TypeGauge)
+	for _, status := range sortedKeys(counts) {
+		mw.Sample("dinoc2_tasks", float64(counts[task.TaskStatus(status)]), "status", status)
+	}
+
+	outcomes := manager.Outcomes()
+	mw.Family("dinoc2_task_outcomes_total", "Tasks that reached a final status, by type and status.", metrics.TypeCounter)
+	for _, taskType := range sortedKeys(outcomes) {
+		statuses := outcomes[task.TaskType(taskType)]
+		for _, status := range sortedKeys(statuses) {
+			mw.Sample("dinoc2_task_outcomes_total", float64(statuses[task.TaskStatus(status)]), "type", taskType, "status", status)
+		}
+	}
+}
+
+// writeClientMetrics writes the number of clients in each lifecycle state
+func writeClientMetrics(mw *metrics.Writer, manager *client.Manager) {
+	counts := manager.LifecycleCounts()
+	mw.Family("dinoc2_clients", "Clients known to the server, by lifecycle state.", metrics.TypeGauge)
+	for _, state := range sortedKeys(counts) {
+		mw.Sample("dinoc2_clients", float64(counts[client.Lifecycle(state)]), "state", state)
+	}
+}
+
+// sortedKeys returns the keys of a map with string keys in order
+func sortedKeys[K ~string, V any](m map[K]V) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, string(key))
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// boolValue returns 1 for true and 0 for false
+func boolValue(b bool) float64 {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+// unixTime returns a time as seconds since the Unix epoch, or 0 for the zero time
+func unixTime(t time.Time) float64 {
+	if t.IsZero() {
+		return 0
+	}
+	return float64(t.UnixNano()) / 1e9
+}
@@ -0,0 +1,90 @@
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"dinoc2/pkg/listener"
+	"dinoc2/pkg/metrics"
+	"dinoc2/pkg/task"
+)
+
+// quietListener is a listener that does not count its traffic
+type quietListener struct{}
+
+func (quietListener) Start() error                                   { return nil }
+func (quietListener) Stop() error                                    { return nil }
+func (quietListener) Status() listener.ListenerStatus                { return listener.StatusStopped }
+func (quietListener) Configure(config listener.ListenerConfig) error { return nil }
+
+func TestMetrics(t *testing.T) {
+	router := newTestRouter()
+	defer router.listenerManager.Shutdown()
+
+	config := listener.ListenerConfig{Address: "127.0.0.1", Port: 4444}
+	if err := router.listenerManager.CreateListener("tcp1", listener.ListenerTypeTCP, config); err != nil {
+		t.Fatalf("Failed to create listener: %v", err)
+	}
+	listener.RegisterType(listener.Registration{
+		Type: "quiet",
+		New: func(config listener.ListenerConfig) (listener.Listener, error) {
+			return quietListener{}, nil
+		},
+	})
+	if err := router.listenerManager.CreateListener("quiet1", "quiet", listener.ListenerConfig{Address: "127.0.0.1"}); err != nil {
+		t.Fatalf("Failed to create listener: %v", err)
+	}
+	for _, status := range []task.TaskStatus{task.TaskStatusCompleted, task.TaskStatusFailed} {
+		newTask, err := router.taskManager.CreateTask(task.TaskTypeCommand, "client-1", []byte("whoami"), task.TaskPriorityNormal, nil)
+		if err != nil {
+			t.Fatalf("Failed to create task: %v", err)
+		}
+		if err := router.taskManager.UpdateTaskStatus(newTask.ID, status, nil, ""); err != nil {
+			t.Fatalf("Failed to update task: %v", err)
+		}
+	}
+	router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/api/v1/tasks/1", nil))
+	router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/api/v1/tasks/42", nil))
+
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	if rec.Code != http.StatusOK || rec.Header().Get("Content-Type") != metrics.ContentType {
+		t.Fatalf("Expected 200 with the exposition format, got %d (%s)", rec.Code, rec.Header().Get("Content-Type"))
+	}
+
+	body := rec.Body.String()
+	for _, line := range []string{
+		"# TYPE dinoc2_listener_up gauge",
+		`dinoc2_listener_up{listener="tcp1",type="tcp"} 0`,
+		`dinoc2_listener_connections_in_total{listener="tcp1",type="tcp"} 0`,
+		`dinoc2_task_outcomes_total{type="command",status="completed"} 1`,
+		`dinoc2_task_outcomes_total{type="command",status="failed"} 1`,
+		`dinoc2_tasks{status="completed"} 1`,
+		`dinoc2_clients{state="active"} 0`,
+		"# TYPE dinoc2_sessions_active gauge",
+		`dinoc2_api_request_duration_seconds_count{method="GET",route="/api/v1/tasks/{id}"} 2`,
+		`dinoc2_api_requests_total{method="GET",route="/api/v1/tasks/{id}",code="404"} 1`,
+	} {
+		if !strings.Contains(body, line+"\n") {
+			t.Errorf("Expected the metrics to contain %q", line)
+		}
+	}
+
+	// Listeners that do not count their traffic have no traffic samples
+	if !strings.Contains(body, `dinoc2_listener_up{listener="quiet1",type="quiet"} 0`+"\n") ||
+		strings.Contains(body, `dinoc2_listener_received_bytes_total{listener="quiet1"`) {
+		t.Errorf("Expected the quiet listener to be reported without traffic samples")
+	}
+
+	// Scrapers can authenticate with the metrics token
+	router.SetMetricsToken("scrape")
+	req := httptest.NewRequest(http.MethodGet, "/metrics", nil)
+	req.Header.Set("Authorization", "Bearer scrape")
+	rec = httptest.NewRecorder()
+	router.ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Errorf("Expected the metrics token to be accepted, got %d", rec.Code)
+	}
+}
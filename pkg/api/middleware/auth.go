@@ -9,37 +9,97 @@ import (
 	"time"
 
 	"dinoc2/pkg/auth"
+	"dinoc2/pkg/store"
 	"github.com/golang-jwt/jwt/v5"
 )
 
+// Default token lifetimes, in minutes
+const (
+	defaultTokenExpiry        = 60
+	defaultRefreshTokenExpiry = 24 * 60
+	defaultSessionLifetime    = 7 * 24 * 60
+)
+
 // AuthConfig holds configuration for the authentication middleware
 type AuthConfig struct {
-	Enabled     bool
-	JWTSecret   string
-	TokenExpiry int // in minutes
+	Enabled            bool
+	JWTSecret          string // only used with the HS256 algorithm
+	Algorithm          string // EdDSA (default), RS256 or HS256
+	TokenExpiry        int    // in minutes
+	RefreshTokenExpiry int    // in minutes
+	SessionLifetime    int    // in minutes, after which an operator must log in again however often they refresh
 }
 
 // Claims represents the JWT claims
 type Claims struct {
-	Username string `json:"username"`
-	Role     string `json:"role"`
+	Username  string `json:"username"`
+	Role      string `json:"role"`
+	SessionID string `json:"sid,omitempty"`
 	jwt.RegisteredClaims
 }
 
+// TokenPair is an access token and the refresh token that replaces it
+type TokenPair struct {
+	Token        string    `json:"token"`
+	RefreshToken string    `json:"refresh_token,omitempty"`
+	ExpiresAt    time.Time `json:"expires_at"`
+}
+
 // AuthMiddleware is a middleware for JWT authentication
 type AuthMiddleware struct {
-	config AuthConfig
+	config   AuthConfig
+	keys     *keyring
+	sessions *sessionTracker
 }
 
-// ValidateToken validates a JWT token
+// NewAuthMiddleware creates a new authentication middleware
+func NewAuthMiddleware(config AuthConfig) (*AuthMiddleware, error) {
+	if config.TokenExpiry <= 0 {
+		config.TokenExpiry = defaultTokenExpiry
+	}
+	if config.RefreshTokenExpiry <= 0 {
+		config.RefreshTokenExpiry = defaultRefreshTokenExpiry
+	}
+	if config.SessionLifetime <= 0 {
+		config.SessionLifetime = defaultSessionLifetime
+	}
+
+	keys, err := newKeyring(config.Algorithm, config.JWTSecret)
+	if err != nil {
+		return nil, err
+	}
+
+	return &AuthMiddleware{
+		config:   config,
+		keys:     keys,
+		sessions: newSessionTracker(),
+	}, nil
+}
+
+// SetStore sets the store that keeps signing keys, refresh tokens and
+// revocations, and loads them from it
+func (am *AuthMiddleware) SetStore(s store.Store) error {
+	if err := am.keys.setStore(s); err != nil {
+		return err
+	}
+	return am.sessions.setStore(s)
+}
+
+// tokenLifetime returns how long access tokens are valid
+func (am *AuthMiddleware) tokenLifetime() time.Duration {
+	return time.Duration(am.config.TokenExpiry) * time.Minute
+}
+
+// sessionEnd returns when a session that started at the given time must end
+func (am *AuthMiddleware) sessionEnd(sessionStart time.Time) time.Time {
+	return sessionStart.Add(time.Duration(am.config.SessionLifetime) * time.Minute)
+}
+
+// ValidateToken validates a JWT token and checks that it has not been revoked
 func (am *AuthMiddleware) ValidateToken(tokenString string) (*jwt.Token, *Claims, error) {
-	// Parse the token
+	// Parse the token, verifying it with the key named in its header
 	token, err := jwt.ParseWithClaims(tokenString, &Claims{}, func(token *jwt.Token) (interface{}, error) {
-		// Validate the signing method
-		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
-			return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
-		}
-		return []byte(am.config.JWTSecret), nil
+		return am.keys.verificationKey(token, am.tokenLifetime())
 	})
 
 	if err != nil {
@@ -57,14 +117,11 @@ func (am *AuthMiddleware) ValidateToken(tokenString string) (*jwt.Token, *Claims
 		return nil, nil, fmt.Errorf("invalid token claims")
 	}
 
-	return token, claims, nil
-}
-
-// NewAuthMiddleware creates a new authentication middleware
-func NewAuthMiddleware(config AuthConfig) *AuthMiddleware {
-	return &AuthMiddleware{
-		config: config,
+	if am.sessions.isRevoked(claims) {
+		return nil, nil, ErrTokenRevoked
 	}
+
+	return token, claims, nil
 }
 
 // Middleware returns a middleware function for JWT authentication
@@ -95,36 +152,13 @@ func (am *AuthMiddleware) Middleware(next http.Handler) http.Handler {
 			return
 		}
 
-		// Extract the token
-		tokenString := strings.TrimPrefix(authHeader, "Bearer ")
-
-		// Parse the token
-		token, err := jwt.ParseWithClaims(tokenString, &Claims{}, func(token *jwt.Token) (interface{}, error) {
-			// Validate the signing method
-			if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
-				return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
-			}
-			return []byte(am.config.JWTSecret), nil
-		})
-
+		// Validate the token
+		_, claims, err := am.ValidateToken(strings.TrimPrefix(authHeader, "Bearer "))
 		if err != nil {
 			http.Error(w, "Invalid or expired token", http.StatusUnauthorized)
 			return
 		}
 
-		// Check if the token is valid
-		if !token.Valid {
-			http.Error(w, "Invalid token", http.StatusUnauthorized)
-			return
-		}
-
-		// Extract claims
-		claims, ok := token.Claims.(*Claims)
-		if !ok {
-			http.Error(w, "Invalid token claims", http.StatusUnauthorized)
-			return
-		}
-
 		// Add claims to the request context
 		ctx := context.WithValue(r.Context(), "claims", claims)
 		r = r.WithContext(ctx)
@@ -134,61 +168,170 @@ func (am *AuthMiddleware) Middleware(next http.Handler) http.Handler {
 	})
 }
 
-// GenerateToken generates a JWT token
+// GenerateToken generates a JWT token in a new session
 func (am *AuthMiddleware) GenerateToken(username, role string) (string, error) {
+	sessionID, err := newID()
+	if err != nil {
+		return "", err
+	}
+	token, _, err := am.generateToken(username, role, sessionID)
+	return token, err
+}
+
+// generateToken signs an access token for a session
+func (am *AuthMiddleware) generateToken(username, role, sessionID string) (string, time.Time, error) {
+	tokenID, err := newID()
+	if err != nil {
+		return "", time.Time{}, err
+	}
+
+	now := time.Now()
+	expiresAt := now.Add(am.tokenLifetime())
+
 	// Create the claims
 	claims := &Claims{
-		Username: username,
-		Role:     role,
+		Username:  username,
+		Role:      role,
+		SessionID: sessionID,
 		RegisteredClaims: jwt.RegisteredClaims{
-			ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Duration(am.config.TokenExpiry) * time.Minute)),
-			IssuedAt:  jwt.NewNumericDate(time.Now()),
-			NotBefore: jwt.NewNumericDate(time.Now()),
+			ID:        tokenID,
+			ExpiresAt: jwt.NewNumericDate(expiresAt),
+			IssuedAt:  jwt.NewNumericDate(now),
+			NotBefore: jwt.NewNumericDate(now),
 			Issuer:    "dinoc2",
 			Subject:   username,
 		},
 	}
 
-	// Create the token
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
+	// Sign the token with the current key
+	tokenString, err := am.keys.sign(claims)
+	if err != nil {
+		return "", time.Time{}, err
+	}
 
-	// Sign the token
-	tokenString, err := token.SignedString([]byte(am.config.JWTSecret))
+	return tokenString, expiresAt, nil
+}
+
+// Login starts a new session for an operator, returning an access token and a refresh token
+func (am *AuthMiddleware) Login(username, role string) (TokenPair, error) {
+	sessionID, err := newID()
 	if err != nil {
-		return "", err
+		return TokenPair{}, err
 	}
+	return am.issueTokens(username, role, sessionID, time.Now().UTC())
+}
 
-	return tokenString, nil
+// issueTokens issues an access token and a refresh token for a session
+func (am *AuthMiddleware) issueTokens(username, role, sessionID string, sessionStart time.Time) (TokenPair, error) {
+	token, expiresAt, err := am.generateToken(username, role, sessionID)
+	if err != nil {
+		return TokenPair{}, err
+	}
+
+	// A refresh token never outlives its session
+	refreshExpiresAt := time.Now().UTC().Add(time.Duration(am.config.RefreshTokenExpiry) * time.Minute)
+	if end := am.sessionEnd(sessionStart); end.Before(refreshExpiresAt) {
+		refreshExpiresAt = end
+	}
+	refresh, err := am.sessions.issue(sessionID, username, sessionStart, refreshExpiresAt)
+	if err != nil {
+		return TokenPair{}, err
+	}
+
+	return TokenPair{Token: token, RefreshToken: refresh, ExpiresAt: expiresAt}, nil
 }
 
-// RefreshToken refreshes a JWT token
-func (am *AuthMiddleware) RefreshToken(tokenString string) (string, error) {
-	// Parse the token
-	token, err := jwt.ParseWithClaims(tokenString, &Claims{}, func(token *jwt.Token) (interface{}, error) {
-		// Validate the signing method
-		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
-			return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
-		}
-		return []byte(am.config.JWTSecret), nil
-	})
+// Refresh exchanges a refresh token for a new token pair. Each refresh token
+// can be used once; presenting it again revokes the session it belongs to.
+func (am *AuthMiddleware) Refresh(refreshToken string) (TokenPair, error) {
+	used, err := am.sessions.use(refreshToken, am.tokenLifetime())
+	if err != nil {
+		return TokenPair{}, err
+	}
+	if !time.Now().Before(am.sessionEnd(used.SessionStart)) {
+		return TokenPair{}, ErrSessionExpired
+	}
+
+	// Use the operator's current role, and refuse disabled or deleted accounts
+	user, err := auth.GetUserStore().GetUser(used.Username)
+	if err != nil || user.Disabled {
+		return TokenPair{}, fmt.Errorf("user account is not active")
+	}
 
+	return am.issueTokens(user.Username, user.Role, used.SessionID, used.SessionStart)
+}
+
+// RefreshToken exchanges a valid access token for a new one in the same
+// session. The old token is revoked so that it cannot be refreshed again.
+// Only a session that still has a refresh token and has not reached the
+// session lifetime can be extended this way.
+func (am *AuthMiddleware) RefreshToken(tokenString string) (string, error) {
+	_, claims, err := am.ValidateToken(tokenString)
 	if err != nil {
 		return "", err
 	}
 
-	// Check if the token is valid
-	if !token.Valid {
-		return "", fmt.Errorf("invalid token")
+	sessionStart, exists := am.sessions.sessionStart(claims.SessionID)
+	if !exists || !time.Now().Before(am.sessionEnd(sessionStart)) {
+		return "", ErrSessionExpired
 	}
 
-	// Extract claims
-	claims, ok := token.Claims.(*Claims)
-	if !ok {
-		return "", fmt.Errorf("invalid token claims")
+	user, err := auth.GetUserStore().GetUser(claims.Username)
+	if err != nil || user.Disabled {
+		return "", fmt.Errorf("user account is not active")
+	}
+
+	if err := am.sessions.revoke(RevokeToken, claims.ID, claims.ExpiresAt.Time); err != nil {
+		return "", err
+	}
+
+	token, _, err := am.generateToken(user.Username, user.Role, claims.SessionID)
+	return token, err
+}
+
+// Logout ends the session of an access token, revoking all of its tokens
+func (am *AuthMiddleware) Logout(claims *Claims) error {
+	if claims.SessionID == "" {
+		return am.sessions.revoke(RevokeToken, claims.ID, claims.ExpiresAt.Time)
 	}
+	return am.sessions.revokeSessionByID(claims.SessionID, am.tokenLifetime())
+}
+
+// RevokeSession revokes every token of a session
+func (am *AuthMiddleware) RevokeSession(sessionID string) error {
+	return am.sessions.revokeSessionByID(sessionID, am.tokenLifetime())
+}
 
-	// Generate a new token
-	return am.GenerateToken(claims.Username, claims.Role)
+// RevokeUser revokes every token issued to an operator so far. The operator
+// can log in again unless the account is also disabled.
+func (am *AuthMiddleware) RevokeUser(username string) error {
+	return am.sessions.revokeUser(username, am.tokenLifetime())
+}
+
+// RevokeTokenID revokes a single access token by its ID
+func (am *AuthMiddleware) RevokeTokenID(tokenID string) error {
+	return am.sessions.revoke(RevokeToken, tokenID, time.Now().Add(am.tokenLifetime()))
+}
+
+// Sessions lists the active sessions, of one operator if username is set
+func (am *AuthMiddleware) Sessions(username string) []Session {
+	return am.sessions.sessions(username)
+}
+
+// RotateKey makes a newly generated key the signing key. Tokens signed with
+// the previous key stay valid until they expire.
+func (am *AuthMiddleware) RotateKey() (KeyInfo, error) {
+	return am.keys.rotate()
+}
+
+// RetireKey deletes a signing key, immediately invalidating the tokens it signed
+func (am *AuthMiddleware) RetireKey(id string) error {
+	return am.keys.retire(id)
+}
+
+// Keys lists the signing keys, newest first
+func (am *AuthMiddleware) Keys() []KeyInfo {
+	return am.keys.list()
 }
 
 // HandleLogin handles the login request
@@ -223,18 +366,16 @@ func (am *AuthMiddleware) HandleLogin(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Generate a token
-	token, err := am.GenerateToken(loginRequest.Username, role)
+	// Start a session
+	tokens, err := am.Login(loginRequest.Username, role)
 	if err != nil {
 		http.Error(w, "Failed to generate token", http.StatusInternalServerError)
 		return
 	}
 
-	// Return the token
+	// Return the tokens
 	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(map[string]string{
-		"token": token,
-	})
+	json.NewEncoder(w).Encode(tokens)
 }
 
 // HandleRefresh handles the token refresh request
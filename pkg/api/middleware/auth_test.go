@@ -0,0 +1,169 @@
+package middleware
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"dinoc2/pkg/auth"
+	"dinoc2/pkg/store"
+)
+
+func newTestMiddleware(t *testing.T, s store.Store) *AuthMiddleware {
+	am, err := NewAuthMiddleware(AuthConfig{Enabled: true, TokenExpiry: 60})
+	if err != nil {
+		t.Fatalf("Failed to create middleware: %v", err)
+	}
+	if err := am.SetStore(s); err != nil {
+		t.Fatalf("Failed to set store: %v", err)
+	}
+	return am
+}
+
+func TestKeyRotation(t *testing.T) {
+	s := store.NewMemoryStore()
+	am := newTestMiddleware(t, s)
+
+	oldToken, err := am.GenerateToken("alice", auth.RoleOperator)
+	if err != nil {
+		t.Fatalf("Failed to generate token: %v", err)
+	}
+	oldKey := am.Keys()[0].ID
+
+	if _, err := am.RotateKey(); err != nil {
+		t.Fatalf("Failed to rotate key: %v", err)
+	}
+	newToken, _ := am.GenerateToken("alice", auth.RoleOperator)
+
+	// Tokens signed before the rotation stay valid
+	if _, _, err := am.ValidateToken(oldToken); err != nil {
+		t.Errorf("Token signed with the previous key should be valid: %v", err)
+	}
+
+	// Keys are loaded from the store by a restarted server
+	restarted := newTestMiddleware(t, s)
+	if _, _, err := restarted.ValidateToken(newToken); err != nil {
+		t.Errorf("Token should be valid after a restart: %v", err)
+	}
+
+	if err := am.RetireKey(am.Keys()[0].ID); err != ErrCurrentKey {
+		t.Errorf("Expected ErrCurrentKey, got %v", err)
+	}
+	if err := am.RetireKey(oldKey); err != nil {
+		t.Fatalf("Failed to retire key: %v", err)
+	}
+	if _, _, err := am.ValidateToken(oldToken); err == nil {
+		t.Error("Token signed with a retired key should be rejected")
+	}
+	if _, _, err := am.ValidateToken(newToken); err != nil {
+		t.Errorf("Token signed with the current key should be valid: %v", err)
+	}
+}
+
+func TestRefreshTokenReuseRevokesSession(t *testing.T) {
+	users := auth.NewUserStore("")
+	if err := users.AddUser(auth.UserAuth{Username: "alice", Password: "secret", Role: auth.RoleOperator}); err != nil {
+		t.Fatalf("Failed to add user: %v", err)
+	}
+	previous := auth.GetUserStore()
+	auth.SetUserStore(users)
+	defer auth.SetUserStore(previous)
+
+	am := newTestMiddleware(t, store.NewMemoryStore())
+
+	first, err := am.Login("alice", auth.RoleOperator)
+	if err != nil {
+		t.Fatalf("Failed to log in: %v", err)
+	}
+	second, err := am.Refresh(first.RefreshToken)
+	if err != nil {
+		t.Fatalf("Failed to refresh: %v", err)
+	}
+
+	// Presenting the first refresh token again revokes the whole session
+	if _, err := am.Refresh(first.RefreshToken); !errors.Is(err, ErrRefreshTokenReused) {
+		t.Fatalf("Expected ErrRefreshTokenReused, got %v", err)
+	}
+	if _, _, err := am.ValidateToken(second.Token); !errors.Is(err, ErrTokenRevoked) {
+		t.Errorf("Expected the session's access token to be revoked, got %v", err)
+	}
+	if _, err := am.Refresh(second.RefreshToken); err == nil {
+		t.Error("Refresh tokens of a revoked session should be rejected")
+	}
+}
+
+func TestLogoutAndRevokeUser(t *testing.T) {
+	am := newTestMiddleware(t, store.NewMemoryStore())
+
+	laptop, _ := am.Login("alice", auth.RoleOperator)
+	desktop, _ := am.Login("alice", auth.RoleOperator)
+
+	_, claims, err := am.ValidateToken(laptop.Token)
+	if err != nil {
+		t.Fatalf("Failed to validate token: %v", err)
+	}
+	if err := am.Logout(claims); err != nil {
+		t.Fatalf("Failed to log out: %v", err)
+	}
+	if _, _, err := am.ValidateToken(laptop.Token); !errors.Is(err, ErrTokenRevoked) {
+		t.Errorf("Expected the logged out token to be revoked, got %v", err)
+	}
+	if _, _, err := am.ValidateToken(desktop.Token); err != nil {
+		t.Errorf("Other sessions should stay valid: %v", err)
+	}
+	if sessions := am.Sessions("alice"); len(sessions) != 1 {
+		t.Errorf("Expected 1 active session, got %d", len(sessions))
+	}
+
+	if err := am.RevokeUser("alice"); err != nil {
+		t.Fatalf("Failed to revoke user: %v", err)
+	}
+	if _, _, err := am.ValidateToken(desktop.Token); !errors.Is(err, ErrTokenRevoked) {
+		t.Errorf("Expected every token of the user to be revoked, got %v", err)
+	}
+	if sessions := am.Sessions("alice"); len(sessions) != 0 {
+		t.Errorf("Expected no active sessions, got %d", len(sessions))
+	}
+}
+
+func TestSessionLifetimeCapsRefresh(t *testing.T) {
+	users := auth.NewUserStore("")
+	if err := users.AddUser(auth.UserAuth{Username: "alice", Password: "secret", Role: auth.RoleOperator}); err != nil {
+		t.Fatalf("Failed to add user: %v", err)
+	}
+	previous := auth.GetUserStore()
+	auth.SetUserStore(users)
+	defer auth.SetUserStore(previous)
+
+	am := newTestMiddleware(t, store.NewMemoryStore())
+
+	// An access token of a session that has a refresh token can be refreshed
+	pair, err := am.Login("alice", auth.RoleOperator)
+	if err != nil {
+		t.Fatalf("Failed to log in: %v", err)
+	}
+	token, err := am.RefreshToken(pair.Token)
+	if err != nil {
+		t.Fatalf("Failed to refresh the access token: %v", err)
+	}
+
+	// Once the session has reached its lifetime, neither kind of refresh extends it
+	for _, refresh := range am.sessions.refreshTokens {
+		refresh.SessionStart = refresh.SessionStart.Add(-time.Duration(defaultSessionLifetime) * time.Minute)
+	}
+	if _, err := am.RefreshToken(token); !errors.Is(err, ErrSessionExpired) {
+		t.Errorf("Expected ErrSessionExpired from the access token refresh, got %v", err)
+	}
+	if _, err := am.Refresh(pair.RefreshToken); !errors.Is(err, ErrSessionExpired) {
+		t.Errorf("Expected ErrSessionExpired from the refresh token, got %v", err)
+	}
+
+	// A session without a refresh token cannot be extended with an access token
+	token, err = am.GenerateToken("alice", auth.RoleOperator)
+	if err != nil {
+		t.Fatalf("Failed to generate token: %v", err)
+	}
+	if _, err := am.RefreshToken(token); !errors.Is(err, ErrSessionExpired) {
+		t.Errorf("Expected ErrSessionExpired for a session without a refresh token, got %v", err)
+	}
+}
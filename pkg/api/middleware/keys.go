@@ -0,0 +1,348 @@
+package middleware
+
+import (
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"dinoc2/pkg/store"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// Signing algorithms
+const (
+	AlgorithmEdDSA = "EdDSA"
+	AlgorithmRS256 = "RS256"
+	AlgorithmHS256 = "HS256"
+)
+
+// keyCollection is the store collection that holds signing keys
+const keyCollection = "auth_keys"
+
+// hmacKeyID is the key ID of the configured HMAC secret
+const hmacKeyID = "hs256"
+
+var (
+	// ErrKeyNotFound is returned when a signing key does not exist
+	ErrKeyNotFound = errors.New("signing key not found")
+
+	// ErrCurrentKey is returned when retiring the key that signs new tokens
+	ErrCurrentKey = errors.New("cannot retire the current signing key, rotate it first")
+
+	// ErrRotationUnsupported is returned when rotating a configured HMAC secret
+	ErrRotationUnsupported = errors.New("key rotation requires an asymmetric signing algorithm")
+)
+
+// signingKey is a key that signs tokens and verifies their signature
+type signingKey struct {
+	ID         string     `json:"id"`
+	Algorithm  string     `json:"algorithm"`
+	CreatedAt  time.Time  `json:"created_at"`
+	RotatedAt  *time.Time `json:"rotated_at,omitempty"` // when the key stopped signing new tokens
+	PrivateKey []byte     `json:"private_key"`          // PKCS #8 DER
+
+	signer crypto.Signer
+}
+
+// KeyInfo describes a signing key without its private part
+type KeyInfo struct {
+	ID        string     `json:"id"`
+	Algorithm string     `json:"algorithm"`
+	CreatedAt time.Time  `json:"created_at"`
+	RotatedAt *time.Time `json:"rotated_at,omitempty"`
+	Current   bool       `json:"current"`
+}
+
+// keyring holds the current signing key and the previous keys that still
+// verify tokens issued before a rotation
+type keyring struct {
+	algorithm string
+	secret    []byte
+	keys      map[string]*signingKey
+	current   string
+	store     store.Store
+	mutex     sync.RWMutex
+}
+
+// newKeyring creates a keyring for the algorithm. Asymmetric keyrings start
+// with a newly generated key.
+func newKeyring(algorithm, secret string) (*keyring, error) {
+	if algorithm == "" {
+		algorithm = AlgorithmEdDSA
+	}
+
+	k := &keyring{
+		algorithm: algorithm,
+		secret:    []byte(secret),
+		keys:      make(map[string]*signingKey),
+	}
+
+	switch algorithm {
+	case AlgorithmHS256:
+		if secret == "" {
+			return nil, errors.New("HS256 requires a JWT secret")
+		}
+		k.current = hmacKeyID
+		return k, nil
+	case AlgorithmEdDSA, AlgorithmRS256:
+		key, err := generateKey(algorithm)
+		if err != nil {
+			return nil, err
+		}
+		k.keys[key.ID] = key
+		k.current = key.ID
+		return k, nil
+	default:
+		return nil, fmt.Errorf("unsupported signing algorithm: %s", algorithm)
+	}
+}
+
+// generateKey creates a new signing key with a random key ID
+func generateKey(algorithm string) (*signingKey, error) {
+	var signer crypto.Signer
+	switch algorithm {
+	case AlgorithmEdDSA:
+		_, privateKey, err := ed25519.GenerateKey(rand.Reader)
+		if err != nil {
+			return nil, fmt.Errorf("failed to generate Ed25519 key: %w", err)
+		}
+		signer = privateKey
+	case AlgorithmRS256:
+		privateKey, err := rsa.GenerateKey(rand.Reader, 2048)
+		if err != nil {
+			return nil, fmt.Errorf("failed to generate RSA key: %w", err)
+		}
+		signer = privateKey
+	default:
+		return nil, fmt.Errorf("unsupported signing algorithm: %s", algorithm)
+	}
+
+	der, err := x509.MarshalPKCS8PrivateKey(signer)
+	if err != nil {
+		return nil, err
+	}
+
+	id := make([]byte, 8)
+	if _, err := rand.Read(id); err != nil {
+		return nil, err
+	}
+
+	return &signingKey{
+		ID:         hex.EncodeToString(id),
+		Algorithm:  algorithm,
+		CreatedAt:  time.Now().UTC(),
+		PrivateKey: der,
+		signer:     signer,
+	}, nil
+}
+
+// setStore loads the keys kept in the store, replacing the generated key, or
+// saves the generated key if the store has none for the algorithm
+func (k *keyring) setStore(s store.Store) error {
+	k.mutex.Lock()
+	defer k.mutex.Unlock()
+
+	k.store = s
+	if k.algorithm == AlgorithmHS256 {
+		return nil
+	}
+
+	records, err := s.List(keyCollection)
+	if err != nil {
+		return fmt.Errorf("failed to load signing keys: %w", err)
+	}
+
+	loaded := make(map[string]*signingKey)
+	var current *signingKey
+	for _, data := range records {
+		var key signingKey
+		if err := json.Unmarshal(data, &key); err != nil {
+			return fmt.Errorf("failed to load signing key: %w", err)
+		}
+		privateKey, err := x509.ParsePKCS8PrivateKey(key.PrivateKey)
+		if err != nil {
+			return fmt.Errorf("failed to parse signing key %s: %w", key.ID, err)
+		}
+		signer, ok := privateKey.(crypto.Signer)
+		if !ok {
+			return fmt.Errorf("signing key %s is not a signing key", key.ID)
+		}
+		key.signer = signer
+		loaded[key.ID] = &key
+
+		// The newest key of the configured algorithm that has not been rotated out signs new tokens
+		if key.Algorithm == k.algorithm && key.RotatedAt == nil && (current == nil || key.CreatedAt.After(current.CreatedAt)) {
+			current = &key
+		}
+	}
+
+	if current == nil {
+		// Keep the generated key, and any keys of a previously configured algorithm for verification
+		generated := k.keys[k.current]
+		loaded[generated.ID] = generated
+		k.keys = loaded
+		return k.save(generated)
+	}
+
+	k.keys = loaded
+	k.current = current.ID
+	return nil
+}
+
+// save persists a key. The caller must hold the mutex.
+func (k *keyring) save(key *signingKey) error {
+	if k.store == nil {
+		return nil
+	}
+	if err := k.store.Put(keyCollection, key.ID, key); err != nil {
+		return fmt.Errorf("failed to save signing key %s: %w", key.ID, err)
+	}
+	return nil
+}
+
+// sign signs the claims with the current key
+func (k *keyring) sign(claims jwt.Claims) (string, error) {
+	k.mutex.RLock()
+	defer k.mutex.RUnlock()
+
+	if k.algorithm == AlgorithmHS256 {
+		token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
+		token.Header["kid"] = hmacKeyID
+		return token.SignedString(k.secret)
+	}
+
+	key := k.keys[k.current]
+	token := jwt.NewWithClaims(signingMethod(key.Algorithm), claims)
+	token.Header["kid"] = key.ID
+	return token.SignedString(key.signer)
+}
+
+// verificationKey returns the key that verifies a token, selected by its kid header.
+// Keys rotated out longer than maxAge ago no longer verify tokens, as every token
+// they signed has expired.
+func (k *keyring) verificationKey(token *jwt.Token, maxAge time.Duration) (interface{}, error) {
+	k.mutex.RLock()
+	defer k.mutex.RUnlock()
+
+	kid, _ := token.Header["kid"].(string)
+
+	// Tokens issued before key IDs were introduced are signed with the HMAC secret
+	if kid == "" || kid == hmacKeyID {
+		if k.algorithm != AlgorithmHS256 {
+			return nil, errors.New("token is not signed with a known key")
+		}
+		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
+			return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
+		}
+		return k.secret, nil
+	}
+
+	key, exists := k.keys[kid]
+	if !exists {
+		return nil, fmt.Errorf("unknown signing key: %s", kid)
+	}
+	if key.RotatedAt != nil && time.Since(*key.RotatedAt) > maxAge {
+		return nil, fmt.Errorf("signing key %s has been rotated out", kid)
+	}
+	if token.Method.Alg() != signingMethod(key.Algorithm).Alg() {
+		return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
+	}
+
+	return key.signer.Public(), nil
+}
+
+// rotate generates a new current key. The previous key keeps verifying the
+// tokens it signed until they expire.
+func (k *keyring) rotate() (KeyInfo, error) {
+	k.mutex.Lock()
+	defer k.mutex.Unlock()
+
+	if k.algorithm == AlgorithmHS256 {
+		return KeyInfo{}, ErrRotationUnsupported
+	}
+
+	key, err := generateKey(k.algorithm)
+	if err != nil {
+		return KeyInfo{}, err
+	}
+	if err := k.save(key); err != nil {
+		return KeyInfo{}, err
+	}
+
+	previous := k.keys[k.current]
+	now := time.Now().UTC()
+	previous.RotatedAt = &now
+	if err := k.save(previous); err != nil {
+		return KeyInfo{}, err
+	}
+
+	k.keys[key.ID] = key
+	k.current = key.ID
+	return key.info(true), nil
+}
+
+// retire deletes a key, immediately invalidating every token it signed
+func (k *keyring) retire(id string) error {
+	k.mutex.Lock()
+	defer k.mutex.Unlock()
+
+	if id == k.current {
+		return ErrCurrentKey
+	}
+	if _, exists := k.keys[id]; !exists {
+		return ErrKeyNotFound
+	}
+
+	if k.store != nil {
+		if err := k.store.Delete(keyCollection, id); err != nil {
+			return fmt.Errorf("failed to delete signing key %s: %w", id, err)
+		}
+	}
+	delete(k.keys, id)
+	return nil
+}
+
+// list describes the keys, newest first
+func (k *keyring) list() []KeyInfo {
+	k.mutex.RLock()
+	defer k.mutex.RUnlock()
+
+	if k.algorithm == AlgorithmHS256 {
+		return []KeyInfo{{ID: hmacKeyID, Algorithm: AlgorithmHS256, Current: true}}
+	}
+
+	keys := make([]KeyInfo, 0, len(k.keys))
+	for id, key := range k.keys {
+		keys = append(keys, key.info(id == k.current))
+	}
+	sort.Slice(keys, func(i, j int) bool { return keys[i].CreatedAt.After(keys[j].CreatedAt) })
+	return keys
+}
+
+// info describes the key
+func (key *signingKey) info(current bool) KeyInfo {
+	return KeyInfo{
+		ID:        key.ID,
+		Algorithm: key.Algorithm,
+		CreatedAt: key.CreatedAt,
+		RotatedAt: key.RotatedAt,
+		Current:   current,
+	}
+}
+
+// signingMethod returns the JWT signing method for an algorithm
+func signingMethod(algorithm string) jwt.SigningMethod {
+	if algorithm == AlgorithmRS256 {
+		return jwt.SigningMethodRS256
+	}
+	return jwt.SigningMethodEdDSA
+}
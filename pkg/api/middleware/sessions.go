@@ -0,0 +1,370 @@
+package middleware
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"dinoc2/pkg/store"
+)
+
+// Store collections that hold refresh tokens and revocations
+const (
+	refreshTokenCollection = "refresh_tokens"
+	revocationCollection   = "revocations"
+)
+
+// Revocation kinds
+const (
+	RevokeToken   = "token"   // a single access token, by its ID
+	RevokeSession = "session" // every token of a login session
+	RevokeUser    = "user"    // every token issued to an operator so far
+)
+
+var (
+	// ErrInvalidRefreshToken is returned for unknown or expired refresh tokens
+	ErrInvalidRefreshToken = errors.New("invalid or expired refresh token")
+
+	// ErrRefreshTokenReused is returned when a refresh token is presented a second time
+	ErrRefreshTokenReused = errors.New("refresh token reuse detected, session revoked")
+
+	// ErrSessionExpired is returned when a session has reached its lifetime, or
+	// is no longer known, and the operator must log in again
+	ErrSessionExpired = errors.New("session has expired")
+
+	// ErrTokenRevoked is returned when a token has been revoked
+	ErrTokenRevoked = errors.New("token has been revoked")
+)
+
+// refreshToken is a single-use token that starts a new token pair in its session
+type refreshToken struct {
+	Hash         string    `json:"hash"`
+	SessionID    string    `json:"session_id"`
+	Username     string    `json:"username"`
+	SessionStart time.Time `json:"session_start"`
+	ExpiresAt    time.Time `json:"expires_at"`
+	Used         bool      `json:"used"` // kept until it expires to detect reuse
+}
+
+// revocation rejects the tokens it covers until they have all expired
+type revocation struct {
+	Kind      string    `json:"kind"`
+	Value     string    `json:"value"`
+	RevokedAt time.Time `json:"revoked_at"`
+	Until     time.Time `json:"until"`
+}
+
+// Session describes an operator's login session
+type Session struct {
+	ID        string    `json:"id"`
+	Username  string    `json:"username"`
+	StartedAt time.Time `json:"started_at"`
+	ExpiresAt time.Time `json:"expires_at"` // unless it is refreshed
+}
+
+// sessionTracker keeps the refresh tokens and the revocation list
+type sessionTracker struct {
+	refreshTokens map[string]*refreshToken
+	revocations   map[string]*revocation
+	store         store.Store
+	mutex         sync.Mutex
+}
+
+// newSessionTracker creates an empty session tracker
+func newSessionTracker() *sessionTracker {
+	return &sessionTracker{
+		refreshTokens: make(map[string]*refreshToken),
+		revocations:   make(map[string]*revocation),
+	}
+}
+
+// setStore loads the refresh tokens and revocations kept in the store
+func (t *sessionTracker) setStore(s store.Store) error {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	t.store = s
+
+	records, err := s.List(refreshTokenCollection)
+	if err != nil {
+		return fmt.Errorf("failed to load refresh tokens: %w", err)
+	}
+	for _, data := range records {
+		var token refreshToken
+		if err := json.Unmarshal(data, &token); err != nil {
+			return fmt.Errorf("failed to load refresh token: %w", err)
+		}
+		t.refreshTokens[token.Hash] = &token
+	}
+
+	records, err = s.List(revocationCollection)
+	if err != nil {
+		return fmt.Errorf("failed to load revocations: %w", err)
+	}
+	for _, data := range records {
+		var entry revocation
+		if err := json.Unmarshal(data, &entry); err != nil {
+			return fmt.Errorf("failed to load revocation: %w", err)
+		}
+		t.revocations[revocationKey(entry.Kind, entry.Value)] = &entry
+	}
+
+	t.prune()
+	return nil
+}
+
+// issue creates a refresh token for a session
+func (t *sessionTracker) issue(sessionID, username string, sessionStart, expiresAt time.Time) (string, error) {
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		return "", err
+	}
+	value := base64.RawURLEncoding.EncodeToString(secret)
+
+	token := &refreshToken{
+		Hash:         hashToken(value),
+		SessionID:    sessionID,
+		Username:     username,
+		SessionStart: sessionStart,
+		ExpiresAt:    expiresAt,
+	}
+
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	t.prune()
+	if err := t.put(refreshTokenCollection, token.Hash, token); err != nil {
+		return "", err
+	}
+	t.refreshTokens[token.Hash] = token
+	return value, nil
+}
+
+// use redeems a refresh token. A token that has already been used means it
+// was copied, so its whole session is revoked.
+func (t *sessionTracker) use(value string, accessLifetime time.Duration) (*refreshToken, error) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	token, exists := t.refreshTokens[hashToken(value)]
+	if !exists || time.Now().After(token.ExpiresAt) {
+		return nil, ErrInvalidRefreshToken
+	}
+	if _, revoked := t.revocations[revocationKey(RevokeSession, token.SessionID)]; revoked {
+		return nil, ErrInvalidRefreshToken
+	}
+
+	if token.Used {
+		if err := t.revokeSession(token.SessionID, accessLifetime); err != nil {
+			return nil, err
+		}
+		return nil, ErrRefreshTokenReused
+	}
+
+	token.Used = true
+	if err := t.put(refreshTokenCollection, token.Hash, token); err != nil {
+		token.Used = false
+		return nil, err
+	}
+	return token, nil
+}
+
+// sessionStart returns when a session started, if it has a refresh token
+// that has not expired and it has not been revoked
+func (t *sessionTracker) sessionStart(sessionID string) (time.Time, bool) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	if sessionID == "" {
+		return time.Time{}, false
+	}
+	if _, revoked := t.revocations[revocationKey(RevokeSession, sessionID)]; revoked {
+		return time.Time{}, false
+	}
+	now := time.Now()
+	for _, token := range t.refreshTokens {
+		if token.SessionID == sessionID && now.Before(token.ExpiresAt) {
+			return token.SessionStart, true
+		}
+	}
+	return time.Time{}, false
+}
+
+// revoke adds a revocation that lasts until every token it covers has expired
+func (t *sessionTracker) revoke(kind, value string, until time.Time) error {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	return t.addRevocation(kind, value, until)
+}
+
+// revokeSession revokes a session and deletes its refresh tokens. The caller must hold the mutex.
+func (t *sessionTracker) revokeSession(sessionID string, accessLifetime time.Duration) error {
+	for hash, token := range t.refreshTokens {
+		if token.SessionID == sessionID {
+			if err := t.deleteRefreshToken(hash); err != nil {
+				return err
+			}
+		}
+	}
+	return t.addRevocation(RevokeSession, sessionID, time.Now().UTC().Add(accessLifetime))
+}
+
+// revokeSessionByID revokes a session and deletes its refresh tokens
+func (t *sessionTracker) revokeSessionByID(sessionID string, accessLifetime time.Duration) error {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	return t.revokeSession(sessionID, accessLifetime)
+}
+
+// revokeUser revokes every token issued to an operator so far
+func (t *sessionTracker) revokeUser(username string, accessLifetime time.Duration) error {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	for hash, token := range t.refreshTokens {
+		if token.Username == username {
+			if err := t.deleteRefreshToken(hash); err != nil {
+				return err
+			}
+		}
+	}
+	return t.addRevocation(RevokeUser, username, time.Now().UTC().Add(accessLifetime))
+}
+
+// isRevoked reports whether an access token has been revoked
+func (t *sessionTracker) isRevoked(claims *Claims) bool {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	if _, revoked := t.revocations[revocationKey(RevokeToken, claims.ID)]; revoked && claims.ID != "" {
+		return true
+	}
+	if _, revoked := t.revocations[revocationKey(RevokeSession, claims.SessionID)]; revoked && claims.SessionID != "" {
+		return true
+	}
+
+	// Revoking an operator covers the tokens issued up to that moment, not later logins
+	if entry, revoked := t.revocations[revocationKey(RevokeUser, claims.Username)]; revoked {
+		if claims.IssuedAt == nil || !claims.IssuedAt.Time.After(entry.RevokedAt) {
+			return true
+		}
+	}
+	return false
+}
+
+// sessions lists the active sessions, of one operator if username is set
+func (t *sessionTracker) sessions(username string) []Session {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	now := time.Now()
+	sessions := make([]Session, 0)
+	for _, token := range t.refreshTokens {
+		if token.Used || now.After(token.ExpiresAt) || (username != "" && token.Username != username) {
+			continue
+		}
+		if _, revoked := t.revocations[revocationKey(RevokeSession, token.SessionID)]; revoked {
+			continue
+		}
+		sessions = append(sessions, Session{
+			ID:        token.SessionID,
+			Username:  token.Username,
+			StartedAt: token.SessionStart,
+			ExpiresAt: token.ExpiresAt,
+		})
+	}
+
+	sort.Slice(sessions, func(i, j int) bool { return sessions[i].StartedAt.Before(sessions[j].StartedAt) })
+	return sessions
+}
+
+// addRevocation records a revocation. The caller must hold the mutex.
+func (t *sessionTracker) addRevocation(kind, value string, until time.Time) error {
+	entry := &revocation{
+		Kind:      kind,
+		Value:     value,
+		RevokedAt: time.Now().UTC(),
+		Until:     until,
+	}
+
+	key := revocationKey(kind, value)
+	if err := t.put(revocationCollection, key, entry); err != nil {
+		return err
+	}
+	t.revocations[key] = entry
+	return nil
+}
+
+// deleteRefreshToken removes a refresh token. The caller must hold the mutex.
+func (t *sessionTracker) deleteRefreshToken(hash string) error {
+	if t.store != nil {
+		if err := t.store.Delete(refreshTokenCollection, hash); err != nil {
+			return fmt.Errorf("failed to delete refresh token: %w", err)
+		}
+	}
+	delete(t.refreshTokens, hash)
+	return nil
+}
+
+// prune drops expired refresh tokens and revocations of tokens that have all
+// expired. The caller must hold the mutex.
+func (t *sessionTracker) prune() {
+	now := time.Now()
+	for hash, token := range t.refreshTokens {
+		if now.After(token.ExpiresAt) {
+			if err := t.deleteRefreshToken(hash); err != nil {
+				fmt.Printf("Failed to prune refresh token: %v\n", err)
+			}
+		}
+	}
+	for key, entry := range t.revocations {
+		if now.After(entry.Until) {
+			if t.store != nil {
+				if err := t.store.Delete(revocationCollection, key); err != nil {
+					fmt.Printf("Failed to prune revocation: %v\n", err)
+					continue
+				}
+			}
+			delete(t.revocations, key)
+		}
+	}
+}
+
+// put persists a record if a store is set. The caller must hold the mutex.
+func (t *sessionTracker) put(collection, key string, value interface{}) error {
+	if t.store == nil {
+		return nil
+	}
+	if err := t.store.Put(collection, key, value); err != nil {
+		return fmt.Errorf("failed to save %s record: %w", collection, err)
+	}
+	return nil
+}
+
+// revocationKey returns the key of a revocation
+func revocationKey(kind, value string) string {
+	return kind + "-" + value
+}
+
+// hashToken returns the hash under which a refresh token is stored, so that
+// the store never holds usable refresh tokens
+func hashToken(value string) string {
+	sum := sha256.Sum256([]byte(value))
+	return hex.EncodeToString(sum[:])
+}
+
+// newID returns a random identifier for tokens and sessions
+func newID() (string, error) {
+	id := make([]byte, 16)
+	if _, err := rand.Read(id); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(id), nil
+}
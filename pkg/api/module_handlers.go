@@ -2,9 +2,13 @@ package api
 
 import (
 	"encoding/json"
+	"errors"
+	"fmt"
 	"net/http"
 	
+	"dinoc2/pkg/module"
 	"dinoc2/pkg/module/loader"
+	"dinoc2/pkg/task"
 )
 
 // ModuleLoadRequest represents a request to load a module
@@ -14,13 +18,18 @@ type ModuleLoadRequest struct {
 	LoaderType loader.LoaderType `json:"loader_type"`
 }
 
-// ModuleExecRequest represents a request to execute a module
-type ModuleExecRequest struct {
-	Name    string        `json:"name"`
+// ModuleCommandRequest represents a module command and its arguments
+type ModuleCommandRequest struct {
 	Command string        `json:"command"`
 	Args    []interface{} `json:"args"`
 }
 
+// ModuleExecRequest represents a request to execute a module
+type ModuleExecRequest struct {
+	Name string `json:"name"`
+	ModuleCommandRequest
+}
+
 // handleListModules handles GET /api/modules
 func (r *Router) handleListModules(w http.ResponseWriter, req *http.Request) {
 	if req.Method != http.MethodGet {
@@ -45,6 +54,12 @@ func (r *Router) handleLoadModule(w http.ResponseWriter, req *http.Request) {
 		return
 	}
 	
+	// Loading a module directly would bypass the approval module_load tasks need
+	if r.taskManager != nil && r.taskManager.RequiresApproval(task.TaskTypeModuleLoad, nil) {
+		writeErrorCode(w, ErrCodeApprovalRequired, "loading modules requires approval; create a module_load task instead", http.StatusForbidden)
+		return
+	}
+	
 	// Load module
 	module, err := r.moduleManager.LoadModule(
 		moduleReq.Name,
@@ -73,13 +88,49 @@ func (r *Router) handleExecModule(w http.ResponseWriter, req *http.Request) {
 		return
 	}
 	
+	r.execModule(w, execReq.Name, execReq.ModuleCommandRequest)
+}
+
+// handleExecModuleCommand handles POST /api/v1/modules/{name}/exec
+func (r *Router) handleExecModuleCommand(w http.ResponseWriter, req *http.Request) {
+	var commandReq ModuleCommandRequest
+	if err := json.NewDecoder(req.Body).Decode(&commandReq); err != nil {
+		writeError(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	
+	name := req.PathValue("name")
+	if _, err := r.moduleManager.GetModuleInfo(name); err != nil {
+		writeError(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	
+	r.execModule(w, name, commandReq)
+}
+
+// execModule executes a module command and writes its result
+func (r *Router) execModule(w http.ResponseWriter, name string, commandReq ModuleCommandRequest) {
+	// Executing a command directly would bypass the approval a module_exec task
+	// for it needs
+	if r.taskManager != nil {
+		data, err := json.Marshal(task.ModuleCommand{Module: name, Command: commandReq.Command, Args: commandReq.Args})
+		if err == nil && r.taskManager.RequiresApproval(task.TaskTypeModuleExec, data) {
+			writeErrorCode(w, ErrCodeApprovalRequired, "this module command requires approval; create a module_exec task instead", http.StatusForbidden)
+			return
+		}
+	}
+	
 	// Execute module
 	result, err := r.moduleManager.ExecModule(
-		execReq.Name,
-		execReq.Command,
-		execReq.Args...,
+		name,
+		commandReq.Command,
+		commandReq.Args...,
 	)
 	
+	if errors.Is(err, module.ErrInvalidCommand) {
+		writeErrorCode(w, ErrCodeInvalidCommand, err.Error(), http.StatusBadRequest)
+		return
+	}
 	if err != nil {
 		writeError(w, err.Error(), http.StatusInternalServerError)
 		return
@@ -87,3 +138,19 @@ func (r *Router) handleExecModule(w http.ResponseWriter, req *http.Request) {
 	
 	writeJSON(w, result, http.StatusOK)
 }
+
+// handleListModuleCommands handles GET /api/v1/modules/commands
+func (r *Router) handleListModuleCommands(w http.ResponseWriter, req *http.Request) {
+	writeJSON(w, r.moduleManager.ListCommands(), http.StatusOK)
+}
+
+// validateModuleCommand checks the data of a module_exec task against the
+// commands its module declares
+func (r *Router) validateModuleCommand(data []byte) error {
+	command, err := task.ParseModuleCommand(data)
+	if err != nil {
+		return fmt.Errorf("%w: %v", module.ErrInvalidCommand, err)
+	}
+	_, err = r.moduleManager.ValidateCommand(command.Module, command.Command, command.Args)
+	return err
+}
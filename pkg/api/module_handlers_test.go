@@ -0,0 +1,38 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"dinoc2/pkg/task"
+)
+
+func TestModuleRoutesRequireApproval(t *testing.T) {
+	router := newTestRouter()
+	router.taskManager.SetApprovalRules([]task.TaskType{task.TaskTypeModuleLoad}, []string{"shell"})
+
+	for _, tc := range []struct {
+		path, body string
+	}{
+		{"/api/v1/modules", `{"name": "shell", "path": "/tmp/shell.so"}`},
+		{"/api/modules/load", `{"name": "shell", "path": "/tmp/shell.so"}`},
+		{"/api/modules/exec", `{"name": "shell", "command": "id"}`},
+	} {
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, tc.path, strings.NewReader(tc.body)))
+		if rec.Code != http.StatusForbidden {
+			t.Errorf("POST %s: expected 403, got %d: %s", tc.path, rec.Code, rec.Body.String())
+		}
+	}
+
+	// Versioned routes say why
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/api/v1/modules", strings.NewReader(`{"name": "shell"}`)))
+	var body ErrorResponse
+	if err := json.NewDecoder(rec.Body).Decode(&body); err != nil || body.Error.Code != ErrCodeApprovalRequired {
+		t.Errorf("Expected an %s error, got %q (%v)", ErrCodeApprovalRequired, rec.Body.String(), err)
+	}
+}
@@ -0,0 +1,270 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"path"
+	"reflect"
+	"regexp"
+	"strings"
+	"time"
+
+	"dinoc2/pkg/auth"
+	"dinoc2/pkg/listener"
+)
+
+// pathParamPattern matches the wildcards in a route path
+var pathParamPattern = regexp.MustCompile(`\{([^}]+)\}`)
+
+// handleOpenAPI handles GET /api/v1/openapi.json and GET /api/docs
+func (r *Router) handleOpenAPI(w http.ResponseWriter, req *http.Request) {
+	if req.Method != http.MethodGet {
+		writeError(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	writeJSON(w, r.OpenAPI(), http.StatusOK)
+}
+
+// OpenAPI generates the OpenAPI 3 document that describes the registered routes
+func (r *Router) OpenAPI() map[string]interface{} {
+	schemas := map[string]interface{}{}
+	paths := map[string]interface{}{}
+
+	errorSchema := schemaRef(reflect.TypeOf(ErrorResponse{}), schemas)
+	legacyErrorSchema := map[string]interface{}{
+		"type":       "object",
+		"properties": map[string]interface{}{"error": map[string]interface{}{"type": "string"}},
+	}
+
+	for _, rt := range r.routes {
+		operation := map[string]interface{}{
+			"summary":     rt.summary,
+			"operationId": operationID(rt),
+			"tags":        []string{rt.tag},
+		}
+		if rt.legacy {
+			operation["deprecated"] = true
+		}
+
+		parameters := make([]interface{}, 0)
+		for _, match := range pathParamPattern.FindAllStringSubmatch(rt.path, -1) {
+			parameters = append(parameters, map[string]interface{}{
+				"name":     match[1],
+				"in":       "path",
+				"required": true,
+				"schema":   map[string]interface{}{"type": "string"},
+			})
+		}
+		for _, p := range rt.query {
+			parameters = append(parameters, map[string]interface{}{
+				"name":        p.name,
+				"in":          "query",
+				"description": p.description,
+				"required":    p.required,
+				"schema":      map[string]interface{}{"type": "string"},
+			})
+		}
+		if len(parameters) > 0 {
+			operation["parameters"] = parameters
+		}
+
+		if rt.request != nil {
+			operation["requestBody"] = map[string]interface{}{
+				"required": true,
+				"content": map[string]interface{}{
+					"application/json": map[string]interface{}{
+						"schema": schemaRef(reflect.TypeOf(rt.request), schemas),
+					},
+				},
+			}
+		}
+
+		contentType := rt.contentType
+		if contentType == "" {
+			contentType = "application/json"
+		}
+		success := map[string]interface{}{"description": "Success"}
+		if rt.response != nil {
+			success["content"] = map[string]interface{}{
+				contentType: map[string]interface{}{
+					"schema": schemaRef(reflect.TypeOf(rt.response), schemas),
+				},
+			}
+		}
+
+		errorContent := errorSchema
+		if rt.legacy {
+			errorContent = legacyErrorSchema
+		}
+		operation["responses"] = map[string]interface{}{
+			"200": success,
+			"default": map[string]interface{}{
+				"description": "Error",
+				"content": map[string]interface{}{
+					"application/json": map[string]interface{}{"schema": errorContent},
+				},
+			},
+		}
+
+		if rt.public {
+			operation["security"] = []interface{}{}
+		} else if rt.permission != "" {
+			operation["x-permission"] = rt.permission
+		}
+
+		item, exists := paths[rt.path].(map[string]interface{})
+		if !exists {
+			item = map[string]interface{}{}
+			paths[rt.path] = item
+		}
+		item[strings.ToLower(rt.method)] = operation
+	}
+
+	roles := map[string]interface{}{}
+	for _, role := range []string{auth.RoleAdmin, auth.RoleOperator, auth.RoleViewer} {
+		roles[role] = auth.RolePermissions(role)
+	}
+
+	// Listener types are those registered with the listener package
+	listenerTypes := map[string]interface{}{}
+	var typeNames []string
+	for _, registration := range listener.ListTypes() {
+		listenerTypes[string(registration.Type)] = registration
+		typeNames = append(typeNames, string(registration.Type))
+	}
+	if request, exists := schemas["api.ListenerRequest"].(map[string]interface{}); exists {
+		request["properties"].(map[string]interface{})["type"] = map[string]interface{}{"type": "string", "enum": typeNames}
+	}
+
+	return map[string]interface{}{
+		"openapi": "3.0.3",
+		"info": map[string]interface{}{
+			"title":            "DinoC2 API",
+			"version":          "1.0.0",
+			"description":      "API for the DinoC2 Command and Control framework. Unversioned routes are deprecated in favour of /api/v1. Each operation lists the permission it requires in x-permission; x-roles lists the permissions of each role, and x-listener-types the options and capabilities of each listener type.",
+			"x-roles":          roles,
+			"x-listener-types": listenerTypes,
+		},
+		"paths": paths,
+		"components": map[string]interface{}{
+			"schemas": schemas,
+			"securitySchemes": map[string]interface{}{
+				"bearerAuth": map[string]interface{}{
+					"type":         "http",
+					"scheme":       "bearer",
+					"bearerFormat": "JWT",
+				},
+			},
+		},
+		"security": []interface{}{
+			map[string]interface{}{"bearerAuth": []string{}},
+		},
+	}
+}
+
+// operationID derives a unique operation ID from a route's method and path
+func operationID(rt route) string {
+	var parts []string
+	if rt.legacy {
+		parts = append(parts, "legacy")
+	}
+	parts = append(parts, strings.ToLower(rt.method))
+	trimmed := strings.TrimPrefix(strings.TrimPrefix(rt.path, "/api"), "/v1")
+	for _, segment := range strings.FieldsFunc(trimmed, func(c rune) bool { return c == '/' || c == '.' }) {
+		parts = append(parts, strings.Trim(segment, "{}"))
+	}
+	return strings.Join(parts, "_")
+}
+
+// schemaRef returns the JSON schema of a Go type. Named struct types are added
+// to schemas and referenced, so that each is described once.
+func schemaRef(t reflect.Type, schemas map[string]interface{}) map[string]interface{} {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+
+	switch t {
+	case reflect.TypeOf(time.Time{}):
+		return map[string]interface{}{"type": "string", "format": "date-time"}
+	case reflect.TypeOf(time.Duration(0)):
+		return map[string]interface{}{"type": "integer", "description": "Duration in nanoseconds"}
+	case reflect.TypeOf(json.RawMessage{}):
+		return map[string]interface{}{}
+	}
+
+	switch t.Kind() {
+	case reflect.Bool:
+		return map[string]interface{}{"type": "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return map[string]interface{}{"type": "integer"}
+	case reflect.Float32, reflect.Float64:
+		return map[string]interface{}{"type": "number"}
+	case reflect.String:
+		return map[string]interface{}{"type": "string"}
+	case reflect.Slice, reflect.Array:
+		if t.Elem().Kind() == reflect.Uint8 {
+			return map[string]interface{}{"type": "string", "format": "byte"}
+		}
+		return map[string]interface{}{"type": "array", "items": schemaRef(t.Elem(), schemas)}
+	case reflect.Map:
+		return map[string]interface{}{"type": "object", "additionalProperties": schemaRef(t.Elem(), schemas)}
+	case reflect.Struct:
+		if t.Name() == "" {
+			return structSchema(t, schemas)
+		}
+		name := path.Base(t.PkgPath()) + "." + t.Name()
+		if _, exists := schemas[name]; !exists {
+			// Reserve the name first so that recursive types terminate
+			schemas[name] = map[string]interface{}{}
+			schemas[name] = structSchema(t, schemas)
+		}
+		return map[string]interface{}{"$ref": "#/components/schemas/" + name}
+	default:
+		return map[string]interface{}{}
+	}
+}
+
+// structSchema returns the JSON schema of a struct type's encoded fields
+func structSchema(t reflect.Type, schemas map[string]interface{}) map[string]interface{} {
+	properties := map[string]interface{}{}
+	addStructFields(t, properties, schemas)
+
+	return map[string]interface{}{
+		"type":       "object",
+		"properties": properties,
+	}
+}
+
+// addStructFields adds the schema of each field encoded by encoding/json,
+// including the fields of embedded structs
+func addStructFields(t reflect.Type, properties, schemas map[string]interface{}) {
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		tag := field.Tag.Get("json")
+		if tag == "-" {
+			continue
+		}
+		name := strings.Split(tag, ",")[0]
+
+		if field.Anonymous && name == "" {
+			embedded := field.Type
+			if embedded.Kind() == reflect.Ptr {
+				embedded = embedded.Elem()
+			}
+			if embedded.Kind() == reflect.Struct {
+				addStructFields(embedded, properties, schemas)
+				continue
+			}
+		}
+		if !field.IsExported() {
+			continue
+		}
+		if name == "" {
+			name = field.Name
+		}
+
+		properties[name] = schemaRef(field.Type, schemas)
+	}
+}
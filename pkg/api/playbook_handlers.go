@@ -0,0 +1,128 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"dinoc2/pkg/client"
+	"dinoc2/pkg/module"
+	"dinoc2/pkg/task"
+)
+
+// PlaybookRequest represents a request to run a playbook against a client
+type PlaybookRequest struct {
+	ClientID string            `json:"client_id"`
+	Playbook task.Playbook     `json:"playbook"`
+	Params   map[string]string `json:"params,omitempty"` // override the playbook's default parameters
+}
+
+// PlaybookRunIDRequest represents a request that refers to a playbook run by its ID
+type PlaybookRunIDRequest struct {
+	ID uint32 `json:"id"`
+}
+
+// handleRunPlaybook handles POST /api/v1/playbooks and POST /api/playbooks/run
+func (r *Router) handleRunPlaybook(w http.ResponseWriter, req *http.Request) {
+	var playbookReq PlaybookRequest
+	if err := json.NewDecoder(req.Body).Decode(&playbookReq); err != nil {
+		writeError(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	if playbookReq.ClientID == "" {
+		writeError(w, "client_id is required", http.StatusBadRequest)
+		return
+	}
+
+	run, err := r.taskManager.RunPlaybook(playbookReq.Playbook, playbookReq.ClientID, playbookReq.Params, requestOperator(req))
+	switch {
+	case errors.Is(err, task.ErrInvalidPlaybook):
+		writeError(w, err.Error(), http.StatusBadRequest)
+	case errors.Is(err, module.ErrInvalidCommand):
+		writeErrorCode(w, ErrCodeInvalidCommand, err.Error(), http.StatusBadRequest)
+	case errors.Is(err, client.ErrClientLocked):
+		writeErrorCode(w, ErrCodeClientLocked, err.Error(), http.StatusConflict)
+	case errors.Is(err, task.ErrTaskRefused):
+		writeErrorCode(w, ErrCodeTaskRefused, err.Error(), http.StatusForbidden)
+	case errors.Is(err, task.ErrQueueFull):
+		writeErrorCode(w, ErrCodeQueueFull, err.Error(), http.StatusTooManyRequests)
+	case err != nil:
+		writeError(w, err.Error(), http.StatusInternalServerError)
+	default:
+		writeJSON(w, run, http.StatusOK)
+	}
+}
+
+// handleListPlaybookRuns handles GET /api/v1/playbooks and GET /api/playbooks
+func (r *Router) handleListPlaybookRuns(w http.ResponseWriter, req *http.Request) {
+	writeJSON(w, r.taskManager.ListPlaybookRuns(), http.StatusOK)
+}
+
+// handlePlaybookRunStatus handles GET /api/playbooks/status
+func (r *Router) handlePlaybookRunStatus(w http.ResponseWriter, req *http.Request) {
+	r.writePlaybookRun(w, req.URL.Query().Get("id"))
+}
+
+// handleGetPlaybookRun handles GET /api/v1/playbooks/{id}
+func (r *Router) handleGetPlaybookRun(w http.ResponseWriter, req *http.Request) {
+	r.writePlaybookRun(w, req.PathValue("id"))
+}
+
+// writePlaybookRun writes the playbook run with the given ID
+func (r *Router) writePlaybookRun(w http.ResponseWriter, idStr string) {
+	id, err := strconv.ParseUint(idStr, 10, 32)
+	if err != nil {
+		writeError(w, "Invalid playbook run ID", http.StatusBadRequest)
+		return
+	}
+
+	run, err := r.taskManager.GetPlaybookRun(uint32(id))
+	if err != nil {
+		writeError(w, err.Error(), http.StatusNotFound)
+		return
+	}
+
+	writeJSON(w, run, http.StatusOK)
+}
+
+// handleCancelPlaybookRunByBody handles POST /api/playbooks/cancel
+func (r *Router) handleCancelPlaybookRunByBody(w http.ResponseWriter, req *http.Request) {
+	var runReq PlaybookRunIDRequest
+	if err := json.NewDecoder(req.Body).Decode(&runReq); err != nil {
+		writeError(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	if runReq.ID == 0 {
+		writeError(w, "Playbook run ID is required", http.StatusBadRequest)
+		return
+	}
+
+	r.cancelPlaybookRun(w, runReq.ID)
+}
+
+// handleCancelPlaybookRun handles POST /api/v1/playbooks/{id}/cancel
+func (r *Router) handleCancelPlaybookRun(w http.ResponseWriter, req *http.Request) {
+	id, err := strconv.ParseUint(req.PathValue("id"), 10, 32)
+	if err != nil {
+		writeError(w, "Invalid playbook run ID", http.StatusBadRequest)
+		return
+	}
+
+	r.cancelPlaybookRun(w, uint32(id))
+}
+
+// cancelPlaybookRun cancels the playbook run with the given ID and writes it
+func (r *Router) cancelPlaybookRun(w http.ResponseWriter, id uint32) {
+	run, err := r.taskManager.CancelPlaybookRun(id)
+	switch {
+	case errors.Is(err, task.ErrRunNotFound):
+		writeError(w, err.Error(), http.StatusNotFound)
+	case errors.Is(err, task.ErrRunFinished):
+		writeError(w, err.Error(), http.StatusConflict)
+	case err != nil:
+		writeError(w, err.Error(), http.StatusInternalServerError)
+	default:
+		writeJSON(w, run, http.StatusOK)
+	}
+}
@@ -6,10 +6,15 @@ import (
 	"net/http"
 )
 
+// ProtocolRequest names the protocol a client should switch to
+type ProtocolRequest struct {
+	Protocol string `json:"protocol"`
+}
+
 // ProtocolSwitchRequest represents a request to switch protocols
 type ProtocolSwitchRequest struct {
 	ClientID string `json:"client_id"`
-	Protocol string `json:"protocol"`
+	ProtocolRequest
 }
 
 // handleProtocolSwitch handles POST /api/protocol/switch
@@ -25,22 +30,35 @@ func (r *Router) handleProtocolSwitch(w http.ResponseWriter, req *http.Request)
 		return
 	}
 	
+	r.switchProtocol(w, switchReq.ClientID, switchReq.Protocol)
+}
+
+// handleSwitchClientProtocol handles POST /api/v1/clients/{id}/protocol
+func (r *Router) handleSwitchClientProtocol(w http.ResponseWriter, req *http.Request) {
+	var protocolReq ProtocolRequest
+	if err := json.NewDecoder(req.Body).Decode(&protocolReq); err != nil {
+		writeError(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	
+	r.switchProtocol(w, req.PathValue("id"), protocolReq.Protocol)
+}
+
+// switchProtocol asks a client to switch protocols and writes the result
+func (r *Router) switchProtocol(w http.ResponseWriter, clientID, protocol string) {
 	// Get the client from the client manager
-	client, err := r.clientManager.GetClient(switchReq.ClientID)
+	client, err := r.clientManager.GetClient(clientID)
 	if err != nil {
 		writeError(w, fmt.Sprintf("Client not found: %v", err), http.StatusNotFound)
 		return
 	}
 	
 	// Send protocol switch command to the client
-	err = client.SwitchProtocol(switchReq.Protocol)
+	err = client.SwitchProtocol(protocol)
 	if err != nil {
 		writeError(w, fmt.Sprintf("Failed to switch protocol: %v", err), http.StatusInternalServerError)
 		return
 	}
 	
-	writeJSON(w, map[string]string{
-		"status": "success",
-		"message": "Protocol switch initiated",
-	}, http.StatusOK)
+	writeMessage(w, "Protocol switch initiated")
 }
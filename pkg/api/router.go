@@ -2,14 +2,21 @@ package api
 
 import (
 	"context"
+	"crypto/x509"
 	"encoding/json"
 	"fmt"
 	"net/http"
 	"strings"
+	"time"
 	
 	"dinoc2/pkg/api/middleware"
+	"dinoc2/pkg/audit"
+	"dinoc2/pkg/auth"
 	"dinoc2/pkg/client"
+	"dinoc2/pkg/engagement"
+	"dinoc2/pkg/events"
 	"dinoc2/pkg/listener"
+	"dinoc2/pkg/metrics"
 	"dinoc2/pkg/module/manager"
 	"dinoc2/pkg/task"
 )
@@ -20,8 +27,19 @@ type Router struct {
 	moduleManager   *manager.ModuleManager
 	taskManager     *task.Manager
 	clientManager   *client.Manager
-	routes          map[string]http.HandlerFunc
+	mux             *http.ServeMux
+	routes          []route
 	authMiddleware  *middleware.AuthMiddleware
+	auditLogger     *audit.Logger
+	engagement      *engagement.Engagement
+	eventBus        *events.Bus
+	configReloader  func() (*listener.ReloadResult, error)
+	metricsToken    string
+	requestDuration *metrics.HistogramVec
+	requestsTotal   *metrics.CounterVec
+
+	requireClientCert bool
+	isRevoked         func(*x509.Certificate) bool
 }
 
 // NewRouter creates a new API router
@@ -31,9 +49,10 @@ func NewRouter(listenerManager *listener.Manager, moduleManager *manager.ModuleM
 		moduleManager:   moduleManager,
 		taskManager:     taskManager,
 		clientManager:   clientManager,
-		routes:          make(map[string]http.HandlerFunc),
+		mux:             http.NewServeMux(),
 		authMiddleware:  authMiddleware,
 	}
+	r.requestDuration, r.requestsTotal = newRequestMetrics()
 	
 	// Register routes
 	r.registerRoutes()
@@ -52,101 +71,230 @@ func NewRouterWithoutAuth(listenerManager *listener.Manager, moduleManager *mana
 	return NewRouter(listenerManager, moduleManager, taskManager, clientManager, nil)
 }
 
-// registerRoutes registers all API routes
-func (r *Router) registerRoutes() {
-	// Listener routes
-	r.routes["/api/listeners"] = r.handleListListeners
-	r.routes["/api/listeners/create"] = r.handleCreateListener
-	r.routes["/api/listeners/delete"] = r.handleDeleteListener
-	r.routes["/api/listeners/status"] = r.handleListenerStatus
-	
-	// Task routes
-	r.routes["/api/tasks"] = r.handleListTasks
-	r.routes["/api/tasks/create"] = r.handleCreateTask
-	r.routes["/api/tasks/status"] = r.handleTaskStatus
-	
-	// Documentation route
-	r.routes["/api/docs"] = r.handleDocs
-	
-	// Module routes
-	r.routes["/api/modules"] = r.handleListModules
-	r.routes["/api/modules/load"] = r.handleLoadModule
-	r.routes["/api/modules/exec"] = r.handleExecModule
-	
-	// Client routes
-	r.routes["/api/clients"] = r.handleListClients
-	r.routes["/api/clients/tasks"] = r.handleClientTasks
-	
-	// Protocol switching routes
-	r.routes["/api/protocol/switch"] = r.handleProtocolSwitch
+// handle registers a route. Versioned routes are matched on method and path;
+// legacy routes are matched on path only and check the method themselves.
+func (r *Router) handle(rt route) {
+	pattern := rt.path
+	if !rt.legacy {
+		pattern = rt.method + " " + rt.path
+	}
+	r.mux.Handle(pattern, r.authorize(rt))
+	r.routes = append(r.routes, rt)
 }
 
 // ServeHTTP implements the http.Handler interface
 func (r *Router) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	start := time.Now()
+	recorder := &statusRecorder{ResponseWriter: w}
+	
+	if r.auditLogger != nil {
+		r.serveAudited(recorder, req)
+	} else {
+		r.serveHTTP(recorder, req)
+	}
+	
+	r.observeRequest(req, recorder, time.Since(start))
+}
+
+// serveHTTP dispatches a request to the route that matches its method and path
+func (r *Router) serveHTTP(w http.ResponseWriter, req *http.Request) {
 	// Set common headers
 	w.Header().Set("Content-Type", "application/json")
 	w.Header().Set("Server", "Microsoft-IIS/10.0")
 	
-	// Skip authentication for login and refresh endpoints
-	if req.URL.Path == "/api/auth/login" || req.URL.Path == "/api/auth/refresh" {
-		// Find handler for the requested path
-		for path, handler := range r.routes {
-			if strings.HasPrefix(req.URL.Path, path) {
-				handler(w, req)
-				return
-			}
-		}
-		
-		// No handler found, return 404
-		http.NotFound(w, req)
-		return
+	if strings.HasPrefix(req.URL.Path, apiV1Prefix) {
+		w = &v1Writer{ResponseWriter: w}
 	}
 	
-	// Apply authentication middleware if available
-	if r.authMiddleware != nil {
-		// Skip authentication for login, refresh, and docs endpoints
-		if req.URL.Path == "/api/auth/login" || req.URL.Path == "/api/auth/refresh" || req.URL.Path == "/api/docs" {
-			// Allow these endpoints without authentication
-		} else {
-			// Get the Authorization header
-			authHeader := req.Header.Get("Authorization")
-			if authHeader == "" {
-				writeError(w, "Authorization header required", http.StatusUnauthorized)
-				return
-			}
-			
-			// Check if the Authorization header has the correct format
-			if !strings.HasPrefix(authHeader, "Bearer ") {
-				writeError(w, "Invalid authorization format", http.StatusUnauthorized)
-				return
-			}
-			
-			// Extract the token
-			tokenString := strings.TrimPrefix(authHeader, "Bearer ")
-			
-			// Validate the token
-			_, claims, err := r.authMiddleware.ValidateToken(tokenString)
-			if err != nil {
-				writeError(w, fmt.Sprintf("Invalid token: %v", err), http.StatusUnauthorized)
-				return
-			}
-			
-			// Add claims to the request context
-			ctx := context.WithValue(req.Context(), "claims", claims)
-			req = req.WithContext(ctx)
+	// Requests that match no route get a JSON error instead of the plain text
+	// one written by the mux
+	if handler, pattern := r.mux.Handler(req); pattern == "" {
+		recorder := &discardWriter{header: make(http.Header)}
+		handler.ServeHTTP(recorder, req)
+		if recorder.status == http.StatusMethodNotAllowed {
+			w.Header().Set("Allow", recorder.header.Get("Allow"))
+			writeError(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
 		}
+		writeError(w, "Not found", http.StatusNotFound)
+		return
 	}
 	
-	// Find handler for the requested path
-	for path, handler := range r.routes {
-		if strings.HasPrefix(req.URL.Path, path) {
-			handler(w, req)
+	r.mux.ServeHTTP(w, req)
+}
+
+// authorize wraps a route's handler with authentication and the permission check
+func (r *Router) authorize(rt route) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		// With mutual TLS, every request must come with a verified client
+		// certificate that has not been revoked
+		certUser, ok := r.checkClientCertificate(w, req)
+		if !ok {
+			return
+		}
+		
+		if r.authMiddleware == nil || rt.public {
+			rt.handler(w, req)
+			return
+		}
+		
+		// Get the Authorization header
+		authHeader := req.Header.Get("Authorization")
+		
+		// Browsers cannot set headers on an event stream, so it also accepts the token as a parameter
+		if authHeader == "" && rt.tokenParam && req.URL.Query().Get("token") != "" {
+			authHeader = "Bearer " + req.URL.Query().Get("token")
+		}
+		
+		if authHeader == "" {
+			writeError(w, "Authorization header required", http.StatusUnauthorized)
+			return
+		}
+		
+		// Check if the Authorization header has the correct format
+		if !strings.HasPrefix(authHeader, "Bearer ") {
+			writeError(w, "Invalid authorization format", http.StatusUnauthorized)
+			return
+		}
+		
+		// Extract the token
+		tokenString := strings.TrimPrefix(authHeader, "Bearer ")
+		
+		// Validate the token
+		_, claims, err := r.authMiddleware.ValidateToken(tokenString)
+		if err != nil {
+			writeError(w, fmt.Sprintf("Invalid token: %v", err), http.StatusUnauthorized)
+			return
+		}
+		
+		// A stolen token cannot be used with another operator's certificate
+		if certUser != "" && certUser != claims.Username {
+			writeError(w, "Client certificate does not belong to the token's operator", http.StatusUnauthorized)
+			return
+		}
+		
+		// Use the operator's current role so that role changes, disabled
+		// accounts and deletions take effect without waiting for token expiry
+		user, err := auth.GetUserStore().GetUser(claims.Username)
+		if err != nil || user.Disabled {
+			writeError(w, "User account is not active", http.StatusUnauthorized)
 			return
 		}
+		claims.Role = user.Role
+		setAuditOperator(req, claims.Username, claims.Role)
+		
+		// Check that the operator's role grants access to this route
+		if rt.permission != "" && !auth.HasPermission(claims.Role, rt.permission) {
+			writeError(w, fmt.Sprintf("Permission %s required", rt.permission), http.StatusForbidden)
+			return
+		}
+		
+		// Add claims to the request context
+		ctx := context.WithValue(req.Context(), "claims", claims)
+		rt.handler(w, req.WithContext(ctx))
+	})
+}
+
+// getClaims returns the JWT claims attached to the request, if any
+func getClaims(req *http.Request) *middleware.Claims {
+	claims, _ := req.Context().Value("claims").(*middleware.Claims)
+	return claims
+}
+
+// requestOperator returns the name of the operator who made the request, or
+// an empty string if authentication is disabled
+func requestOperator(req *http.Request) string {
+	if claims := getClaims(req); claims != nil {
+		return claims.Username
+	}
+	return ""
+}
+
+// discardWriter records the status and headers of a response and discards its body
+type discardWriter struct {
+	header http.Header
+	status int
+}
+
+// Header implements http.ResponseWriter
+func (w *discardWriter) Header() http.Header {
+	return w.header
+}
+
+// Write implements http.ResponseWriter
+func (w *discardWriter) Write(data []byte) (int, error) {
+	return len(data), nil
+}
+
+// WriteHeader implements http.ResponseWriter
+func (w *discardWriter) WriteHeader(statusCode int) {
+	w.status = statusCode
+}
+
+// v1Writer marks the response to an /api/v1 request, whose errors use the
+// structured error body
+type v1Writer struct {
+	http.ResponseWriter
+}
+
+// Flush implements http.Flusher when the underlying writer supports it
+func (w *v1Writer) Flush() {
+	if flusher, ok := w.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+// Error codes returned in the body of /api/v1 error responses
+const (
+	ErrCodeInvalidRequest   = "invalid_request"
+	ErrCodeUnauthorized     = "unauthorized"
+	ErrCodeForbidden        = "forbidden"
+	ErrCodeNotFound         = "not_found"
+	ErrCodeMethodNotAllowed = "method_not_allowed"
+	ErrCodeConflict         = "conflict"
+	ErrCodeTaskRefused      = "task_refused"
+	ErrCodeQueueFull        = "queue_full"
+	ErrCodeInvalidCommand   = "invalid_command"
+	ErrCodeClientLocked     = "client_locked"
+	ErrCodeApprovalRequired = "approval_required"
+	ErrCodeInternal         = "internal_error"
+)
+
+// ErrorResponse is the body of an /api/v1 error response
+type ErrorResponse struct {
+	Error ErrorDetail `json:"error"`
+}
+
+// ErrorDetail describes an API error
+type ErrorDetail struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+// MessageResponse is the body of a successful request that returns no data
+type MessageResponse struct {
+	Status  string `json:"status"`
+	Message string `json:"message"`
+}
+
+// errorCode returns the default error code for an HTTP status
+func errorCode(statusCode int) string {
+	switch statusCode {
+	case http.StatusBadRequest:
+		return ErrCodeInvalidRequest
+	case http.StatusUnauthorized:
+		return ErrCodeUnauthorized
+	case http.StatusForbidden:
+		return ErrCodeForbidden
+	case http.StatusNotFound:
+		return ErrCodeNotFound
+	case http.StatusMethodNotAllowed:
+		return ErrCodeMethodNotAllowed
+	case http.StatusConflict:
+		return ErrCodeConflict
+	default:
+		return ErrCodeInternal
 	}
-	
-	// No handler found, return 404
-	http.NotFound(w, req)
 }
 
 // writeJSON writes a JSON response
@@ -155,7 +303,22 @@ func writeJSON(w http.ResponseWriter, data interface{}, statusCode int) {
 	json.NewEncoder(w).Encode(data)
 }
 
-// writeError writes an error response
+// writeMessage writes a success response that carries only a message
+func writeMessage(w http.ResponseWriter, message string) {
+	writeJSON(w, MessageResponse{Status: "success", Message: message}, http.StatusOK)
+}
+
+// writeError writes an error response with the default code for its status
 func writeError(w http.ResponseWriter, message string, statusCode int) {
+	writeErrorCode(w, errorCode(statusCode), message, statusCode)
+}
+
+// writeErrorCode writes an error response. Responses to /api/v1 requests carry
+// the error code; legacy responses only carry the message.
+func writeErrorCode(w http.ResponseWriter, code, message string, statusCode int) {
+	if _, ok := w.(*v1Writer); ok {
+		writeJSON(w, ErrorResponse{Error: ErrorDetail{Code: code, Message: message}}, statusCode)
+		return
+	}
 	writeJSON(w, map[string]string{"error": message}, statusCode)
 }
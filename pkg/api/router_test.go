@@ -0,0 +1,211 @@
+package api
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"dinoc2/pkg/client"
+	"dinoc2/pkg/listener"
+	"dinoc2/pkg/task"
+)
+
+func newTestRouter() *Router {
+	clientManager := client.NewManager()
+	return NewRouterWithoutAuth(listener.NewManager(clientManager), nil, task.NewManager(), clientManager)
+}
+
+func TestV1RoutesMatchMethodAndPath(t *testing.T) {
+	router := newTestRouter()
+
+	newTask, err := router.taskManager.CreateTask(task.TaskTypeCommand, "client-1", []byte("whoami"), task.TaskPriorityNormal, nil)
+	if err != nil {
+		t.Fatalf("Failed to create task: %v", err)
+	}
+
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/v1/tasks/1", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected 200, got %d: %s", rec.Code, rec.Body.String())
+	}
+	var got task.Task
+	if err := json.NewDecoder(rec.Body).Decode(&got); err != nil || got.ID != newTask.ID {
+		t.Errorf("Unexpected task: %+v (%v)", got, err)
+	}
+
+	// Unknown tasks, unknown paths and wrong methods get structured errors
+	for _, tc := range []struct {
+		method, path string
+		status       int
+		code         string
+	}{
+		{http.MethodGet, "/api/v1/tasks/42", http.StatusNotFound, ErrCodeNotFound},
+		{http.MethodGet, "/api/v1/tasks/abc", http.StatusBadRequest, ErrCodeInvalidRequest},
+		{http.MethodGet, "/api/v1/nothing", http.StatusNotFound, ErrCodeNotFound},
+		{http.MethodPut, "/api/v1/tasks/1", http.StatusMethodNotAllowed, ErrCodeMethodNotAllowed},
+		{http.MethodDelete, "/api/v1/listeners/missing", http.StatusNotFound, ErrCodeNotFound},
+	} {
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, httptest.NewRequest(tc.method, tc.path, nil))
+
+		var body ErrorResponse
+		json.NewDecoder(rec.Body).Decode(&body)
+		if rec.Code != tc.status || body.Error.Code != tc.code || body.Error.Message == "" {
+			t.Errorf("%s %s: expected %d %s, got %d %+v", tc.method, tc.path, tc.status, tc.code, rec.Code, body)
+		}
+	}
+}
+
+func TestLegacyRoutesKeepErrorFormat(t *testing.T) {
+	router := newTestRouter()
+
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/tasks/status?id=42", nil))
+
+	var body map[string]string
+	if err := json.NewDecoder(rec.Body).Decode(&body); err != nil || body["error"] == "" {
+		t.Errorf("Expected a legacy error body, got %q (%v)", rec.Body.String(), err)
+	}
+
+	// Paths are no longer matched by prefix
+	rec = httptest.NewRecorder()
+	router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/tasks/anything", nil))
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("Expected 404 for an unregistered path, got %d", rec.Code)
+	}
+}
+
+func TestLegacyScheduleRoutes(t *testing.T) {
+	router := newTestRouter()
+
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/api/schedules/create",
+		strings.NewReader(`{"client_id": "client-1", "type": "command", "data": "whoami", "interval": 3600}`)))
+	var created task.Schedule
+	if err := json.NewDecoder(rec.Body).Decode(&created); err != nil || rec.Code != http.StatusOK || created.ID == 0 {
+		t.Fatalf("Failed to create schedule: %d %+v (%v)", rec.Code, created, err)
+	}
+
+	rec = httptest.NewRecorder()
+	router.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/api/schedules/pause", strings.NewReader(`{"id": 1}`)))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected 200 when pausing, got %d: %s", rec.Code, rec.Body.String())
+	}
+
+	rec = httptest.NewRecorder()
+	router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/schedules/status?id=1", nil))
+	var got task.Schedule
+	if err := json.NewDecoder(rec.Body).Decode(&got); err != nil || !got.Paused {
+		t.Errorf("Expected a paused schedule, got %+v (%v)", got, err)
+	}
+
+	rec = httptest.NewRecorder()
+	router.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/api/schedules/delete", strings.NewReader(`{"id": 1}`)))
+	if rec.Code != http.StatusOK {
+		t.Errorf("Expected 200 when deleting, got %d: %s", rec.Code, rec.Body.String())
+	}
+}
+
+func TestOpenAPIDescribesRoutes(t *testing.T) {
+	router := newTestRouter()
+
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/v1/openapi.json", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected 200, got %d", rec.Code)
+	}
+
+	var spec struct {
+		Paths      map[string]map[string]json.RawMessage `json:"paths"`
+		Components struct {
+			Schemas map[string]json.RawMessage `json:"schemas"`
+		} `json:"components"`
+	}
+	if err := json.NewDecoder(rec.Body).Decode(&spec); err != nil {
+		t.Fatalf("Invalid document: %v", err)
+	}
+
+	if _, exists := spec.Paths["/api/v1/tasks/{id}"]["get"]; !exists {
+		t.Error("Missing GET /api/v1/tasks/{id}")
+	}
+	if _, exists := spec.Paths["/api/v1/listeners/{id}"]["delete"]; !exists {
+		t.Error("Missing DELETE /api/v1/listeners/{id}")
+	}
+	if operation := spec.Paths["/api/tasks"]["get"]; !strings.Contains(string(operation), `"deprecated":true`) {
+		t.Error("Legacy routes should be marked deprecated")
+	}
+	if _, exists := spec.Components.Schemas["task.Task"]; !exists {
+		t.Error("Missing task.Task schema")
+	}
+}
+
+func TestClientCertificateRequired(t *testing.T) {
+	router := newTestRouter()
+	router.SetClientCertificateRequired(true)
+
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/v1/tasks", nil))
+	if rec.Code != http.StatusUnauthorized {
+		t.Errorf("Expected 401 without a client certificate, got %d", rec.Code)
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/api/v1/tasks", nil)
+	req.TLS = &tls.ConnectionState{VerifiedChains: [][]*x509.Certificate{{{Subject: pkix.Name{CommonName: "alice"}}}}}
+	rec = httptest.NewRecorder()
+	router.ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Errorf("Expected 200 with a verified client certificate, got %d", rec.Code)
+	}
+}
+
+func TestRevokedClientCertificateIsRejected(t *testing.T) {
+	router := newTestRouter()
+	router.SetClientCertificateRequired(true)
+	router.SetMetricsToken("scrape")
+	revoked := map[string]bool{}
+	router.SetRevocationCheck(func(cert *x509.Certificate) bool { return revoked[cert.SerialNumber.Text(16)] })
+
+	request := func(path, token string, cert *x509.Certificate) int {
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		if cert != nil {
+			req.TLS = &tls.ConnectionState{
+				PeerCertificates: []*x509.Certificate{cert},
+				VerifiedChains:   [][]*x509.Certificate{{cert}},
+			}
+		}
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, req)
+		return rec.Code
+	}
+
+	cert := &x509.Certificate{SerialNumber: big.NewInt(42), Subject: pkix.Name{CommonName: "alice"}}
+	if code := request("/api/v1/tasks", "", cert); code != http.StatusOK {
+		t.Errorf("Expected 200 before the certificate is revoked, got %d", code)
+	}
+	if code := request("/metrics", "scrape", cert); code != http.StatusOK {
+		t.Errorf("Expected the metrics token to be accepted with a certificate, got %d", code)
+	}
+
+	// The metrics token does not stand in for a client certificate
+	if code := request("/metrics", "scrape", nil); code != http.StatusUnauthorized {
+		t.Errorf("Expected 401 for the metrics token without a certificate, got %d", code)
+	}
+
+	// A certificate revoked after the handshake is rejected on the next request
+	revoked["2a"] = true
+	if code := request("/api/v1/tasks", "", cert); code != http.StatusUnauthorized {
+		t.Errorf("Expected 401 once the certificate is revoked, got %d", code)
+	}
+	if code := request("/metrics", "scrape", cert); code != http.StatusUnauthorized {
+		t.Errorf("Expected 401 for the metrics token once the certificate is revoked, got %d", code)
+	}
+}
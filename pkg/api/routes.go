@@ -0,0 +1,382 @@
+package api
+
+import (
+	"net/http"
+
+	"dinoc2/pkg/auth"
+	"dinoc2/pkg/client"
+	"dinoc2/pkg/engagement"
+	"dinoc2/pkg/events"
+	"dinoc2/pkg/listener"
+	"dinoc2/pkg/module"
+	"dinoc2/pkg/module/manager"
+	"dinoc2/pkg/task"
+)
+
+// apiV1Prefix is the path prefix of the versioned API
+const apiV1Prefix = "/api/v1/"
+
+// route describes an API endpoint. The route table drives both request
+// dispatch and the generated OpenAPI document.
+type route struct {
+	method      string
+	path        string          // may contain {name} wildcards
+	permission  auth.Permission // empty means any authenticated user
+	public      bool            // no authentication required
+	tokenParam  bool            // the token may also be passed as a query parameter
+	legacy      bool            // unversioned route kept for existing clients
+	tag         string
+	summary     string
+	query       []param
+	request     interface{} // example of the request body, nil if there is none
+	response    interface{} // example of the success response
+	contentType string      // response content type when it is not JSON
+	handler     http.HandlerFunc
+}
+
+// param describes a path or query parameter
+type param struct {
+	name        string
+	description string
+	required    bool
+}
+
+// registerRoutes registers all API routes
+func (r *Router) registerRoutes() {
+	for _, rt := range r.v1Routes() {
+		r.handle(rt)
+	}
+	for _, rt := range r.legacyRoutes() {
+		rt.legacy = true
+		r.handle(rt)
+	}
+}
+
+// v1Routes returns the routes of the versioned API
+func (r *Router) v1Routes() []route {
+	return []route{
+		// Listener routes
+		{method: http.MethodGet, path: "/api/v1/listeners", permission: auth.PermListenersRead, tag: "listeners",
+			summary: "List listeners and their status", response: map[string]listener.ListenerStatus{},
+			handler: r.handleListListeners},
+		{method: http.MethodPost, path: "/api/v1/listeners", permission: auth.PermListenersWrite, tag: "listeners",
+			summary: "Create and start a listener", request: ListenerRequest{}, response: MessageResponse{},
+			handler: r.handleCreateListener},
+		{method: http.MethodGet, path: "/api/v1/listeners/types", permission: auth.PermListenersRead, tag: "listeners",
+			summary: "List the listener types with their configuration schema and capabilities", response: []listener.Registration{},
+			handler: r.handleListenerTypes},
+		{method: http.MethodGet, path: "/api/v1/listeners/{id}", permission: auth.PermListenersRead, tag: "listeners",
+			summary: "Get a listener", response: ListenerInfo{},
+			handler: r.handleGetListener},
+		{method: http.MethodDelete, path: "/api/v1/listeners/{id}", permission: auth.PermListenersWrite, tag: "listeners",
+			summary: "Delete a stopped listener", response: MessageResponse{},
+			handler: r.handleRemoveListener},
+		{method: http.MethodPost, path: "/api/v1/listeners/{id}/start", permission: auth.PermListenersWrite, tag: "listeners",
+			summary: "Start a listener", response: MessageResponse{},
+			handler: r.handleStartListener},
+		{method: http.MethodPost, path: "/api/v1/listeners/{id}/stop", permission: auth.PermListenersWrite, tag: "listeners",
+			summary: "Stop a listener", response: MessageResponse{},
+			handler: r.handleStopListener},
+
+		// Task routes
+		{method: http.MethodGet, path: "/api/v1/tasks", permission: auth.PermTasksRead, tag: "tasks",
+			summary: "List tasks", response: []task.Task{},
+			query: []param{
+				{name: "client_id", description: "Only list the tasks of this client"},
+				{name: "status", description: "Only list the tasks in this status, such as awaiting_approval"},
+			},
+			handler: r.handleListTasks},
+		{method: http.MethodPost, path: "/api/v1/tasks", permission: auth.PermTasksWrite, tag: "tasks",
+			summary: "Create a task", request: TaskRequest{}, response: task.Task{},
+			handler: r.handleCreateTask},
+		{method: http.MethodGet, path: "/api/v1/tasks/queue", permission: auth.PermTasksRead, tag: "tasks",
+			summary: "Get the depth of the task queues", response: task.QueueStats{},
+			handler: r.handleQueueStats},
+		{method: http.MethodGet, path: "/api/v1/tasks/cleanup", permission: auth.PermTasksRead, tag: "tasks",
+			summary: "Get the report of which clients cleaned up and exited", response: task.CleanupReport{},
+			handler: r.handleCleanupReport},
+		{method: http.MethodGet, path: "/api/v1/tasks/{id}", permission: auth.PermTasksRead, tag: "tasks",
+			summary: "Get a task", response: task.Task{},
+			handler: r.handleGetTask},
+		{method: http.MethodPost, path: "/api/v1/tasks/{id}/cancel", permission: auth.PermTasksWrite, tag: "tasks",
+			summary: "Cancel a pending or running task", request: TaskCancelReason{}, response: task.Task{},
+			handler: r.handleCancelTaskByID},
+		{method: http.MethodPost, path: "/api/v1/tasks/{id}/approve", permission: auth.PermTasksApprove, tag: "tasks",
+			summary: "Approve a task created by another operator, which starts it", response: task.Task{},
+			handler: r.handleApproveTask},
+		{method: http.MethodPost, path: "/api/v1/tasks/{id}/reject", permission: auth.PermTasksApprove, tag: "tasks",
+			summary: "Reject a task awaiting approval, which cancels it", request: TaskCancelReason{}, response: task.Task{},
+			handler: r.handleRejectTask},
+
+		// Playbook routes
+		{method: http.MethodGet, path: "/api/v1/playbooks", permission: auth.PermTasksRead, tag: "playbooks",
+			summary: "List playbook runs", response: []task.PlaybookRun{},
+			handler: r.handleListPlaybookRuns},
+		{method: http.MethodPost, path: "/api/v1/playbooks", permission: auth.PermTasksWrite, tag: "playbooks",
+			summary: "Run a playbook against a client", request: PlaybookRequest{}, response: task.PlaybookRun{},
+			handler: r.handleRunPlaybook},
+		{method: http.MethodGet, path: "/api/v1/playbooks/{id}", permission: auth.PermTasksRead, tag: "playbooks",
+			summary: "Get a playbook run and the status of its steps", response: task.PlaybookRun{},
+			handler: r.handleGetPlaybookRun},
+		{method: http.MethodPost, path: "/api/v1/playbooks/{id}/cancel", permission: auth.PermTasksWrite, tag: "playbooks",
+			summary: "Cancel the steps of a playbook run that have not finished", response: task.PlaybookRun{},
+			handler: r.handleCancelPlaybookRun},
+
+		// Schedule routes
+		{method: http.MethodGet, path: "/api/v1/schedules", permission: auth.PermTasksRead, tag: "schedules",
+			summary: "List schedules", response: []task.Schedule{},
+			handler: r.handleListSchedules},
+		{method: http.MethodPost, path: "/api/v1/schedules", permission: auth.PermTasksWrite, tag: "schedules",
+			summary: "Create a schedule that creates a task on a cron expression or at an interval", request: task.Schedule{}, response: task.Schedule{},
+			handler: r.handleCreateSchedule},
+		{method: http.MethodGet, path: "/api/v1/schedules/{id}", permission: auth.PermTasksRead, tag: "schedules",
+			summary: "Get a schedule", response: task.Schedule{},
+			handler: r.handleGetSchedule},
+		{method: http.MethodDelete, path: "/api/v1/schedules/{id}", permission: auth.PermTasksWrite, tag: "schedules",
+			summary: "Delete a schedule", response: MessageResponse{},
+			handler: r.handleDeleteSchedule},
+		{method: http.MethodPost, path: "/api/v1/schedules/{id}/pause", permission: auth.PermTasksWrite, tag: "schedules",
+			summary: "Pause a schedule", response: task.Schedule{},
+			handler: r.handlePauseSchedule},
+		{method: http.MethodPost, path: "/api/v1/schedules/{id}/resume", permission: auth.PermTasksWrite, tag: "schedules",
+			summary: "Resume a paused schedule", response: task.Schedule{},
+			handler: r.handleResumeSchedule},
+
+		// Client routes
+		{method: http.MethodGet, path: "/api/v1/clients", permission: auth.PermClientsRead, tag: "clients",
+			summary: "List clients", response: []ClientInfo{}, query: clientQueryParams,
+			handler: r.handleListClientInfo},
+		{method: http.MethodGet, path: "/api/v1/clients/{id}/checkins", permission: auth.PermClientsRead, tag: "clients",
+			summary: "Get the recent check-ins of a client, oldest first", response: []client.CheckIn{},
+			handler: r.handleGetClientCheckIns},
+		{method: http.MethodGet, path: "/api/v1/clients/{id}/tags", permission: auth.PermClientsRead, tag: "clients",
+			summary: "Get the tags of a client", response: map[string]string{},
+			handler: r.handleGetClientTags},
+		{method: http.MethodPatch, path: "/api/v1/clients/{id}/tags", permission: auth.PermClientsWrite, tag: "clients",
+			summary: "Add or change tags of a client; an empty value removes the tag", request: map[string]string{}, response: map[string]string{},
+			handler: r.handleSetClientTags},
+		{method: http.MethodDelete, path: "/api/v1/clients/{id}/tags/{key}", permission: auth.PermClientsWrite, tag: "clients",
+			summary: "Remove a tag from a client", response: map[string]string{},
+			handler: r.handleDeleteClientTag},
+		{method: http.MethodGet, path: "/api/v1/clients/{id}/notes", permission: auth.PermClientsRead, tag: "clients",
+			summary: "Get the notes attached to a client, oldest first", response: []client.Note{},
+			handler: r.handleGetClientNotes},
+		{method: http.MethodPost, path: "/api/v1/clients/{id}/notes", permission: auth.PermClientsWrite, tag: "clients",
+			summary: "Attach a note to a client", request: NoteRequest{}, response: client.Note{},
+			handler: r.handleAddClientNote},
+		{method: http.MethodGet, path: "/api/v1/clients/{id}/lock", permission: auth.PermClientsRead, tag: "clients",
+			summary: "Get the lock held on a client", response: client.Lock{},
+			handler: r.handleGetClientLock},
+		{method: http.MethodPost, path: "/api/v1/clients/{id}/lock", permission: auth.PermClientsWrite, tag: "clients",
+			summary: "Take or renew a time-limited lock on a client", request: LockRequest{}, response: client.Lock{},
+			handler: r.handleLockClient},
+		{method: http.MethodDelete, path: "/api/v1/clients/{id}/lock", permission: auth.PermClientsWrite, tag: "clients",
+			summary: "Release the lock on a client", response: MessageResponse{},
+			query: unlockQueryParams, handler: r.handleUnlockClient},
+		{method: http.MethodGet, path: "/api/v1/clients/{id}/tasks", permission: auth.PermClientsRead, tag: "clients",
+			summary: "List the tasks of a client", response: []task.Task{},
+			handler: r.handleGetClientTasks},
+		{method: http.MethodPost, path: "/api/v1/clients/{id}/protocol", permission: auth.PermClientsWrite, tag: "clients",
+			summary: "Switch the protocol a client uses", request: ProtocolRequest{}, response: MessageResponse{},
+			handler: r.handleSwitchClientProtocol},
+
+		// Module routes
+		{method: http.MethodGet, path: "/api/v1/modules", permission: auth.PermModulesRead, tag: "modules",
+			summary: "List loaded modules", response: map[string]manager.ModuleInfo{},
+			handler: r.handleListModules},
+		{method: http.MethodGet, path: "/api/v1/modules/commands", permission: auth.PermModulesRead, tag: "modules",
+			summary: "List the commands and arguments each module accepts, by module name", response: map[string][]module.Command{},
+			handler: r.handleListModuleCommands},
+		{method: http.MethodPost, path: "/api/v1/modules", permission: auth.PermModulesWrite, tag: "modules",
+			summary: "Load a module", request: ModuleLoadRequest{},
+			handler: r.handleLoadModule},
+		{method: http.MethodPost, path: "/api/v1/modules/{name}/exec", permission: auth.PermModulesWrite, tag: "modules",
+			summary: "Execute a module command", request: ModuleCommandRequest{},
+			handler: r.handleExecModuleCommand},
+
+		// User management routes
+		{method: http.MethodGet, path: "/api/v1/users", permission: auth.PermUsersManage, tag: "users",
+			summary: "List operator accounts", response: []auth.UserAuth{},
+			handler: r.handleListUsers},
+		{method: http.MethodPost, path: "/api/v1/users", permission: auth.PermUsersManage, tag: "users",
+			summary: "Create an operator account", request: UserRequest{}, response: MessageResponse{},
+			handler: r.handleCreateUser},
+		{method: http.MethodPatch, path: "/api/v1/users/{username}", permission: auth.PermUsersManage, tag: "users",
+			summary: "Update an operator's password, role or disabled flag", request: auth.UserUpdate{}, response: MessageResponse{},
+			handler: r.handlePatchUser},
+		{method: http.MethodDelete, path: "/api/v1/users/{username}", permission: auth.PermUsersManage, tag: "users",
+			summary: "Delete an operator account", response: MessageResponse{},
+			handler: r.handleRemoveUser},
+
+		// Audit log routes
+		{method: http.MethodGet, path: "/api/v1/audit", permission: auth.PermAuditRead, tag: "audit",
+			summary: "Query the audit log", response: AuditQueryResponse{}, query: auditQueryParams,
+			handler: r.handleAuditQuery},
+
+		// Engagement routes
+		{method: http.MethodGet, path: "/api/v1/engagement", tag: "engagement",
+			summary: "Get the engagement window and whether it is pending, active or closed", response: engagement.Status{},
+			handler: r.handleEngagementStatus},
+
+		// Configuration routes
+		{method: http.MethodPost, path: "/api/v1/config/reload", permission: auth.PermConfigReload, tag: "config",
+			summary: "Reload the listeners from the configuration file, changing only those that changed", response: listener.ReloadResult{},
+			handler: r.handleReloadConfig},
+
+		// Event stream routes
+		{method: http.MethodGet, path: "/api/v1/events", tag: "events", tokenParam: true,
+			summary:  "Stream task, client, listener and module events as Server-Sent Events",
+			response: events.Event{}, contentType: "text/event-stream", query: eventQueryParams,
+			handler: r.handleEvents},
+
+		// Metrics routes, which check the metrics token or the metrics:read permission themselves
+		{method: http.MethodGet, path: "/metrics", public: true, tag: "metrics",
+			summary:     "Get listener, task, session, client and API metrics in the Prometheus text format",
+			contentType: "text/plain", handler: r.handleMetrics},
+
+		// Documentation routes
+		{method: http.MethodGet, path: "/api/v1/openapi.json", public: true, tag: "docs",
+			summary: "Get the OpenAPI document of the API",
+			handler: r.handleOpenAPI},
+	}
+}
+
+// legacyRoutes returns the unversioned routes, which are kept for existing clients
+func (r *Router) legacyRoutes() []route {
+	return []route{
+		// Listener routes
+		{method: http.MethodGet, path: "/api/listeners", permission: auth.PermListenersRead, tag: "listeners",
+			summary: "List listeners", response: map[string]listener.ListenerStatus{},
+			handler: r.handleListListeners},
+		{method: http.MethodPost, path: "/api/listeners/create", permission: auth.PermListenersWrite, tag: "listeners",
+			summary: "Create a listener", request: ListenerRequest{}, response: MessageResponse{},
+			handler: r.handleCreateListener},
+		{method: http.MethodGet, path: "/api/listeners/types", permission: auth.PermListenersRead, tag: "listeners",
+			summary: "List listener types", response: []listener.Registration{},
+			handler: r.handleListenerTypes},
+		{method: http.MethodPost, path: "/api/listeners/delete", permission: auth.PermListenersWrite, tag: "listeners",
+			summary: "Delete a listener", request: ListenerIDRequest{}, response: MessageResponse{},
+			handler: r.handleDeleteListener},
+		{method: http.MethodGet, path: "/api/listeners/status", permission: auth.PermListenersRead, tag: "listeners",
+			summary: "Get listener status", response: listener.StatusUnknown,
+			query:   []param{{name: "id", description: "Listener ID", required: true}},
+			handler: r.handleListenerStatus},
+
+		// Task routes
+		{method: http.MethodGet, path: "/api/tasks", permission: auth.PermTasksRead, tag: "tasks",
+			summary: "List tasks", response: []task.Task{},
+			query:   []param{{name: "client_id", description: "Only list the tasks of this client"}},
+			handler: r.handleListTasks},
+		{method: http.MethodPost, path: "/api/tasks/create", permission: auth.PermTasksWrite, tag: "tasks",
+			summary: "Create a task", request: TaskRequest{}, response: task.Task{},
+			handler: r.handleCreateTask},
+		{method: http.MethodGet, path: "/api/tasks/status", permission: auth.PermTasksRead, tag: "tasks",
+			summary: "Get a task", response: task.Task{},
+			query:   []param{{name: "id", description: "Task ID", required: true}},
+			handler: r.handleTaskStatus},
+		{method: http.MethodPost, path: "/api/tasks/cancel", permission: auth.PermTasksWrite, tag: "tasks",
+			summary: "Cancel a pending or running task", request: TaskCancelRequest{}, response: task.Task{},
+			handler: r.handleCancelTask},
+
+		// Playbook routes
+		{method: http.MethodGet, path: "/api/playbooks", permission: auth.PermTasksRead, tag: "playbooks",
+			summary: "List playbook runs", response: []task.PlaybookRun{},
+			handler: r.handleListPlaybookRuns},
+		{method: http.MethodPost, path: "/api/playbooks/run", permission: auth.PermTasksWrite, tag: "playbooks",
+			summary: "Run a playbook against a client", request: PlaybookRequest{}, response: task.PlaybookRun{},
+			handler: r.handleRunPlaybook},
+		{method: http.MethodGet, path: "/api/playbooks/status", permission: auth.PermTasksRead, tag: "playbooks",
+			summary: "Get a playbook run", response: task.PlaybookRun{},
+			query:   []param{{name: "id", description: "Playbook run ID", required: true}},
+			handler: r.handlePlaybookRunStatus},
+		{method: http.MethodPost, path: "/api/playbooks/cancel", permission: auth.PermTasksWrite, tag: "playbooks",
+			summary: "Cancel a playbook run", request: PlaybookRunIDRequest{}, response: task.PlaybookRun{},
+			handler: r.handleCancelPlaybookRunByBody},
+
+		// Schedule routes
+		{method: http.MethodGet, path: "/api/schedules", permission: auth.PermTasksRead, tag: "schedules",
+			summary: "List schedules", response: []task.Schedule{},
+			handler: r.handleListSchedules},
+		{method: http.MethodPost, path: "/api/schedules/create", permission: auth.PermTasksWrite, tag: "schedules",
+			summary: "Create a schedule", request: task.Schedule{}, response: task.Schedule{},
+			handler: r.handleCreateSchedule},
+		{method: http.MethodGet, path: "/api/schedules/status", permission: auth.PermTasksRead, tag: "schedules",
+			summary: "Get a schedule", response: task.Schedule{},
+			query:   []param{{name: "id", description: "Schedule ID", required: true}},
+			handler: r.handleScheduleStatus},
+		{method: http.MethodPost, path: "/api/schedules/pause", permission: auth.PermTasksWrite, tag: "schedules",
+			summary: "Pause a schedule", request: ScheduleIDRequest{}, response: task.Schedule{},
+			handler: r.handlePauseScheduleByBody},
+		{method: http.MethodPost, path: "/api/schedules/resume", permission: auth.PermTasksWrite, tag: "schedules",
+			summary: "Resume a paused schedule", request: ScheduleIDRequest{}, response: task.Schedule{},
+			handler: r.handleResumeScheduleByBody},
+		{method: http.MethodPost, path: "/api/schedules/delete", permission: auth.PermTasksWrite, tag: "schedules",
+			summary: "Delete a schedule", request: ScheduleIDRequest{}, response: MessageResponse{},
+			handler: r.handleDeleteScheduleByBody},
+
+		// Module routes
+		{method: http.MethodGet, path: "/api/modules", permission: auth.PermModulesRead, tag: "modules",
+			summary: "List modules", response: map[string]manager.ModuleInfo{},
+			handler: r.handleListModules},
+		{method: http.MethodPost, path: "/api/modules/load", permission: auth.PermModulesWrite, tag: "modules",
+			summary: "Load a module", request: ModuleLoadRequest{},
+			handler: r.handleLoadModule},
+		{method: http.MethodPost, path: "/api/modules/exec", permission: auth.PermModulesWrite, tag: "modules",
+			summary: "Execute a module", request: ModuleExecRequest{},
+			handler: r.handleExecModule},
+
+		// Client routes
+		{method: http.MethodGet, path: "/api/clients", permission: auth.PermClientsRead, tag: "clients",
+			summary: "List clients", response: ClientListResponse{}, query: clientQueryParams,
+			handler: r.handleListClients},
+		{method: http.MethodGet, path: "/api/clients/tasks", permission: auth.PermClientsRead, tag: "clients",
+			summary: "Get client tasks", response: []task.Task{},
+			query:   []param{{name: "client_id", description: "Client ID", required: true}},
+			handler: r.handleClientTasks},
+
+		// Protocol switching routes
+		{method: http.MethodPost, path: "/api/protocol/switch", permission: auth.PermClientsWrite, tag: "clients",
+			summary: "Switch protocol", request: ProtocolSwitchRequest{}, response: MessageResponse{},
+			handler: r.handleProtocolSwitch},
+
+		// User management routes
+		{method: http.MethodGet, path: "/api/users", permission: auth.PermUsersManage, tag: "users",
+			summary: "List operator accounts", response: []auth.UserAuth{},
+			handler: r.handleListUsers},
+		{method: http.MethodPost, path: "/api/users/create", permission: auth.PermUsersManage, tag: "users",
+			summary: "Create an operator account", request: UserRequest{}, response: MessageResponse{},
+			handler: r.handleCreateUser},
+		{method: http.MethodPost, path: "/api/users/update", permission: auth.PermUsersManage, tag: "users",
+			summary: "Update an operator account", request: UserUpdateRequest{}, response: MessageResponse{},
+			handler: r.handleUpdateUser},
+		{method: http.MethodPost, path: "/api/users/delete", permission: auth.PermUsersManage, tag: "users",
+			summary: "Delete an operator account", request: UsernameRequest{}, response: MessageResponse{},
+			handler: r.handleDeleteUser},
+
+		// Audit log routes
+		{method: http.MethodGet, path: "/api/audit", permission: auth.PermAuditRead, tag: "audit",
+			summary: "Query the audit log", response: AuditQueryResponse{}, query: auditQueryParams,
+			handler: r.handleAuditQuery},
+
+		// Engagement routes
+		{method: http.MethodGet, path: "/api/engagement", tag: "engagement",
+			summary: "Get the engagement status", response: engagement.Status{},
+			handler: r.handleEngagementStatus},
+
+		// Configuration routes
+		{method: http.MethodPost, path: "/api/config/reload", permission: auth.PermConfigReload, tag: "config",
+			summary: "Reload the listeners from the configuration file", response: listener.ReloadResult{},
+			handler: r.handleReloadConfig},
+
+		// Event stream routes
+		{method: http.MethodGet, path: "/api/events", tag: "events", tokenParam: true,
+			summary:  "Stream events as Server-Sent Events",
+			response: events.Event{}, contentType: "text/event-stream", query: eventQueryParams,
+			handler: r.handleEvents},
+
+		// Documentation route
+		{method: http.MethodGet, path: "/api/docs", public: true, tag: "docs",
+			summary: "Get the OpenAPI document of the API",
+			handler: r.handleOpenAPI},
+	}
+}
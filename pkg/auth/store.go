@@ -0,0 +1,263 @@
+package auth
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"sync"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+var (
+	// ErrUserNotFound is returned when a user does not exist
+	ErrUserNotFound = errors.New("user not found")
+	// ErrUserExists is returned when creating a user that already exists
+	ErrUserExists = errors.New("user already exists")
+	// ErrLastAdmin is returned when a change would remove the last enabled admin
+	ErrLastAdmin = errors.New("at least one enabled admin user is required")
+)
+
+// UserStore holds the operator accounts known to the server
+type UserStore struct {
+	users map[string]*UserAuth
+	path  string
+	mutex sync.RWMutex
+}
+
+// NewUserStore creates a new user store, persisted to path if it is not empty
+func NewUserStore(path string) *UserStore {
+	return &UserStore{
+		users: make(map[string]*UserAuth),
+		path:  path,
+	}
+}
+
+// Load reads the users from the store file, if one is configured and exists
+func (s *UserStore) Load() error {
+	if s.path == "" {
+		return nil
+	}
+
+	data, err := os.ReadFile(s.path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return fmt.Errorf("failed to read user store: %w", err)
+	}
+
+	var users []UserAuth
+	if err := json.Unmarshal(data, &users); err != nil {
+		return fmt.Errorf("failed to parse user store: %w", err)
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	for i := range users {
+		user := users[i]
+		user.Password = ""
+		s.users[user.Username] = &user
+	}
+
+	return nil
+}
+
+// save writes the users to the store file; the caller must hold the lock
+func (s *UserStore) save() error {
+	if s.path == "" {
+		return nil
+	}
+
+	users := make([]UserAuth, 0, len(s.users))
+	for _, user := range s.users {
+		users = append(users, *user)
+	}
+	sort.Slice(users, func(i, j int) bool { return users[i].Username < users[j].Username })
+
+	data, err := json.MarshalIndent(users, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal user store: %w", err)
+	}
+
+	tmpPath := s.path + ".tmp"
+	if err := os.WriteFile(tmpPath, data, 0600); err != nil {
+		return fmt.Errorf("failed to write user store: %w", err)
+	}
+
+	return os.Rename(tmpPath, s.path)
+}
+
+// AddUser adds a new user, hashing the plaintext password if one is given
+func (s *UserStore) AddUser(user UserAuth) error {
+	if user.Username == "" {
+		return errors.New("username is required")
+	}
+	if !ValidRole(user.Role) {
+		return fmt.Errorf("invalid role: %s", user.Role)
+	}
+
+	if user.Password != "" {
+		hash, err := HashPassword(user.Password)
+		if err != nil {
+			return fmt.Errorf("failed to hash password: %w", err)
+		}
+		user.PasswordHash = hash
+		user.Password = ""
+	}
+	if user.PasswordHash == "" {
+		return errors.New("password is required")
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if _, exists := s.users[user.Username]; exists {
+		return ErrUserExists
+	}
+
+	s.users[user.Username] = &user
+
+	return s.save()
+}
+
+// UserUpdate holds the fields that can be changed on an existing user
+type UserUpdate struct {
+	Password *string `json:"password,omitempty"`
+	Role     *string `json:"role,omitempty"`
+	Disabled *bool   `json:"disabled,omitempty"`
+}
+
+// UpdateUser applies the non-nil fields of update to the named user
+func (s *UserStore) UpdateUser(username string, update UserUpdate) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	current, exists := s.users[username]
+	if !exists {
+		return ErrUserNotFound
+	}
+
+	hadAdmin := s.hasEnabledAdmin()
+	user := *current
+	if update.Role != nil {
+		if !ValidRole(*update.Role) {
+			return fmt.Errorf("invalid role: %s", *update.Role)
+		}
+		user.Role = *update.Role
+	}
+	if update.Disabled != nil {
+		user.Disabled = *update.Disabled
+	}
+	if update.Password != nil {
+		if *update.Password == "" {
+			return errors.New("password cannot be empty")
+		}
+		hash, err := HashPassword(*update.Password)
+		if err != nil {
+			return fmt.Errorf("failed to hash password: %w", err)
+		}
+		user.PasswordHash = hash
+	}
+
+	s.users[username] = &user
+	if hadAdmin && !s.hasEnabledAdmin() {
+		s.users[username] = current
+		return ErrLastAdmin
+	}
+
+	return s.save()
+}
+
+// DeleteUser removes the named user
+func (s *UserStore) DeleteUser(username string) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	current, exists := s.users[username]
+	if !exists {
+		return ErrUserNotFound
+	}
+
+	hadAdmin := s.hasEnabledAdmin()
+	delete(s.users, username)
+	if hadAdmin && !s.hasEnabledAdmin() {
+		s.users[username] = current
+		return ErrLastAdmin
+	}
+
+	return s.save()
+}
+
+// hasEnabledAdmin reports whether any enabled admin remains; the caller must hold the lock
+func (s *UserStore) hasEnabledAdmin() bool {
+	for _, user := range s.users {
+		if user.Role == RoleAdmin && !user.Disabled {
+			return true
+		}
+	}
+	return false
+}
+
+// GetUser returns a copy of the named user without its password hash
+func (s *UserStore) GetUser(username string) (UserAuth, error) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	user, exists := s.users[username]
+	if !exists {
+		return UserAuth{}, ErrUserNotFound
+	}
+
+	result := *user
+	result.PasswordHash = ""
+	return result, nil
+}
+
+// ListUsers returns copies of all users without their password hashes
+func (s *UserStore) ListUsers() []UserAuth {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	users := make([]UserAuth, 0, len(s.users))
+	for _, user := range s.users {
+		result := *user
+		result.PasswordHash = ""
+		users = append(users, result)
+	}
+	sort.Slice(users, func(i, j int) bool { return users[i].Username < users[j].Username })
+
+	return users
+}
+
+// Count returns the number of users in the store
+func (s *UserStore) Count() int {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	return len(s.users)
+}
+
+// Authenticate checks a username and password and returns the user's role
+func (s *UserStore) Authenticate(username, password string) (string, bool) {
+	s.mutex.RLock()
+	user, exists := s.users[username]
+	var hash, role string
+	var disabled bool
+	if exists {
+		hash, role, disabled = user.PasswordHash, user.Role, user.Disabled
+	}
+	s.mutex.RUnlock()
+
+	if !exists || disabled {
+		return "", false
+	}
+
+	if err := bcrypt.CompareHashAndPassword([]byte(hash), []byte(password)); err != nil {
+		return "", false
+	}
+
+	return role, true
+}
@@ -0,0 +1,101 @@
+package auth
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+func TestUserStoreAuthenticate(t *testing.T) {
+	store := NewUserStore("")
+
+	if err := store.AddUser(UserAuth{Username: "alice", Password: "secret", Role: RoleOperator}); err != nil {
+		t.Fatalf("Failed to add user: %v", err)
+	}
+
+	role, ok := store.Authenticate("alice", "secret")
+	if !ok || role != RoleOperator {
+		t.Fatalf("Expected operator login to succeed, got role=%q ok=%v", role, ok)
+	}
+
+	if _, ok := store.Authenticate("alice", "wrong"); ok {
+		t.Fatal("Login with wrong password should fail")
+	}
+
+	disabled := true
+	if err := store.UpdateUser("alice", UserUpdate{Disabled: &disabled}); err != nil {
+		t.Fatalf("Failed to disable user: %v", err)
+	}
+	if _, ok := store.Authenticate("alice", "secret"); ok {
+		t.Fatal("Login for a disabled user should fail")
+	}
+}
+
+func TestUserStoreKeepsLastAdmin(t *testing.T) {
+	store := NewUserStore("")
+
+	if err := store.AddUser(UserAuth{Username: "admin", Password: "secret", Role: RoleAdmin}); err != nil {
+		t.Fatalf("Failed to add user: %v", err)
+	}
+
+	viewer := RoleViewer
+	if err := store.UpdateUser("admin", UserUpdate{Role: &viewer}); err != ErrLastAdmin {
+		t.Fatalf("Expected ErrLastAdmin when demoting the last admin, got %v", err)
+	}
+	if err := store.DeleteUser("admin"); err != ErrLastAdmin {
+		t.Fatalf("Expected ErrLastAdmin when deleting the last admin, got %v", err)
+	}
+
+	user, err := store.GetUser("admin")
+	if err != nil || user.Role != RoleAdmin {
+		t.Fatalf("Admin should be unchanged, got %+v, %v", user, err)
+	}
+}
+
+func TestUserStorePersistence(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "users.json")
+
+	store := NewUserStore(path)
+	if err := store.AddUser(UserAuth{Username: "admin", Password: "secret", Role: RoleAdmin}); err != nil {
+		t.Fatalf("Failed to add user: %v", err)
+	}
+
+	reloaded := NewUserStore(path)
+	if err := reloaded.Load(); err != nil {
+		t.Fatalf("Failed to load user store: %v", err)
+	}
+	if _, ok := reloaded.Authenticate("admin", "secret"); !ok {
+		t.Fatal("Reloaded store should accept the saved credentials")
+	}
+}
+
+func TestRolePermissions(t *testing.T) {
+	if !HasPermission(RoleAdmin, PermUsersManage) {
+		t.Error("Admin should be able to manage users")
+	}
+	if HasPermission(RoleOperator, PermUsersManage) {
+		t.Error("Operator should not be able to manage users")
+	}
+	if HasPermission(RoleViewer, PermTasksWrite) {
+		t.Error("Viewer should not be able to create tasks")
+	}
+	if !HasPermission(RoleViewer, PermTasksRead) {
+		t.Error("Viewer should be able to read tasks")
+	}
+}
+
+func TestSetUserAuthReturnsStoreErrors(t *testing.T) {
+	previous := GetUserStore()
+	defer SetUserStore(previous)
+	SetUserStore(NewUserStore(""))
+
+	if err := SetUserAuth(&UserAuth{Username: "admin", Password: "secret", Role: "unknown"}); err == nil {
+		t.Fatal("expected an invalid role to be reported")
+	}
+
+	if err := SetUserAuth(&UserAuth{Username: "admin", Password: "secret", Role: RoleAdmin}); err != nil {
+		t.Fatalf("SetUserAuth: %v", err)
+	}
+	if err := SetUserAuth(&UserAuth{Username: "admin", Password: "other", Role: RoleAdmin}); err != nil {
+		t.Fatalf("existing user should keep its stored settings, got %v", err)
+	}
+}
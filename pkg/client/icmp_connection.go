@@ -184,7 +184,7 @@ func (c *ICMPConnection) ReceivePacket() (*protocol.Packet, error) {
 // performHandshake performs the initial handshake with the server
 func (c *ICMPConnection) performHandshake() error {
 	// Create handshake packet
-	handshake := protocol.NewPacket(protocol.PacketTypeKeyExchange, []byte(string(c.sessionID)))
+	handshake := protocol.NewPacket(protocol.PacketTypeKeyExchange, handshakeData(c.sessionID))
 
 	// Send handshake packet
 	err := c.SendPacket(handshake)
@@ -0,0 +1,185 @@
+package client
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Inventory holds the normalized host details of a client, as reported by the
+// sysinfo module or seen at registration
+type Inventory struct {
+	Hostname     string    `json:"hostname,omitempty"` // lower case
+	OS           string    `json:"os,omitempty"`       // windows, linux, macos, or the reported name in lower case
+	Architecture string    `json:"arch,omitempty"`     // amd64, 386, arm64 or arm, or the reported name in lower case
+	User         string    `json:"user,omitempty"`
+	IPAddresses  []string  `json:"ip_addresses,omitempty"` // sorted, without loopback addresses
+	UpdatedAt    time.Time `json:"updated_at,omitempty"`
+}
+
+// osNames maps names an operating system may be reported as to its normalized name
+var osNames = map[string]string{
+	"windows": "windows", "win32": "windows", "win64": "windows",
+	"linux": "linux", "ubuntu": "linux", "debian": "linux", "centos": "linux", "rhel": "linux", "fedora": "linux", "alpine": "linux",
+	"darwin": "macos", "macos": "macos", "mac": "macos", "osx": "macos",
+	"freebsd": "freebsd", "openbsd": "openbsd", "netbsd": "netbsd",
+}
+
+// archNames maps names an architecture may be reported as to its normalized name
+var archNames = map[string]string{
+	"amd64": "amd64", "x86_64": "amd64", "x64": "amd64",
+	"386": "386", "i386": "386", "i686": "386", "x86": "386",
+	"arm64": "arm64", "aarch64": "arm64",
+	"arm": "arm", "armv6l": "arm", "armv7l": "arm",
+}
+
+// ParseInventory extracts host details from the result of a sysinfo module
+// command: the map returned by "all", or the value returned by "get" for one
+// of the keys hostname, os, arch, username and network_interfaces
+func ParseInventory(command string, args []interface{}, result []byte) (map[string]interface{}, error) {
+	switch command {
+	case "all":
+		var details map[string]interface{}
+		if err := json.Unmarshal(result, &details); err != nil {
+			return nil, fmt.Errorf("invalid sysinfo result: %v", err)
+		}
+		return details, nil
+	case "get":
+		if len(args) == 0 {
+			return nil, fmt.Errorf("sysinfo get has no key")
+		}
+		key, _ := args[0].(string)
+		var value interface{}
+		if err := json.Unmarshal(result, &value); err != nil {
+			// Plain string results may not be JSON encoded
+			value = string(result)
+		}
+		return map[string]interface{}{key: value}, nil
+	default:
+		return nil, nil
+	}
+}
+
+// UpdateInventory updates the inventory of a client from reported host
+// details, such as those of the sysinfo module. Details that are not reported
+// keep their previous values. A reported hostname is also checked against the
+// engagement scope.
+func (m *Manager) UpdateInventory(clientID string, details map[string]interface{}) error {
+	m.clientMutex.Lock()
+	defer m.clientMutex.Unlock()
+
+	client, exists := m.clients[clientID]
+	if !exists {
+		return ErrClientNotFound
+	}
+
+	inventory := m.inventory[clientID]
+	if hostname, ok := details["hostname"].(string); ok && hostname != "" {
+		inventory.Hostname = normalizeHostname(hostname)
+		client.SetHostname(hostname)
+		m.checkScope(clientID, client)
+	}
+	if os, ok := details["os"].(string); ok && os != "" {
+		inventory.OS = normalizeName(os, osNames)
+	}
+	if arch, ok := details["arch"].(string); ok && arch != "" {
+		inventory.Architecture = normalizeName(arch, archNames)
+	}
+	for _, key := range []string{"username", "user"} {
+		if user, ok := details[key].(string); ok && user != "" {
+			inventory.User = strings.TrimSpace(user)
+			break
+		}
+	}
+	if interfaces, ok := details["network_interfaces"].([]interface{}); ok {
+		var addresses []string
+		for _, iface := range interfaces {
+			if iface, ok := iface.(map[string]interface{}); ok {
+				if ips, ok := iface["ip_addrs"].([]interface{}); ok {
+					for _, ip := range ips {
+						if ip, ok := ip.(string); ok {
+							addresses = append(addresses, ip)
+						}
+					}
+				}
+			}
+		}
+		inventory.IPAddresses = normalizeAddresses(addresses)
+	}
+	inventory.UpdatedAt = time.Now()
+
+	m.inventory[clientID] = inventory
+	m.persist(clientID, client)
+	return nil
+}
+
+// Inventory returns the inventory of a client
+func (m *Manager) Inventory(clientID string) (Inventory, error) {
+	m.clientMutex.RLock()
+	defer m.clientMutex.RUnlock()
+
+	if _, exists := m.clients[clientID]; !exists {
+		return Inventory{}, ErrClientNotFound
+	}
+	inventory := m.inventory[clientID]
+	inventory.IPAddresses = append([]string(nil), inventory.IPAddresses...)
+	return inventory, nil
+}
+
+// seedInventory fills in the inventory of a newly registered client from what
+// is known at registration, without overwriting reported details. The caller
+// must hold the mutex.
+func (m *Manager) seedInventory(clientID string, client *Client) {
+	inventory := m.inventory[clientID]
+	if inventory.Hostname == "" && client.GetHostname() != "" {
+		inventory.Hostname = normalizeHostname(client.GetHostname())
+	}
+	if len(inventory.IPAddresses) == 0 {
+		host, _, err := net.SplitHostPort(client.GetRemoteAddress())
+		if err != nil {
+			host = client.GetRemoteAddress()
+		}
+		inventory.IPAddresses = normalizeAddresses([]string{host})
+	}
+	m.inventory[clientID] = inventory
+}
+
+// normalizeHostname lower-cases a hostname and removes a trailing dot
+func normalizeHostname(hostname string) string {
+	return strings.TrimSuffix(strings.ToLower(strings.TrimSpace(hostname)), ".")
+}
+
+// normalizeName maps a reported name to its normalized form, using the first
+// word of names such as "Windows 10 Pro"
+func normalizeName(name string, names map[string]string) string {
+	name = strings.ToLower(strings.TrimSpace(name))
+	if normalized, ok := names[name]; ok {
+		return normalized
+	}
+	if fields := strings.Fields(name); len(fields) > 0 {
+		if normalized, ok := names[fields[0]]; ok {
+			return normalized
+		}
+	}
+	return name
+}
+
+// normalizeAddresses parses, deduplicates and sorts IP addresses, leaving out
+// loopback and unparsable addresses
+func normalizeAddresses(addresses []string) []string {
+	seen := make(map[string]bool, len(addresses))
+	var normalized []string
+	for _, address := range addresses {
+		ip := net.ParseIP(strings.TrimSpace(address))
+		if ip == nil || ip.IsLoopback() || seen[ip.String()] {
+			continue
+		}
+		seen[ip.String()] = true
+		normalized = append(normalized, ip.String())
+	}
+	sort.Strings(normalized)
+	return normalized
+}
@@ -0,0 +1,44 @@
+package client
+
+import (
+	"reflect"
+	"testing"
+
+	"dinoc2/pkg/crypto"
+)
+
+func TestUpdateInventory(t *testing.T) {
+	m := NewManager()
+	c := &Client{config: DefaultConfig(), sessionID: crypto.SessionID("client1")}
+	c.SetRemoteAddress("203.0.113.7:51234")
+	m.RegisterClient(c)
+
+	// The address the client connected from is known at registration
+	if inventory, _ := m.Inventory("client1"); !reflect.DeepEqual(inventory.IPAddresses, []string{"203.0.113.7"}) {
+		t.Errorf("Expected the remote address to be seeded, got %v", inventory.IPAddresses)
+	}
+
+	result := []byte(`{"hostname": "WEB01.corp.example.com.", "os": "Windows 10 Pro", "arch": "x86_64", "username": "CORP\\svc",
+		"network_interfaces": [{"name": "eth0", "ip_addrs": ["10.0.0.5", "fe80::1", "10.0.0.5"]}, {"name": "lo", "ip_addrs": ["127.0.0.1"]}]}`)
+	details, err := ParseInventory("all", nil, result)
+	if err != nil {
+		t.Fatalf("Failed to parse inventory: %v", err)
+	}
+	if err := m.UpdateInventory("client1", details); err != nil {
+		t.Fatalf("Failed to update inventory: %v", err)
+	}
+
+	inventory, _ := m.Inventory("client1")
+	want := Inventory{Hostname: "web01.corp.example.com", OS: "windows", Architecture: "amd64", User: `CORP\svc`,
+		IPAddresses: []string{"10.0.0.5", "fe80::1"}, UpdatedAt: inventory.UpdatedAt}
+	if !reflect.DeepEqual(inventory, want) {
+		t.Errorf("Expected %+v, got %+v", want, inventory)
+	}
+
+	// A single reported detail leaves the others as they are
+	details, _ = ParseInventory("get", []interface{}{"os"}, []byte(`"linux"`))
+	m.UpdateInventory("client1", details)
+	if inventory, _ := m.Inventory("client1"); inventory.OS != "linux" || inventory.Architecture != "amd64" {
+		t.Errorf("Expected only the OS to change, got %+v", inventory)
+	}
+}
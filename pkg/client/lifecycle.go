@@ -0,0 +1,356 @@
+package client
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"dinoc2/pkg/events"
+)
+
+// Lifecycle is where a client is in its lifecycle, based on how recently it checked in
+type Lifecycle string
+
+const (
+	LifecycleActive Lifecycle = "active" // checked in recently
+	LifecycleLate   Lifecycle = "late"   // missed a few check-ins
+	LifecycleStale  Lifecycle = "stale"  // has not checked in for a long time
+	LifecycleLost   Lifecycle = "lost"   // is not expected to check in again
+	LifecycleExited Lifecycle = "exited" // exited on purpose
+)
+
+// defaultThresholds is the key of the thresholds used for listener types without their own
+const defaultThresholds = "default"
+
+// lifecycleInterval is how often client lifecycle states are updated
+var lifecycleInterval = 15 * time.Second
+
+// ErrInvalidLifecycleConfig is returned when lifecycle thresholds are inconsistent
+var ErrInvalidLifecycleConfig = errors.New("invalid client lifecycle configuration")
+
+// Thresholds are how long after its last check-in a client becomes late,
+// stale and lost, in seconds
+type Thresholds struct {
+	Late  int `json:"late"`
+	Stale int `json:"stale"`
+	Lost  int `json:"lost"`
+}
+
+// LifecycleConfig configures how client lifecycle states are tracked
+type LifecycleConfig struct {
+	Thresholds map[string]Thresholds `json:"thresholds,omitempty"` // by listener type, "default" for the others
+	Retention  int                   `json:"retention,omitempty"`  // in seconds that lost and exited clients are kept, 0 to keep them
+	History    int                   `json:"history,omitempty"`    // check-ins kept per client
+}
+
+// DefaultLifecycleConfig returns the lifecycle configuration used when none is
+// set: clients are late after three missed heartbeats at the default interval,
+// stale after ten minutes and lost after an hour, and are never removed
+func DefaultLifecycleConfig() LifecycleConfig {
+	return LifecycleConfig{
+		Thresholds: map[string]Thresholds{
+			defaultThresholds: {Late: 90, Stale: 600, Lost: 3600},
+		},
+		History: 50,
+	}
+}
+
+// CheckIn is a single check-in of a client
+type CheckIn struct {
+	Time          time.Time `json:"time"`
+	Listener      string    `json:"listener,omitempty"` // type of the listener the client checked in through
+	RemoteAddress string    `json:"remote_address,omitempty"`
+}
+
+// LifecycleStatus describes a client's lifecycle state
+type LifecycleStatus struct {
+	State       Lifecycle `json:"state"`
+	Since       time.Time `json:"since"`
+	LastCheckIn time.Time `json:"last_check_in"`
+	Listener    string    `json:"listener,omitempty"` // type of the listener the client last checked in through
+	Reason      string    `json:"reason,omitempty"`   // why the client exited
+}
+
+// lifecycle tracks the lifecycle state and check-in history of a client
+type lifecycle struct {
+	LifecycleStatus
+	history []CheckIn
+}
+
+// SetLifecycleConfig sets the thresholds that client lifecycle states are
+// derived from, how long lost clients are kept and how many check-ins are kept
+// per client. Listener types without their own thresholds use the default ones.
+func (m *Manager) SetLifecycleConfig(config LifecycleConfig) error {
+	defaults := DefaultLifecycleConfig()
+	if config.History == 0 {
+		config.History = defaults.History
+	}
+	if config.History < 0 || config.Retention < 0 {
+		return fmt.Errorf("%w: history and retention must not be negative", ErrInvalidLifecycleConfig)
+	}
+
+	thresholds := make(map[string]Thresholds, len(config.Thresholds)+1)
+	thresholds[defaultThresholds] = defaults.Thresholds[defaultThresholds]
+	for listenerType, t := range config.Thresholds {
+		if t.Late <= 0 || t.Stale <= t.Late || t.Lost <= t.Stale {
+			return fmt.Errorf("%w: thresholds for %s must be positive and increase from late to stale to lost", ErrInvalidLifecycleConfig, listenerType)
+		}
+		thresholds[listenerType] = t
+	}
+	config.Thresholds = thresholds
+
+	m.clientMutex.Lock()
+	defer m.clientMutex.Unlock()
+
+	m.lifecycleConfig = config
+	return nil
+}
+
+// CheckIn records that a client checked in through a listener of the given
+// type, which makes it active again
+func (m *Manager) CheckIn(clientID, listenerType string) error {
+	m.clientMutex.Lock()
+	defer m.clientMutex.Unlock()
+
+	client, exists := m.clients[clientID]
+	if !exists {
+		return ErrClientNotFound
+	}
+
+	now := time.Now()
+	client.stateMutex.Lock()
+	client.lastHeartbeat = now
+	client.stateMutex.Unlock()
+
+	l := m.lifecycleOf(clientID, client)
+	l.LastCheckIn = now
+	if listenerType != "" {
+		l.Listener = listenerType
+	}
+	l.history = append(l.history, CheckIn{Time: now, Listener: listenerType, RemoteAddress: client.GetRemoteAddress()})
+	if excess := len(l.history) - m.lifecycleConfig.History; excess > 0 {
+		l.history = append(l.history[:0:0], l.history[excess:]...)
+	}
+	l.Reason = ""
+
+	// Only a change of state is written at once; the check-ins of an active
+	// client are written in batches, at the next lifecycle update
+	if l.State == LifecycleActive {
+		m.unsaved[clientID] = true
+		return nil
+	}
+	m.transition(clientID, client, l, LifecycleActive, now)
+	m.persist(clientID, client)
+	return nil
+}
+
+// FlushCheckIns writes the clients whose check-ins have not been written yet
+// to the store. The writes do not hold up the clients that check in meanwhile.
+func (m *Manager) FlushCheckIns() {
+	m.clientMutex.Lock()
+	if m.store == nil || len(m.unsaved) == 0 {
+		m.clientMutex.Unlock()
+		return
+	}
+	records := make([]Record, 0, len(m.unsaved))
+	for clientID := range m.unsaved {
+		if client, exists := m.clients[clientID]; exists {
+			records = append(records, m.record(clientID, client))
+		}
+	}
+	m.unsaved = make(map[string]bool)
+
+	// Taking the store mutex before releasing the client mutex keeps any
+	// later write of these clients from being overwritten by this one
+	m.storeMutex.Lock()
+	defer m.storeMutex.Unlock()
+	m.clientMutex.Unlock()
+
+	for _, record := range records {
+		if err := m.store.Put(clientCollection, record.ID, record); err != nil {
+			log.Printf("Failed to persist client %s: %v", record.ID, err)
+		}
+	}
+}
+
+// MarkExited records that a client exited on purpose, so it is not reported as lost
+func (m *Manager) MarkExited(clientID, reason string) error {
+	m.clientMutex.Lock()
+	defer m.clientMutex.Unlock()
+
+	client, exists := m.clients[clientID]
+	if !exists {
+		return ErrClientNotFound
+	}
+
+	l := m.lifecycleOf(clientID, client)
+	l.Reason = reason
+	m.transition(clientID, client, l, LifecycleExited, time.Now())
+
+	m.persist(clientID, client)
+	return nil
+}
+
+// Lifecycle returns the lifecycle state of a client
+func (m *Manager) Lifecycle(clientID string) (LifecycleStatus, error) {
+	m.clientMutex.Lock()
+	defer m.clientMutex.Unlock()
+
+	client, exists := m.clients[clientID]
+	if !exists {
+		return LifecycleStatus{}, ErrClientNotFound
+	}
+	return m.lifecycleOf(clientID, client).LifecycleStatus, nil
+}
+
+// LifecycleCounts returns the number of clients in each lifecycle state
+func (m *Manager) LifecycleCounts() map[Lifecycle]int {
+	m.clientMutex.Lock()
+	defer m.clientMutex.Unlock()
+
+	counts := map[Lifecycle]int{
+		LifecycleActive: 0,
+		LifecycleLate:   0,
+		LifecycleStale:  0,
+		LifecycleLost:   0,
+		LifecycleExited: 0,
+	}
+	for clientID, client := range m.clients {
+		counts[m.lifecycleOf(clientID, client).State]++
+	}
+	return counts
+}
+
+// CheckIns returns the recent check-ins of a client, oldest first
+func (m *Manager) CheckIns(clientID string) ([]CheckIn, error) {
+	m.clientMutex.Lock()
+	defer m.clientMutex.Unlock()
+
+	client, exists := m.clients[clientID]
+	if !exists {
+		return nil, ErrClientNotFound
+	}
+	history := m.lifecycleOf(clientID, client).history
+	return append([]CheckIn(nil), history...), nil
+}
+
+// StartLifecycle starts updating client lifecycle states as their check-ins
+// age, and removing lost and exited clients after the retention period
+func (m *Manager) StartLifecycle() {
+	m.clientMutex.Lock()
+	defer m.clientMutex.Unlock()
+
+	if m.stopLifecycle != nil {
+		return
+	}
+	stop := make(chan struct{})
+	m.stopLifecycle = stop
+
+	go func() {
+		ticker := time.NewTicker(lifecycleInterval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case now := <-ticker.C:
+				m.updateLifecycles(now)
+				m.FlushCheckIns()
+			case <-stop:
+				return
+			}
+		}
+	}()
+}
+
+// StopLifecycle stops updating client lifecycle states and writes the
+// check-ins that have not been written yet
+func (m *Manager) StopLifecycle() {
+	m.clientMutex.Lock()
+	if m.stopLifecycle != nil {
+		close(m.stopLifecycle)
+		m.stopLifecycle = nil
+	}
+	m.clientMutex.Unlock()
+
+	m.FlushCheckIns()
+}
+
+// updateLifecycles moves clients to the state their last check-in calls for,
+// and removes clients that have been lost or exited for longer than the
+// retention period
+func (m *Manager) updateLifecycles(now time.Time) {
+	m.clientMutex.Lock()
+	defer m.clientMutex.Unlock()
+
+	retention := time.Duration(m.lifecycleConfig.Retention) * time.Second
+	for clientID, client := range m.clients {
+		l := m.lifecycleOf(clientID, client)
+		if l.State != LifecycleExited {
+			state := m.stateAfter(l, now.Sub(l.LastCheckIn))
+			if state != l.State {
+				m.transition(clientID, client, l, state, now)
+				m.persist(clientID, client)
+			}
+		}
+
+		if retention > 0 && (l.State == LifecycleLost || l.State == LifecycleExited) && now.Sub(l.Since) >= retention {
+			log.Printf("Removing client %s, which has been %s since %s", clientID, l.State, l.Since.Format(time.RFC3339))
+			m.remove(clientID, fmt.Sprintf("%s for longer than the retention period", l.State))
+		}
+	}
+}
+
+// stateAfter returns the state of a client that last checked in the given
+// time ago. The caller must hold the mutex.
+func (m *Manager) stateAfter(l *lifecycle, elapsed time.Duration) Lifecycle {
+	t, exists := m.lifecycleConfig.Thresholds[l.Listener]
+	if !exists {
+		t = m.lifecycleConfig.Thresholds[defaultThresholds]
+	}
+
+	switch {
+	case elapsed >= time.Duration(t.Lost)*time.Second:
+		return LifecycleLost
+	case elapsed >= time.Duration(t.Stale)*time.Second:
+		return LifecycleStale
+	case elapsed >= time.Duration(t.Late)*time.Second:
+		return LifecycleLate
+	default:
+		return LifecycleActive
+	}
+}
+
+// lifecycleOf returns the lifecycle of a client, starting it from the client's
+// last heartbeat if it has none yet. The caller must hold the mutex.
+func (m *Manager) lifecycleOf(clientID string, client *Client) *lifecycle {
+	l, exists := m.lifecycles[clientID]
+	if !exists {
+		lastHeartbeat := client.GetLastHeartbeat()
+		l = &lifecycle{LifecycleStatus: LifecycleStatus{State: LifecycleActive, Since: lastHeartbeat, LastCheckIn: lastHeartbeat}}
+		m.lifecycles[clientID] = l
+	}
+	return l
+}
+
+// transition moves a client to a lifecycle state and publishes the change.
+// The caller must hold the mutex.
+func (m *Manager) transition(clientID string, client *Client, l *lifecycle, state Lifecycle, now time.Time) {
+	if l.State == state {
+		return
+	}
+
+	previous := l.State
+	l.State = state
+	l.Since = now
+	log.Printf("Client %s is now %s (was %s)", clientID, state, previous)
+
+	m.events.Publish(events.TypeClientState, events.ClientEvent{
+		ClientID:      clientID,
+		Protocol:      client.GetCurrentProtocol(),
+		RemoteAddress: client.GetRemoteAddress(),
+		State:         string(state),
+		PreviousState: string(previous),
+		Reason:        l.Reason,
+	})
+}
@@ -0,0 +1,133 @@
+package client
+
+import (
+	"testing"
+	"time"
+
+	"dinoc2/pkg/crypto"
+	"dinoc2/pkg/store"
+)
+
+func TestClientLifecycle(t *testing.T) {
+	s := store.NewMemoryStore()
+	m := NewManager()
+	if err := m.SetStore(s); err != nil {
+		t.Fatalf("Failed to set store: %v", err)
+	}
+	err := m.SetLifecycleConfig(LifecycleConfig{
+		Thresholds: map[string]Thresholds{"dns": {Late: 600, Stale: 1200, Lost: 3600}},
+		Retention:  3 * 3600,
+	})
+	if err != nil {
+		t.Fatalf("Failed to set lifecycle config: %v", err)
+	}
+
+	for _, id := range []string{"tcp1", "dns1", "gone1"} {
+		m.RegisterClient(&Client{config: DefaultConfig(), sessionID: crypto.SessionID(id)})
+	}
+	m.CheckIn("tcp1", "tcp")
+	m.CheckIn("dns1", "dns")
+	m.MarkExited("gone1", "exit task")
+
+	// Each client is judged by the thresholds of the listener type it last checked in through
+	now := time.Now()
+	tests := []struct {
+		after time.Duration
+		tcp   Lifecycle
+		dns   Lifecycle
+	}{
+		{time.Minute, LifecycleActive, LifecycleActive},
+		{5 * time.Minute, LifecycleLate, LifecycleActive},
+		{15 * time.Minute, LifecycleStale, LifecycleLate},
+		{2 * time.Hour, LifecycleLost, LifecycleLost},
+	}
+	for _, test := range tests {
+		m.updateLifecycles(now.Add(test.after))
+		if status, _ := m.Lifecycle("tcp1"); status.State != test.tcp {
+			t.Errorf("After %s: expected the tcp client to be %s, got %s", test.after, test.tcp, status.State)
+		}
+		if status, _ := m.Lifecycle("dns1"); status.State != test.dns {
+			t.Errorf("After %s: expected the dns client to be %s, got %s", test.after, test.dns, status.State)
+		}
+	}
+	if status, _ := m.Lifecycle("gone1"); status.State != LifecycleExited || status.Reason != "exit task" {
+		t.Errorf("Expected the exited client to stay exited, got %+v", status)
+	}
+
+	// A check-in makes a lost client active again, and is kept in its history
+	m.CheckIn("tcp1", "tcp")
+	if status, _ := m.Lifecycle("tcp1"); status.State != LifecycleActive {
+		t.Errorf("Expected the client to be active after checking in, got %s", status.State)
+	}
+	if checkIns, _ := m.CheckIns("tcp1"); len(checkIns) != 2 || checkIns[1].Listener != "tcp" {
+		t.Errorf("Expected 2 check-ins, got %+v", checkIns)
+	}
+
+	// Lifecycles survive a restart
+	restored := NewManager()
+	if err := restored.SetStore(s); err != nil {
+		t.Fatalf("Failed to restore: %v", err)
+	}
+	if status, _ := restored.Lifecycle("dns1"); status.State != LifecycleLost || status.Listener != "dns" {
+		t.Errorf("Expected the lost client to be restored, got %+v", status)
+	}
+
+	// Lost and exited clients are removed once they have been lost or exited for the retention period
+	m.updateLifecycles(now.Add(4 * time.Hour))
+	for id, kept := range map[string]bool{"tcp1": true, "dns1": true, "gone1": false} {
+		if _, err := m.GetClient(id); (err == nil) != kept {
+			t.Errorf("Expected client %s to be kept: %t", id, kept)
+		}
+	}
+	m.updateLifecycles(now.Add(8 * time.Hour))
+	if clients := m.ListClients(); len(clients) != 0 {
+		t.Errorf("Expected all clients to be removed, got %d", len(clients))
+	}
+
+	if err := m.SetLifecycleConfig(LifecycleConfig{Thresholds: map[string]Thresholds{"http": {Late: 60, Stale: 30, Lost: 90}}}); err == nil {
+		t.Error("Expected thresholds that do not increase to be refused")
+	}
+}
+
+func TestCheckInsAreWrittenInBatches(t *testing.T) {
+	s := store.NewMemoryStore()
+	m := NewManager()
+	if err := m.SetStore(s); err != nil {
+		t.Fatalf("Failed to set store: %v", err)
+	}
+	m.RegisterClient(&Client{config: DefaultConfig(), sessionID: crypto.SessionID("tcp1")})
+
+	restore := func() *Manager {
+		restored := NewManager()
+		if err := restored.SetStore(s); err != nil {
+			t.Fatalf("Failed to restore: %v", err)
+		}
+		return restored
+	}
+
+	// The check-ins of an active client are kept in memory until they are flushed
+	for i := 0; i < 3; i++ {
+		m.CheckIn("tcp1", "tcp")
+	}
+	if checkIns, _ := restore().CheckIns("tcp1"); len(checkIns) != 0 {
+		t.Errorf("Expected no check-ins to be written before a flush, got %d", len(checkIns))
+	}
+	m.FlushCheckIns()
+	if checkIns, _ := restore().CheckIns("tcp1"); len(checkIns) != 3 {
+		t.Errorf("Expected 3 check-ins to be written by the flush, got %d", len(checkIns))
+	}
+
+	// A check-in that changes the state of a client is written at once
+	m.updateLifecycles(time.Now().Add(2 * time.Hour))
+	m.CheckIn("tcp1", "tcp")
+	if status, _ := restore().Lifecycle("tcp1"); status.State != LifecycleActive {
+		t.Errorf("Expected the lost client to be written as active at once, got %s", status.State)
+	}
+
+	// Stopping the lifecycle updates writes the check-ins that are left
+	m.CheckIn("tcp1", "tcp")
+	m.StopLifecycle()
+	if checkIns, _ := restore().CheckIns("tcp1"); len(checkIns) != 5 {
+		t.Errorf("Expected 5 check-ins to be written when stopping, got %d", len(checkIns))
+	}
+}
@@ -1,48 +1,373 @@
 package client
 
 import (
+	"context"
+	"encoding/json"
 	"errors"
 	"fmt"
+	"log"
 	"sync"
+	"time"
+
+	"dinoc2/pkg/crypto"
+	"dinoc2/pkg/events"
+	"dinoc2/pkg/module"
+	"dinoc2/pkg/protocol"
+	"dinoc2/pkg/scope"
+	"dinoc2/pkg/store"
 )
 
+// clientCollection is the store collection that holds client records
+const clientCollection = "clients"
+
+// ErrClientNotFound is returned when a client does not exist
+var ErrClientNotFound = errors.New("client not found")
+
+// Record is the persisted form of a client
+type Record struct {
+	ID                  string            `json:"id"`
+	Protocol            string            `json:"protocol"`
+	Protocols           []string          `json:"protocols"`
+	EncryptionAlgorithm string            `json:"encryption_algorithm"`
+	ServerAddress       string            `json:"server_address"`
+	RemoteAddress       string            `json:"remote_address,omitempty"`
+	Hostname            string            `json:"hostname,omitempty"`
+	LastHeartbeat       time.Time         `json:"last_heartbeat"`
+	Quarantined         bool              `json:"quarantined,omitempty"`
+	QuarantineReason    string            `json:"quarantine_reason,omitempty"`
+	ScopePending        bool              `json:"scope_pending,omitempty"`
+	Tags                map[string]string `json:"tags,omitempty"`
+	Lifecycle           *LifecycleStatus  `json:"lifecycle,omitempty"`
+	CheckIns            []CheckIn         `json:"check_ins,omitempty"`
+	Inventory           *Inventory        `json:"inventory,omitempty"`
+	Notes               []Note            `json:"notes,omitempty"`
+	Lock                *Lock             `json:"lock,omitempty"`
+}
+
 // Manager handles client connections and management
 type Manager struct {
 	clients     map[string]*Client
+	quarantined map[string]string                     // Client ID to the reason it was quarantined
+	pending     map[string]bool                       // IDs of the clients whose scope check waits for their hostname
+	tags        map[string]map[string]string          // Client ID to its tags
+	tagIndex    map[string]map[string]map[string]bool // Tag key to value to the IDs of the clients with it
+	inventory   map[string]Inventory                  // Client ID to its host details
+	notes       map[string][]Note                     // Client ID to the notes attached to it
+	locks       map[string]Lock                       // Client ID to the lock an operator holds on it
+	scope       *scope.Scope
+	store       store.Store     // Optional store that client records are persisted to
+	unsaved     map[string]bool // IDs of the clients whose check-ins have not been written to the store yet
+	storeMutex  sync.Mutex      // Orders the writes to the store, taken after the client mutex
+	events      *events.Bus
 	clientMutex sync.RWMutex
+
+	lifecycles      map[string]*lifecycle // Client ID to its lifecycle state and check-in history
+	lifecycleConfig LifecycleConfig
+	stopLifecycle   chan struct{}
 }
 
 // NewManager creates a new client manager
 func NewManager() *Manager {
 	return &Manager{
-		clients: make(map[string]*Client),
+		clients:     make(map[string]*Client),
+		quarantined: make(map[string]string),
+		pending:     make(map[string]bool),
+		tags:        make(map[string]map[string]string),
+		tagIndex:    make(map[string]map[string]map[string]bool),
+		inventory:   make(map[string]Inventory),
+		notes:       make(map[string][]Note),
+		locks:       make(map[string]Lock),
+		unsaved:     make(map[string]bool),
+
+		lifecycles:      make(map[string]*lifecycle),
+		lifecycleConfig: DefaultLifecycleConfig(),
 	}
 }
 
-// RegisterClient registers a client with the manager
+// SetScope sets the engagement scope and re-checks all registered clients against it
+func (m *Manager) SetScope(s *scope.Scope) {
+	m.clientMutex.Lock()
+	defer m.clientMutex.Unlock()
+	
+	m.scope = s
+	for clientID, client := range m.clients {
+		m.checkScope(clientID, client)
+		m.persist(clientID, client)
+	}
+}
+
+// RegisterClient registers a client with the manager.
+// Clients outside the engagement scope are registered but quarantined, and
+// clients whose hostname the scope still needs are registered as pending.
 func (m *Manager) RegisterClient(client *Client) string {
 	m.clientMutex.Lock()
 	defer m.clientMutex.Unlock()
 	
 	clientID := string(client.sessionID)
 	m.clients[clientID] = client
+	m.checkScope(clientID, client)
+	m.seedInventory(clientID, client)
+	
+	// Registering counts as checking in
+	now := time.Now()
+	client.stateMutex.Lock()
+	client.lastHeartbeat = now
+	client.stateMutex.Unlock()
+	l := m.lifecycleOf(clientID, client)
+	l.LastCheckIn = now
+	m.transition(clientID, client, l, LifecycleActive, now)
+	m.persist(clientID, client)
+	
+	reason, quarantined := m.quarantined[clientID]
+	m.events.Publish(events.TypeClientRegistered, events.ClientEvent{
+		ClientID:      clientID,
+		Protocol:      client.GetCurrentProtocol(),
+		RemoteAddress: client.GetRemoteAddress(),
+		Quarantined:   quarantined,
+		ScopePending:  m.pending[clientID],
+		Reason:        reason,
+	})
 	
 	return clientID
 }
 
+// SetEventBus sets the bus that client registration and loss are published to
+func (m *Manager) SetEventBus(bus *events.Bus) {
+	m.clientMutex.Lock()
+	defer m.clientMutex.Unlock()
+	
+	m.events = bus
+}
+
+// checkScope quarantines, holds or releases a client based on the current scope
+func (m *Manager) checkScope(clientID string, client *Client) {
+	verdict, reason := m.scope.Check(client.GetRemoteAddress(), client.GetHostname())
+	switch verdict {
+	case scope.InScope:
+		if _, exists := m.quarantined[clientID]; exists {
+			log.Printf("Client %s is now in scope, releasing it from quarantine", clientID)
+		} else if m.pending[clientID] {
+			log.Printf("Client %s is in scope", clientID)
+		}
+		delete(m.quarantined, clientID)
+		delete(m.pending, clientID)
+	case scope.Pending:
+		delete(m.quarantined, clientID)
+		m.pending[clientID] = true
+		log.Printf("Client %s is pending a scope check: %s", clientID, reason)
+	default:
+		delete(m.pending, clientID)
+		m.quarantined[clientID] = reason
+		log.Printf("Quarantined client %s: out of engagement scope: %s", clientID, reason)
+	}
+}
+
+// QuarantineReason returns why a client is quarantined, and whether it is
+func (m *Manager) QuarantineReason(clientID string) (string, bool) {
+	m.clientMutex.RLock()
+	defer m.clientMutex.RUnlock()
+	
+	reason, quarantined := m.quarantined[clientID]
+	return reason, quarantined
+}
+
+// ScopePending reports whether a client's scope check waits for it to report its hostname
+func (m *Manager) ScopePending(clientID string) bool {
+	m.clientMutex.RLock()
+	defer m.clientMutex.RUnlock()
+	
+	return m.pending[clientID]
+}
+
+// ReportHostname records the hostname a registered client reported, such as in
+// the handshake of a new session, and checks the client against the scope again
+func (m *Manager) ReportHostname(clientID, hostname string) error {
+	m.clientMutex.Lock()
+	defer m.clientMutex.Unlock()
+	
+	client, exists := m.clients[clientID]
+	if !exists {
+		return ErrClientNotFound
+	}
+	
+	client.SetHostname(hostname)
+	m.checkScope(clientID, client)
+	m.persist(clientID, client)
+	return nil
+}
+
 // UnregisterClient removes a client from the manager
 func (m *Manager) UnregisterClient(clientID string) error {
 	m.clientMutex.Lock()
 	defer m.clientMutex.Unlock()
 	
 	if _, exists := m.clients[clientID]; !exists {
-		return errors.New("client not found")
+		return ErrClientNotFound
 	}
 	
+	m.remove(clientID, "unregistered")
+	return nil
+}
+
+// remove removes a client and its record. The caller must hold the mutex.
+func (m *Manager) remove(clientID, reason string) {
+	client := m.clients[clientID]
 	delete(m.clients, clientID)
+	delete(m.quarantined, clientID)
+	delete(m.pending, clientID)
+	delete(m.lifecycles, clientID)
+	delete(m.inventory, clientID)
+	delete(m.notes, clientID)
+	delete(m.locks, clientID)
+	delete(m.unsaved, clientID)
+	m.untagAll(clientID)
+	
+	if m.store != nil {
+		m.storeMutex.Lock()
+		defer m.storeMutex.Unlock()
+		if err := m.store.Delete(clientCollection, clientID); err != nil {
+			log.Printf("Failed to delete client record %s: %v", clientID, err)
+		}
+	}
+	
+	m.events.Publish(events.TypeClientLost, events.ClientEvent{
+		ClientID:      clientID,
+		Protocol:      client.GetCurrentProtocol(),
+		RemoteAddress: client.GetRemoteAddress(),
+		Reason:        reason,
+	})
+}
+
+// SetStore sets the store that client records are persisted to and restores the
+// clients it holds. Restored clients are disconnected until they check in again.
+func (m *Manager) SetStore(s store.Store) error {
+	records, err := s.List(clientCollection)
+	if err != nil {
+		return fmt.Errorf("failed to load clients: %w", err)
+	}
+	
+	m.clientMutex.Lock()
+	defer m.clientMutex.Unlock()
+	
+	m.store = s
+	for _, data := range records {
+		var record Record
+		if err := json.Unmarshal(data, &record); err != nil {
+			return fmt.Errorf("failed to restore client: %w", err)
+		}
+		if _, exists := m.clients[record.ID]; exists {
+			continue
+		}
+		
+		m.clients[record.ID] = restoreClient(record)
+		if record.Quarantined {
+			m.quarantined[record.ID] = record.QuarantineReason
+		}
+		if record.ScopePending {
+			m.pending[record.ID] = true
+		}
+		for key, value := range record.Tags {
+			m.tag(record.ID, key, value)
+		}
+		if record.Lifecycle != nil {
+			m.lifecycles[record.ID] = &lifecycle{LifecycleStatus: *record.Lifecycle, history: record.CheckIns}
+		}
+		if record.Inventory != nil {
+			m.inventory[record.ID] = *record.Inventory
+		}
+		if len(record.Notes) > 0 {
+			m.notes[record.ID] = record.Notes
+		}
+		if record.Lock != nil && time.Now().Before(record.Lock.ExpiresAt) {
+			m.locks[record.ID] = *record.Lock
+		}
+	}
+	
+	log.Printf("Restored %d clients", len(records))
 	return nil
 }
 
+// persist writes a client record to the store, if one is set. The caller must hold the mutex.
+func (m *Manager) persist(clientID string, client *Client) {
+	if m.store == nil {
+		return
+	}
+	delete(m.unsaved, clientID)
+	record := m.record(clientID, client)
+	
+	m.storeMutex.Lock()
+	defer m.storeMutex.Unlock()
+	if err := m.store.Put(clientCollection, clientID, record); err != nil {
+		log.Printf("Failed to persist client %s: %v", clientID, err)
+	}
+}
+
+// record returns the record of a client. The caller must hold the mutex.
+func (m *Manager) record(clientID string, client *Client) Record {
+	client.stateMutex.RLock()
+	record := Record{
+		ID:                  clientID,
+		Protocol:            string(client.currentProtocol),
+		EncryptionAlgorithm: client.config.EncryptionAlg,
+		ServerAddress:       client.config.ServerAddress,
+		RemoteAddress:       client.remoteAddress,
+		Hostname:            client.hostname,
+		LastHeartbeat:       client.lastHeartbeat,
+	}
+	client.stateMutex.RUnlock()
+	
+	for _, p := range client.config.Protocols {
+		record.Protocols = append(record.Protocols, string(p))
+	}
+	record.QuarantineReason, record.Quarantined = m.quarantined[clientID]
+	record.ScopePending = m.pending[clientID]
+	record.Tags = m.tags[clientID]
+	if l, exists := m.lifecycles[clientID]; exists {
+		status := l.LifecycleStatus
+		record.Lifecycle = &status
+		record.CheckIns = l.history
+	}
+	if inventory, exists := m.inventory[clientID]; exists {
+		record.Inventory = &inventory
+	}
+	record.Notes = m.notes[clientID]
+	if lock, exists := m.locks[clientID]; exists {
+		record.Lock = &lock
+	}
+	return record
+}
+
+// restoreClient recreates a disconnected client from its record
+func restoreClient(record Record) *Client {
+	config := DefaultConfig()
+	config.ServerAddress = record.ServerAddress
+	config.EncryptionAlg = record.EncryptionAlgorithm
+	config.EnableAntiDebug = false
+	config.EnableAntiSandbox = false
+	config.EnableMemProtect = false
+	if len(record.Protocols) > 0 {
+		config.Protocols = nil
+		for _, p := range record.Protocols {
+			config.Protocols = append(config.Protocols, ProtocolType(p))
+		}
+	}
+	
+	ctx, cancel := context.WithCancel(context.Background())
+	return &Client{
+		config:          config,
+		protocolHandler: protocol.NewProtocolHandler(),
+		sessionID:       crypto.SessionID(record.ID),
+		currentProtocol: ProtocolType(record.Protocol),
+		state:           StateDisconnected,
+		ctx:             ctx,
+		cancel:          cancel,
+		lastHeartbeat:   record.LastHeartbeat,
+		remoteAddress:   record.RemoteAddress,
+		hostname:        record.Hostname,
+		loadedModules:   make(map[string]module.Module),
+	}
+}
+
 // GetClient retrieves a client by ID
 func (m *Manager) GetClient(clientID string) (*Client, error) {
 	m.clientMutex.RLock()
@@ -50,7 +375,7 @@ func (m *Manager) GetClient(clientID string) (*Client, error) {
 	
 	client, exists := m.clients[clientID]
 	if !exists {
-		return nil, errors.New("client not found")
+		return nil, ErrClientNotFound
 	}
 	
 	return client, nil
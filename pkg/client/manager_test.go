@@ -0,0 +1,56 @@
+package client
+
+import (
+	"testing"
+
+	"dinoc2/pkg/crypto"
+	"dinoc2/pkg/scope"
+)
+
+func TestScopePendingUntilHostnameIsReported(t *testing.T) {
+	s, err := scope.New(scope.Config{
+		AllowedCIDRs: []string{"10.0.0.0/16"},
+		AllowedHosts: []string{"corp.example.com"},
+	})
+	if err != nil {
+		t.Fatalf("Failed to create scope: %v", err)
+	}
+	m := NewManager()
+	m.SetScope(s)
+
+	// A client that has not reported its hostname is pending, not quarantined
+	c := &Client{config: DefaultConfig(), sessionID: crypto.SessionID("client1")}
+	c.SetRemoteAddress("10.0.1.20:51234")
+	m.RegisterClient(c)
+	if _, quarantined := m.QuarantineReason("client1"); quarantined {
+		t.Error("Expected a client without a hostname not to be quarantined")
+	}
+	if !m.ScopePending("client1") {
+		t.Error("Expected a client without a hostname to be pending")
+	}
+
+	// Reporting an authorized hostname releases it
+	if err := m.ReportHostname("client1", "ws01.corp.example.com"); err != nil {
+		t.Fatalf("ReportHostname: %v", err)
+	}
+	if _, quarantined := m.QuarantineReason("client1"); quarantined || m.ScopePending("client1") {
+		t.Error("Expected the client to be in scope once it reported an authorized hostname")
+	}
+
+	// A hostname reported in the handshake is checked at registration, and
+	// never authorizes an address outside the authorized ranges
+	c = &Client{config: DefaultConfig(), sessionID: crypto.SessionID("client2")}
+	c.SetRemoteAddress("203.0.113.9:51234")
+	c.SetHostname("ws02.corp.example.com")
+	m.RegisterClient(c)
+	if _, quarantined := m.QuarantineReason("client2"); !quarantined {
+		t.Error("Expected a client outside the authorized ranges to be quarantined")
+	}
+	if m.ScopePending("client2") {
+		t.Error("Expected a quarantined client not to be pending")
+	}
+
+	if err := m.ReportHostname("missing", "ws03.corp.example.com"); err != ErrClientNotFound {
+		t.Errorf("Expected ErrClientNotFound, got %v", err)
+	}
+}
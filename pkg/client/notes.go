@@ -0,0 +1,213 @@
+package client
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"dinoc2/pkg/events"
+)
+
+var (
+	// ErrInvalidNote is returned when a note is empty or too long
+	ErrInvalidNote = errors.New("invalid note")
+
+	// ErrInvalidLock is returned when a lock is taken without an operator or for a negative duration
+	ErrInvalidLock = errors.New("invalid lock")
+
+	// ErrClientLocked is returned when another operator holds the lock on a client
+	ErrClientLocked = errors.New("client is locked by another operator")
+
+	// ErrLockNotHeld is returned when releasing a lock the operator does not hold
+	ErrLockNotHeld = errors.New("client lock is not held")
+)
+
+const (
+	// DefaultLockDuration is how long a lock is held when no duration is given
+	DefaultLockDuration = 30 * time.Minute
+
+	// MaxLockDuration is the longest a lock can be held before it must be renewed
+	MaxLockDuration = 24 * time.Hour
+
+	// maxNoteLength is the longest note that can be attached to a client, in bytes
+	maxNoteLength = 4096
+)
+
+// Note is a timestamped note an operator attached to a client
+type Note struct {
+	ID        int       `json:"id"`
+	Operator  string    `json:"operator"`
+	Text      string    `json:"text"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// Lock is an operator's time-limited claim on a client. While it is held, the
+// tasks other operators create for the client are refused or flagged.
+type Lock struct {
+	Operator   string    `json:"operator"`
+	Reason     string    `json:"reason,omitempty"`
+	AcquiredAt time.Time `json:"acquired_at"`
+	ExpiresAt  time.Time `json:"expires_at"`
+}
+
+// AddNote attaches a note to a client
+func (m *Manager) AddNote(clientID, operator, text string) (Note, error) {
+	text = strings.TrimSpace(text)
+	if text == "" {
+		return Note{}, fmt.Errorf("%w: text is required", ErrInvalidNote)
+	}
+	if len(text) > maxNoteLength {
+		return Note{}, fmt.Errorf("%w: text is longer than %d bytes", ErrInvalidNote, maxNoteLength)
+	}
+
+	m.clientMutex.Lock()
+	defer m.clientMutex.Unlock()
+
+	client, exists := m.clients[clientID]
+	if !exists {
+		return Note{}, ErrClientNotFound
+	}
+
+	note := Note{ID: 1, Operator: operator, Text: text, CreatedAt: time.Now()}
+	if notes := m.notes[clientID]; len(notes) > 0 {
+		note.ID = notes[len(notes)-1].ID + 1
+	}
+	m.notes[clientID] = append(m.notes[clientID], note)
+
+	m.persist(clientID, client)
+	return note, nil
+}
+
+// Notes returns the notes attached to a client, oldest first
+func (m *Manager) Notes(clientID string) ([]Note, error) {
+	m.clientMutex.RLock()
+	defer m.clientMutex.RUnlock()
+
+	if _, exists := m.clients[clientID]; !exists {
+		return nil, ErrClientNotFound
+	}
+	return append([]Note(nil), m.notes[clientID]...), nil
+}
+
+// LockClient takes or renews an operator's lock on a client for the given
+// duration, DefaultLockDuration if it is zero and at most MaxLockDuration.
+// It returns ErrClientLocked if another operator holds the lock.
+func (m *Manager) LockClient(clientID, operator string, duration time.Duration, reason string) (Lock, error) {
+	if operator == "" {
+		return Lock{}, fmt.Errorf("%w: an operator is required", ErrInvalidLock)
+	}
+	if duration < 0 {
+		return Lock{}, fmt.Errorf("%w: duration must not be negative", ErrInvalidLock)
+	}
+	if duration == 0 {
+		duration = DefaultLockDuration
+	}
+	if duration > MaxLockDuration {
+		duration = MaxLockDuration
+	}
+
+	m.clientMutex.Lock()
+	defer m.clientMutex.Unlock()
+
+	client, exists := m.clients[clientID]
+	if !exists {
+		return Lock{}, ErrClientNotFound
+	}
+
+	now := time.Now()
+	lock, held := m.lockOf(clientID, now)
+	if held && lock.Operator != operator {
+		return Lock{}, lockedError(lock)
+	}
+	if !held {
+		lock = Lock{Operator: operator, AcquiredAt: now}
+	}
+	lock.Reason = reason
+	lock.ExpiresAt = now.Add(duration)
+	m.locks[clientID] = lock
+	log.Printf("Client %s locked by %s until %s", clientID, operator, lock.ExpiresAt.Format(time.RFC3339))
+
+	m.events.Publish(events.TypeClientLocked, events.ClientEvent{
+		ClientID:      clientID,
+		Protocol:      client.GetCurrentProtocol(),
+		RemoteAddress: client.GetRemoteAddress(),
+		Operator:      operator,
+		Reason:        reason,
+	})
+
+	m.persist(clientID, client)
+	return lock, nil
+}
+
+// UnlockClient releases an operator's lock on a client. A lock held by another
+// operator is only released if force is set.
+func (m *Manager) UnlockClient(clientID, operator string, force bool) error {
+	m.clientMutex.Lock()
+	defer m.clientMutex.Unlock()
+
+	client, exists := m.clients[clientID]
+	if !exists {
+		return ErrClientNotFound
+	}
+
+	lock, held := m.lockOf(clientID, time.Now())
+	if !held {
+		return ErrLockNotHeld
+	}
+	if lock.Operator != operator && !force {
+		return lockedError(lock)
+	}
+	delete(m.locks, clientID)
+	log.Printf("Client %s unlocked by %s (held by %s)", clientID, operator, lock.Operator)
+
+	m.events.Publish(events.TypeClientUnlocked, events.ClientEvent{
+		ClientID:      clientID,
+		Protocol:      client.GetCurrentProtocol(),
+		RemoteAddress: client.GetRemoteAddress(),
+		Operator:      operator,
+		Reason:        fmt.Sprintf("lock held by %s released", lock.Operator),
+	})
+
+	m.persist(clientID, client)
+	return nil
+}
+
+// ClientLock returns the lock held on a client, and whether one is held
+func (m *Manager) ClientLock(clientID string) (Lock, bool) {
+	m.clientMutex.Lock()
+	defer m.clientMutex.Unlock()
+
+	return m.lockOf(clientID, time.Now())
+}
+
+// CheckLock returns ErrClientLocked if an operator other than the given one
+// holds the lock on a client
+func (m *Manager) CheckLock(clientID, operator string) error {
+	lock, held := m.ClientLock(clientID)
+	if held && lock.Operator != operator {
+		return lockedError(lock)
+	}
+	return nil
+}
+
+// lockOf returns the lock held on a client, dropping it if it has expired.
+// The caller must hold the mutex.
+func (m *Manager) lockOf(clientID string, now time.Time) (Lock, bool) {
+	lock, exists := m.locks[clientID]
+	if !exists {
+		return Lock{}, false
+	}
+	if !now.Before(lock.ExpiresAt) {
+		log.Printf("Lock on client %s held by %s expired", clientID, lock.Operator)
+		delete(m.locks, clientID)
+		return Lock{}, false
+	}
+	return lock, true
+}
+
+// lockedError describes a lock held by another operator
+func lockedError(lock Lock) error {
+	return fmt.Errorf("%w: %s holds it until %s", ErrClientLocked, lock.Operator, lock.ExpiresAt.Format(time.RFC3339))
+}
@@ -0,0 +1,81 @@
+package client
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"dinoc2/pkg/crypto"
+	"dinoc2/pkg/store"
+)
+
+func TestClientNotesAndLocks(t *testing.T) {
+	s := store.NewMemoryStore()
+	m := NewManager()
+	if err := m.SetStore(s); err != nil {
+		t.Fatalf("Failed to set store: %v", err)
+	}
+	m.RegisterClient(&Client{config: DefaultConfig(), sessionID: crypto.SessionID("web1")})
+
+	if _, err := m.AddNote("web1", "alice", "  "); !errors.Is(err, ErrInvalidNote) {
+		t.Errorf("Expected ErrInvalidNote for an empty note, got %v", err)
+	}
+	m.AddNote("web1", "alice", "domain controller")
+	note, err := m.AddNote("web1", "bob", "AV is Defender")
+	if err != nil {
+		t.Fatalf("Failed to add note: %v", err)
+	}
+	if note.ID != 2 || note.Operator != "bob" {
+		t.Errorf("Expected note 2 by bob, got %+v", note)
+	}
+
+	// The lock holder can renew it, other operators cannot take it
+	if _, err := m.LockClient("web1", "alice", time.Hour, "escalating"); err != nil {
+		t.Fatalf("Failed to lock client: %v", err)
+	}
+	if _, err := m.LockClient("web1", "bob", 0, ""); !errors.Is(err, ErrClientLocked) {
+		t.Errorf("Expected ErrClientLocked, got %v", err)
+	}
+	lock, err := m.LockClient("web1", "alice", 48*time.Hour, "still escalating")
+	if err != nil {
+		t.Fatalf("Failed to renew lock: %v", err)
+	}
+	if lock.ExpiresAt.Sub(lock.AcquiredAt) > MaxLockDuration+time.Second {
+		t.Errorf("Expected the lock to be capped at %s, got %s", MaxLockDuration, lock.ExpiresAt.Sub(lock.AcquiredAt))
+	}
+	if err := m.CheckLock("web1", "alice"); err != nil {
+		t.Errorf("Expected the lock holder to pass, got %v", err)
+	}
+	if err := m.CheckLock("web1", "bob"); !errors.Is(err, ErrClientLocked) {
+		t.Errorf("Expected ErrClientLocked for another operator, got %v", err)
+	}
+
+	// Notes and locks survive a restart
+	restarted := NewManager()
+	if err := restarted.SetStore(s); err != nil {
+		t.Fatalf("Failed to restore clients: %v", err)
+	}
+	if notes, _ := restarted.Notes("web1"); len(notes) != 2 || notes[0].Text != "domain controller" {
+		t.Errorf("Expected both notes to be restored, got %+v", notes)
+	}
+	if lock, held := restarted.ClientLock("web1"); !held || lock.Operator != "alice" {
+		t.Errorf("Expected alice's lock to be restored, got %+v", lock)
+	}
+
+	// Only the holder releases a lock, unless it is forced
+	if err := m.UnlockClient("web1", "bob", false); !errors.Is(err, ErrClientLocked) {
+		t.Errorf("Expected ErrClientLocked, got %v", err)
+	}
+	if err := m.UnlockClient("web1", "bob", true); err != nil {
+		t.Fatalf("Failed to force unlock: %v", err)
+	}
+	if err := m.UnlockClient("web1", "alice", false); !errors.Is(err, ErrLockNotHeld) {
+		t.Errorf("Expected ErrLockNotHeld, got %v", err)
+	}
+
+	// Expired locks no longer hold anyone back
+	m.locks["web1"] = Lock{Operator: "alice", ExpiresAt: time.Now().Add(-time.Minute)}
+	if err := m.CheckLock("web1", "bob"); err != nil {
+		t.Errorf("Expected an expired lock to be ignored, got %v", err)
+	}
+}
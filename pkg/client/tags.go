@@ -0,0 +1,237 @@
+package client
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+var (
+	// ErrInvalidTag is returned when a tag key or value contains characters that are not allowed
+	ErrInvalidTag = errors.New("invalid tag")
+
+	// ErrInvalidSelector is returned when a tag selector cannot be parsed
+	ErrInvalidSelector = errors.New("invalid selector")
+)
+
+var (
+	tagKeyPattern   = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9_./-]*$`)
+	tagValuePattern = regexp.MustCompile(`^[A-Za-z0-9_./:-]*$`)
+)
+
+// Requirement is one condition of a selector on a client's tags
+type Requirement struct {
+	Key    string
+	Value  string
+	Negate bool // key!=value, or !key without a value
+	Exists bool // the requirement is only on the key being present
+}
+
+// Selector chooses clients by their tags. All requirements must match.
+type Selector []Requirement
+
+// ParseSelector parses a comma-separated list of requirements: key=value,
+// key!=value, key (has the tag) and !key (does not have the tag), for example
+// "segment=dmz,os=linux"
+func ParseSelector(selector string) (Selector, error) {
+	var parsed Selector
+	for _, term := range strings.Split(selector, ",") {
+		term = strings.TrimSpace(term)
+		if term == "" {
+			continue
+		}
+
+		var requirement Requirement
+		switch {
+		case strings.Contains(term, "!="):
+			requirement.Key, requirement.Value, _ = strings.Cut(term, "!=")
+			requirement.Negate = true
+		case strings.Contains(term, "="):
+			requirement.Key, requirement.Value, _ = strings.Cut(term, "=")
+		case strings.HasPrefix(term, "!"):
+			requirement.Key = term[1:]
+			requirement.Exists = true
+			requirement.Negate = true
+		default:
+			requirement.Key = term
+			requirement.Exists = true
+		}
+
+		requirement.Key = strings.TrimSpace(requirement.Key)
+		requirement.Value = strings.TrimSpace(requirement.Value)
+		if err := validateTag(requirement.Key, requirement.Value); err != nil {
+			return nil, fmt.Errorf("%w: %q: %v", ErrInvalidSelector, term, err)
+		}
+		parsed = append(parsed, requirement)
+	}
+
+	if len(parsed) == 0 {
+		return nil, fmt.Errorf("%w: selector is empty", ErrInvalidSelector)
+	}
+	return parsed, nil
+}
+
+// Matches reports whether a set of tags satisfies every requirement of the selector
+func (s Selector) Matches(tags map[string]string) bool {
+	for _, requirement := range s {
+		value, exists := tags[requirement.Key]
+		matches := exists && (requirement.Exists || value == requirement.Value)
+		if matches == requirement.Negate {
+			return false
+		}
+	}
+	return true
+}
+
+// String returns the selector in the form ParseSelector accepts
+func (s Selector) String() string {
+	terms := make([]string, len(s))
+	for i, requirement := range s {
+		switch {
+		case requirement.Exists && requirement.Negate:
+			terms[i] = "!" + requirement.Key
+		case requirement.Exists:
+			terms[i] = requirement.Key
+		case requirement.Negate:
+			terms[i] = requirement.Key + "!=" + requirement.Value
+		default:
+			terms[i] = requirement.Key + "=" + requirement.Value
+		}
+	}
+	return strings.Join(terms, ",")
+}
+
+// validateTag checks a tag key and value
+func validateTag(key, value string) error {
+	if !tagKeyPattern.MatchString(key) {
+		return fmt.Errorf("%w: key %q must start with a letter or digit and contain only letters, digits and _ . / -", ErrInvalidTag, key)
+	}
+	if !tagValuePattern.MatchString(value) {
+		return fmt.Errorf("%w: value %q may contain only letters, digits and _ . / : -", ErrInvalidTag, value)
+	}
+	return nil
+}
+
+// SetTags adds tags to a client, replacing the values of keys it already has.
+// An empty value removes the tag.
+func (m *Manager) SetTags(clientID string, tags map[string]string) error {
+	for key, value := range tags {
+		if err := validateTag(key, value); err != nil {
+			return err
+		}
+	}
+
+	m.clientMutex.Lock()
+	defer m.clientMutex.Unlock()
+
+	client, exists := m.clients[clientID]
+	if !exists {
+		return ErrClientNotFound
+	}
+
+	for key, value := range tags {
+		m.untag(clientID, key)
+		if value != "" {
+			m.tag(clientID, key, value)
+		}
+	}
+	m.persist(clientID, client)
+	return nil
+}
+
+// Tags returns the tags of a client
+func (m *Manager) Tags(clientID string) map[string]string {
+	m.clientMutex.RLock()
+	defer m.clientMutex.RUnlock()
+
+	tags := make(map[string]string, len(m.tags[clientID]))
+	for key, value := range m.tags[clientID] {
+		tags[key] = value
+	}
+	return tags
+}
+
+// Select returns the IDs of the clients whose tags match a selector, sorted
+func (m *Manager) Select(selector Selector) []string {
+	m.clientMutex.RLock()
+	defer m.clientMutex.RUnlock()
+
+	// Start from the smallest set of clients with a tag the selector requires,
+	// so that only those need to be checked against every requirement
+	var candidates map[string]bool
+	indexed := false
+	for _, requirement := range selector {
+		if requirement.Negate || requirement.Exists {
+			continue
+		}
+		clients := m.tagIndex[requirement.Key][requirement.Value]
+		if !indexed || len(clients) < len(candidates) {
+			candidates = clients
+			indexed = true
+		}
+	}
+
+	var clientIDs []string
+	if !indexed {
+		for clientID := range m.clients {
+			if selector.Matches(m.tags[clientID]) {
+				clientIDs = append(clientIDs, clientID)
+			}
+		}
+	} else {
+		for clientID := range candidates {
+			if _, exists := m.clients[clientID]; exists && selector.Matches(m.tags[clientID]) {
+				clientIDs = append(clientIDs, clientID)
+			}
+		}
+	}
+
+	sort.Strings(clientIDs)
+	return clientIDs
+}
+
+// tag sets a tag of a client and indexes it. The caller must hold the mutex.
+func (m *Manager) tag(clientID, key, value string) {
+	if m.tags[clientID] == nil {
+		m.tags[clientID] = make(map[string]string)
+	}
+	m.tags[clientID][key] = value
+
+	if m.tagIndex[key] == nil {
+		m.tagIndex[key] = make(map[string]map[string]bool)
+	}
+	if m.tagIndex[key][value] == nil {
+		m.tagIndex[key][value] = make(map[string]bool)
+	}
+	m.tagIndex[key][value][clientID] = true
+}
+
+// untag removes a tag of a client from the tags and the index. The caller must hold the mutex.
+func (m *Manager) untag(clientID, key string) {
+	value, exists := m.tags[clientID][key]
+	if !exists {
+		return
+	}
+
+	delete(m.tags[clientID], key)
+	if len(m.tags[clientID]) == 0 {
+		delete(m.tags, clientID)
+	}
+
+	delete(m.tagIndex[key][value], clientID)
+	if len(m.tagIndex[key][value]) == 0 {
+		delete(m.tagIndex[key], value)
+	}
+	if len(m.tagIndex[key]) == 0 {
+		delete(m.tagIndex, key)
+	}
+}
+
+// untagAll removes every tag of a client. The caller must hold the mutex.
+func (m *Manager) untagAll(clientID string) {
+	for key := range m.tags[clientID] {
+		m.untag(clientID, key)
+	}
+}
@@ -0,0 +1,65 @@
+package client
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+
+	"dinoc2/pkg/crypto"
+	"dinoc2/pkg/store"
+)
+
+func TestSelectClientsByTags(t *testing.T) {
+	s := store.NewMemoryStore()
+	m := NewManager()
+	if err := m.SetStore(s); err != nil {
+		t.Fatalf("Failed to set store: %v", err)
+	}
+
+	tags := map[string]map[string]string{
+		"web1": {"segment": "dmz", "os": "linux"},
+		"web2": {"segment": "dmz", "os": "windows"},
+		"db1":  {"segment": "internal", "os": "linux", "critical": "yes"},
+	}
+	for id, clientTags := range tags {
+		m.RegisterClient(&Client{config: DefaultConfig(), sessionID: crypto.SessionID(id)})
+		if err := m.SetTags(id, clientTags); err != nil {
+			t.Fatalf("Failed to tag %s: %v", id, err)
+		}
+	}
+
+	tests := map[string][]string{
+		"segment=dmz":            {"web1", "web2"},
+		"segment=dmz, os=linux":  {"web1"},
+		"os=linux,!critical":     {"web1"},
+		"critical":               {"db1"},
+		"segment!=dmz":           {"db1"},
+		"os=linux,segment=other": nil,
+	}
+	for selector, expected := range tests {
+		parsed, err := ParseSelector(selector)
+		if err != nil {
+			t.Fatalf("Failed to parse %q: %v", selector, err)
+		}
+		if got := m.Select(parsed); !reflect.DeepEqual(got, expected) {
+			t.Errorf("Selector %q: expected %v, got %v", selector, expected, got)
+		}
+	}
+
+	for _, selector := range []string{"", "segment=dmz;rm", "=dmz"} {
+		if _, err := ParseSelector(selector); !errors.Is(err, ErrInvalidSelector) {
+			t.Errorf("Selector %q: expected ErrInvalidSelector, got %v", selector, err)
+		}
+	}
+
+	// Removing a tag updates the index, and tags survive a restart
+	m.SetTags("web2", map[string]string{"segment": ""})
+	restarted := NewManager()
+	if err := restarted.SetStore(s); err != nil {
+		t.Fatalf("Failed to restore clients: %v", err)
+	}
+	parsed, _ := ParseSelector("segment=dmz")
+	if got := restarted.Select(parsed); !reflect.DeepEqual(got, []string{"web1"}) {
+		t.Errorf("Expected only web1 after untagging web2, got %v", got)
+	}
+}
@@ -3,6 +3,9 @@ package crypto
 import (
 	"bytes"
 	"testing"
+	"time"
+
+	"dinoc2/pkg/store"
 )
 
 func TestAESEncryption(t *testing.T) {
@@ -218,3 +221,70 @@ func TestSessionManager(t *testing.T) {
 		t.Fatalf("Expected 1 session after removal, got %d", count)
 	}
 }
+
+func TestSessionRecords(t *testing.T) {
+	s := store.NewMemoryStore()
+	SetSessionStore(s)
+	defer SetSessionStore(nil)
+
+	// Records that have not been rotated within the rotation interval are pruned on load
+	now := time.Now()
+	s.Put(sessionCollection, "old", SessionRecord{ID: "old", LastRotation: now.Add(-2 * sessionRotationInterval)})
+	s.Put(sessionCollection, "kept", SessionRecord{ID: "kept", CreatedAt: now.Add(-time.Hour), LastRotation: now, RotationCount: 3})
+	records, err := LoadSessionRecords()
+	if err != nil {
+		t.Fatalf("LoadSessionRecords: %v", err)
+	}
+	if len(records) != 1 || records[0].ID != "kept" {
+		t.Fatalf("Expected only the recent record, got %+v", records)
+	}
+	if err := s.Get(sessionCollection, "old", &SessionRecord{}); err != store.ErrNotFound {
+		t.Errorf("Expected the old record to be deleted, got %v", err)
+	}
+
+	manager := NewSessionManager()
+	defer manager.Shutdown()
+
+	// A session re-created after a restart keeps its history
+	kept, err := manager.CreateSession("kept", AlgorithmAES)
+	if err != nil {
+		t.Fatalf("Failed to create session: %v", err)
+	}
+	if kept.RotationCount != 3 {
+		t.Errorf("Expected the rotation count to be restored, got %d", kept.RotationCount)
+	}
+
+	// Sessions are written in batches, and short-lived sessions not at all
+	if _, err := manager.CreateSession("packet", AlgorithmAES); err != nil {
+		t.Fatalf("Failed to create session: %v", err)
+	}
+	if err := manager.RemoveSession("packet"); err != nil {
+		t.Fatalf("Failed to remove session: %v", err)
+	}
+	if _, err := manager.CreateSession("long", AlgorithmAES); err != nil {
+		t.Fatalf("Failed to create session: %v", err)
+	}
+	if err := s.Get(sessionCollection, "long", &SessionRecord{}); err != store.ErrNotFound {
+		t.Errorf("Expected the session not to be written before a flush, got %v", err)
+	}
+	if err := FlushSessionRecords(); err != nil {
+		t.Fatalf("FlushSessionRecords: %v", err)
+	}
+	if err := s.Get(sessionCollection, "long", &SessionRecord{}); err != nil {
+		t.Errorf("Expected the session to be written by the flush: %v", err)
+	}
+	if err := s.Get(sessionCollection, "packet", &SessionRecord{}); err != store.ErrNotFound {
+		t.Errorf("Expected the short-lived session never to be written, got %v", err)
+	}
+
+	// Closing a session deletes its record at the next flush
+	if err := manager.RemoveSession("long"); err != nil {
+		t.Fatalf("Failed to remove session: %v", err)
+	}
+	if err := FlushSessionRecords(); err != nil {
+		t.Fatalf("FlushSessionRecords: %v", err)
+	}
+	if err := s.Get(sessionCollection, "long", &SessionRecord{}); err != store.ErrNotFound {
+		t.Errorf("Expected the closed session's record to be deleted, got %v", err)
+	}
+}
@@ -1,13 +1,241 @@
 package crypto
 
 import (
+	"encoding/hex"
+	"encoding/json"
 	"errors"
+	"fmt"
 	"sync"
+	"sync/atomic"
 	"time"
+
+	"dinoc2/pkg/store"
 )
 
 // SessionID is defined in crypto.go
 
+// sessionCollection is the store collection that holds session metadata
+const sessionCollection = "sessions"
+
+// SessionRecord is the persisted metadata of a session.
+// Key material is never persisted; clients re-key after a server restart.
+type SessionRecord struct {
+	ID             SessionID `json:"id"`
+	Algorithm      Algorithm `json:"algorithm"`
+	KeyFingerprint string    `json:"key_fingerprint"`
+	CreatedAt      time.Time `json:"created_at"`
+	LastRotation   time.Time `json:"last_rotation"`
+	RotationCount  int       `json:"rotation_count"`
+}
+
+// sessionRotationInterval is how often session keys are rotated. Persisted
+// records that have not been rotated for this long belong to sessions that are
+// gone and are pruned.
+const sessionRotationInterval = 12 * time.Hour
+
+// sessionFlushInterval is how often changes to session metadata are written
+// to the store. Listeners that create a session for every packet would
+// otherwise write to the store twice per packet; sessions that are created
+// and removed between two flushes are never written at all.
+var sessionFlushInterval = 30 * time.Second
+
+// The session store and the records not yet written to it are shared by all
+// session managers, since every protocol handler has its own
+var (
+	sessionStore      store.Store
+	sessionStoreMutex sync.Mutex
+	restoredSessions  = make(map[SessionID]SessionRecord)  // Records loaded on start
+	pendingSessions   = make(map[SessionID]*SessionRecord) // Changes not yet written; nil deletes the record
+	storedSessions    = make(map[SessionID]time.Time)      // Last rotation of each record in the store
+	sessionFlushStop  chan struct{}
+	sessionFlushDone  chan struct{}
+)
+
+// SetSessionStore sets the store that session metadata is persisted to
+func SetSessionStore(s store.Store) {
+	sessionStoreMutex.Lock()
+	defer sessionStoreMutex.Unlock()
+
+	sessionStore = s
+	restoredSessions = make(map[SessionID]SessionRecord)
+	pendingSessions = make(map[SessionID]*SessionRecord)
+	storedSessions = make(map[SessionID]time.Time)
+}
+
+// LoadSessionRecords loads the persisted metadata of all sessions, so that
+// sessions re-created after a restart keep their history, and returns it.
+// Records that have not been rotated within the rotation interval are deleted.
+func LoadSessionRecords() ([]SessionRecord, error) {
+	sessionStoreMutex.Lock()
+	defer sessionStoreMutex.Unlock()
+
+	if sessionStore == nil {
+		return nil, nil
+	}
+
+	data, err := sessionStore.List(sessionCollection)
+	if err != nil {
+		return nil, err
+	}
+
+	cutoff := time.Now().Add(-sessionRotationInterval)
+	records := make([]SessionRecord, 0, len(data))
+	for _, item := range data {
+		var record SessionRecord
+		if err := json.Unmarshal(item, &record); err != nil {
+			return nil, fmt.Errorf("failed to load session record: %w", err)
+		}
+		if record.LastRotation.Before(cutoff) {
+			if err := sessionStore.Delete(sessionCollection, string(record.ID)); err != nil {
+				return nil, fmt.Errorf("failed to prune session record: %w", err)
+			}
+			continue
+		}
+		restoredSessions[record.ID] = record
+		storedSessions[record.ID] = record.LastRotation
+		records = append(records, record)
+	}
+	return records, nil
+}
+
+// restoreSessionRecord fills in the history of a session from the metadata loaded on start
+func restoreSessionRecord(session *Session) {
+	sessionStoreMutex.Lock()
+	defer sessionStoreMutex.Unlock()
+
+	if record, exists := restoredSessions[session.ID]; exists {
+		session.CreatedAt = record.CreatedAt
+		session.RotationCount = record.RotationCount
+	}
+}
+
+// persistSession queues the metadata of a session to be written to the store, if one is set
+func persistSession(session *Session) {
+	sessionStoreMutex.Lock()
+	defer sessionStoreMutex.Unlock()
+
+	if sessionStore == nil {
+		return
+	}
+
+	pendingSessions[session.ID] = &SessionRecord{
+		ID:             session.ID,
+		Algorithm:      session.Encryptor.Algorithm(),
+		KeyFingerprint: hex.EncodeToString(session.Encryptor.GetKeyFingerprint()),
+		CreatedAt:      session.CreatedAt,
+		LastRotation:   session.LastRotation,
+		RotationCount:  session.RotationCount,
+	}
+}
+
+// forgetSession queues the metadata of a session to be removed from the store.
+// A session that was never written is only dropped from the queue.
+func forgetSession(id SessionID) {
+	sessionStoreMutex.Lock()
+	defer sessionStoreMutex.Unlock()
+
+	delete(restoredSessions, id)
+	if _, stored := storedSessions[id]; stored {
+		pendingSessions[id] = nil
+	} else {
+		delete(pendingSessions, id)
+	}
+}
+
+// FlushSessionRecords writes the queued session metadata to the store and
+// prunes records that have not been rotated within the rotation interval
+func FlushSessionRecords() error {
+	sessionStoreMutex.Lock()
+	s := sessionStore
+	pending := pendingSessions
+	pendingSessions = make(map[SessionID]*SessionRecord)
+	cutoff := time.Now().Add(-sessionRotationInterval)
+	for id, lastRotation := range storedSessions {
+		if _, queued := pending[id]; !queued && lastRotation.Before(cutoff) {
+			pending[id] = nil
+		}
+	}
+	for id, record := range pending {
+		if record != nil {
+			storedSessions[id] = record.LastRotation
+		} else {
+			delete(storedSessions, id)
+			delete(restoredSessions, id)
+		}
+	}
+	sessionStoreMutex.Unlock()
+
+	if s == nil {
+		return nil
+	}
+
+	var lastErr error
+	for id, record := range pending {
+		var err error
+		if record != nil {
+			err = s.Put(sessionCollection, string(id), record)
+		} else {
+			err = s.Delete(sessionCollection, string(id))
+		}
+		if err != nil {
+			lastErr = fmt.Errorf("failed to persist session %s: %w", id, err)
+		}
+	}
+	return lastErr
+}
+
+// StartSessionFlush starts writing queued session metadata to the store every flush interval
+func StartSessionFlush() {
+	sessionStoreMutex.Lock()
+	defer sessionStoreMutex.Unlock()
+
+	if sessionFlushStop != nil {
+		return
+	}
+	stop, done := make(chan struct{}), make(chan struct{})
+	sessionFlushStop, sessionFlushDone = stop, done
+
+	go func() {
+		defer close(done)
+		ticker := time.NewTicker(sessionFlushInterval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ticker.C:
+				if err := FlushSessionRecords(); err != nil {
+					fmt.Printf("Failed to flush session records: %v\n", err)
+				}
+			case <-stop:
+				return
+			}
+		}
+	}()
+}
+
+// StopSessionFlush stops the periodic flush and writes the metadata still queued
+func StopSessionFlush() error {
+	sessionStoreMutex.Lock()
+	stop, done := sessionFlushStop, sessionFlushDone
+	sessionFlushStop, sessionFlushDone = nil, nil
+	sessionStoreMutex.Unlock()
+
+	if stop != nil {
+		close(stop)
+		<-done
+	}
+	return FlushSessionRecords()
+}
+
+// activeSessions counts the sessions of all session managers, since every
+// protocol handler has its own
+var activeSessions atomic.Int64
+
+// ActiveSessionCount returns the number of active sessions across all session managers
+func ActiveSessionCount() int {
+	return int(activeSessions.Load())
+}
+
 // Session represents an encryption session with a client
 type Session struct {
 	ID            SessionID
@@ -66,8 +294,13 @@ func (m *SessionManager) CreateSession(id SessionID, algorithm Algorithm) (*Sess
 		RotationCount: 0,
 	}
 	
+	// A session re-created after a restart keeps its history
+	restoreSessionRecord(session)
+	
 	// Add the session to the map
 	m.sessions[id] = session
+	activeSessions.Add(1)
+	persistSession(session)
 	
 	return session, nil
 }
@@ -98,6 +331,8 @@ func (m *SessionManager) RemoveSession(id SessionID) error {
 	}
 	
 	delete(m.sessions, id)
+	activeSessions.Add(-1)
+	forgetSession(id)
 	return nil
 }
 
@@ -119,6 +354,7 @@ func (m *SessionManager) RotateSessionKey(id SessionID) error {
 	// Update session metadata
 	session.LastRotation = time.Now()
 	session.RotationCount++
+	persistSession(session)
 	
 	return nil
 }
@@ -145,15 +381,13 @@ func (m *SessionManager) RotateAllKeys() {
 		// Update session metadata
 		session.LastRotation = now
 		session.RotationCount++
+		persistSession(session)
 	}
 }
 
 // startRotationTimer starts a timer to periodically rotate keys
 func (m *SessionManager) startRotationTimer() {
-	// Rotate keys every 12 hours
-	rotationInterval := 12 * time.Hour
-	
-	m.rotationTimer = time.NewTimer(rotationInterval)
+	m.rotationTimer = time.NewTimer(sessionRotationInterval)
 	
 	go func() {
 		for {
@@ -163,7 +397,7 @@ func (m *SessionManager) startRotationTimer() {
 				m.RotateAllKeys()
 				
 				// Reset the timer
-				m.rotationTimer.Reset(rotationInterval)
+				m.rotationTimer.Reset(sessionRotationInterval)
 			case <-m.rotationDone:
 				// Stop the timer
 				if !m.rotationTimer.Stop() {
@@ -185,6 +419,7 @@ func (m *SessionManager) Shutdown() {
 	defer m.mutex.Unlock()
 	
 	// Clear all sessions
+	activeSessions.Add(-int64(len(m.sessions)))
 	m.sessions = make(map[SessionID]*Session)
 }
 
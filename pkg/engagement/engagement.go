@@ -0,0 +1,164 @@
+package engagement
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+)
+
+// State describes where the current time falls in the engagement window
+type State string
+
+const (
+	StatePending State = "pending"
+	StateActive  State = "active"
+	StateClosed  State = "closed"
+)
+
+var (
+	// ErrNotStarted is returned before the engagement start date
+	ErrNotStarted = errors.New("engagement has not started")
+	// ErrClosed is returned after the engagement end date
+	ErrClosed = errors.New("engagement is closed")
+)
+
+// Config describes the authorized engagement window
+type Config struct {
+	Name  string     `json:"name,omitempty"`
+	Start *time.Time `json:"start,omitempty"`
+	End   *time.Time `json:"end,omitempty"` // the kill date, after which nothing may run
+}
+
+// Status reports the state of the engagement
+type Status struct {
+	Name      string     `json:"name,omitempty"`
+	State     State      `json:"state"`
+	Start     *time.Time `json:"start,omitempty"`
+	End       *time.Time `json:"end,omitempty"`
+	Remaining string     `json:"remaining,omitempty"`
+}
+
+// Engagement tracks the engagement window and runs shutdown hooks when it closes
+type Engagement struct {
+	config  Config
+	closed  bool
+	onClose []func()
+	stop    chan struct{}
+	mutex   sync.Mutex
+}
+
+// New creates an engagement from its configuration
+func New(config Config) (*Engagement, error) {
+	if config.Start != nil && config.End != nil && !config.End.After(*config.Start) {
+		return nil, fmt.Errorf("engagement end %s is not after its start %s",
+			config.End.Format(time.RFC3339), config.Start.Format(time.RFC3339))
+	}
+
+	return &Engagement{
+		config: config,
+		stop:   make(chan struct{}),
+	}, nil
+}
+
+// State returns the state of the engagement at the given time
+func (e *Engagement) State(now time.Time) State {
+	if e.config.End != nil && !now.Before(*e.config.End) {
+		return StateClosed
+	}
+	if e.config.Start != nil && now.Before(*e.config.Start) {
+		return StatePending
+	}
+	return StateActive
+}
+
+// Check returns an error unless the engagement is active now
+func (e *Engagement) Check() error {
+	switch e.State(time.Now()) {
+	case StatePending:
+		return fmt.Errorf("%w: it starts at %s", ErrNotStarted, e.config.Start.Format(time.RFC3339))
+	case StateClosed:
+		return fmt.Errorf("%w: it ended at %s", ErrClosed, e.config.End.Format(time.RFC3339))
+	}
+	return nil
+}
+
+// Status returns the current status of the engagement
+func (e *Engagement) Status() Status {
+	now := time.Now()
+	status := Status{
+		Name:  e.config.Name,
+		State: e.State(now),
+		Start: e.config.Start,
+		End:   e.config.End,
+	}
+	if status.State != StateClosed && e.config.End != nil {
+		status.Remaining = e.config.End.Sub(now).Round(time.Second).String()
+	}
+	return status
+}
+
+// OnClose registers a function to run once when the engagement closes
+func (e *Engagement) OnClose(fn func()) {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+
+	e.onClose = append(e.onClose, fn)
+}
+
+// Watch waits for the end of the engagement and runs the close hooks.
+// If the engagement has already ended, the hooks run immediately.
+func (e *Engagement) Watch() {
+	if e.config.End == nil {
+		return
+	}
+
+	for {
+		remaining := time.Until(*e.config.End)
+		if remaining <= 0 {
+			e.close()
+			return
+		}
+
+		// Wake up at least once a minute so clock changes are noticed
+		if remaining > time.Minute {
+			remaining = time.Minute
+		}
+
+		select {
+		case <-time.After(remaining):
+		case <-e.stop:
+			return
+		}
+	}
+}
+
+// Stop stops watching for the end of the engagement
+func (e *Engagement) Stop() {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+
+	select {
+	case <-e.stop:
+	default:
+		close(e.stop)
+	}
+}
+
+// close runs the close hooks once
+func (e *Engagement) close() {
+	e.mutex.Lock()
+	if e.closed {
+		e.mutex.Unlock()
+		return
+	}
+	e.closed = true
+	hooks := e.onClose
+	e.mutex.Unlock()
+
+	log.Printf("Engagement ended at %s, shutting down", e.config.End.Format(time.RFC3339))
+	for _, hook := range hooks {
+		hook()
+	}
+}
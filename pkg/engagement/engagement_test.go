@@ -0,0 +1,50 @@
+package engagement
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestEngagementWindow(t *testing.T) {
+	start := time.Now().Add(-time.Hour)
+	end := time.Now().Add(time.Hour)
+	e, err := New(Config{Start: &start, End: &end})
+	if err != nil {
+		t.Fatalf("Failed to create engagement: %v", err)
+	}
+
+	if e.State(start.Add(-time.Minute)) != StatePending {
+		t.Error("Expected the engagement to be pending before its start")
+	}
+	if err := e.Check(); err != nil {
+		t.Errorf("Expected the engagement to be active, got %v", err)
+	}
+	if e.State(end) != StateClosed {
+		t.Error("Expected the engagement to be closed at its end")
+	}
+
+	if _, err := New(Config{Start: &end, End: &start}); err == nil {
+		t.Error("Expected an end before the start to be rejected")
+	}
+}
+
+func TestEngagementCloseHooks(t *testing.T) {
+	end := time.Now().Add(-time.Second)
+	e, err := New(Config{End: &end})
+	if err != nil {
+		t.Fatalf("Failed to create engagement: %v", err)
+	}
+
+	if err := e.Check(); !errors.Is(err, ErrClosed) {
+		t.Errorf("Expected ErrClosed, got %v", err)
+	}
+
+	closed := 0
+	e.OnClose(func() { closed++ })
+	e.Watch()
+	e.Watch()
+	if closed != 1 {
+		t.Errorf("Expected the close hook to run once, ran %d times", closed)
+	}
+}
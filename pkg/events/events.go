@@ -0,0 +1,166 @@
+package events
+
+import (
+	"sync"
+	"time"
+)
+
+// Type identifies the kind of an event
+type Type string
+
+const (
+	TypeTaskStatus       Type = "task.status"
+	TypeClientRegistered Type = "client.registered"
+	TypeClientLost       Type = "client.lost"
+	TypeClientState      Type = "client.state"
+	TypeClientLocked     Type = "client.locked"
+	TypeClientUnlocked   Type = "client.unlocked"
+	TypeListenerHealth   Type = "listener.health"
+	TypeListenerRestart  Type = "listener.restart"
+	TypeModuleLoad       Type = "module.load"
+	TypePlaybookStatus   Type = "playbook.status"
+)
+
+// historySize is the number of recent events kept for subscribers that reconnect
+const historySize = 256
+
+// Event is a single server event
+type Event struct {
+	ID        uint64      `json:"id"`
+	Type      Type        `json:"type"`
+	Timestamp time.Time   `json:"timestamp"`
+	Data      interface{} `json:"data"`
+}
+
+// TaskEvent describes a task status transition
+type TaskEvent struct {
+	TaskID         uint32 `json:"task_id"`
+	ClientID       string `json:"client_id"`
+	TaskType       string `json:"task_type"`
+	Status         string `json:"status"`
+	PreviousStatus string `json:"previous_status,omitempty"`
+	Error          string `json:"error,omitempty"`
+	Parent         uint32 `json:"parent,omitempty"` // ID of the bulk task the task is a child of
+}
+
+// ClientEvent describes a client registering or being lost
+type ClientEvent struct {
+	ClientID      string `json:"client_id"`
+	Protocol      string `json:"protocol,omitempty"`
+	RemoteAddress string `json:"remote_address,omitempty"`
+	Quarantined   bool   `json:"quarantined,omitempty"`
+	ScopePending  bool   `json:"scope_pending,omitempty"`
+	State         string `json:"state,omitempty"` // lifecycle state, such as active, late or lost
+	PreviousState string `json:"previous_state,omitempty"`
+	Reason        string `json:"reason,omitempty"`
+	Operator      string `json:"operator,omitempty"` // operator who locked or unlocked the client
+}
+
+// ListenerEvent describes a change in a listener's health
+type ListenerEvent struct {
+	ListenerID     string `json:"listener_id"`
+	Status         string `json:"status"`
+	PreviousStatus string `json:"previous_status,omitempty"`
+	Error          string `json:"error,omitempty"`
+	Restarts       int    `json:"restarts,omitempty"` // restarts in a row by the health monitor
+}
+
+// ModuleEvent describes the result of loading a module
+type ModuleEvent struct {
+	Name    string `json:"name"`
+	Path    string `json:"path"`
+	Loader  string `json:"loader"`
+	Success bool   `json:"success"`
+	Error   string `json:"error,omitempty"`
+}
+
+// PlaybookEvent describes a playbook run starting or finishing
+type PlaybookEvent struct {
+	RunID    uint32 `json:"run_id"`
+	Playbook string `json:"playbook"`
+	ClientID string `json:"client_id"`
+	Status   string `json:"status"`
+	Error    string `json:"error,omitempty"`
+}
+
+// Bus delivers events to subscribers. A nil bus discards all events.
+type Bus struct {
+	subscribers map[uint64]chan Event
+	history     []Event
+	nextEventID uint64
+	nextSubID   uint64
+	mutex       sync.Mutex
+}
+
+// NewBus creates a new event bus
+func NewBus() *Bus {
+	return &Bus{
+		subscribers: make(map[uint64]chan Event),
+		nextEventID: 1,
+	}
+}
+
+// Publish sends an event to all subscribers. It never blocks: subscribers that
+// are not keeping up miss the event.
+func (b *Bus) Publish(eventType Type, data interface{}) {
+	if b == nil {
+		return
+	}
+
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	event := Event{
+		ID:        b.nextEventID,
+		Type:      eventType,
+		Timestamp: time.Now().UTC(),
+		Data:      data,
+	}
+	b.nextEventID++
+
+	b.history = append(b.history, event)
+	if len(b.history) > historySize {
+		b.history = b.history[len(b.history)-historySize:]
+	}
+
+	for _, ch := range b.subscribers {
+		select {
+		case ch <- event:
+		default:
+		}
+	}
+}
+
+// Subscribe returns a channel of events and a function to cancel the subscription.
+// Events still in the history with an ID greater than after are delivered first.
+func (b *Bus) Subscribe(after uint64, buffer int) (<-chan Event, func()) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	// Make room for the replayed events so that none are dropped
+	replay := make([]Event, 0)
+	if after > 0 {
+		for _, event := range b.history {
+			if event.ID > after {
+				replay = append(replay, event)
+			}
+		}
+	}
+
+	ch := make(chan Event, buffer+len(replay))
+	for _, event := range replay {
+		ch <- event
+	}
+
+	id := b.nextSubID
+	b.nextSubID++
+	b.subscribers[id] = ch
+
+	unsubscribe := func() {
+		b.mutex.Lock()
+		defer b.mutex.Unlock()
+		delete(b.subscribers, id)
+	}
+
+	return ch, unsubscribe
+}
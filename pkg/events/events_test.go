@@ -0,0 +1,43 @@
+package events
+
+import (
+	"testing"
+)
+
+func TestBusDeliversAndReplays(t *testing.T) {
+	bus := NewBus()
+
+	events, unsubscribe := bus.Subscribe(0, 10)
+	bus.Publish(TypeTaskStatus, TaskEvent{TaskID: 1, Status: "pending"})
+	bus.Publish(TypeTaskStatus, TaskEvent{TaskID: 1, Status: "completed"})
+	unsubscribe()
+
+	first := <-events
+	if first.ID != 1 || first.Type != TypeTaskStatus {
+		t.Errorf("Unexpected first event: %+v", first)
+	}
+
+	// A reconnecting subscriber receives the events it missed
+	replayed, unsubscribe := bus.Subscribe(first.ID, 10)
+	defer unsubscribe()
+
+	event := <-replayed
+	if event.ID != 2 || event.Data.(TaskEvent).Status != "completed" {
+		t.Errorf("Unexpected replayed event: %+v", event)
+	}
+}
+
+func TestBusNeverBlocks(t *testing.T) {
+	bus := NewBus()
+	_, unsubscribe := bus.Subscribe(0, 1)
+	defer unsubscribe()
+
+	// The subscriber never reads, so all but the first event are dropped
+	for i := 0; i < 10; i++ {
+		bus.Publish(TypeListenerHealth, ListenerEvent{ListenerID: "tcp1", Status: "running"})
+	}
+
+	// Publishing to a nil bus is a no-op
+	var nilBus *Bus
+	nilBus.Publish(TypeClientLost, ClientEvent{ClientID: "client-1"})
+}
@@ -0,0 +1,121 @@
+package listener
+
+import (
+	"fmt"
+	"net"
+	"sync"
+
+	"dinoc2/pkg/client"
+	"dinoc2/pkg/protocol"
+)
+
+// ClientTracker remembers the clients registered by a listener that handles
+// each packet on its own, such as the HTTP and DNS listeners, so that a client
+// is registered once rather than for every packet it sends, and its later
+// heartbeats check in the same client
+type ClientTracker struct {
+	listenerType ListenerType
+	mutex        sync.Mutex
+	clients      map[string]string // Client ID by the key the listener identifies the client by
+}
+
+// NewClientTracker creates a client tracker for a listener of the given type
+func NewClientTracker(listenerType ListenerType) *ClientTracker {
+	return &ClientTracker{
+		listenerType: listenerType,
+		clients:      make(map[string]string),
+	}
+}
+
+// Register returns the ID of the client identified by key. A client that is
+// not known yet, or that the client manager has removed since, is created with
+// newClient and registered with the client manager, which records its first
+// check-in. The returned flag reports whether the client was registered now.
+// A hostname the client reported in its handshake is recorded before the
+// client is checked against the engagement scope; an empty hostname is ignored.
+func (t *ClientTracker) Register(clientManager interface{}, key, hostname string, newClient func() (*client.Client, error)) (string, bool, error) {
+	registrar, ok := clientManager.(interface{ RegisterClient(*client.Client) string })
+	if !ok {
+		return "", false, fmt.Errorf("client manager does not implement RegisterClient")
+	}
+
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	if clientID, exists := t.clients[key]; exists {
+		getter, ok := clientManager.(interface {
+			GetClient(string) (*client.Client, error)
+		})
+		if !ok {
+			return clientID, false, nil
+		}
+		if _, err := getter.GetClient(clientID); err == nil {
+			if hostname != "" {
+				reportHostname(clientManager, clientID, hostname)
+			}
+			return clientID, false, nil
+		}
+	}
+
+	c, err := newClient()
+	if err != nil {
+		return "", false, err
+	}
+	if hostname != "" {
+		c.SetHostname(hostname)
+	}
+	clientID := registrar.RegisterClient(c)
+	t.clients[key] = clientID
+	checkIn(clientManager, clientID, t.listenerType)
+
+	return clientID, true, nil
+}
+
+// CheckIn records a check-in of a registered client
+func (t *ClientTracker) CheckIn(clientManager interface{}, clientID string) {
+	checkIn(clientManager, clientID, t.listenerType)
+}
+
+// Forget forgets the client identified by key, for example once its connection closes
+func (t *ClientTracker) Forget(key string) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	delete(t.clients, key)
+}
+
+// HandshakeHostname returns the hostname a client reported in a key exchange
+// packet, or an empty string for other packets
+func HandshakeHostname(packet *protocol.Packet) string {
+	if packet.Header.Type != protocol.PacketTypeKeyExchange {
+		return ""
+	}
+	handshake, ok := protocol.DecodeHandshake(packet.Data)
+	if !ok {
+		return ""
+	}
+	return handshake.Hostname
+}
+
+// reportHostname passes the hostname a registered client reported to the client manager
+func reportHostname(clientManager interface{}, clientID, hostname string) {
+	reporter, ok := clientManager.(interface {
+		ReportHostname(string, string) error
+	})
+	if !ok {
+		return
+	}
+	if err := reporter.ReportHostname(clientID, hostname); err != nil {
+		fmt.Printf("Error recording the hostname of client %s: %v\n", clientID, err)
+	}
+}
+
+// HostKey returns the host of an address, which identifies a client whose
+// packets come from changing ports
+func HostKey(address string) string {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return address
+	}
+	return host
+}
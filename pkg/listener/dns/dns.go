@@ -13,6 +13,7 @@ import (
 	"github.com/miekg/dns"
 	"dinoc2/pkg/client"
 	"dinoc2/pkg/crypto"
+	"dinoc2/pkg/listener"
 	"dinoc2/pkg/protocol"
 )
 
@@ -25,6 +26,8 @@ type DNSListener struct {
 	stopChan   chan struct{}
 	ttlCache   map[string]time.Time
 	cacheLock  sync.RWMutex
+	clientTracker *listener.ClientTracker
+	traffic       listener.TrafficCounters
 }
 
 // DNSConfig holds configuration for the DNS listener
@@ -61,6 +64,7 @@ func NewDNSListener(config DNSConfig) *DNSListener {
 		status:    "stopped",
 		stopChan:  make(chan struct{}),
 		ttlCache:  make(map[string]time.Time),
+		clientTracker: listener.NewClientTracker(listener.ListenerTypeDNS),
 	}
 }
 
@@ -152,8 +156,16 @@ func (l *DNSListener) Configure(config interface{}) error {
 	return nil
 }
 
+// Traffic returns the connections and bytes the listener has handled
+func (l *DNSListener) Traffic() listener.Traffic {
+	return l.traffic.Snapshot()
+}
+
 // handleDNSRequest processes incoming DNS requests
 func (l *DNSListener) handleDNSRequest(w dns.ResponseWriter, r *dns.Msg) {
+	l.traffic.AddConnection()
+	l.traffic.AddReceived(r.Len())
+	
 	m := new(dns.Msg)
 	m.SetReply(r)
 	m.Authoritative = true
@@ -201,7 +213,9 @@ func (l *DNSListener) handleDNSRequest(w dns.ResponseWriter, r *dns.Msg) {
 	time.Sleep(delay)
 
 	// Send response
-	w.WriteMsg(m)
+	if err := w.WriteMsg(m); err == nil {
+		l.traffic.AddSent(m.Len())
+	}
 }
 
 // extractSubdomain extracts the subdomain part from a DNS query
@@ -288,9 +302,12 @@ func (l *DNSListener) processData(data string, addr net.Addr) {
 		return
 	}
 	
-	// Get the client manager from the options if available
-	if l.config.Options != nil {
-		if clientManager, ok := l.config.Options["client_manager"]; ok {
+	// Register the client once, and check it in on each later heartbeat
+	var clientID string
+	var registered bool
+	clientManager, hasClientManager := l.config.Options["client_manager"]
+	if hasClientManager {
+		clientID, registered, err = l.clientTracker.Register(clientManager, listener.HostKey(addr.String()), listener.HandshakeHostname(packet), func() (*client.Client, error) {
 			// Create a new client with the detected encryption algorithm
 			config := client.DefaultConfig()
 			config.ServerAddress = fmt.Sprintf("%s:%d", l.config.Address, l.config.Port)
@@ -298,14 +315,17 @@ func (l *DNSListener) processData(data string, addr net.Addr) {
 			
 			newClient, err := client.NewClient(config)
 			if err != nil {
-				fmt.Printf("Error creating client: %v\n", err)
-			} else {
-				// Register the client with the client manager
-				if cm, ok := clientManager.(interface{ RegisterClient(*client.Client) string }); ok {
-					clientID := cm.RegisterClient(newClient)
-					fmt.Printf("Registered DNS client with ID %s using %s encryption\n", clientID, encAlgorithm)
-				}
+				return nil, err
 			}
+			
+			// Record where the client connected from for the scope check
+			newClient.SetRemoteAddress(addr.String())
+			return newClient, nil
+		})
+		if err != nil {
+			fmt.Printf("Error registering DNS client: %v\n", err)
+		} else if registered {
+			fmt.Printf("Registered DNS client with ID %s using %s encryption\n", clientID, encAlgorithm)
 		}
 	}
 	
@@ -315,6 +335,9 @@ func (l *DNSListener) processData(data string, addr net.Addr) {
 		fmt.Printf("Received key exchange from %s via DNS\n", addr)
 	case protocol.PacketTypeHeartbeat:
 		fmt.Printf("Received heartbeat from %s via DNS\n", addr)
+		if clientID != "" && !registered {
+			l.clientTracker.CheckIn(clientManager, clientID)
+		}
 	default:
 		fmt.Printf("Received packet type %d from %s via DNS\n", packet.Header.Type, addr)
 	}
@@ -0,0 +1,75 @@
+package dns
+
+import (
+	"dinoc2/pkg/listener"
+)
+
+func init() {
+	listener.RegisterType(listener.Registration{
+		Type:        listener.ListenerTypeDNS,
+		Description: "DNS queries for a domain the server is authoritative for",
+		Schema: listener.Schema{
+			Port: true,
+			Options: []listener.Option{
+				{Name: "domain", Type: listener.OptionString, Required: true, Description: "Domain whose queries carry client traffic"},
+				{Name: "ttl", Type: listener.OptionNumber, Description: "TTL of the answers in seconds"},
+			},
+		},
+		New: func(config listener.ListenerConfig) (listener.Listener, error) {
+			return &adapter{listener: NewDNSListener(configFrom(config))}, nil
+		},
+	})
+}
+
+// configFrom converts a generic listener configuration to a DNS configuration
+func configFrom(config listener.ListenerConfig) DNSConfig {
+	dnsConfig := DNSConfig{
+		Address: config.Address,
+		Port:    config.Port,
+		Options: config.Options,
+	}
+
+	// Extract DNS-specific options
+	if config.Options != nil {
+		if domain, ok := config.Options["domain"].(string); ok {
+			dnsConfig.Domain = domain
+		}
+		switch ttl := config.Options["ttl"].(type) {
+		case uint32:
+			dnsConfig.TTL = ttl
+		case float64:
+			dnsConfig.TTL = uint32(ttl)
+		}
+	}
+	return dnsConfig
+}
+
+// adapter adapts the DNS listener to the listener.Listener interface
+type adapter struct {
+	listener *DNSListener
+}
+
+// Start implements the listener.Listener interface
+func (a *adapter) Start() error {
+	return a.listener.Start()
+}
+
+// Stop implements the listener.Listener interface
+func (a *adapter) Stop() error {
+	return a.listener.Stop()
+}
+
+// Status implements the listener.Listener interface
+func (a *adapter) Status() listener.ListenerStatus {
+	return listener.ParseStatus(a.listener.Status())
+}
+
+// Configure implements the listener.Listener interface
+func (a *adapter) Configure(config listener.ListenerConfig) error {
+	return a.listener.Configure(configFrom(config))
+}
+
+// Traffic implements the listener.TrafficCounter interface
+func (a *adapter) Traffic() listener.Traffic {
+	return a.listener.Traffic()
+}
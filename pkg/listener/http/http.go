@@ -15,6 +15,7 @@ import (
 	// "dinoc2/pkg/api" - removed to avoid import cycle
 	"dinoc2/pkg/client"
 	"dinoc2/pkg/crypto"
+	"dinoc2/pkg/listener"
 	"dinoc2/pkg/protocol"
 )
 
@@ -26,6 +27,8 @@ type HTTPListener struct {
 	statusLock  sync.RWMutex
 	handlers    map[string]http.HandlerFunc
 	apiHandler  http.Handler // API handler for handling API requests
+	clientTracker *listener.ClientTracker
+	traffic       listener.TrafficCounters
 }
 
 // HTTPConfig holds configuration for the HTTP listener
@@ -46,6 +49,7 @@ func NewHTTPListener(config HTTPConfig, apiHandler http.Handler) *HTTPListener {
 		status:     "stopped",
 		handlers:   make(map[string]http.HandlerFunc),
 		apiHandler: apiHandler,
+		clientTracker: listener.NewClientTracker(listener.ListenerTypeHTTP),
 	}
 }
 
@@ -175,6 +179,11 @@ func (l *HTTPListener) Configure(config interface{}) error {
 	return nil
 }
 
+// Traffic returns the connections and bytes the listener has handled
+func (l *HTTPListener) Traffic() listener.Traffic {
+	return l.traffic.Snapshot()
+}
+
 // RegisterHandler registers a handler for a specific path
 func (l *HTTPListener) RegisterHandler(path string, handler http.HandlerFunc) {
 	l.statusLock.Lock()
@@ -207,6 +216,8 @@ func (l *HTTPListener) defaultHandler(w http.ResponseWriter, r *http.Request) {
 			http.Error(w, "Error reading request body", http.StatusInternalServerError)
 			return
 		}
+		l.traffic.AddConnection()
+		l.traffic.AddReceived(len(body))
 		
 		// Create a protocol handler for processing the data
 		protocolHandler := protocol.NewProtocolHandler()
@@ -247,9 +258,12 @@ func (l *HTTPListener) defaultHandler(w http.ResponseWriter, r *http.Request) {
 			return
 		}
 		
-		// Get the client manager from the options if available
-		if l.config.Options != nil {
-			if clientManager, ok := l.config.Options["client_manager"]; ok {
+		// Register the client once, and check it in on each later heartbeat
+		var clientID string
+		var registered bool
+		clientManager, hasClientManager := l.config.Options["client_manager"]
+		if hasClientManager {
+			clientID, registered, err = l.clientTracker.Register(clientManager, clientKey(r), listener.HandshakeHostname(packet), func() (*client.Client, error) {
 				// Create a new client with the detected encryption algorithm
 				config := client.DefaultConfig()
 				config.ServerAddress = fmt.Sprintf("%s:%d", l.config.Address, l.config.Port)
@@ -257,14 +271,17 @@ func (l *HTTPListener) defaultHandler(w http.ResponseWriter, r *http.Request) {
 				
 				newClient, err := client.NewClient(config)
 				if err != nil {
-					fmt.Printf("Error creating client: %v\n", err)
-				} else {
-					// Register the client with the client manager
-					if cm, ok := clientManager.(interface{ RegisterClient(*client.Client) string }); ok {
-						clientID := cm.RegisterClient(newClient)
-						fmt.Printf("Registered HTTP client with ID %s using %s encryption\n", clientID, encAlgorithm)
-					}
+					return nil, err
 				}
+				
+				// Record where the client connected from for the scope check
+				newClient.SetRemoteAddress(r.RemoteAddr)
+				return newClient, nil
+			})
+			if err != nil {
+				fmt.Printf("Error registering HTTP client: %v\n", err)
+			} else if registered {
+				fmt.Printf("Registered HTTP client with ID %s using %s encryption\n", clientID, encAlgorithm)
 			}
 		}
 		
@@ -280,6 +297,9 @@ func (l *HTTPListener) defaultHandler(w http.ResponseWriter, r *http.Request) {
 			
 		case protocol.PacketTypeHeartbeat:
 			fmt.Printf("Received heartbeat from %s via HTTP\n", r.RemoteAddr)
+			if clientID != "" && !registered {
+				l.clientTracker.CheckIn(clientManager, clientID)
+			}
 			// Create a heartbeat response
 			responsePacket := protocol.NewPacket(protocol.PacketTypeHeartbeat, []byte("pong"))
 			responseData = protocol.EncodePacket(responsePacket)
@@ -295,7 +315,8 @@ func (l *HTTPListener) defaultHandler(w http.ResponseWriter, r *http.Request) {
 		
 		// Send the response
 		w.WriteHeader(http.StatusOK)
-		w.Write(responseData)
+		n, _ := w.Write(responseData)
+		l.traffic.AddSent(n)
 	} else {
 		// Regular request, send a generic response
 		w.WriteHeader(http.StatusOK)
@@ -303,6 +324,15 @@ func (l *HTTPListener) defaultHandler(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
+// clientKey returns the key that identifies the client sending a request: the
+// session ID it sends, or its address if it sends none
+func clientKey(r *http.Request) string {
+	if sessionID := r.Header.Get("X-Session-ID"); sessionID != "" {
+		return sessionID
+	}
+	return listener.HostKey(r.RemoteAddr)
+}
+
 // CreateTLSConfig creates a TLS configuration for the HTTP server
 func CreateTLSConfig(certFile, keyFile string) (*tls.Config, error) {
 	cert, err := tls.LoadX509KeyPair(certFile, keyFile)
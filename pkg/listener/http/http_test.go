@@ -0,0 +1,126 @@
+package http
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"dinoc2/pkg/client"
+	"dinoc2/pkg/protocol"
+)
+
+// sendPacket posts a packet to the listener as a client with the given session ID would
+func sendPacket(t *testing.T, l *HTTPListener, sessionID string, packetType protocol.PacketType) {
+	req := httptest.NewRequest(http.MethodPost, "/data", bytes.NewReader(protocol.EncodePacket(protocol.NewPacket(packetType, nil))))
+	req.Header.Set("X-Command", "data")
+	req.Header.Set("X-Session-ID", sessionID)
+
+	rec := httptest.NewRecorder()
+	l.defaultHandler(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected 200, got %d", rec.Code)
+	}
+}
+
+func TestHeartbeatsCheckInTheRegisteredClient(t *testing.T) {
+	clientManager := client.NewManager()
+	l := NewHTTPListenerWithoutAPI(HTTPConfig{
+		Address: "127.0.0.1",
+		Port:    8080,
+		Options: map[string]interface{}{"client_manager": clientManager},
+	})
+
+	sendPacket(t, l, "session-1", protocol.PacketTypeKeyExchange)
+	sendPacket(t, l, "session-1", protocol.PacketTypeHeartbeat)
+	sendPacket(t, l, "session-1", protocol.PacketTypeHeartbeat)
+
+	clients := clientManager.ListClients()
+	if len(clients) != 1 {
+		t.Fatalf("Expected the client to be registered once, got %d clients", len(clients))
+	}
+	clientID := clients[0].GetSessionID()
+
+	// Registering and each heartbeat check the client in
+	checkIns, err := clientManager.CheckIns(clientID)
+	if err != nil {
+		t.Fatalf("CheckIns: %v", err)
+	}
+	if len(checkIns) != 3 {
+		t.Errorf("Expected 3 check-ins, got %d", len(checkIns))
+	}
+	status, err := clientManager.Lifecycle(clientID)
+	if err != nil {
+		t.Fatalf("Lifecycle: %v", err)
+	}
+	if status.State != client.LifecycleActive || status.Listener != "http" {
+		t.Errorf("Expected an active client checked in through http, got %+v", status)
+	}
+
+	// Another client is registered on its own
+	sendPacket(t, l, "session-2", protocol.PacketTypeHeartbeat)
+	if n := len(clientManager.ListClients()); n != 2 {
+		t.Errorf("Expected 2 clients, got %d", n)
+	}
+
+	// Each data request is counted as a connection
+	traffic := l.Traffic()
+	if traffic.ConnectionsIn != 4 || traffic.BytesReceived == 0 || traffic.BytesSent == 0 {
+		t.Errorf("Expected 4 counted requests with their bytes, got %+v", traffic)
+	}
+}
+
+func TestHandshakeReportsHostname(t *testing.T) {
+	clientManager := client.NewManager()
+	l := NewHTTPListenerWithoutAPI(HTTPConfig{
+		Address: "127.0.0.1",
+		Port:    8080,
+		Options: map[string]interface{}{"client_manager": clientManager},
+	})
+
+	handshake := protocol.NewPacket(protocol.PacketTypeKeyExchange, protocol.EncodeHandshake(protocol.Handshake{SessionID: "session-1", Hostname: "ws01.corp.example.com"}))
+	req := httptest.NewRequest(http.MethodPost, "/data", bytes.NewReader(protocol.EncodePacket(handshake)))
+	req.Header.Set("X-Command", "data")
+	req.Header.Set("X-Session-ID", "session-1")
+	l.defaultHandler(httptest.NewRecorder(), req)
+
+	clients := clientManager.ListClients()
+	if len(clients) != 1 {
+		t.Fatalf("Expected 1 client, got %d", len(clients))
+	}
+	if hostname := clients[0].GetHostname(); hostname != "ws01.corp.example.com" {
+		t.Errorf("Expected the hostname from the handshake, got %q", hostname)
+	}
+}
+
+func TestOlderClientKeyExchangeRegistersWithoutHostname(t *testing.T) {
+	clientManager := client.NewManager()
+	l := NewHTTPListenerWithoutAPI(HTTPConfig{
+		Address: "127.0.0.1",
+		Port:    8080,
+		Options: map[string]interface{}{"client_manager": clientManager},
+	})
+
+	// Older clients send their session ID encrypted, which the server cannot read
+	keyExchange := protocol.NewPacket(protocol.PacketTypeKeyExchange, []byte{0x9c, 0x01, 0x42, 0x17, 0xe3, 0x5a})
+	keyExchange.SetEncryptionAlgorithm(protocol.EncryptionAlgorithmAES)
+	req := httptest.NewRequest(http.MethodPost, "/data", bytes.NewReader(protocol.EncodePacket(keyExchange)))
+	req.Header.Set("X-Command", "data")
+	req.Header.Set("X-Session-ID", "legacy-session")
+	rec := httptest.NewRecorder()
+	l.defaultHandler(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected 200, got %d", rec.Code)
+	}
+
+	clients := clientManager.ListClients()
+	if len(clients) != 1 {
+		t.Fatalf("Expected 1 client, got %d", len(clients))
+	}
+	if hostname := clients[0].GetHostname(); hostname != "" {
+		t.Errorf("Expected no hostname, got %q", hostname)
+	}
+	if clients[0].GetEncryptionAlgorithm() != "aes" {
+		t.Errorf("Expected the algorithm from the header, got %q", clients[0].GetEncryptionAlgorithm())
+	}
+}
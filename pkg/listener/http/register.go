@@ -0,0 +1,81 @@
+package http
+
+import (
+	"dinoc2/pkg/listener"
+)
+
+func init() {
+	listener.RegisterType(listener.Registration{
+		Type:        listener.ListenerTypeHTTP,
+		Description: "HTTP and HTTP/2 requests that look like regular web traffic",
+		Schema: listener.Schema{
+			Port: true,
+			Options: []listener.Option{
+				{Name: "tls_cert_file", Type: listener.OptionString, Description: "TLS certificate, serves HTTPS with tls_key_file"},
+				{Name: "tls_key_file", Type: listener.OptionString, Description: "TLS private key"},
+				{Name: "use_http2", Type: listener.OptionBool, Description: "Serve HTTP/2"},
+				{Name: "allow_h2c", Type: listener.OptionBool, Description: "Allow HTTP/2 without TLS"},
+			},
+		},
+		Capabilities: listener.Capabilities{TLS: true, APIHandler: true},
+		New: func(config listener.ListenerConfig) (listener.Listener, error) {
+			return &adapter{listener: NewHTTPListenerWithoutAPI(configFrom(config))}, nil
+		},
+	})
+}
+
+// configFrom converts a generic listener configuration to an HTTP configuration
+func configFrom(config listener.ListenerConfig) HTTPConfig {
+	httpConfig := HTTPConfig{
+		Address: config.Address,
+		Port:    config.Port,
+		Options: config.Options,
+	}
+
+	// Extract HTTP-specific options
+	if config.Options != nil {
+		if certFile, ok := config.Options["tls_cert_file"].(string); ok {
+			httpConfig.TLSCertFile = certFile
+		}
+		if keyFile, ok := config.Options["tls_key_file"].(string); ok {
+			httpConfig.TLSKeyFile = keyFile
+		}
+		if useHTTP2, ok := config.Options["use_http2"].(bool); ok {
+			httpConfig.UseHTTP2 = useHTTP2
+		}
+		if allowH2C, ok := config.Options["allow_h2c"].(bool); ok {
+			httpConfig.AllowHTTP2H2C = allowH2C
+		}
+	}
+	return httpConfig
+}
+
+// adapter adapts the HTTP listener to the listener.Listener interface
+type adapter struct {
+	listener *HTTPListener
+}
+
+// Start implements the listener.Listener interface
+func (a *adapter) Start() error {
+	return a.listener.Start()
+}
+
+// Stop implements the listener.Listener interface
+func (a *adapter) Stop() error {
+	return a.listener.Stop()
+}
+
+// Status implements the listener.Listener interface
+func (a *adapter) Status() listener.ListenerStatus {
+	return listener.ParseStatus(a.listener.Status())
+}
+
+// Configure implements the listener.Listener interface
+func (a *adapter) Configure(config listener.ListenerConfig) error {
+	return a.listener.Configure(configFrom(config))
+}
+
+// Traffic implements the listener.TrafficCounter interface
+func (a *adapter) Traffic() listener.Traffic {
+	return a.listener.Traffic()
+}
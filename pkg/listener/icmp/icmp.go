@@ -11,6 +11,7 @@ import (
 	"golang.org/x/net/ipv4"
 	"dinoc2/pkg/client"
 	"dinoc2/pkg/crypto"
+	"dinoc2/pkg/listener"
 	"dinoc2/pkg/protocol"
 )
 
@@ -21,6 +22,8 @@ type ICMPListener struct {
 	status     string
 	statusLock sync.RWMutex
 	stopChan   chan struct{}
+	clientTracker *listener.ClientTracker
+	traffic       listener.TrafficCounters
 }
 
 // ICMPConfig holds configuration for the ICMP listener
@@ -45,6 +48,7 @@ func NewICMPListener(config ICMPConfig) *ICMPListener {
 		config:   config,
 		status:   "stopped",
 		stopChan: make(chan struct{}),
+		clientTracker: listener.NewClientTracker(listener.ListenerTypeICMP),
 	}
 }
 
@@ -136,6 +140,11 @@ func (l *ICMPListener) Configure(config interface{}) error {
 	return nil
 }
 
+// Traffic returns the connections and bytes the listener has handled
+func (l *ICMPListener) Traffic() listener.Traffic {
+	return l.traffic.Snapshot()
+}
+
 // listenForPackets listens for incoming ICMP packets
 func (l *ICMPListener) listenForPackets() {
 	buffer := make([]byte, 1500) // Standard MTU size
@@ -177,6 +186,9 @@ func (l *ICMPListener) listenForPackets() {
 
 // processPacket processes an ICMP packet
 func (l *ICMPListener) processPacket(packet []byte, addr net.Addr) {
+	l.traffic.AddConnection()
+	l.traffic.AddReceived(len(packet))
+
 	// Parse the ICMP message
 	msg, err := icmp.ParseMessage(ipv4.ICMPTypeEcho.Protocol(), packet)
 	if err != nil {
@@ -231,9 +243,12 @@ func (l *ICMPListener) processPacket(packet []byte, addr net.Addr) {
 				return
 			}
 			
-			// Get the client manager from the options if available
-			if l.config.Options != nil {
-				if clientManager, ok := l.config.Options["client_manager"]; ok {
+			// Register the client once, and check it in on each later heartbeat
+			var clientID string
+			var registered bool
+			clientManager, hasClientManager := l.config.Options["client_manager"]
+			if hasClientManager {
+				clientID, registered, err = l.clientTracker.Register(clientManager, listener.HostKey(addr.String()), listener.HandshakeHostname(packet), func() (*client.Client, error) {
 					// Create a new client with the detected encryption algorithm
 					config := client.DefaultConfig()
 					config.ServerAddress = l.config.ListenAddress
@@ -241,14 +256,17 @@ func (l *ICMPListener) processPacket(packet []byte, addr net.Addr) {
 					
 					newClient, err := client.NewClient(config)
 					if err != nil {
-						fmt.Printf("Error creating client: %v\n", err)
-					} else {
-						// Register the client with the client manager
-						if cm, ok := clientManager.(interface{ RegisterClient(*client.Client) string }); ok {
-							clientID := cm.RegisterClient(newClient)
-							fmt.Printf("Registered ICMP client with ID %s using %s encryption\n", clientID, encAlgorithm)
-						}
+						return nil, err
 					}
+					
+					// Record where the client connected from for the scope check
+					newClient.SetRemoteAddress(addr.String())
+					return newClient, nil
+				})
+				if err != nil {
+					fmt.Printf("Error registering ICMP client: %v\n", err)
+				} else if registered {
+					fmt.Printf("Registered ICMP client with ID %s using %s encryption\n", clientID, encAlgorithm)
 				}
 			}
 			
@@ -258,6 +276,9 @@ func (l *ICMPListener) processPacket(packet []byte, addr net.Addr) {
 				fmt.Printf("Received key exchange from %s via ICMP\n", addr)
 			case protocol.PacketTypeHeartbeat:
 				fmt.Printf("Received heartbeat from %s via ICMP\n", addr)
+				if clientID != "" && !registered {
+					l.clientTracker.CheckIn(clientManager, clientID)
+				}
 			default:
 				fmt.Printf("Received packet type %d from %s via ICMP\n", packet.Header.Type, addr)
 			}
@@ -294,7 +315,8 @@ func (l *ICMPListener) sendEchoReply(addr net.Addr, id, seq int, data []byte) {
 	}
 
 	// Send the reply
-	_, err = l.conn.WriteTo(msgBytes, addr)
+	n, err := l.conn.WriteTo(msgBytes, addr)
+	l.traffic.AddSent(n)
 	if err != nil {
 		fmt.Printf("Error sending ICMP echo reply: %v\n", err)
 	}
@@ -0,0 +1,67 @@
+package icmp
+
+import (
+	"dinoc2/pkg/listener"
+)
+
+func init() {
+	listener.RegisterType(listener.Registration{
+		Type:        listener.ListenerTypeICMP,
+		Description: "ICMP echo requests and replies",
+		Schema: listener.Schema{
+			Options: []listener.Option{
+				{Name: "protocol", Type: listener.OptionString, Description: "icmp for raw sockets (the default), or udp for unprivileged ICMP sockets"},
+			},
+		},
+		Capabilities: listener.Capabilities{Privileged: true},
+		New: func(config listener.ListenerConfig) (listener.Listener, error) {
+			return &adapter{listener: NewICMPListener(configFrom(config))}, nil
+		},
+	})
+}
+
+// configFrom converts a generic listener configuration to an ICMP configuration
+func configFrom(config listener.ListenerConfig) ICMPConfig {
+	icmpConfig := ICMPConfig{
+		ListenAddress: config.Address,
+		Options:       config.Options,
+	}
+
+	// Extract ICMP-specific options
+	if config.Options != nil {
+		if protocol, ok := config.Options["protocol"].(string); ok {
+			icmpConfig.Protocol = protocol
+		}
+	}
+	return icmpConfig
+}
+
+// adapter adapts the ICMP listener to the listener.Listener interface
+type adapter struct {
+	listener *ICMPListener
+}
+
+// Start implements the listener.Listener interface
+func (a *adapter) Start() error {
+	return a.listener.Start()
+}
+
+// Stop implements the listener.Listener interface
+func (a *adapter) Stop() error {
+	return a.listener.Stop()
+}
+
+// Status implements the listener.Listener interface
+func (a *adapter) Status() listener.ListenerStatus {
+	return listener.ParseStatus(a.listener.Status())
+}
+
+// Configure implements the listener.Listener interface
+func (a *adapter) Configure(config listener.ListenerConfig) error {
+	return a.listener.Configure(configFrom(config))
+}
+
+// Traffic implements the listener.TrafficCounter interface
+func (a *adapter) Traffic() listener.Traffic {
+	return a.listener.Traffic()
+}
@@ -1,12 +1,26 @@
 package listener
 
 import (
+	"encoding/json"
 	"errors"
 	"fmt"
 	"sync"
+	"sync/atomic"
 	"time"
+
+	"dinoc2/pkg/events"
+	"dinoc2/pkg/store"
 )
 
+// listenerCollection is the store collection that holds listener records
+const listenerCollection = "listeners"
+
+// healthCheckInterval is how often the health of listeners is checked
+var healthCheckInterval = 5 * time.Second
+
+// runtimeOptions are listener options set by the server at runtime, which are never persisted
+var runtimeOptions = []string{"client_manager", "api_handler"}
+
 // ListenerStatus represents the current status of a listener
 type ListenerStatus string
 
@@ -15,14 +29,19 @@ const (
 	StatusStopped  ListenerStatus = "stopped"
 	StatusError    ListenerStatus = "error"
 	StatusUnknown  ListenerStatus = "unknown"
+	StatusCrashLoop ListenerStatus = "crash_loop" // failed too many times in a row to be restarted again
 )
 
+// ErrListenerNotFound is returned when a listener does not exist
+var ErrListenerNotFound = errors.New("listener not found")
+
 // ListenerConfig holds configuration for a listener
 type ListenerConfig struct {
 	Protocol string
 	Address  string
 	Port     int
 	Options  map[string]interface{}
+	Restart  RestartConfig
 }
 
 // ListenerStats holds statistics for a listener
@@ -36,6 +55,60 @@ type ListenerStats struct {
 	LastErrorTime  time.Time
 }
 
+// Traffic is the connections and bytes a listener has handled since it was created
+type Traffic struct {
+	ConnectionsIn  int64
+	ConnectionsOut int64
+	BytesReceived  int64
+	BytesSent      int64
+}
+
+// TrafficCounter is implemented by listeners that count their own traffic,
+// which GetStats reports in the listener's statistics
+type TrafficCounter interface {
+	Traffic() Traffic
+}
+
+// TrafficCounters counts the connections and bytes of a listener. Listeners
+// that handle each request or packet on its own count each as a connection.
+type TrafficCounters struct {
+	connectionsIn atomic.Int64
+	bytesReceived atomic.Int64
+	bytesSent     atomic.Int64
+}
+
+// AddConnection counts an incoming connection
+func (c *TrafficCounters) AddConnection() {
+	c.connectionsIn.Add(1)
+}
+
+// AddReceived counts bytes received
+func (c *TrafficCounters) AddReceived(n int) {
+	c.bytesReceived.Add(int64(n))
+}
+
+// AddSent counts bytes sent
+func (c *TrafficCounters) AddSent(n int) {
+	c.bytesSent.Add(int64(n))
+}
+
+// Snapshot returns the current counts
+func (c *TrafficCounters) Snapshot() Traffic {
+	return Traffic{
+		ConnectionsIn: c.connectionsIn.Load(),
+		BytesReceived: c.bytesReceived.Load(),
+		BytesSent:     c.bytesSent.Load(),
+	}
+}
+
+// Record is the persisted form of a listener
+type Record struct {
+	ID      string         `json:"id"`
+	Type    ListenerType   `json:"type"`
+	Config  ListenerConfig `json:"config"`
+	Running bool           `json:"running"` // Whether the listener should be started on restore
+}
+
 // Listener interface defines methods that all listener types must implement
 type Listener interface {
 	Start() error
@@ -51,7 +124,16 @@ type Manager struct {
 	stats        map[string]*ListenerStats
 	mutex        sync.RWMutex
 	monitorStop  chan struct{}
+	monitorDone  chan struct{}
+	monitorOnce  sync.Once
 	clientManager interface{} // Client manager for registering clients
+	disabled     string      // Reason the manager was disabled, empty if enabled
+	records      map[string]*Record
+	store        store.Store // Optional store that listener records are persisted to
+	events       *events.Bus
+	lastStatus   map[string]ListenerStatus // Last status published for each listener
+	restarts     map[string]*RestartState  // Restarts by the health monitor for each listener
+	holding      map[string]bool           // Listeners the health monitor leaves alone while they are reconfigured
 }
 
 // NewManager creates a new listener manager
@@ -61,7 +143,12 @@ func NewManager(clientManager interface{}) *Manager {
 		listenerType: make(map[string]ListenerType),
 		stats:        make(map[string]*ListenerStats),
 		monitorStop:  make(chan struct{}),
+		monitorDone:  make(chan struct{}),
 		clientManager: clientManager,
+		records:      make(map[string]*Record),
+		lastStatus:   make(map[string]ListenerStatus),
+		restarts:     make(map[string]*RestartState),
+		holding:      make(map[string]bool),
 	}
 	
 	// Start the health monitor
@@ -72,6 +159,10 @@ func NewManager(clientManager interface{}) *Manager {
 
 // CreateListener creates a new listener with the specified type and configuration
 func (m *Manager) CreateListener(id string, listenerType ListenerType, config ListenerConfig) error {
+	if err := m.checkEnabled(); err != nil {
+		return err
+	}
+	
 	// Validate the configuration
 	if err := ValidateListenerConfig(listenerType, config); err != nil {
 		return fmt.Errorf("invalid configuration: %w", err)
@@ -98,6 +189,8 @@ func (m *Manager) CreateListener(id string, listenerType ListenerType, config Li
 	m.mutex.Lock()
 	m.listenerType[id] = listenerType
 	m.stats[id] = &ListenerStats{}
+	m.records[id] = &Record{ID: id, Type: listenerType, Config: persistableConfig(config)}
+	m.persist(id)
 	m.mutex.Unlock()
 	
 	return nil
@@ -128,10 +221,18 @@ func (m *Manager) RemoveListener(id string) error {
 		delete(m.listeners, id)
 		delete(m.listenerType, id)
 		delete(m.stats, id)
+		delete(m.records, id)
+		delete(m.lastStatus, id)
+		delete(m.restarts, id)
+		if m.store != nil {
+			if err := m.store.Delete(listenerCollection, id); err != nil {
+				fmt.Printf("Failed to delete listener record %s: %v\n", id, err)
+			}
+		}
 		return nil
 	}
 
-	return errors.New("listener not found")
+	return ErrListenerNotFound
 }
 
 // StartListener starts a specific listener
@@ -141,7 +242,11 @@ func (m *Manager) StartListener(id string) error {
 	m.mutex.RUnlock()
 
 	if !exists {
-		return errors.New("listener not found")
+		return ErrListenerNotFound
+	}
+
+	if err := m.checkEnabled(); err != nil {
+		return err
 	}
 
 	err := listener.Start()
@@ -149,13 +254,17 @@ func (m *Manager) StartListener(id string) error {
 		// Update stats
 		m.mutex.Lock()
 		m.stats[id].StartTime = time.Now()
+		m.setRunning(id, true)
+		delete(m.restarts, id)
 		m.mutex.Unlock()
+		m.reportStatus(id, listener.Status(), "")
 	} else {
 		// Update error stats
 		m.mutex.Lock()
 		m.stats[id].LastError = err.Error()
 		m.stats[id].LastErrorTime = time.Now()
 		m.mutex.Unlock()
+		m.reportStatus(id, StatusError, err.Error())
 	}
 	
 	return err
@@ -163,15 +272,111 @@ func (m *Manager) StartListener(id string) error {
 
 // StopListener stops a specific listener
 func (m *Manager) StopListener(id string) error {
+	if err := m.stopListener(id); err != nil {
+		return err
+	}
+
+	m.mutex.Lock()
+	m.setRunning(id, false)
+	delete(m.restarts, id)
+	m.mutex.Unlock()
+	return nil
+}
+
+// stopListener stops a listener without changing whether it is restored as running
+func (m *Manager) stopListener(id string) error {
+	m.mutex.RLock()
+	listener, exists := m.listeners[id]
+	m.mutex.RUnlock()
+
+	if !exists {
+		return ErrListenerNotFound
+	}
+
+	if err := listener.Stop(); err != nil {
+		return err
+	}
+	m.reportStatus(id, listener.Status(), "")
+	return nil
+}
+
+// ReconfigureListener applies a new configuration to a listener through its
+// Configure method. A running listener is stopped for the change and started
+// again; other listeners, and the sessions on them, are not touched.
+func (m *Manager) ReconfigureListener(id string, config ListenerConfig) error {
+	if err := m.checkEnabled(); err != nil {
+		return err
+	}
+
 	m.mutex.RLock()
 	listener, exists := m.listeners[id]
+	listenerType := m.listenerType[id]
 	m.mutex.RUnlock()
 
 	if !exists {
-		return errors.New("listener not found")
+		return ErrListenerNotFound
+	}
+	if err := ValidateListenerConfig(listenerType, config); err != nil {
+		return fmt.Errorf("invalid configuration: %w", err)
+	}
+
+	// Keep the runtime options of the listener, which are not part of its record
+	options := make(map[string]interface{}, len(config.Options)+1)
+	for key, value := range config.Options {
+		options[key] = value
+	}
+	options["client_manager"] = m.clientManager
+	config.Options = options
+
+	// Keep the health monitor from restarting the listener while it is reconfigured
+	m.mutex.Lock()
+	m.holding[id] = true
+	m.mutex.Unlock()
+	defer func() {
+		m.mutex.Lock()
+		delete(m.holding, id)
+		m.mutex.Unlock()
+	}()
+
+	// Listeners refuse to be configured while they are running
+	wasRunning := listener.Status() != StatusStopped
+	if wasRunning {
+		if err := m.stopListener(id); err != nil {
+			return fmt.Errorf("failed to stop listener: %w", err)
+		}
+	}
+
+	if err := listener.Configure(config); err != nil {
+		// Bring the listener back up with its previous configuration
+		if wasRunning {
+			m.StartListener(id)
+		}
+		return fmt.Errorf("failed to configure listener: %w", err)
+	}
+
+	m.mutex.Lock()
+	if record, exists := m.records[id]; exists {
+		record.Config = persistableConfig(config)
+		m.persist(id)
 	}
+	m.mutex.Unlock()
 
-	return listener.Stop()
+	if wasRunning {
+		return m.StartListener(id)
+	}
+	return nil
+}
+
+// GetConfig returns the configuration of a specific listener, without runtime options
+func (m *Manager) GetConfig(id string) (ListenerConfig, error) {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+
+	if record, exists := m.records[id]; exists {
+		return persistableConfig(record.Config), nil
+	}
+
+	return ListenerConfig{}, ErrListenerNotFound
 }
 
 // GetStatus returns the status of a specific listener
@@ -180,10 +385,10 @@ func (m *Manager) GetStatus(id string) (ListenerStatus, error) {
 	defer m.mutex.RUnlock()
 
 	if listener, exists := m.listeners[id]; exists {
-		return listener.Status(), nil
+		return m.statusOf(id, listener), nil
 	}
 
-	return StatusUnknown, errors.New("listener not found")
+	return StatusUnknown, ErrListenerNotFound
 }
 
 // GetStats returns the statistics for a specific listener
@@ -191,11 +396,30 @@ func (m *Manager) GetStats(id string) (*ListenerStats, error) {
 	m.mutex.RLock()
 	defer m.mutex.RUnlock()
 
-	if stats, exists := m.stats[id]; exists {
-		return stats, nil
+	stats, exists := m.stats[id]
+	if !exists {
+		return nil, ErrListenerNotFound
 	}
 
-	return nil, errors.New("listener not found")
+	current := *stats
+	if counter, ok := m.listeners[id].(TrafficCounter); ok {
+		traffic := counter.Traffic()
+		current.ConnectionsIn = traffic.ConnectionsIn
+		current.ConnectionsOut = traffic.ConnectionsOut
+		current.BytesReceived = traffic.BytesReceived
+		current.BytesSent = traffic.BytesSent
+	}
+	return &current, nil
+}
+
+// CountsTraffic reports whether a listener counts its own traffic, so that
+// the traffic in its statistics is meaningful
+func (m *Manager) CountsTraffic(id string) bool {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+
+	_, ok := m.listeners[id].(TrafficCounter)
+	return ok
 }
 
 // ListListeners returns a list of all listener IDs and their statuses
@@ -205,7 +429,7 @@ func (m *Manager) ListListeners() map[string]ListenerStatus {
 
 	result := make(map[string]ListenerStatus)
 	for id, listener := range m.listeners {
-		result[id] = listener.Status()
+		result[id] = m.statusOf(id, listener)
 	}
 
 	return result
@@ -220,11 +444,17 @@ func (m *Manager) GetListenerType(id string) (ListenerType, error) {
 		return listenerType, nil
 	}
 
-	return "", errors.New("listener not found")
+	return "", ErrListenerNotFound
 }
 
-// StopAll stops all running listeners
+// StopAll stops the health monitor and all running listeners. Listeners that
+// were running are still restored as running, so that a server shutdown does
+// not change their state.
 func (m *Manager) StopAll() error {
+	// Stop the health monitor first, so that it cannot restart the listeners
+	// that are being stopped
+	m.stopMonitor()
+
 	m.mutex.RLock()
 	listeners := make([]string, 0, len(m.listeners))
 	for id := range m.listeners {
@@ -234,7 +464,7 @@ func (m *Manager) StopAll() error {
 
 	var lastErr error
 	for _, id := range listeners {
-		if err := m.StopListener(id); err != nil {
+		if err := m.stopListener(id); err != nil {
 			lastErr = fmt.Errorf("failed to stop listener %s: %w", id, err)
 		}
 	}
@@ -242,32 +472,145 @@ func (m *Manager) StopAll() error {
 	return lastErr
 }
 
+// SetStore sets the store that listener records are persisted to and returns the
+// records it holds, so that the server can recreate the listeners
+func (m *Manager) SetStore(s store.Store) ([]Record, error) {
+	data, err := s.List(listenerCollection)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load listeners: %w", err)
+	}
+
+	records := make([]Record, 0, len(data))
+	for _, item := range data {
+		var record Record
+		if err := json.Unmarshal(item, &record); err != nil {
+			return nil, fmt.Errorf("failed to restore listener: %w", err)
+		}
+		records = append(records, record)
+	}
+
+	m.mutex.Lock()
+	m.store = s
+	m.mutex.Unlock()
+
+	return records, nil
+}
+
+// SetEventBus sets the bus that listener health changes are published to
+func (m *Manager) SetEventBus(bus *events.Bus) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	m.events = bus
+}
+
+// reportStatus publishes a listener's status if it changed since it was last reported
+func (m *Manager) reportStatus(id string, status ListenerStatus, errMsg string) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	previous := m.lastStatus[id]
+	if previous == status {
+		return
+	}
+	m.lastStatus[id] = status
+
+	m.events.Publish(events.TypeListenerHealth, events.ListenerEvent{
+		ListenerID:     id,
+		Status:         string(status),
+		PreviousStatus: string(previous),
+		Error:          errMsg,
+	})
+}
+
+// setRunning records whether a listener should be running. The caller must hold the mutex.
+func (m *Manager) setRunning(id string, running bool) {
+	if record, exists := m.records[id]; exists && record.Running != running {
+		record.Running = running
+		m.persist(id)
+	}
+}
+
+// persist writes a listener record to the store, if one is set. The caller must hold the mutex.
+func (m *Manager) persist(id string) {
+	record, exists := m.records[id]
+	if m.store == nil || !exists {
+		return
+	}
+	if err := m.store.Put(listenerCollection, id, record); err != nil {
+		fmt.Printf("Failed to persist listener %s: %v\n", id, err)
+	}
+}
+
+// persistableConfig returns a copy of a listener configuration without runtime options
+func persistableConfig(config ListenerConfig) ListenerConfig {
+	options := make(map[string]interface{}, len(config.Options))
+	for key, value := range config.Options {
+		options[key] = value
+	}
+	for _, key := range runtimeOptions {
+		delete(options, key)
+	}
+	config.Options = options
+	return config
+}
+
+// Disable stops all listeners and refuses to create or start any more.
+// It is used when the engagement ends and cannot be undone.
+func (m *Manager) Disable(reason string) error {
+	m.mutex.Lock()
+	m.disabled = reason
+	m.mutex.Unlock()
+	
+	fmt.Printf("Disabling all listeners: %s\n", reason)
+	return m.StopAll()
+}
+
+// checkEnabled returns an error if the manager has been disabled
+func (m *Manager) checkEnabled() error {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+	
+	if m.disabled != "" {
+		return fmt.Errorf("listeners are disabled: %s", m.disabled)
+	}
+	return nil
+}
+
 // Shutdown stops all listeners and shuts down the manager
 func (m *Manager) Shutdown() error {
-	// Stop the health monitor
-	close(m.monitorStop)
-	
-	// Stop all listeners
 	return m.StopAll()
 }
 
+// stopMonitor stops the health monitor and waits for a health check in
+// progress to finish
+func (m *Manager) stopMonitor() {
+	m.monitorOnce.Do(func() {
+		close(m.monitorStop)
+	})
+	<-m.monitorDone
+}
+
 // monitorHealth periodically checks the health of all listeners
 func (m *Manager) monitorHealth() {
-	ticker := time.NewTicker(30 * time.Second)
+	defer close(m.monitorDone)
+
+	ticker := time.NewTicker(healthCheckInterval)
 	defer ticker.Stop()
 
 	for {
 		select {
-		case <-ticker.C:
-			m.checkListenerHealth()
+		case now := <-ticker.C:
+			m.checkListenerHealth(now)
 		case <-m.monitorStop:
 			return
 		}
 	}
 }
 
-// checkListenerHealth checks the health of all listeners and attempts to recover if needed
-func (m *Manager) checkListenerHealth() {
+// checkListenerHealth checks the health of all listeners and restarts those
+// that are down, as their restart policies call for
+func (m *Manager) checkListenerHealth(now time.Time) {
 	m.mutex.RLock()
 	listeners := make(map[string]Listener)
 	for id, listener := range m.listeners {
@@ -275,39 +618,17 @@ func (m *Manager) checkListenerHealth() {
 	}
 	m.mutex.RUnlock()
 
+	// Never restart listeners once the manager is disabled or stopped
+	if m.checkEnabled() != nil {
+		return
+	}
+	select {
+	case <-m.monitorStop:
+		return
+	default:
+	}
+
 	for id, listener := range listeners {
-		status := listener.Status()
-		
-		// If the listener is in an error state, attempt to restart it
-		if status == StatusError {
-			fmt.Printf("Listener %s is in error state, attempting to restart\n", id)
-			
-			// Stop the listener
-			if err := listener.Stop(); err != nil {
-				fmt.Printf("Error stopping listener %s: %v\n", id, err)
-				continue
-			}
-			
-			// Wait a moment before restarting
-			time.Sleep(1 * time.Second)
-			
-			// Start the listener
-			if err := listener.Start(); err != nil {
-				fmt.Printf("Error restarting listener %s: %v\n", id, err)
-				
-				// Update error stats
-				m.mutex.Lock()
-				m.stats[id].LastError = err.Error()
-				m.stats[id].LastErrorTime = time.Now()
-				m.mutex.Unlock()
-			} else {
-				fmt.Printf("Successfully restarted listener %s\n", id)
-				
-				// Update stats
-				m.mutex.Lock()
-				m.stats[id].StartTime = time.Now()
-				m.mutex.Unlock()
-			}
-		}
+		m.checkHealth(id, listener, now)
 	}
 }
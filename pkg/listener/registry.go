@@ -0,0 +1,154 @@
+package listener
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+)
+
+// ErrUnknownListenerType is returned for a listener type that is not registered
+var ErrUnknownListenerType = errors.New("unknown listener type")
+
+// OptionType is the type of the value of a listener option
+type OptionType string
+
+const (
+	OptionString OptionType = "string"
+	OptionBool   OptionType = "bool"
+	OptionNumber OptionType = "number"
+)
+
+// Option describes an option that a listener type understands
+type Option struct {
+	Name        string     `json:"name"`
+	Type        OptionType `json:"type"`
+	Required    bool       `json:"required,omitempty"`
+	Description string     `json:"description"`
+}
+
+// Schema describes the configuration that a listener type accepts. Options
+// that are not in the schema are passed to the listener unchecked.
+type Schema struct {
+	Port    bool     `json:"port"` // whether the listener needs a port
+	Options []Option `json:"options,omitempty"`
+}
+
+// Capabilities describes what a listener type can do
+type Capabilities struct {
+	TLS        bool `json:"tls"`         // can serve over TLS with tls_cert_file and tls_key_file
+	APIHandler bool `json:"api_handler"` // is given the API router in the api_handler option
+	Privileged bool `json:"privileged"`  // needs raw sockets, and so root or CAP_NET_RAW
+}
+
+// Registration describes a listener type and how to create listeners of it
+type Registration struct {
+	Type         ListenerType `json:"type"`
+	Description  string       `json:"description"`
+	Schema       Schema       `json:"schema"`
+	Capabilities Capabilities `json:"capabilities"`
+
+	// New creates a stopped listener. The manager checks the configuration against the schema first.
+	New func(config ListenerConfig) (Listener, error) `json:"-"`
+}
+
+var (
+	registry      = make(map[ListenerType]Registration)
+	registryMutex sync.RWMutex
+)
+
+// RegisterType makes a listener type available to CreateListener, configuration
+// validation and the API. Listener packages call it from init.
+func RegisterType(registration Registration) {
+	registryMutex.Lock()
+	defer registryMutex.Unlock()
+
+	if _, exists := registry[registration.Type]; exists {
+		fmt.Printf("Warning: Listener type '%s' already registered, overwriting\n", registration.Type)
+	}
+	registry[registration.Type] = registration
+}
+
+// LookupType returns the registration of a listener type
+func LookupType(listenerType ListenerType) (Registration, error) {
+	registryMutex.RLock()
+	defer registryMutex.RUnlock()
+
+	registration, exists := registry[listenerType]
+	if !exists {
+		return Registration{}, fmt.Errorf("%w %q, expected one of %v", ErrUnknownListenerType, listenerType, typeNames())
+	}
+	return registration, nil
+}
+
+// ListTypes returns the registered listener types, ordered by type
+func ListTypes() []Registration {
+	registryMutex.RLock()
+	defer registryMutex.RUnlock()
+
+	registrations := make([]Registration, 0, len(registry))
+	for _, registration := range registry {
+		registrations = append(registrations, registration)
+	}
+	sort.Slice(registrations, func(i, j int) bool { return registrations[i].Type < registrations[j].Type })
+	return registrations
+}
+
+// typeNames returns the names of the registered listener types in order. The
+// caller must hold the mutex.
+func typeNames() []string {
+	names := make([]string, 0, len(registry))
+	for listenerType := range registry {
+		names = append(names, string(listenerType))
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Validate checks a listener configuration against the schema
+func (s Schema) Validate(listenerType ListenerType, config ListenerConfig) error {
+	if s.Port && (config.Port <= 0 || config.Port > 65535) {
+		return errors.New("invalid port number")
+	}
+
+	for _, option := range s.Options {
+		value, exists := config.Options[option.Name]
+		if !exists || value == nil {
+			if option.Required {
+				return fmt.Errorf("%s listener requires the %s option", listenerType, option.Name)
+			}
+			continue
+		}
+		if !option.Type.matches(value) {
+			return fmt.Errorf("option %s of a %s listener must be a %s", option.Name, listenerType, option.Type)
+		}
+	}
+	return nil
+}
+
+// matches reports whether a value, as decoded from JSON or set in Go, has the option type
+func (t OptionType) matches(value interface{}) bool {
+	switch value.(type) {
+	case string:
+		return t == OptionString
+	case bool:
+		return t == OptionBool
+	case float64, float32, int, int8, int16, int32, int64, uint, uint8, uint16, uint32, uint64:
+		return t == OptionNumber
+	}
+	return false
+}
+
+// ParseStatus converts the status string reported by a listener package to a ListenerStatus
+func ParseStatus(status string) ListenerStatus {
+	switch status {
+	case "running":
+		return StatusRunning
+	case "stopped":
+		return StatusStopped
+	case "error":
+		return StatusError
+	default:
+		return StatusUnknown
+	}
+}
@@ -0,0 +1,56 @@
+package listener
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestListenerTypeRegistry(t *testing.T) {
+	// A type registered by another package can be validated and created like the built-in ones
+	RegisterType(Registration{
+		Type:   "test",
+		Schema: Schema{Port: true, Options: []Option{{Name: "path", Type: OptionString, Required: true}}},
+		New: func(config ListenerConfig) (Listener, error) {
+			return &flakyListener{status: StatusStopped}, nil
+		},
+	})
+	defer func() {
+		registryMutex.Lock()
+		delete(registry, "test")
+		registryMutex.Unlock()
+	}()
+
+	for _, tc := range []struct {
+		name   string
+		config ListenerConfig
+		valid  bool
+	}{
+		{"valid", ListenerConfig{Address: "127.0.0.1", Port: 8000, Options: map[string]interface{}{"path": "/x"}}, true},
+		{"no port", ListenerConfig{Address: "127.0.0.1", Options: map[string]interface{}{"path": "/x"}}, false},
+		{"missing option", ListenerConfig{Address: "127.0.0.1", Port: 8000}, false},
+		{"wrong option type", ListenerConfig{Address: "127.0.0.1", Port: 8000, Options: map[string]interface{}{"path": 1.0}}, false},
+	} {
+		if err := ValidateListenerConfig("test", tc.config); (err == nil) != tc.valid {
+			t.Errorf("%s: expected valid=%v, got %v", tc.name, tc.valid, err)
+		}
+	}
+
+	m := NewManager(nil)
+	defer m.Shutdown()
+	config := ListenerConfig{Address: "127.0.0.1", Port: 8000, Options: map[string]interface{}{"path": "/x"}}
+	if err := m.CreateListener("test1", "test", config); err != nil {
+		t.Fatalf("Failed to create listener of a registered type: %v", err)
+	}
+
+	found := false
+	for _, registration := range ListTypes() {
+		found = found || registration.Type == "test"
+	}
+	if !found {
+		t.Errorf("Expected the registered type to be listed")
+	}
+
+	if err := ValidateListenerConfig("carrier-pigeon", config); !errors.Is(err, ErrUnknownListenerType) {
+		t.Errorf("Expected ErrUnknownListenerType, got %v", err)
+	}
+}
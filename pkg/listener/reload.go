@@ -0,0 +1,28 @@
+package listener
+
+import "reflect"
+
+// ReloadResult reports what a configuration reload did to the listeners in the
+// configuration, by listener ID
+type ReloadResult struct {
+	Created      []string          `json:"created,omitempty"`
+	Reconfigured []string          `json:"reconfigured,omitempty"` // including listeners recreated with another type
+	Removed      []string          `json:"removed,omitempty"`      // removed from the configuration, or disabled
+	Unchanged    []string          `json:"unchanged,omitempty"`
+	Failed       map[string]string `json:"failed,omitempty"` // error by listener ID
+}
+
+// Fail records that a change to a listener failed
+func (r *ReloadResult) Fail(id string, err error) {
+	if r.Failed == nil {
+		r.Failed = make(map[string]string)
+	}
+	r.Failed[id] = err.Error()
+}
+
+// SameConfig reports whether two listener configurations listen on the same
+// address and port with the same options, ignoring runtime options
+func SameConfig(a, b ListenerConfig) bool {
+	a, b = persistableConfig(a), persistableConfig(b)
+	return a.Address == b.Address && a.Port == b.Port && reflect.DeepEqual(a.Options, b.Options)
+}
@@ -0,0 +1,73 @@
+package listener
+
+import (
+	"net"
+	"strconv"
+	"testing"
+)
+
+// freePort returns a TCP port that is free to listen on
+func freePort(t *testing.T) int {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to find a free port: %v", err)
+	}
+	defer l.Close()
+	return l.Addr().(*net.TCPAddr).Port
+}
+
+func TestReconfigureListener(t *testing.T) {
+	m := NewManager(nil)
+	defer m.Shutdown()
+
+	config := ListenerConfig{Address: "127.0.0.1", Port: freePort(t), Options: map[string]interface{}{}}
+	if err := m.CreateListener("tcp1", ListenerTypeTCP, config); err != nil {
+		t.Fatalf("Failed to create listener: %v", err)
+	}
+	if err := m.StartListener("tcp1"); err != nil {
+		t.Fatalf("Failed to start listener: %v", err)
+	}
+
+	current, err := m.GetConfig("tcp1")
+	if err != nil {
+		t.Fatalf("Failed to get listener config: %v", err)
+	}
+	if !SameConfig(current, config) {
+		t.Errorf("Expected the config the listener was created with, got %+v", current)
+	}
+	if _, exists := current.Options["client_manager"]; exists {
+		t.Errorf("Expected runtime options to be left out of the config")
+	}
+
+	// A running listener is moved to its new port and keeps running
+	moved := ListenerConfig{Address: "127.0.0.1", Port: freePort(t)}
+	if SameConfig(current, moved) {
+		t.Fatalf("Expected a different port to be a different config")
+	}
+	if err := m.ReconfigureListener("tcp1", moved); err != nil {
+		t.Fatalf("Failed to reconfigure listener: %v", err)
+	}
+	if status, _ := m.GetStatus("tcp1"); status != StatusRunning {
+		t.Errorf("Expected the listener to be running again, got %s", status)
+	}
+	conn, err := net.Dial("tcp", net.JoinHostPort("127.0.0.1", strconv.Itoa(moved.Port)))
+	if err != nil {
+		t.Errorf("Expected the listener to accept connections on its new port: %v", err)
+	} else {
+		conn.Close()
+	}
+	if current, _ := m.GetConfig("tcp1"); current.Port != moved.Port {
+		t.Errorf("Expected the record to hold port %d, got %d", moved.Port, current.Port)
+	}
+
+	// Invalid configurations are refused without touching the listener
+	if err := m.ReconfigureListener("tcp1", ListenerConfig{Address: "127.0.0.1"}); err == nil {
+		t.Errorf("Expected an error for a config without a port")
+	}
+	if status, _ := m.GetStatus("tcp1"); status != StatusRunning {
+		t.Errorf("Expected the listener to keep running, got %s", status)
+	}
+	if err := m.ReconfigureListener("missing", moved); err != ErrListenerNotFound {
+		t.Errorf("Expected ErrListenerNotFound, got %v", err)
+	}
+}
@@ -0,0 +1,250 @@
+package listener
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"dinoc2/pkg/events"
+)
+
+// RestartPolicy decides when the health monitor restarts a listener
+type RestartPolicy string
+
+const (
+	RestartNever     RestartPolicy = "never"      // leave listeners that fail down
+	RestartOnFailure RestartPolicy = "on-failure" // restart listeners that fail
+	RestartAlways    RestartPolicy = "always"     // also restart listeners that stopped without being stopped through the manager
+)
+
+const (
+	defaultMaxRestarts       = 5
+	defaultRestartBackoff    = 5   // in seconds
+	defaultMaxRestartBackoff = 300 // in seconds
+)
+
+// restartStableAfter is how long a restarted listener must stay up before its
+// restarts in a row are forgotten
+var restartStableAfter = 5 * time.Minute
+
+// ErrInvalidRestartConfig is returned when a restart configuration is inconsistent
+var ErrInvalidRestartConfig = errors.New("invalid restart configuration")
+
+// RestartConfig configures how the health monitor restarts a listener that is down
+type RestartConfig struct {
+	Policy      RestartPolicy `json:"policy,omitempty"`       // never, on-failure or always, on-failure if not set
+	MaxRestarts int           `json:"max_restarts,omitempty"` // restarts in a row before the listener is considered crash looping, 5 if not set
+	Backoff     int           `json:"backoff,omitempty"`      // in seconds before the first restart, doubled for each restart in a row, 5 if not set
+	MaxBackoff  int           `json:"max_backoff,omitempty"`  // longest wait between restarts in seconds, 300 if not set
+}
+
+// RestartState describes how the health monitor has restarted a listener
+type RestartState struct {
+	Policy      RestartPolicy `json:"policy"`
+	Restarts    int           `json:"restarts"` // restarts in a row, forgotten once the listener stays up
+	MaxRestarts int           `json:"max_restarts"`
+	CrashLoop   bool          `json:"crash_loop"` // restarts gave up, until the listener is started again
+	LastRestart time.Time     `json:"last_restart,omitempty"`
+	NextRestart time.Time     `json:"next_restart,omitempty"`
+}
+
+// Validate checks that a restart configuration has a known policy and no negative limits
+func (c RestartConfig) Validate() error {
+	switch c.Policy {
+	case "", RestartNever, RestartOnFailure, RestartAlways:
+	default:
+		return fmt.Errorf("%w: unknown policy %q, expected never, on-failure or always", ErrInvalidRestartConfig, c.Policy)
+	}
+	if c.MaxRestarts < 0 || c.Backoff < 0 || c.MaxBackoff < 0 {
+		return fmt.Errorf("%w: max_restarts, backoff and max_backoff must not be negative", ErrInvalidRestartConfig)
+	}
+	return nil
+}
+
+// withDefaults returns the restart configuration with defaults for the settings that are not set
+func (c RestartConfig) withDefaults() RestartConfig {
+	if c.Policy == "" {
+		c.Policy = RestartOnFailure
+	}
+	if c.MaxRestarts == 0 {
+		c.MaxRestarts = defaultMaxRestarts
+	}
+	if c.Backoff == 0 {
+		c.Backoff = defaultRestartBackoff
+	}
+	if c.MaxBackoff == 0 {
+		c.MaxBackoff = defaultMaxRestartBackoff
+	}
+	return c
+}
+
+// delay returns how long to wait before restarting a listener that has
+// already been restarted the given number of times in a row
+func (c RestartConfig) delay(restarts int) time.Duration {
+	delay := time.Duration(c.Backoff) * time.Second
+	limit := time.Duration(c.MaxBackoff) * time.Second
+	for i := 0; i < restarts && delay < limit; i++ {
+		delay *= 2
+	}
+	if delay > limit {
+		delay = limit
+	}
+	return delay
+}
+
+// SetRestartConfig changes how a listener is restarted when it is down. It
+// takes effect at the next health check, without restarting the listener.
+func (m *Manager) SetRestartConfig(id string, config RestartConfig) error {
+	if err := config.Validate(); err != nil {
+		return err
+	}
+
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	record, exists := m.records[id]
+	if !exists {
+		return ErrListenerNotFound
+	}
+	record.Config.Restart = config
+	m.persist(id)
+	return nil
+}
+
+// GetRestartState returns how the health monitor has restarted a listener
+func (m *Manager) GetRestartState(id string) (RestartState, error) {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+
+	if _, exists := m.listeners[id]; !exists {
+		return RestartState{}, ErrListenerNotFound
+	}
+
+	config := m.restartConfigOf(id)
+	state := RestartState{Policy: config.Policy, MaxRestarts: config.MaxRestarts}
+	if current, exists := m.restarts[id]; exists {
+		state.Restarts = current.Restarts
+		state.CrashLoop = current.CrashLoop
+		state.LastRestart = current.LastRestart
+		state.NextRestart = current.NextRestart
+	}
+	return state, nil
+}
+
+// restartConfigOf returns the restart configuration of a listener with
+// defaults applied. The caller must hold the mutex.
+func (m *Manager) restartConfigOf(id string) RestartConfig {
+	if record, exists := m.records[id]; exists {
+		return record.Config.Restart.withDefaults()
+	}
+	return RestartConfig{}.withDefaults()
+}
+
+// statusOf returns the status of a listener, which is StatusCrashLoop while
+// the health monitor has given up restarting it. The caller must hold the mutex.
+func (m *Manager) statusOf(id string, listener Listener) ListenerStatus {
+	status := listener.Status()
+	if state, exists := m.restarts[id]; exists && state.CrashLoop && status != StatusRunning {
+		return StatusCrashLoop
+	}
+	return status
+}
+
+// checkHealth restarts a listener that is down if its restart policy calls for
+// it, waiting longer for each restart in a row, and gives up once the listener
+// has been restarted too many times in a row
+func (m *Manager) checkHealth(id string, listener Listener, now time.Time) {
+	status := listener.Status()
+
+	m.mutex.Lock()
+	if m.holding[id] {
+		m.mutex.Unlock()
+		return
+	}
+	config := m.restartConfigOf(id)
+	state, exists := m.restarts[id]
+	if !exists {
+		state = &RestartState{}
+		m.restarts[id] = state
+	}
+	if state.CrashLoop {
+		m.mutex.Unlock()
+		return
+	}
+
+	// A listener that stayed up long enough starts counting its restarts over
+	if status == StatusRunning && state.Restarts > 0 && now.Sub(state.LastRestart) >= restartStableAfter {
+		state.Restarts = 0
+	}
+
+	record, hasRecord := m.records[id]
+	down := (status == StatusError && config.Policy != RestartNever) ||
+		(status == StatusStopped && config.Policy == RestartAlways && hasRecord && record.Running)
+	lastError := ""
+	if stats, exists := m.stats[id]; exists {
+		lastError = stats.LastError
+	}
+
+	switch {
+	case !down:
+		state.NextRestart = time.Time{}
+		m.mutex.Unlock()
+		m.reportStatus(id, status, "")
+		return
+	case state.Restarts >= config.MaxRestarts:
+		state.CrashLoop = true
+		state.NextRestart = time.Time{}
+		restarts := state.Restarts
+		m.mutex.Unlock()
+		fmt.Printf("Listener %s is crash looping after %d restarts in a row, no longer restarting it\n", id, restarts)
+		m.reportStatus(id, StatusCrashLoop, lastError)
+		return
+	case state.NextRestart.IsZero():
+		next := now.Add(config.delay(state.Restarts))
+		state.NextRestart = next
+		m.mutex.Unlock()
+		fmt.Printf("Listener %s is %s, restarting it at %s\n", id, status, next.Format(time.RFC3339))
+		m.reportStatus(id, status, lastError)
+		return
+	case now.Before(state.NextRestart):
+		m.mutex.Unlock()
+		return
+	}
+
+	state.Restarts++
+	state.LastRestart = now
+	state.NextRestart = time.Time{}
+	restarts := state.Restarts
+	m.mutex.Unlock()
+
+	fmt.Printf("Restarting listener %s (restart %d of %d)\n", id, restarts, config.MaxRestarts)
+	err := listener.Stop()
+	if err == nil {
+		err = listener.Start()
+	}
+
+	m.mutex.Lock()
+	if stats, exists := m.stats[id]; exists {
+		if err != nil {
+			stats.LastError = err.Error()
+			stats.LastErrorTime = time.Now()
+		} else {
+			stats.StartTime = time.Now()
+		}
+	}
+	bus := m.events
+	m.mutex.Unlock()
+
+	event := events.ListenerEvent{ListenerID: id, Status: string(listener.Status()), Restarts: restarts}
+	if err != nil {
+		fmt.Printf("Error restarting listener %s: %v\n", id, err)
+		event.Status = string(StatusError)
+		event.Error = err.Error()
+		bus.Publish(events.TypeListenerRestart, event)
+		m.reportStatus(id, StatusError, err.Error())
+		return
+	}
+	fmt.Printf("Successfully restarted listener %s\n", id)
+	bus.Publish(events.TypeListenerRestart, event)
+	m.reportStatus(id, listener.Status(), "")
+}
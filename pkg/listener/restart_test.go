@@ -0,0 +1,151 @@
+package listener
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+// flakyListener is a listener whose Start fails while it is broken
+type flakyListener struct {
+	status ListenerStatus
+	broken bool
+	starts int
+}
+
+func (l *flakyListener) Start() error {
+	l.starts++
+	if l.broken {
+		l.status = StatusError
+		return errors.New("address already in use")
+	}
+	l.status = StatusRunning
+	return nil
+}
+
+func (l *flakyListener) Stop() error {
+	if l.status == StatusRunning {
+		l.status = StatusStopped
+	}
+	return nil
+}
+
+func (l *flakyListener) Status() ListenerStatus                { return l.status }
+func (l *flakyListener) Configure(config ListenerConfig) error { return nil }
+
+// addFlakyListener adds a running flaky listener with a restart configuration to a manager
+func addFlakyListener(t *testing.T, m *Manager, id string, restart RestartConfig) *flakyListener {
+	l := &flakyListener{status: StatusRunning}
+	if err := m.AddListener(id, l); err != nil {
+		t.Fatalf("Failed to add listener: %v", err)
+	}
+	m.mutex.Lock()
+	m.stats[id] = &ListenerStats{}
+	m.records[id] = &Record{ID: id, Type: ListenerTypeTCP, Config: ListenerConfig{Restart: restart}, Running: true}
+	m.mutex.Unlock()
+	return l
+}
+
+func TestRestartPolicies(t *testing.T) {
+	m := NewManager(nil)
+	defer m.Shutdown()
+	now := time.Now()
+
+	// on-failure backs off between restarts and gives up after max_restarts
+	l := addFlakyListener(t, m, "tcp1", RestartConfig{MaxRestarts: 2, Backoff: 1, MaxBackoff: 60})
+	l.status, l.broken = StatusError, true
+
+	m.checkHealth("tcp1", l, now)
+	if l.starts != 0 {
+		t.Fatalf("Expected the first restart to wait for the backoff, got %d starts", l.starts)
+	}
+	m.checkHealth("tcp1", l, now.Add(time.Second))
+	if l.starts != 1 {
+		t.Fatalf("Expected a restart after the backoff, got %d starts", l.starts)
+	}
+	m.checkHealth("tcp1", l, now.Add(time.Second))
+	m.checkHealth("tcp1", l, now.Add(2*time.Second))
+	if l.starts != 1 {
+		t.Errorf("Expected the second restart to wait twice as long, got %d starts", l.starts)
+	}
+	m.checkHealth("tcp1", l, now.Add(3*time.Second))
+	m.checkHealth("tcp1", l, now.Add(3*time.Second))
+	if status, _ := m.GetStatus("tcp1"); status != StatusCrashLoop {
+		t.Errorf("Expected the listener to be crash looping, got %s", status)
+	}
+	m.checkHealth("tcp1", l, now.Add(time.Hour))
+	if l.starts != 2 {
+		t.Errorf("Expected no restarts once crash looping, got %d starts", l.starts)
+	}
+	state, err := m.GetRestartState("tcp1")
+	if err != nil || !state.CrashLoop || state.Restarts != 2 || state.Policy != RestartOnFailure {
+		t.Errorf("Expected a crash loop after 2 on-failure restarts, got %+v (%v)", state, err)
+	}
+
+	// Starting the listener again clears the crash loop
+	l.broken = false
+	if err := m.StartListener("tcp1"); err != nil {
+		t.Fatalf("Failed to start listener: %v", err)
+	}
+	if state, _ := m.GetRestartState("tcp1"); state.CrashLoop || state.Restarts != 0 {
+		t.Errorf("Expected the restart state to be cleared, got %+v", state)
+	}
+
+	// never leaves a failed listener down
+	never := addFlakyListener(t, m, "tcp2", RestartConfig{Policy: RestartNever})
+	never.status = StatusError
+	m.checkHealth("tcp2", never, now)
+	m.checkHealth("tcp2", never, now.Add(time.Hour))
+	if never.starts != 0 {
+		t.Errorf("Expected no restarts with the never policy, got %d", never.starts)
+	}
+
+	// always also restarts a listener that stopped on its own, but not one stopped through the manager
+	always := addFlakyListener(t, m, "tcp3", RestartConfig{Policy: RestartAlways, Backoff: 1})
+	always.status = StatusStopped
+	m.checkHealth("tcp3", always, now)
+	m.checkHealth("tcp3", always, now.Add(time.Second))
+	if always.starts != 1 || always.status != StatusRunning {
+		t.Errorf("Expected the stopped listener to be restarted, got %d starts (%s)", always.starts, always.status)
+	}
+	if err := m.StopListener("tcp3"); err != nil {
+		t.Fatalf("Failed to stop listener: %v", err)
+	}
+	m.checkHealth("tcp3", always, now.Add(time.Hour))
+	m.checkHealth("tcp3", always, now.Add(2*time.Hour))
+	if always.starts != 1 {
+		t.Errorf("Expected a listener stopped through the manager to stay stopped, got %d starts", always.starts)
+	}
+
+	if err := m.SetRestartConfig("tcp3", RestartConfig{Policy: "sometimes"}); !errors.Is(err, ErrInvalidRestartConfig) {
+		t.Errorf("Expected ErrInvalidRestartConfig, got %v", err)
+	}
+}
+
+func TestStopAllStopsRestarts(t *testing.T) {
+	m := NewManager(nil)
+	now := time.Now()
+
+	l := addFlakyListener(t, m, "tcp1", RestartConfig{Policy: RestartAlways, Backoff: 1})
+	if err := m.StopAll(); err != nil {
+		t.Fatalf("StopAll: %v", err)
+	}
+	if l.status != StatusStopped {
+		t.Fatalf("Expected the listener to be stopped, got %s", l.status)
+	}
+
+	// The listener is still restored as running, but not restarted while shutting down
+	m.checkListenerHealth(now)
+	m.checkListenerHealth(now.Add(time.Hour))
+	if l.starts != 0 {
+		t.Errorf("Expected no restarts after StopAll, got %d", l.starts)
+	}
+	if record := m.records["tcp1"]; !record.Running {
+		t.Error("Expected the listener to still be restored as running")
+	}
+
+	// Shutting down after StopAll is harmless
+	if err := m.Shutdown(); err != nil {
+		t.Errorf("Shutdown: %v", err)
+	}
+}
@@ -10,6 +10,17 @@ import (
 	"dinoc2/pkg/protocol"
 )
 
+func init() {
+	RegisterType(Registration{
+		Type:        ListenerTypeTCP,
+		Description: "Raw TCP with length-prefixed packets",
+		Schema:      Schema{Port: true},
+		New: func(config ListenerConfig) (Listener, error) {
+			return NewTCPListener(config), nil
+		},
+	})
+}
+
 // TCPListener implements the Listener interface for TCP protocol
 type TCPListener struct {
 	config     ListenerConfig
@@ -17,6 +28,7 @@ type TCPListener struct {
 	status     ListenerStatus
 	statusLock sync.RWMutex
 	stopChan   chan struct{}
+	traffic    TrafficCounters
 }
 
 // NewTCPListener creates a new TCP listener
@@ -49,7 +61,7 @@ func (l *TCPListener) Start() error {
 	l.stopChan = make(chan struct{})
 
 	// Start accepting connections in a goroutine
-	go l.acceptConnections()
+	go l.acceptConnections(listener, l.stopChan)
 
 	return nil
 }
@@ -86,6 +98,11 @@ func (l *TCPListener) Status() ListenerStatus {
 	return l.status
 }
 
+// Traffic implements the TrafficCounter interface
+func (l *TCPListener) Traffic() Traffic {
+	return l.traffic.Snapshot()
+}
+
 // UpdateStats updates the listener statistics
 func (l *TCPListener) UpdateStats(stats map[string]interface{}) {
 	// This method can be used to update statistics from the connection handler
@@ -105,17 +122,19 @@ func (l *TCPListener) Configure(config ListenerConfig) error {
 	return nil
 }
 
-// acceptConnections handles incoming TCP connections
-func (l *TCPListener) acceptConnections() {
+// acceptConnections handles incoming TCP connections until stopChan is closed.
+// It is given the listener and channel of one start, so that a restart does not
+// change them under it.
+func (l *TCPListener) acceptConnections(listener net.Listener, stopChan chan struct{}) {
 	for {
 		select {
-		case <-l.stopChan:
+		case <-stopChan:
 			return
 		default:
-			conn, err := l.listener.Accept()
+			conn, err := listener.Accept()
 			if err != nil {
 				select {
-				case <-l.stopChan:
+				case <-stopChan:
 					// Listener was closed intentionally, not an error
 					return
 				default:
@@ -129,7 +148,8 @@ func (l *TCPListener) acceptConnections() {
 			}
 
 			// Handle the connection in a new goroutine
-			go l.handleConnection(conn)
+			l.traffic.AddConnection()
+			go l.handleConnection(&countingConn{Conn: conn, traffic: &l.traffic})
 		}
 	}
 }
@@ -202,7 +222,9 @@ func (l *TCPListener) handleConnection(conn net.Conn) {
 	fmt.Printf("Successfully created session with encryption algorithm: %s\n", encAlgorithm)
 	
 	// Get the client manager from the listener manager
-	if clientManager, ok := l.config.Options["client_manager"]; ok {
+	var clientID string
+	clientManager, hasClientManager := l.config.Options["client_manager"]
+	if hasClientManager {
 		// Create a new client with the detected encryption algorithm
 		config := client.DefaultConfig()
 		config.ServerAddress = l.config.Address
@@ -218,10 +240,18 @@ func (l *TCPListener) handleConnection(conn net.Conn) {
 		// This is a temporary solution until the client package is updated
 		fmt.Printf("Created client with encryption algorithm: %s\n", encAlgorithm)
 		
+		// Record where the client connected from, and the hostname it reported
+		// in its handshake, for the scope check
+		newClient.SetRemoteAddress(conn.RemoteAddr().String())
+		if hostname := HandshakeHostname(packet); hostname != "" {
+			newClient.SetHostname(hostname)
+		}
+		
 		// Register the client with the client manager
 		if cm, ok := clientManager.(interface{ RegisterClient(*client.Client) string }); ok {
-			clientID := cm.RegisterClient(newClient)
+			clientID = cm.RegisterClient(newClient)
 			fmt.Printf("Registered client with ID %s using %s encryption\n", clientID, encAlgorithm)
+			checkIn(clientManager, clientID, ListenerTypeTCP)
 			
 			// Store the client ID for later use
 			clientIDStr := clientID
@@ -305,6 +335,9 @@ func (l *TCPListener) handleConnection(conn net.Conn) {
 		case protocol.PacketTypeHeartbeat:
 			// Handle heartbeat
 			fmt.Printf("Received heartbeat from %s\n", conn.RemoteAddr())
+			if clientID != "" {
+				checkIn(clientManager, clientID, ListenerTypeTCP)
+			}
 			
 			// Create a heartbeat response
 			responsePacket = protocol.NewPacket(protocol.PacketTypeHeartbeat, []byte("pong"))
@@ -339,3 +372,33 @@ func (l *TCPListener) handleConnection(conn net.Conn) {
 	// Clean up
 	protocolHandler.RemoveSession(sessionID)
 }
+
+// countingConn is a connection that counts the bytes read from and written to it
+type countingConn struct {
+	net.Conn
+	traffic *TrafficCounters
+}
+
+// Read implements net.Conn
+func (c *countingConn) Read(b []byte) (int, error) {
+	n, err := c.Conn.Read(b)
+	c.traffic.AddReceived(n)
+	return n, err
+}
+
+// Write implements net.Conn
+func (c *countingConn) Write(b []byte) (int, error) {
+	n, err := c.Conn.Write(b)
+	c.traffic.AddSent(n)
+	return n, err
+}
+
+// checkIn records a client's check-in through a listener with the client
+// manager, if it tracks client lifecycles
+func checkIn(clientManager interface{}, clientID string, listenerType ListenerType) {
+	if checker, ok := clientManager.(interface{ CheckIn(string, string) error }); ok {
+		if err := checker.CheckIn(clientID, string(listenerType)); err != nil {
+			fmt.Printf("Error recording check-in of client %s: %v\n", clientID, err)
+		}
+	}
+}
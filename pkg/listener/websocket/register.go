@@ -0,0 +1,77 @@
+package websocket
+
+import (
+	"dinoc2/pkg/listener"
+)
+
+func init() {
+	listener.RegisterType(listener.Registration{
+		Type:        listener.ListenerTypeWebSocket,
+		Description: "WebSocket connections, with or without TLS",
+		Schema: listener.Schema{
+			Port: true,
+			Options: []listener.Option{
+				{Name: "path", Type: listener.OptionString, Description: "Path that accepts WebSocket connections, /ws if not set"},
+				{Name: "tls_cert_file", Type: listener.OptionString, Description: "TLS certificate, serves wss with tls_key_file"},
+				{Name: "tls_key_file", Type: listener.OptionString, Description: "TLS private key"},
+			},
+		},
+		Capabilities: listener.Capabilities{TLS: true, APIHandler: true},
+		New: func(config listener.ListenerConfig) (listener.Listener, error) {
+			return &adapter{listener: NewWebSocketListener(configFrom(config))}, nil
+		},
+	})
+}
+
+// configFrom converts a generic listener configuration to a WebSocket configuration
+func configFrom(config listener.ListenerConfig) WebSocketConfig {
+	wsConfig := WebSocketConfig{
+		Address: config.Address,
+		Port:    config.Port,
+		Options: config.Options,
+	}
+
+	// Extract WebSocket-specific options
+	if config.Options != nil {
+		if path, ok := config.Options["path"].(string); ok {
+			wsConfig.Path = path
+		}
+		if certFile, ok := config.Options["tls_cert_file"].(string); ok {
+			wsConfig.TLSCertFile = certFile
+		}
+		if keyFile, ok := config.Options["tls_key_file"].(string); ok {
+			wsConfig.TLSKeyFile = keyFile
+		}
+	}
+	return wsConfig
+}
+
+// adapter adapts the WebSocket listener to the listener.Listener interface
+type adapter struct {
+	listener *WebSocketListener
+}
+
+// Start implements the listener.Listener interface
+func (a *adapter) Start() error {
+	return a.listener.Start()
+}
+
+// Stop implements the listener.Listener interface
+func (a *adapter) Stop() error {
+	return a.listener.Stop()
+}
+
+// Status implements the listener.Listener interface
+func (a *adapter) Status() listener.ListenerStatus {
+	return listener.ParseStatus(a.listener.Status())
+}
+
+// Configure implements the listener.Listener interface
+func (a *adapter) Configure(config listener.ListenerConfig) error {
+	return a.listener.Configure(configFrom(config))
+}
+
+// Traffic implements the listener.TrafficCounter interface
+func (a *adapter) Traffic() listener.Traffic {
+	return a.listener.Traffic()
+}
@@ -8,6 +8,7 @@ import (
 	"github.com/gorilla/websocket"
 	"dinoc2/pkg/client"
 	"dinoc2/pkg/crypto"
+	"dinoc2/pkg/listener"
 	"dinoc2/pkg/protocol"
 )
 
@@ -20,6 +21,8 @@ type WebSocketListener struct {
 	upgrader   websocket.Upgrader
 	clients    map[*websocket.Conn]bool
 	clientLock sync.RWMutex
+	clientTracker *listener.ClientTracker
+	traffic       listener.TrafficCounters
 }
 
 // WebSocketConfig holds configuration for the WebSocket listener
@@ -49,6 +52,7 @@ func NewWebSocketListener(config WebSocketConfig) *WebSocketListener {
 			CheckOrigin: func(r *http.Request) bool { return true },
 		},
 		clients: make(map[*websocket.Conn]bool),
+		clientTracker: listener.NewClientTracker(listener.ListenerTypeWebSocket),
 	}
 }
 
@@ -153,6 +157,11 @@ func (l *WebSocketListener) Configure(config interface{}) error {
 	return nil
 }
 
+// Traffic returns the connections and bytes the listener has handled
+func (l *WebSocketListener) Traffic() listener.Traffic {
+	return l.traffic.Snapshot()
+}
+
 // handleWebSocket handles WebSocket connections
 func (l *WebSocketListener) handleWebSocket(w http.ResponseWriter, r *http.Request) {
 	// Upgrade the HTTP connection to a WebSocket connection
@@ -163,6 +172,7 @@ func (l *WebSocketListener) handleWebSocket(w http.ResponseWriter, r *http.Reque
 	}
 	
 	// Register the client
+	l.traffic.AddConnection()
 	l.clientLock.Lock()
 	l.clients[conn] = true
 	l.clientLock.Unlock()
@@ -178,6 +188,7 @@ func (l *WebSocketListener) handleConnection(conn *websocket.Conn) {
 		l.clientLock.Lock()
 		delete(l.clients, conn)
 		l.clientLock.Unlock()
+		l.clientTracker.Forget(conn.RemoteAddr().String())
 		
 		// Close the connection
 		conn.Close()
@@ -194,6 +205,8 @@ func (l *WebSocketListener) handleConnection(conn *websocket.Conn) {
 			break
 		}
 		
+		l.traffic.AddReceived(len(message))
+		
 		// Process the message
 		go l.processMessage(conn, messageType, message)
 	}
@@ -214,7 +227,9 @@ func (l *WebSocketListener) processMessage(conn *websocket.Conn, messageType int
 	if err != nil {
 		fmt.Printf("Error decoding WebSocket packet data: %v\n", err)
 		// Echo the message back for invalid packets
-		conn.WriteMessage(messageType, message)
+		if conn.WriteMessage(messageType, message) == nil {
+			l.traffic.AddSent(len(message))
+		}
 		return
 	}
 	
@@ -242,9 +257,12 @@ func (l *WebSocketListener) processMessage(conn *websocket.Conn, messageType int
 		return
 	}
 	
-	// Get the client manager from the options if available
-	if l.config.Options != nil {
-		if clientManager, ok := l.config.Options["client_manager"]; ok {
+	// Register the client once, and check it in on each later heartbeat
+	var clientID string
+	var registered bool
+	clientManager, hasClientManager := l.config.Options["client_manager"]
+	if hasClientManager {
+		clientID, registered, err = l.clientTracker.Register(clientManager, conn.RemoteAddr().String(), listener.HandshakeHostname(packet), func() (*client.Client, error) {
 			// Create a new client with the detected encryption algorithm
 			config := client.DefaultConfig()
 			config.ServerAddress = fmt.Sprintf("%s:%d", l.config.Address, l.config.Port)
@@ -252,14 +270,17 @@ func (l *WebSocketListener) processMessage(conn *websocket.Conn, messageType int
 			
 			newClient, err := client.NewClient(config)
 			if err != nil {
-				fmt.Printf("Error creating client: %v\n", err)
-			} else {
-				// Register the client with the client manager
-				if cm, ok := clientManager.(interface{ RegisterClient(*client.Client) string }); ok {
-					clientID := cm.RegisterClient(newClient)
-					fmt.Printf("Registered WebSocket client with ID %s using %s encryption\n", clientID, encAlgorithm)
-				}
+				return nil, err
 			}
+			
+			// Record where the client connected from for the scope check
+			newClient.SetRemoteAddress(conn.RemoteAddr().String())
+			return newClient, nil
+		})
+		if err != nil {
+			fmt.Printf("Error registering WebSocket client: %v\n", err)
+		} else if registered {
+			fmt.Printf("Registered WebSocket client with ID %s using %s encryption\n", clientID, encAlgorithm)
 		}
 	}
 	
@@ -275,6 +296,9 @@ func (l *WebSocketListener) processMessage(conn *websocket.Conn, messageType int
 		
 	case protocol.PacketTypeHeartbeat:
 		fmt.Printf("Received heartbeat from %s via WebSocket\n", conn.RemoteAddr())
+		if clientID != "" && !registered {
+			l.clientTracker.CheckIn(clientManager, clientID)
+		}
 		// Create a heartbeat response
 		responsePacket := protocol.NewPacket(protocol.PacketTypeHeartbeat, []byte("pong"))
 		responseData = protocol.EncodePacket(responsePacket)
@@ -292,7 +316,9 @@ func (l *WebSocketListener) processMessage(conn *websocket.Conn, messageType int
 	err = conn.WriteMessage(messageType, responseData)
 	if err != nil {
 		fmt.Printf("Error writing WebSocket message: %v\n", err)
+		return
 	}
+	l.traffic.AddSent(len(responseData))
 }
 
 // Broadcast sends a message to all connected clients
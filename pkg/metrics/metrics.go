@@ -0,0 +1,233 @@
+// Package metrics writes metrics in the Prometheus text exposition format
+package metrics
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// ContentType is the content type of the text exposition format
+const ContentType = "text/plain; version=0.0.4; charset=utf-8"
+
+// Metric types
+const (
+	TypeCounter   = "counter"
+	TypeGauge     = "gauge"
+	TypeHistogram = "histogram"
+)
+
+// Writer writes metric families in the text exposition format. Errors are
+// kept and returned by Flush, so that callers can write without checking each line.
+type Writer struct {
+	w   *bufio.Writer
+	err error
+}
+
+// NewWriter creates a writer that writes to w
+func NewWriter(w io.Writer) *Writer {
+	return &Writer{w: bufio.NewWriter(w)}
+}
+
+// Family starts a metric family with its help text and type
+func (w *Writer) Family(name, help, metricType string) {
+	w.printf("# HELP %s %s\n", name, escapeHelp(help))
+	w.printf("# TYPE %s %s\n", name, metricType)
+}
+
+// Sample writes one sample. Labels are given as name and value pairs.
+func (w *Writer) Sample(name string, value float64, labels ...string) {
+	w.printf("%s%s %s\n", name, formatLabels(labels), formatValue(value))
+}
+
+// Flush writes any buffered samples and returns the first error that occurred
+func (w *Writer) Flush() error {
+	if w.err != nil {
+		return w.err
+	}
+	return w.w.Flush()
+}
+
+func (w *Writer) printf(format string, args ...interface{}) {
+	if w.err != nil {
+		return
+	}
+	_, w.err = fmt.Fprintf(w.w, format, args...)
+}
+
+// formatLabels formats name and value pairs as a label set
+func formatLabels(labels []string) string {
+	if len(labels) == 0 {
+		return ""
+	}
+	var b strings.Builder
+	b.WriteByte('{')
+	for i := 0; i+1 < len(labels); i += 2 {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+		b.WriteString(labels[i])
+		b.WriteString(`="`)
+		b.WriteString(escapeLabel(labels[i+1]))
+		b.WriteByte('"')
+	}
+	b.WriteByte('}')
+	return b.String()
+}
+
+// formatValue formats a sample value
+func formatValue(value float64) string {
+	switch {
+	case math.IsInf(value, 1):
+		return "+Inf"
+	case math.IsInf(value, -1):
+		return "-Inf"
+	case math.IsNaN(value):
+		return "NaN"
+	}
+	return strconv.FormatFloat(value, 'g', -1, 64)
+}
+
+var (
+	helpEscaper  = strings.NewReplacer(`\`, `\\`, "\n", `\n`)
+	labelEscaper = strings.NewReplacer(`\`, `\\`, "\n", `\n`, `"`, `\"`)
+)
+
+func escapeHelp(s string) string  { return helpEscaper.Replace(s) }
+func escapeLabel(s string) string { return labelEscaper.Replace(s) }
+
+// DefaultBuckets are the upper bounds in seconds of the buckets of a latency histogram
+var DefaultBuckets = []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10}
+
+// series is the data of a metric for one set of label values
+type series struct {
+	values []string
+	counts []uint64 // per bucket, for histograms
+	count  uint64
+	sum    float64
+}
+
+// vec holds the series of a metric by label values
+type vec struct {
+	name       string
+	help       string
+	labelNames []string
+	mutex      sync.Mutex
+	series     map[string]*series
+}
+
+// get returns the series for a set of label values, creating it if needed.
+// The caller must hold the mutex.
+func (v *vec) get(values []string, buckets int) *series {
+	key := strings.Join(values, "\xff")
+	s, exists := v.series[key]
+	if !exists {
+		s = &series{values: append([]string(nil), values...), counts: make([]uint64, buckets)}
+		v.series[key] = s
+	}
+	return s
+}
+
+// sorted returns the series ordered by label values. The caller must hold the mutex.
+func (v *vec) sorted() []*series {
+	keys := make([]string, 0, len(v.series))
+	for key := range v.series {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	sorted := make([]*series, len(keys))
+	for i, key := range keys {
+		sorted[i] = v.series[key]
+	}
+	return sorted
+}
+
+// labels pairs the label names with a series' values
+func (v *vec) labels(s *series, extra ...string) []string {
+	labels := make([]string, 0, 2*len(v.labelNames)+len(extra))
+	for i, name := range v.labelNames {
+		labels = append(labels, name, s.values[i])
+	}
+	return append(labels, extra...)
+}
+
+// CounterVec is a counter with one series for each set of label values
+type CounterVec struct {
+	vec
+}
+
+// NewCounterVec creates a counter with the given label names
+func NewCounterVec(name, help string, labelNames ...string) *CounterVec {
+	return &CounterVec{vec{name: name, help: help, labelNames: labelNames, series: make(map[string]*series)}}
+}
+
+// Inc adds one to the series with the given label values
+func (c *CounterVec) Inc(values ...string) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	c.get(values, 0).count++
+}
+
+// Write writes the counter to w
+func (c *CounterVec) Write(w *Writer) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	w.Family(c.name, c.help, TypeCounter)
+	for _, s := range c.sorted() {
+		w.Sample(c.name, float64(s.count), c.labels(s)...)
+	}
+}
+
+// HistogramVec is a histogram with one series for each set of label values
+type HistogramVec struct {
+	vec
+	buckets []float64
+}
+
+// NewHistogramVec creates a histogram with the given bucket upper bounds and label names
+func NewHistogramVec(name, help string, buckets []float64, labelNames ...string) *HistogramVec {
+	buckets = append([]float64(nil), buckets...)
+	sort.Float64s(buckets)
+	return &HistogramVec{
+		vec:     vec{name: name, help: help, labelNames: labelNames, series: make(map[string]*series)},
+		buckets: buckets,
+	}
+}
+
+// Observe records a value in the series with the given label values
+func (h *HistogramVec) Observe(value float64, values ...string) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	s := h.get(values, len(h.buckets))
+	for i, bound := range h.buckets {
+		if value <= bound {
+			s.counts[i]++
+		}
+	}
+	s.count++
+	s.sum += value
+}
+
+// Write writes the histogram to w
+func (h *HistogramVec) Write(w *Writer) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	w.Family(h.name, h.help, TypeHistogram)
+	for _, s := range h.sorted() {
+		for i, bound := range h.buckets {
+			w.Sample(h.name+"_bucket", float64(s.counts[i]), h.labels(s, "le", formatValue(bound))...)
+		}
+		w.Sample(h.name+"_bucket", float64(s.count), h.labels(s, "le", "+Inf")...)
+		w.Sample(h.name+"_sum", s.sum, h.labels(s)...)
+		w.Sample(h.name+"_count", float64(s.count), h.labels(s)...)
+	}
+}
@@ -156,6 +156,21 @@ func (m *RPCModule) GetCapabilities() []string {
 	return reply
 }
 
+// GetCommands returns the commands the remote module declares, if it declares any
+func (m *RPCModule) GetCommands() []module.Command {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	
+	// Call remote GetCommands method, which older modules do not have
+	var reply []module.Command
+	err := m.client.Call(m.name+".GetCommands", struct{}{}, &reply)
+	if err != nil {
+		return nil
+	}
+	
+	return reply
+}
+
 // Pause pauses the module
 func (m *RPCModule) Pause() error {
 	m.mutex.Lock()
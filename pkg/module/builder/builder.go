@@ -207,6 +207,16 @@ func (m *{{.ModuleName}}Module) GetCapabilities() []string {
 	}
 }
 
+// GetCommands returns the commands the module accepts and their arguments
+func (m *{{.ModuleName}}Module) GetCommands() []module.Command {
+	return []module.Command{
+		{{range .ModuleInfo.Commands}}{Name: {{printf "%q" .Name}}, Description: {{printf "%q" .Description}}, Args: []module.Arg{
+			{{range .Args}}{Name: {{printf "%q" .Name}}, Type: {{printf "%q" .Type}}, Required: {{.Required}}, Description: {{printf "%q" .Description}}},
+			{{end}}}},
+		{{end}}
+	}
+}
+
 // Pause temporarily pauses the module's operations
 func (m *{{.ModuleName}}Module) Pause() error {
 	m.mutex.Lock()
@@ -1,8 +1,10 @@
 package file
 
 import (
+	"errors"
 	"fmt"
 	"io"
+	"io/fs"
 	"os"
 	"path/filepath"
 	"sync"
@@ -18,6 +20,7 @@ type FileModule struct {
 	isRunning   bool
 	isPaused    bool
 	stats       map[string]interface{}
+	created     []string // files and directories the module created, in the order it created them
 }
 
 // NewFileModule creates a new file module
@@ -120,6 +123,14 @@ func (m *FileModule) Exec(command string, args ...interface{}) (interface{}, err
 		}
 		return nil, m.deleteFile(path)
 
+	case "artifacts":
+		// List the files and directories the module created
+		return m.artifacts(), nil
+
+	case "cleanup":
+		// Remove the files and directories the module created
+		return m.cleanup(), nil
+
 	default:
 		return nil, fmt.Errorf("unknown command: %s", command)
 	}
@@ -178,12 +189,22 @@ func (m *FileModule) readFile(path string) ([]byte, error) {
 
 // writeFile writes data to a file
 func (m *FileModule) writeFile(path string, data []byte) error {
-	// Create directory if it doesn't exist
-	dir := filepath.Dir(path)
-	err := os.MkdirAll(dir, 0755)
+	// Create directory if it doesn't exist, remembering the directories it creates
+	var dirs []string
+	for dir := filepath.Dir(path); ; dir = filepath.Dir(dir) {
+		if _, err := os.Stat(dir); !errors.Is(err, fs.ErrNotExist) || dir == filepath.Dir(dir) {
+			break
+		}
+		dirs = append([]string{dir}, dirs...)
+	}
+	err := os.MkdirAll(filepath.Dir(path), 0755)
 	if err != nil {
 		return fmt.Errorf("failed to create directory: %w", err)
 	}
+	m.created = append(m.created, dirs...)
+	if _, err := os.Stat(path); errors.Is(err, fs.ErrNotExist) {
+		m.created = append(m.created, path)
+	}
 
 	// Create file
 	file, err := os.Create(path)
@@ -208,10 +229,68 @@ func (m *FileModule) deleteFile(path string) error {
 	if err != nil {
 		return fmt.Errorf("failed to delete file: %w", err)
 	}
+	m.forget(path)
 
 	return nil
 }
 
+// artifacts returns the files and directories the module created that are still on the host
+func (m *FileModule) artifacts() []module.Artifact {
+	artifacts := make([]module.Artifact, 0, len(m.created))
+	for _, path := range m.created {
+		if _, err := os.Lstat(path); err == nil {
+			artifacts = append(artifacts, module.Artifact{Module: m.name, Path: path})
+		}
+	}
+	return artifacts
+}
+
+// cleanup removes the files and directories the module created, newest first so
+// that directories are empty by the time they are removed. Artifacts that could
+// not be removed are kept, so a later cleanup can try again.
+func (m *FileModule) cleanup() []module.Artifact {
+	artifacts := make([]module.Artifact, 0, len(m.created))
+	var remaining []string
+	for i := len(m.created) - 1; i >= 0; i-- {
+		path := m.created[i]
+		artifact := module.Artifact{Module: m.name, Path: path, Removed: true}
+		if err := os.Remove(path); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			artifact.Removed = false
+			artifact.Error = err.Error()
+			remaining = append([]string{path}, remaining...)
+		}
+		artifacts = append(artifacts, artifact)
+	}
+	m.created = remaining
+	return artifacts
+}
+
+// forget stops tracking a file that was removed
+func (m *FileModule) forget(path string) {
+	for i, created := range m.created {
+		if created == path {
+			m.created = append(m.created[:i], m.created[i+1:]...)
+			return
+		}
+	}
+}
+
+// Artifacts implements module.Cleaner
+func (m *FileModule) Artifacts() []module.Artifact {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	return m.artifacts()
+}
+
+// Cleanup implements module.Cleaner
+func (m *FileModule) Cleanup() []module.Artifact {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	return m.cleanup()
+}
+
 // Shutdown shuts down the module
 func (m *FileModule) Shutdown() error {
 	m.mutex.Lock()
@@ -247,6 +326,29 @@ func (m *FileModule) GetCapabilities() []string {
 		"read",
 		"write",
 		"delete",
+		"artifacts",
+		"cleanup",
+	}
+}
+
+// GetCommands returns the commands the module accepts and their arguments
+func (m *FileModule) GetCommands() []module.Command {
+	return []module.Command{
+		{Name: "list", Description: "List the files in a directory", Args: []module.Arg{
+			{Name: "path", Type: module.ArgString, Required: true},
+		}},
+		{Name: "read", Description: "Read a file", Args: []module.Arg{
+			{Name: "path", Type: module.ArgString, Required: true},
+		}},
+		{Name: "write", Description: "Write data to a file", Args: []module.Arg{
+			{Name: "path", Type: module.ArgString, Required: true},
+			{Name: "data", Type: module.ArgString, Required: true},
+		}},
+		{Name: "delete", Description: "Delete a file", Args: []module.Arg{
+			{Name: "path", Type: module.ArgString, Required: true},
+		}},
+		{Name: "artifacts", Description: "List the files and directories the module created"},
+		{Name: "cleanup", Description: "Remove the files and directories the module created"},
 	}
 }
 
@@ -283,3 +385,8 @@ func (m *FileModule) Resume() error {
 	m.isPaused = false
 	return nil
 }
+
+// init registers the module
+func init() {
+	module.RegisterModule("file", NewFileModule)
+}
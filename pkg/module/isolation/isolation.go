@@ -192,6 +192,36 @@ func (m *IsolatedModule) GetCapabilities() []string {
 	}
 }
 
+// GetCommands returns the commands the wrapped module declares, if any
+func (m *IsolatedModule) GetCommands() []module.Command {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	
+	// Create a channel to receive the result
+	resultChan := make(chan []module.Command, 1)
+	
+	// Execute the getCommands function in a goroutine with panic recovery
+	go func() {
+		defer func() {
+			if r := recover(); r != nil {
+				// Declare no commands on panic
+				resultChan <- nil
+			}
+		}()
+		
+		resultChan <- module.Commands(m.module)
+	}()
+	
+	// Wait for the result with timeout
+	select {
+	case commands := <-resultChan:
+		return commands
+	case <-time.After(m.timeout):
+		// Declare no commands on timeout
+		return nil
+	}
+}
+
 // Pause pauses the module with safety boundaries
 func (m *IsolatedModule) Pause() error {
 	m.mutex.Lock()
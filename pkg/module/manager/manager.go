@@ -1,9 +1,12 @@
 package manager
 
 import (
+	"dinoc2/pkg/events"
 	"dinoc2/pkg/module"
 	"dinoc2/pkg/module/loader"
 	"fmt"
+	"sort"
+	"strings"
 	"sync"
 )
 
@@ -12,6 +15,7 @@ type ModuleManager struct {
 	loaders       map[loader.LoaderType]loader.ModuleLoader
 	loadedModules map[string]module.Module
 	moduleInfo    map[string]ModuleInfo
+	events        *events.Bus
 	mutex         sync.RWMutex
 }
 
@@ -45,11 +49,38 @@ func NewModuleManager() (*ModuleManager, error) {
 	return manager, nil
 }
 
+// SetEventBus sets the bus that module load results are published to
+func (m *ModuleManager) SetEventBus(bus *events.Bus) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	
+	m.events = bus
+}
+
 // LoadModule loads a module using the specified loader
 func (m *ModuleManager) LoadModule(name, path string, loaderType loader.LoaderType) (module.Module, error) {
 	m.mutex.Lock()
 	defer m.mutex.Unlock()
 	
+	mod, err := m.loadModule(name, path, loaderType)
+	
+	// Publish the result of the load
+	event := events.ModuleEvent{
+		Name:    name,
+		Path:    path,
+		Loader:  string(loaderType),
+		Success: err == nil,
+	}
+	if err != nil {
+		event.Error = err.Error()
+	}
+	m.events.Publish(events.TypeModuleLoad, event)
+	
+	return mod, err
+}
+
+// loadModule loads a module. The caller must hold the mutex.
+func (m *ModuleManager) loadModule(name, path string, loaderType loader.LoaderType) (module.Module, error) {
 	// Check if module is already loaded
 	if mod, exists := m.loadedModules[name]; exists {
 		return mod, nil
@@ -175,7 +206,79 @@ func (m *ModuleManager) ListModules() map[string]ModuleInfo {
 	return result
 }
 
-// ExecModule executes a command on a module
+// ValidateCommand checks a command and its arguments against the commands a
+// module declares, and returns the arguments converted to their declared
+// types. Loaded modules are checked first, then registered module factories,
+// so commands for built-in modules that only run on clients are checked as
+// well. Commands for modules the server does not know, such as plugins loaded
+// on a client, are accepted as they are.
+func (m *ModuleManager) ValidateCommand(name, command string, args []interface{}) ([]interface{}, error) {
+	return module.ValidateCommand(m.declaredCommands(name), command, args)
+}
+
+// CheckCommandName checks that a command name, such as one in an approval
+// rule, can match a command of a module. Modules the server does not know and
+// modules that do not declare commands accept any name. The commands of a
+// module that runs any command line, such as shell, are the command lines
+// themselves, so no command name can be relied on to match them.
+func (m *ModuleManager) CheckCommandName(name, command string) error {
+	commands := m.declaredCommands(name)
+	if len(commands) == 0 {
+		return nil
+	}
+	
+	names := make([]string, 0, len(commands))
+	for _, declared := range commands {
+		if declared.Name == module.AnyCommand {
+			return fmt.Errorf("module %s runs any command line, so its commands cannot be named", name)
+		}
+		if declared.Name == command {
+			return nil
+		}
+		names = append(names, declared.Name)
+	}
+	sort.Strings(names)
+	return fmt.Errorf("module %s has no command %q, expected one of %s", name, command, strings.Join(names, ", "))
+}
+
+// declaredCommands returns the commands a loaded or registered module declares
+func (m *ModuleManager) declaredCommands(name string) []module.Command {
+	m.mutex.RLock()
+	mod, loaded := m.loadedModules[name]
+	m.mutex.RUnlock()
+	
+	if loaded {
+		return module.Commands(mod)
+	}
+	if described, err := module.DescribeModule(name); err == nil {
+		return described
+	}
+	return nil
+}
+
+// ListCommands returns the declared commands of all registered and loaded
+// modules, by module name. Modules that do not declare commands are included
+// with no commands.
+func (m *ModuleManager) ListCommands() map[string][]module.Command {
+	result := make(map[string][]module.Command)
+	for _, name := range module.ListModules() {
+		if commands, err := module.DescribeModule(name); err == nil {
+			result[name] = commands
+		}
+	}
+	
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+	
+	for name, mod := range m.loadedModules {
+		result[name] = module.Commands(mod)
+	}
+	
+	return result
+}
+
+// ExecModule executes a command on a module, after checking it against the
+// commands the module declares
 func (m *ModuleManager) ExecModule(name, command string, args ...interface{}) (interface{}, error) {
 	m.mutex.RLock()
 	mod, exists := m.loadedModules[name]
@@ -185,6 +288,11 @@ func (m *ModuleManager) ExecModule(name, command string, args ...interface{}) (i
 		return nil, fmt.Errorf("module %s not found", name)
 	}
 	
+	args, err := module.ValidateCommand(module.Commands(mod), command, args)
+	if err != nil {
+		return nil, err
+	}
+	
 	// Execute command
 	result, err := mod.Exec(command, args...)
 	if err != nil {
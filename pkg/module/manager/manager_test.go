@@ -0,0 +1,33 @@
+package manager
+
+import (
+	"testing"
+
+	_ "dinoc2/pkg/module/file"
+	_ "dinoc2/pkg/module/shell"
+)
+
+func TestCheckCommandName(t *testing.T) {
+	m, err := NewModuleManager()
+	if err != nil {
+		t.Fatalf("Failed to create module manager: %v", err)
+	}
+
+	tests := []struct {
+		module, command string
+		valid           bool
+	}{
+		{"file", "delete", true},
+		{"file", "remove", false},
+		// The shell module runs command lines, so no command name matches reliably
+		{"shell", "exec", false},
+		// Commands of modules the server does not know cannot be checked
+		{"custom-plugin", "run", true},
+	}
+	for _, tt := range tests {
+		err := m.CheckCommandName(tt.module, tt.command)
+		if (err == nil) != tt.valid {
+			t.Errorf("CheckCommandName(%q, %q) = %v, expected valid: %v", tt.module, tt.command, err, tt.valid)
+		}
+	}
+}
@@ -33,6 +33,24 @@ type Module interface {
 	Resume() error
 }
 
+// Artifact is something a module left on the host, such as a file it wrote
+type Artifact struct {
+	Module  string `json:"module"`
+	Path    string `json:"path"`
+	Removed bool   `json:"removed"`
+	Error   string `json:"error,omitempty"` // why the artifact could not be removed
+}
+
+// Cleaner is implemented by modules that leave artifacts on the host, so that
+// they can be removed before the client exits
+type Cleaner interface {
+	// Artifacts returns the artifacts the module created that are still on the host
+	Artifacts() []Artifact
+
+	// Cleanup removes the artifacts the module created and reports each of them
+	Cleanup() []Artifact
+}
+
 // ModuleType represents the type of module
 type ModuleType string
 
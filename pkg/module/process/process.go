@@ -239,6 +239,20 @@ func (m *ProcessModule) GetCapabilities() []string {
 	}
 }
 
+// GetCommands returns the commands the module accepts and their arguments
+func (m *ProcessModule) GetCommands() []module.Command {
+	return []module.Command{
+		{Name: "list", Description: "List processes"},
+		{Name: "kill", Description: "Kill a process", Args: []module.Arg{
+			{Name: "pid", Type: module.ArgInt, Required: true},
+		}},
+		{Name: "execute", Description: "Start a program", Args: []module.Arg{
+			{Name: "command", Type: module.ArgString, Required: true},
+			{Name: "args", Type: module.ArgString, Description: "arguments separated by spaces"},
+		}},
+	}
+}
+
 // Pause temporarily pauses the module's operations
 func (m *ProcessModule) Pause() error {
 	m.mutex.Lock()
@@ -52,6 +52,16 @@ func CreateModule(name string) (Module, error) {
 	return factory(), nil
 }
 
+// DescribeModule returns the commands a registered module declares, or nil if it declares none
+func DescribeModule(name string) ([]Command, error) {
+	module, err := CreateModule(name)
+	if err != nil {
+		return nil, err
+	}
+
+	return Commands(module), nil
+}
+
 // ListModules returns a list of registered module names
 func ListModules() []string {
 	moduleRegistry.mutex.RLock()
@@ -3,6 +3,8 @@ package registry
 import (
 	"fmt"
 	"sync"
+
+	"dinoc2/pkg/module"
 )
 
 // ModuleInfo contains information about a registered module
@@ -12,6 +14,7 @@ type ModuleInfo struct {
 	Version      string
 	Author       string
 	Capabilities []string
+	Commands     []module.Command // commands the module accepts and their arguments
 	Platforms    []string
 }
 
@@ -99,6 +102,19 @@ func (r *RegistryManager) FindModulesByCapability(capability string) []ModuleInf
 	return result
 }
 
+// GetModuleCommands returns the commands a registered module declares
+func (r *RegistryManager) GetModuleCommands(name string) ([]module.Command, error) {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+
+	info, exists := r.modules[name]
+	if !exists {
+		return nil, fmt.Errorf("module %s not registered", name)
+	}
+
+	return info.Commands, nil
+}
+
 // FindModulesByPlatform returns a list of modules that support the specified platform
 func (r *RegistryManager) FindModulesByPlatform(platform string) []ModuleInfo {
 	r.mutex.RLock()
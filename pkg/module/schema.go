@@ -0,0 +1,138 @@
+package module
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+)
+
+// ErrInvalidCommand is returned when a module command does not match the module's declared commands
+var ErrInvalidCommand = errors.New("invalid module command")
+
+// AnyCommand is the name of a declared command that stands for any command
+// line, such as the commands of the shell module
+const AnyCommand = "*"
+
+// ArgType is the type of a module command argument
+type ArgType string
+
+const (
+	ArgString ArgType = "string"
+	ArgInt    ArgType = "int"
+	ArgNumber ArgType = "number"
+	ArgBool   ArgType = "bool"
+)
+
+// Arg describes an argument of a module command
+type Arg struct {
+	Name        string  `json:"name"`
+	Type        ArgType `json:"type"`
+	Required    bool    `json:"required,omitempty"`
+	Description string  `json:"description,omitempty"`
+}
+
+// Command describes a module command and the arguments it takes, in order
+type Command struct {
+	Name        string `json:"name"`
+	Description string `json:"description,omitempty"`
+	Args        []Arg  `json:"args,omitempty"`
+}
+
+// CommandDescriber is implemented by modules that declare their commands, so
+// that commands can be checked before they are sent to a client
+type CommandDescriber interface {
+	// GetCommands returns the commands the module accepts and their arguments
+	GetCommands() []Command
+}
+
+// Commands returns the commands a module declares, or nil if it does not declare any
+func Commands(m Module) []Command {
+	if describer, ok := m.(CommandDescriber); ok {
+		return describer.GetCommands()
+	}
+	return nil
+}
+
+// ValidateCommand checks a command and its arguments against the declared
+// commands of a module. It returns the arguments converted to their declared
+// types, since numbers decoded from JSON are always float64. If no commands
+// are declared, anything is accepted.
+func ValidateCommand(commands []Command, command string, args []interface{}) ([]interface{}, error) {
+	if len(commands) == 0 {
+		return args, nil
+	}
+
+	var declared *Command
+	names := make([]string, 0, len(commands))
+	for i := range commands {
+		if commands[i].Name == command || commands[i].Name == AnyCommand {
+			declared = &commands[i]
+			break
+		}
+		names = append(names, commands[i].Name)
+	}
+	if declared == nil {
+		sort.Strings(names)
+		return nil, fmt.Errorf("%w: unknown command %q, expected one of %s", ErrInvalidCommand, command, strings.Join(names, ", "))
+	}
+	if command == "" {
+		return nil, fmt.Errorf("%w: command is required", ErrInvalidCommand)
+	}
+
+	if len(args) > len(declared.Args) {
+		return nil, fmt.Errorf("%w: %s takes at most %d arguments, got %d", ErrInvalidCommand, command, len(declared.Args), len(args))
+	}
+	converted := make([]interface{}, len(args))
+	for i, arg := range declared.Args {
+		if i >= len(args) {
+			if arg.Required {
+				return nil, fmt.Errorf("%w: %s is missing its %s argument", ErrInvalidCommand, command, arg.Name)
+			}
+			continue
+		}
+
+		value, err := arg.convert(args[i])
+		if err != nil {
+			return nil, fmt.Errorf("%w: %s argument %s: %v", ErrInvalidCommand, command, arg.Name, err)
+		}
+		converted[i] = value
+	}
+	return converted, nil
+}
+
+// convert checks a value against the argument's type and converts it
+func (a Arg) convert(value interface{}) (interface{}, error) {
+	switch a.Type {
+	case ArgString:
+		if s, ok := value.(string); ok {
+			return s, nil
+		}
+	case ArgInt:
+		switch v := value.(type) {
+		case int:
+			return v, nil
+		case int64:
+			return int(v), nil
+		case float64:
+			if v == math.Trunc(v) && math.Abs(v) <= math.MaxInt32 {
+				return int(v), nil
+			}
+		}
+	case ArgNumber:
+		switch v := value.(type) {
+		case float64:
+			return v, nil
+		case int:
+			return float64(v), nil
+		}
+	case ArgBool:
+		if b, ok := value.(bool); ok {
+			return b, nil
+		}
+	default:
+		return value, nil
+	}
+	return nil, fmt.Errorf("expected %s, got %v", a.Type, value)
+}
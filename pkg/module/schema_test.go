@@ -0,0 +1,47 @@
+package module
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestValidateCommand(t *testing.T) {
+	commands := []Command{
+		{Name: "list"},
+		{Name: "kill", Args: []Arg{{Name: "pid", Type: ArgInt, Required: true}, {Name: "force", Type: ArgBool}}},
+	}
+
+	// Numbers decoded from JSON are converted to the declared type
+	args, err := ValidateCommand(commands, "kill", []interface{}{float64(42)})
+	if err != nil {
+		t.Fatalf("Failed to validate command: %v", err)
+	}
+	if pid, ok := args[0].(int); !ok || pid != 42 {
+		t.Errorf("Expected pid 42 as int, got %#v", args[0])
+	}
+
+	invalid := []struct {
+		command string
+		args    []interface{}
+	}{
+		{"stop", nil},
+		{"kill", nil},
+		{"kill", []interface{}{"42"}},
+		{"kill", []interface{}{1.5}},
+		{"kill", []interface{}{float64(42), "yes"}},
+		{"list", []interface{}{"extra"}},
+	}
+	for _, test := range invalid {
+		if _, err := ValidateCommand(commands, test.command, test.args); !errors.Is(err, ErrInvalidCommand) {
+			t.Errorf("%s %v: expected ErrInvalidCommand, got %v", test.command, test.args, err)
+		}
+	}
+
+	// Modules that declare no commands, or any command, accept anything
+	if _, err := ValidateCommand(nil, "anything", []interface{}{1}); err != nil {
+		t.Errorf("Expected undeclared commands to be accepted, got %v", err)
+	}
+	if _, err := ValidateCommand([]Command{{Name: AnyCommand, Args: []Arg{{Name: "line", Type: ArgString}}}}, "whoami", nil); err != nil {
+		t.Errorf("Expected any command to be accepted, got %v", err)
+	}
+}
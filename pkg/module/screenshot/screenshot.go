@@ -121,6 +121,14 @@ func (m *ScreenshotModule) GetCapabilities() []string {
 	}
 }
 
+// GetCommands returns the commands the module accepts and their arguments
+func (m *ScreenshotModule) GetCommands() []module.Command {
+	return []module.Command{
+		{Name: "capture", Description: "Capture the screen"},
+		{Name: "last", Description: "Get the last capture"},
+	}
+}
+
 // Pause temporarily pauses the module's operations
 func (m *ScreenshotModule) Pause() error {
 	m.mutex.Lock()
@@ -146,3 +154,8 @@ func (m *ScreenshotModule) Resume() error {
 	// Nothing to resume in this module
 	return nil
 }
+
+// init registers the module
+func init() {
+	module.RegisterModule("screenshot", NewScreenshotModule)
+}
@@ -173,6 +173,13 @@ func (m *ShellModule) GetCapabilities() []string {
 	}
 }
 
+// GetCommands returns the commands the module accepts and their arguments
+func (m *ShellModule) GetCommands() []module.Command {
+	return []module.Command{
+		{Name: module.AnyCommand, Description: "Run a command line in the shell"},
+	}
+}
+
 // Pause temporarily pauses the module's operations
 func (m *ShellModule) Pause() error {
 	m.mutex.Lock()
@@ -206,3 +213,8 @@ func (m *ShellModule) Resume() error {
 	m.isPaused = false
 	return nil
 }
+
+// init registers the module
+func init() {
+	module.RegisterModule("shell", NewShellModule)
+}
@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"net"
 	"os"
+	"os/user"
 	"runtime"
 	"strings"
 	"sync"
@@ -126,6 +127,11 @@ func (m *SysInfoModule) gatherSystemInfo() error {
 	m.cachedInfo["arch"] = runtime.GOARCH
 	m.cachedInfo["cpus"] = runtime.NumCPU()
 
+	// Get the user the client runs as
+	if current, err := user.Current(); err == nil {
+		m.cachedInfo["username"] = current.Username
+	}
+
 	// Get memory information
 	var memStats runtime.MemStats
 	runtime.ReadMemStats(&memStats)
@@ -236,6 +242,17 @@ func (m *SysInfoModule) GetCapabilities() []string {
 	}
 }
 
+// GetCommands returns the commands the module accepts and their arguments
+func (m *SysInfoModule) GetCommands() []module.Command {
+	return []module.Command{
+		{Name: "get", Description: "Get one item of system information", Args: []module.Arg{
+			{Name: "key", Type: module.ArgString, Required: true, Description: "such as hostname, os or arch"},
+		}},
+		{Name: "refresh", Description: "Gather the system information again"},
+		{Name: "all", Description: "Get all system information"},
+	}
+}
+
 // Pause temporarily pauses the module's operations
 func (m *SysInfoModule) Pause() error {
 	m.mutex.Lock()
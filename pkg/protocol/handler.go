@@ -38,6 +38,13 @@ func (h *ProtocolHandler) ProcessIncomingPacket(data []byte, sessionID crypto.Se
 		return nil, fmt.Errorf("failed to decode packet: %w", err)
 	}
 	
+	// Key exchange packets are handled whole and as they are: a handshake is
+	// sent in the clear, and the encrypted key exchange of an older client
+	// cannot be decrypted, as the server does not have its key
+	if packet.Header.Type == PacketTypeKeyExchange {
+		return packet, nil
+	}
+	
 	// Handle fragmented packets
 	if len(packet.Data) > 0 && packet.Data[1]&FlagFragmented != 0 {
 		return h.handleFragmentedPacket(packet)
@@ -57,6 +64,19 @@ func (h *ProtocolHandler) ProcessIncomingPacket(data []byte, sessionID crypto.Se
 
 // PrepareOutgoingPacket prepares a packet for sending
 func (h *ProtocolHandler) PrepareOutgoingPacket(packet *Packet, sessionID crypto.SessionID, encrypt bool) ([][]byte, error) {
+	// Key exchange packets open the session before the server has a key for
+	// it, so they are sent in the clear with the session's algorithm in the header
+	if encrypt && packet.Header.Type == PacketTypeKeyExchange {
+		session, err := h.sessionManager.GetSession(sessionID)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get session: %w", err)
+		}
+		handshake := *packet
+		handshake.Header.EncAlgorithm = getEncryptionAlgorithm(session.Encryptor.Algorithm())
+		packet = &handshake
+		encrypt = false
+	}
+	
 	// Apply encryption if requested
 	if encrypt {
 		encryptedPacket, err := h.encryptPacket(packet, sessionID)
@@ -0,0 +1,56 @@
+package protocol
+
+import "bytes"
+
+// handshakeMarker starts the data of a handshake, which tells it apart from
+// the key exchange of older clients: their data is their session ID,
+// encrypted with a key the server does not have
+var handshakeMarker = []byte("DHS1")
+
+// TLV types of the handshake fields
+const (
+	handshakeSessionID byte = 1
+	handshakeHostname  byte = 2
+)
+
+// Handshake is the data of the key exchange packet a client opens a session
+// with. It is sent in the clear, as no key is shared with the server yet.
+type Handshake struct {
+	SessionID string // Session ID the client generated
+	Hostname  string // Hostname of the system the client runs on, if known
+}
+
+// EncodeHandshake encodes a handshake as the marker followed by a sequence of TLVs
+func EncodeHandshake(h Handshake) []byte {
+	data := append([]byte{}, handshakeMarker...)
+	data = append(data, EncodeTLV(NewTLV(handshakeSessionID, []byte(h.SessionID)))...)
+	if h.Hostname != "" {
+		data = append(data, EncodeTLV(NewTLV(handshakeHostname, []byte(h.Hostname)))...)
+	}
+	return data
+}
+
+// DecodeHandshake decodes the data of a key exchange packet. It returns false
+// if the data is not a handshake, such as the encrypted key exchange of an
+// older client, whose session is then opened without a hostname.
+func DecodeHandshake(data []byte) (Handshake, bool) {
+	if !bytes.HasPrefix(data, handshakeMarker) {
+		return Handshake{}, false
+	}
+
+	var h Handshake
+	for offset := len(handshakeMarker); offset < len(data); {
+		tlv, n, err := DecodeTLV(data[offset:])
+		if err != nil {
+			return Handshake{}, false
+		}
+		switch tlv.Type {
+		case handshakeSessionID:
+			h.SessionID = string(tlv.Value)
+		case handshakeHostname:
+			h.Hostname = string(tlv.Value)
+		}
+		offset += n
+	}
+	return h, true
+}
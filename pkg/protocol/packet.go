@@ -12,6 +12,7 @@ const (
 	PacketTypeError
 	PacketTypeKeyExchange
 	PacketTypeProtocolSwitch
+	PacketTypeExitCleanup
 )
 
 // EncryptionAlgorithm represents the encryption algorithm used
@@ -253,3 +253,70 @@ func TestJitter(t *testing.T) {
 		t.Errorf("Jitter delay should be zero when disabled: got %v", delay)
 	}
 }
+
+func TestHandshake(t *testing.T) {
+	handler := NewProtocolHandler()
+	defer handler.Shutdown()
+	
+	sessionID := crypto.SessionID("test-session")
+	if err := handler.CreateSession(sessionID, crypto.AlgorithmChacha20); err != nil {
+		t.Fatalf("Failed to create session: %v", err)
+	}
+	
+	// The handshake is sent in the clear, with the session's algorithm in the header
+	handshake := NewPacket(PacketTypeKeyExchange, EncodeHandshake(Handshake{SessionID: string(sessionID), Hostname: "ws01.corp.example.com"}))
+	fragments, err := handler.PrepareOutgoingPacket(handshake, sessionID, true)
+	if err != nil {
+		t.Fatalf("Failed to prepare handshake: %v", err)
+	}
+	packet, err := DecodePacket(fragments[0])
+	if err != nil {
+		t.Fatalf("Failed to decode handshake: %v", err)
+	}
+	if packet.Header.EncAlgorithm != EncryptionAlgorithmChacha20 {
+		t.Errorf("Expected the chacha20 algorithm in the header, got %d", packet.Header.EncAlgorithm)
+	}
+	
+	decoded, ok := DecodeHandshake(packet.Data)
+	if !ok || decoded.SessionID != string(sessionID) || decoded.Hostname != "ws01.corp.example.com" {
+		t.Errorf("Unexpected handshake: %+v (%v)", decoded, ok)
+	}
+}
+
+func TestEncryptedKeyExchangeFromOlderClient(t *testing.T) {
+	// Older clients encrypt their session ID with a key the server does not have
+	clientHandler := NewProtocolHandler()
+	defer clientHandler.Shutdown()
+	sessionID := crypto.SessionID("legacy-session")
+	if err := clientHandler.CreateSession(sessionID, crypto.AlgorithmAES); err != nil {
+		t.Fatalf("Failed to create session: %v", err)
+	}
+	packet := NewPacket(PacketTypeKeyExchange, []byte(sessionID))
+	encrypted, err := clientHandler.encryptPacket(packet, sessionID)
+	if err != nil {
+		t.Fatalf("Failed to encrypt key exchange: %v", err)
+	}
+	
+	// The server opens the session without failing on the data it cannot decrypt
+	serverHandler := NewProtocolHandler()
+	defer serverHandler.Shutdown()
+	serverSession := crypto.SessionID("server-session")
+	if err := serverHandler.CreateSession(serverSession, crypto.AlgorithmAES); err != nil {
+		t.Fatalf("Failed to create session: %v", err)
+	}
+	received, err := serverHandler.ProcessIncomingPacket(EncodePacket(encrypted), serverSession)
+	if err != nil {
+		t.Fatalf("Expected the key exchange of an older client to be accepted, got %v", err)
+	}
+	if received.Header.Type != PacketTypeKeyExchange || received.Header.EncAlgorithm != EncryptionAlgorithmAES {
+		t.Errorf("Unexpected key exchange header: %+v", received.Header)
+	}
+	
+	// It is not mistaken for a handshake, so the client reports no hostname
+	if decoded, ok := DecodeHandshake(received.Data); ok {
+		t.Errorf("Expected the encrypted key exchange not to decode as a handshake, got %+v", decoded)
+	}
+	if _, ok := DecodeHandshake([]byte("legacy-session")); ok {
+		t.Error("Expected a bare session ID not to decode as a handshake")
+	}
+}
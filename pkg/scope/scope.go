@@ -0,0 +1,191 @@
+package scope
+
+import (
+	"fmt"
+	"net"
+	"strings"
+)
+
+// Config describes the systems an engagement is authorized to touch
+type Config struct {
+	AllowedCIDRs  []string `json:"allowed_cidrs,omitempty"`
+	AllowedHosts  []string `json:"allowed_hosts,omitempty"`
+	ExcludedCIDRs []string `json:"excluded_cidrs,omitempty"`
+	ExcludedHosts []string `json:"excluded_hosts,omitempty"`
+}
+
+// Scope checks client addresses and hostnames against the rules of engagement
+type Scope struct {
+	allowedNets   []*net.IPNet
+	allowedHosts  []string
+	excludedNets  []*net.IPNet
+	excludedHosts []string
+}
+
+// New creates a scope from its configuration
+func New(config Config) (*Scope, error) {
+	s := &Scope{}
+
+	var err error
+	if s.allowedNets, err = parseNetworks(config.AllowedCIDRs); err != nil {
+		return nil, err
+	}
+	if s.excludedNets, err = parseNetworks(config.ExcludedCIDRs); err != nil {
+		return nil, err
+	}
+	s.allowedHosts = normalizeHosts(config.AllowedHosts)
+	s.excludedHosts = normalizeHosts(config.ExcludedHosts)
+
+	return s, nil
+}
+
+// IsEmpty reports whether the scope has no rules, in which case every client is in scope
+func (s *Scope) IsEmpty() bool {
+	return len(s.allowedNets) == 0 && len(s.allowedHosts) == 0 &&
+		len(s.excludedNets) == 0 && len(s.excludedHosts) == 0
+}
+
+// Verdict is the outcome of checking a client against the scope
+type Verdict int
+
+const (
+	// InScope means the client is authorized
+	InScope Verdict = iota
+	// OutOfScope means the client is excluded or not authorized
+	OutOfScope
+	// Pending means the scope has host rules but the client has not reported
+	// its hostname yet, so it can be neither authorized nor excluded
+	Pending
+)
+
+// Check checks a client with the given address and hostname against the scope.
+// The address is the one the server saw the client connect from; the hostname
+// is empty until the client reports it. When both authorized ranges and
+// authorized domains are set, a client must match both: its reported hostname
+// never authorizes an address outside the authorized ranges. Unless the client
+// is in scope, the returned reason explains why.
+func (s *Scope) Check(address, hostname string) (Verdict, string) {
+	if s == nil || s.IsEmpty() {
+		return InScope, ""
+	}
+
+	ip := parseIP(address)
+	hostname = normalizeHost(hostname)
+
+	// Exclusions always win over authorizations
+	if ip != nil {
+		for _, network := range s.excludedNets {
+			if network.Contains(ip) {
+				return OutOfScope, fmt.Sprintf("address %s is in excluded range %s", ip, network)
+			}
+		}
+	}
+	if hostname != "" {
+		for _, pattern := range s.excludedHosts {
+			if matchHost(pattern, hostname) {
+				return OutOfScope, fmt.Sprintf("host %s matches excluded host %s", hostname, pattern)
+			}
+		}
+	}
+
+	if len(s.allowedNets) > 0 && !s.allowsAddress(ip) {
+		if ip == nil {
+			return OutOfScope, "client address is unknown"
+		}
+		return OutOfScope, fmt.Sprintf("address %s is not in an authorized range", ip)
+	}
+
+	if hostname == "" && (len(s.allowedHosts) > 0 || len(s.excludedHosts) > 0) {
+		return Pending, "waiting for the client to report its hostname"
+	}
+	if len(s.allowedHosts) > 0 && !s.allowsHost(hostname) {
+		return OutOfScope, fmt.Sprintf("host %s is not in an authorized domain", hostname)
+	}
+
+	return InScope, ""
+}
+
+// allowsAddress reports whether ip is in an authorized range
+func (s *Scope) allowsAddress(ip net.IP) bool {
+	if ip == nil {
+		return false
+	}
+	for _, network := range s.allowedNets {
+		if network.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// allowsHost reports whether hostname is in an authorized domain
+func (s *Scope) allowsHost(hostname string) bool {
+	for _, pattern := range s.allowedHosts {
+		if matchHost(pattern, hostname) {
+			return true
+		}
+	}
+	return false
+}
+
+// parseNetworks parses CIDRs, treating a bare IP address as a single-host network
+func parseNetworks(values []string) ([]*net.IPNet, error) {
+	networks := make([]*net.IPNet, 0, len(values))
+	for _, value := range values {
+		value = strings.TrimSpace(value)
+		if !strings.Contains(value, "/") {
+			ip := net.ParseIP(value)
+			if ip == nil {
+				return nil, fmt.Errorf("invalid scope address: %s", value)
+			}
+			bits := 128
+			if ip.To4() != nil {
+				ip = ip.To4()
+				bits = 32
+			}
+			networks = append(networks, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+			continue
+		}
+
+		_, network, err := net.ParseCIDR(value)
+		if err != nil {
+			return nil, fmt.Errorf("invalid scope CIDR %s: %w", value, err)
+		}
+		networks = append(networks, network)
+	}
+	return networks, nil
+}
+
+// parseIP extracts the IP address from an address that may include a port
+func parseIP(address string) net.IP {
+	address = strings.TrimSpace(address)
+	if host, _, err := net.SplitHostPort(address); err == nil {
+		address = host
+	}
+	return net.ParseIP(address)
+}
+
+// normalizeHosts normalizes a list of host patterns
+func normalizeHosts(hosts []string) []string {
+	normalized := make([]string, 0, len(hosts))
+	for _, host := range hosts {
+		if host = normalizeHost(host); host != "" {
+			normalized = append(normalized, host)
+		}
+	}
+	return normalized
+}
+
+// normalizeHost lowercases a hostname and removes any trailing dot
+func normalizeHost(host string) string {
+	return strings.TrimSuffix(strings.ToLower(strings.TrimSpace(host)), ".")
+}
+
+// matchHost reports whether hostname matches pattern. A pattern of "example.com"
+// matches the domain and all of its subdomains, "*.example.com" only its subdomains.
+func matchHost(pattern, hostname string) bool {
+	if strings.HasPrefix(pattern, "*.") {
+		return strings.HasSuffix(hostname, pattern[1:])
+	}
+	return hostname == pattern || strings.HasSuffix(hostname, "."+pattern)
+}
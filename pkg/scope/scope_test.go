@@ -0,0 +1,104 @@
+package scope
+
+import (
+	"testing"
+)
+
+// checkCase is a client address and hostname with the verdict expected for them
+type checkCase struct {
+	address  string
+	hostname string
+	verdict  Verdict
+}
+
+// runChecks checks each case against the scope
+func runChecks(t *testing.T, s *Scope, tests []checkCase) {
+	for _, tt := range tests {
+		verdict, reason := s.Check(tt.address, tt.hostname)
+		if verdict != tt.verdict {
+			t.Errorf("Check(%q, %q) = %v (%s), expected %v", tt.address, tt.hostname, verdict, reason, tt.verdict)
+		}
+		if verdict != InScope && reason == "" {
+			t.Errorf("Check(%q, %q) returned no reason", tt.address, tt.hostname)
+		}
+	}
+}
+
+func TestScopeCheck(t *testing.T) {
+	s, err := New(Config{
+		AllowedCIDRs:  []string{"10.0.0.0/16", "192.168.1.5"},
+		ExcludedCIDRs: []string{"10.0.99.0/24"},
+	})
+	if err != nil {
+		t.Fatalf("Failed to create scope: %v", err)
+	}
+
+	runChecks(t, s, []checkCase{
+		{"10.0.1.20:51234", "", InScope},
+		{"192.168.1.5", "", InScope},
+		{"192.168.1.6", "", OutOfScope},
+		{"10.0.99.7:443", "", OutOfScope},
+		{"10.0.1.20", "anything.example.net", InScope},
+		{"", "", OutOfScope},
+	})
+}
+
+func TestHostnameOnlyScope(t *testing.T) {
+	s, err := New(Config{
+		AllowedHosts:  []string{"corp.example.com"},
+		ExcludedHosts: []string{"*.prod.corp.example.com"},
+	})
+	if err != nil {
+		t.Fatalf("Failed to create scope: %v", err)
+	}
+
+	runChecks(t, s, []checkCase{
+		// Clients that have not reported their hostname yet are pending, not out of scope
+		{"203.0.113.9", "", Pending},
+		{"", "", Pending},
+		{"203.0.113.9", "ws01.corp.example.com", InScope},
+		{"203.0.113.9", "CORP.EXAMPLE.COM.", InScope},
+		{"203.0.113.9", "db.prod.corp.example.com", OutOfScope},
+		{"203.0.113.9", "corp.example.com.evil.net", OutOfScope},
+	})
+}
+
+func TestMixedScope(t *testing.T) {
+	s, err := New(Config{
+		AllowedCIDRs:  []string{"10.0.0.0/16"},
+		AllowedHosts:  []string{"corp.example.com"},
+		ExcludedCIDRs: []string{"10.0.99.0/24"},
+		ExcludedHosts: []string{"*.prod.corp.example.com"},
+	})
+	if err != nil {
+		t.Fatalf("Failed to create scope: %v", err)
+	}
+
+	runChecks(t, s, []checkCase{
+		// Both the address and the hostname must be authorized
+		{"10.0.1.20", "ws01.corp.example.com", InScope},
+		{"10.0.1.20", "", Pending},
+		{"10.0.1.20", "ws01.other.example.net", OutOfScope},
+		// A reported hostname never authorizes an address outside the authorized ranges
+		{"203.0.113.9", "ws01.corp.example.com", OutOfScope},
+		{"203.0.113.9", "", OutOfScope},
+		// Exclusions win over authorizations
+		{"10.0.99.7", "ws01.corp.example.com", OutOfScope},
+		{"10.0.1.20", "db.prod.corp.example.com", OutOfScope},
+	})
+}
+
+func TestEmptyScopeAllowsAll(t *testing.T) {
+	s, err := New(Config{})
+	if err != nil {
+		t.Fatalf("Failed to create scope: %v", err)
+	}
+
+	if verdict, _ := s.Check("203.0.113.9", ""); verdict != InScope {
+		t.Error("Expected an empty scope to allow every client")
+	}
+
+	if _, err := New(Config{AllowedCIDRs: []string{"10.0.0.0/33"}}); err == nil {
+		t.Error("Expected an invalid CIDR to be rejected")
+	}
+}
@@ -48,6 +48,11 @@ type Authenticator struct {
 	mutex       sync.RWMutex
 	tlsConfig   *tls.Config
 	certificates map[string]*tls.Certificate
+
+	// Certificate revocation list checked for peer certificates, reloaded when the file changes
+	crlFile    string
+	crlModTime time.Time
+	revoked    map[string]bool
 }
 
 // NewAuthenticator creates a new authenticator with the specified options
@@ -283,6 +288,16 @@ func (a *Authenticator) GetTLSConfig(isServer bool) *tls.Config {
 		if !a.options.RequireMutualAuth {
 			tlsConfig.ClientAuth = tls.VerifyClientCertIfGiven
 		}
+
+		// Reject client certificates that have been revoked
+		if a.crlFile != "" {
+			tlsConfig.VerifyConnection = func(state tls.ConnectionState) error {
+				if len(state.PeerCertificates) > 0 && a.IsRevoked(state.PeerCertificates[0]) {
+					return fmt.Errorf("client certificate %s has been revoked", state.PeerCertificates[0].SerialNumber.Text(16))
+				}
+				return nil
+			}
+		}
 	} else {
 		// Client configuration
 		tlsConfig.InsecureSkipVerify = false
@@ -301,6 +316,158 @@ func (a *Authenticator) GetTLSConfig(isServer bool) *tls.Config {
 	return tlsConfig
 }
 
+// SetCertValidityDays sets how long generated certificates are valid
+func (a *Authenticator) SetCertValidityDays(days int) {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+
+	a.options.CertValidityDays = days
+}
+
+// AddTrustedCertsFromFile trusts the certificates in a PEM file, such as the
+// certificate of a CA whose private key is kept elsewhere
+func (a *Authenticator) AddTrustedCertsFromFile(certFile string) error {
+	data, err := os.ReadFile(certFile)
+	if err != nil {
+		return fmt.Errorf("failed to read certificate file: %w", err)
+	}
+
+	var certs []*x509.Certificate
+	for {
+		var block *pem.Block
+		block, data = pem.Decode(data)
+		if block == nil {
+			break
+		}
+		if block.Type != "CERTIFICATE" {
+			continue
+		}
+		cert, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return fmt.Errorf("failed to parse certificate: %w", err)
+		}
+		certs = append(certs, cert)
+	}
+	if len(certs) == 0 {
+		return fmt.Errorf("no certificates found in %s", certFile)
+	}
+
+	a.mutex.Lock()
+	a.options.TrustedCerts = append(a.options.TrustedCerts, certs...)
+	a.mutex.Unlock()
+
+	return nil
+}
+
+// CreateRevocationList creates a PEM encoded certificate revocation list signed by the CA
+func (a *Authenticator) CreateRevocationList(entries []x509.RevocationListEntry, nextUpdate time.Time) ([]byte, error) {
+	a.mutex.RLock()
+	ca := a.options.CertificateAuthority
+	caKey := a.options.CAPrivateKey
+	a.mutex.RUnlock()
+
+	if ca == nil || caKey == nil {
+		return nil, fmt.Errorf("CA not initialized")
+	}
+
+	template := &x509.RevocationList{
+		RevokedCertificateEntries: entries,
+		Number:                    big.NewInt(time.Now().UnixNano()),
+		ThisUpdate:                time.Now(),
+		NextUpdate:                nextUpdate,
+	}
+
+	der, err := x509.CreateRevocationList(rand.Reader, template, ca, caKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create revocation list: %w", err)
+	}
+
+	return pem.EncodeToMemory(&pem.Block{Type: "X509 CRL", Bytes: der}), nil
+}
+
+// SetRevocationListFile checks peer certificates against the revocation list
+// in a PEM file. The file is read again whenever it changes, so revoking a
+// certificate takes effect without restarting the server.
+func (a *Authenticator) SetRevocationListFile(crlFile string) error {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+
+	a.crlFile = crlFile
+	a.crlModTime = time.Time{}
+	return a.loadRevocationList()
+}
+
+// IsRevoked reports whether a certificate is on the revocation list
+func (a *Authenticator) IsRevoked(cert *x509.Certificate) bool {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+
+	if a.crlFile == "" {
+		return false
+	}
+
+	// Keep the previous list if the file cannot be read or verified
+	if err := a.loadRevocationList(); err != nil {
+		fmt.Printf("Failed to reload revocation list: %v\n", err)
+	}
+
+	return a.revoked[cert.SerialNumber.Text(16)]
+}
+
+// loadRevocationList reads the revocation list if it changed since it was
+// last read. The caller must hold the mutex.
+func (a *Authenticator) loadRevocationList() error {
+	info, err := os.Stat(a.crlFile)
+	if os.IsNotExist(err) && a.crlModTime.IsZero() {
+		// Nothing has been revoked yet
+		a.revoked = make(map[string]bool)
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to read revocation list: %w", err)
+	}
+	if info.ModTime().Equal(a.crlModTime) {
+		return nil
+	}
+
+	data, err := os.ReadFile(a.crlFile)
+	if err != nil {
+		return fmt.Errorf("failed to read revocation list: %w", err)
+	}
+	block, _ := pem.Decode(data)
+	if block == nil || block.Type != "X509 CRL" {
+		return fmt.Errorf("failed to decode revocation list PEM")
+	}
+	crl, err := x509.ParseRevocationList(block.Bytes)
+	if err != nil {
+		return fmt.Errorf("failed to parse revocation list: %w", err)
+	}
+
+	// Only accept a list signed by a trusted CA
+	issuers := a.options.TrustedCerts
+	if a.options.CertificateAuthority != nil {
+		issuers = append([]*x509.Certificate{a.options.CertificateAuthority}, issuers...)
+	}
+	verified := false
+	for _, issuer := range issuers {
+		if crl.CheckSignatureFrom(issuer) == nil {
+			verified = true
+			break
+		}
+	}
+	if !verified {
+		return fmt.Errorf("revocation list is not signed by a trusted CA")
+	}
+
+	revoked := make(map[string]bool, len(crl.RevokedCertificateEntries))
+	for _, entry := range crl.RevokedCertificateEntries {
+		revoked[entry.SerialNumber.Text(16)] = true
+	}
+	a.revoked = revoked
+	a.crlModTime = info.ModTime()
+	return nil
+}
+
 // AddPreSharedKey adds a pre-shared key
 func (a *Authenticator) AddPreSharedKey(id, key string) {
 	a.mutex.Lock()
@@ -0,0 +1,217 @@
+package security
+
+import (
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+)
+
+// Files kept in an operator CA directory
+const (
+	OperatorCACertFile  = "ca.pem"
+	OperatorCAKeyFile   = "ca-key.pem"
+	OperatorCRLFile     = "crl.pem"
+	operatorCAIndexFile = "index.json"
+)
+
+// crlValidity is how long a revocation list is valid before it must be reissued
+const crlValidity = 365 * 24 * time.Hour
+
+var (
+	// ErrCAExists is returned when initializing a directory that already holds a CA
+	ErrCAExists = errors.New("a CA already exists in this directory")
+
+	// ErrCertificateNotFound is returned when revoking an unknown certificate
+	ErrCertificateNotFound = errors.New("certificate not found")
+)
+
+// IssuedCertificate records an operator certificate issued by the CA
+type IssuedCertificate struct {
+	Serial    string     `json:"serial"`
+	Username  string     `json:"username"`
+	IssuedAt  time.Time  `json:"issued_at"`
+	ExpiresAt time.Time  `json:"expires_at"`
+	RevokedAt *time.Time `json:"revoked_at,omitempty"`
+}
+
+// OperatorCA issues and revokes the client certificates operators present to
+// the API. It keeps its certificate, key, an index of issued certificates and
+// the revocation list in a directory.
+type OperatorCA struct {
+	dir           string
+	authenticator *Authenticator
+	certificates  []IssuedCertificate
+}
+
+// InitOperatorCA creates a new CA in a directory, with an empty revocation list
+func InitOperatorCA(dir string) (*OperatorCA, error) {
+	if _, err := os.Stat(filepath.Join(dir, OperatorCACertFile)); err == nil {
+		return nil, ErrCAExists
+	}
+
+	authenticator := NewAuthenticator(DefaultAuthenticationOptions())
+	if err := authenticator.InitCA(); err != nil {
+		return nil, err
+	}
+
+	keyFile := filepath.Join(dir, OperatorCAKeyFile)
+	if err := authenticator.SaveCAToFile(filepath.Join(dir, OperatorCACertFile), keyFile); err != nil {
+		return nil, err
+	}
+	if err := os.Chmod(keyFile, 0600); err != nil {
+		return nil, fmt.Errorf("failed to protect CA key file: %w", err)
+	}
+
+	ca := &OperatorCA{dir: dir, authenticator: authenticator}
+	if err := ca.save(); err != nil {
+		return nil, err
+	}
+	return ca, nil
+}
+
+// OpenOperatorCA opens the CA in a directory
+func OpenOperatorCA(dir string) (*OperatorCA, error) {
+	authenticator := NewAuthenticator(DefaultAuthenticationOptions())
+	if err := authenticator.LoadCAFromFile(filepath.Join(dir, OperatorCACertFile), filepath.Join(dir, OperatorCAKeyFile)); err != nil {
+		return nil, err
+	}
+
+	ca := &OperatorCA{dir: dir, authenticator: authenticator}
+	data, err := os.ReadFile(filepath.Join(dir, operatorCAIndexFile))
+	if err != nil && !os.IsNotExist(err) {
+		return nil, fmt.Errorf("failed to read certificate index: %w", err)
+	}
+	if err == nil {
+		if err := json.Unmarshal(data, &ca.certificates); err != nil {
+			return nil, fmt.Errorf("failed to parse certificate index: %w", err)
+		}
+	}
+
+	return ca, nil
+}
+
+// Issue creates a client certificate for an operator. The certificate's
+// common name is the operator's username.
+func (ca *OperatorCA) Issue(username string, validityDays int, certFile, keyFile string) (IssuedCertificate, error) {
+	if username == "" {
+		return IssuedCertificate{}, errors.New("username is required")
+	}
+	if validityDays <= 0 {
+		return IssuedCertificate{}, errors.New("validity must be at least one day")
+	}
+
+	ca.authenticator.SetCertValidityDays(validityDays)
+	cert, err := ca.authenticator.GenerateCertificate(username, username, false, nil, nil)
+	if err != nil {
+		return IssuedCertificate{}, err
+	}
+	if err := ca.authenticator.SaveCertificateToFile(username, certFile, keyFile); err != nil {
+		return IssuedCertificate{}, err
+	}
+	if err := os.Chmod(keyFile, 0600); err != nil {
+		return IssuedCertificate{}, fmt.Errorf("failed to protect key file: %w", err)
+	}
+
+	issued := IssuedCertificate{
+		Serial:    cert.Leaf.SerialNumber.Text(16),
+		Username:  username,
+		IssuedAt:  cert.Leaf.NotBefore.UTC(),
+		ExpiresAt: cert.Leaf.NotAfter.UTC(),
+	}
+	ca.certificates = append(ca.certificates, issued)
+	if err := ca.save(); err != nil {
+		return IssuedCertificate{}, err
+	}
+
+	return issued, nil
+}
+
+// Revoke revokes a certificate by its serial number
+func (ca *OperatorCA) Revoke(serial string) error {
+	for i := range ca.certificates {
+		if ca.certificates[i].Serial == serial {
+			if ca.certificates[i].RevokedAt == nil {
+				now := time.Now().UTC()
+				ca.certificates[i].RevokedAt = &now
+			}
+			return ca.save()
+		}
+	}
+	return ErrCertificateNotFound
+}
+
+// RevokeUser revokes every certificate issued to an operator and returns how many were revoked
+func (ca *OperatorCA) RevokeUser(username string) (int, error) {
+	now := time.Now().UTC()
+	count := 0
+	for i := range ca.certificates {
+		if ca.certificates[i].Username == username && ca.certificates[i].RevokedAt == nil {
+			ca.certificates[i].RevokedAt = &now
+			count++
+		}
+	}
+	if count == 0 {
+		return 0, ErrCertificateNotFound
+	}
+	return count, ca.save()
+}
+
+// Certificates returns the issued certificates, oldest first
+func (ca *OperatorCA) Certificates() []IssuedCertificate {
+	certificates := make([]IssuedCertificate, len(ca.certificates))
+	copy(certificates, ca.certificates)
+	sort.Slice(certificates, func(i, j int) bool { return certificates[i].IssuedAt.Before(certificates[j].IssuedAt) })
+	return certificates
+}
+
+// CRLFile returns the path of the revocation list the API server should load
+func (ca *OperatorCA) CRLFile() string {
+	return filepath.Join(ca.dir, OperatorCRLFile)
+}
+
+// save writes the certificate index and a new revocation list
+func (ca *OperatorCA) save() error {
+	data, err := json.MarshalIndent(ca.certificates, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := writeFileAtomic(filepath.Join(ca.dir, operatorCAIndexFile), data); err != nil {
+		return fmt.Errorf("failed to write certificate index: %w", err)
+	}
+
+	var entries []x509.RevocationListEntry
+	for _, cert := range ca.certificates {
+		if cert.RevokedAt == nil {
+			continue
+		}
+		serial, ok := new(big.Int).SetString(cert.Serial, 16)
+		if !ok {
+			return fmt.Errorf("invalid serial number in index: %s", cert.Serial)
+		}
+		entries = append(entries, x509.RevocationListEntry{SerialNumber: serial, RevocationTime: *cert.RevokedAt})
+	}
+
+	crl, err := ca.authenticator.CreateRevocationList(entries, time.Now().Add(crlValidity))
+	if err != nil {
+		return err
+	}
+	if err := writeFileAtomic(ca.CRLFile(), crl); err != nil {
+		return fmt.Errorf("failed to write revocation list: %w", err)
+	}
+	return nil
+}
+
+// writeFileAtomic replaces a file so that readers never see a partial write
+func writeFileAtomic(path string, data []byte) error {
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
@@ -0,0 +1,59 @@
+package security
+
+import (
+	"crypto/tls"
+	"path/filepath"
+	"testing"
+)
+
+func TestOperatorCARevocation(t *testing.T) {
+	dir := t.TempDir()
+	ca, err := InitOperatorCA(dir)
+	if err != nil {
+		t.Fatalf("Failed to create CA: %v", err)
+	}
+	if _, err := InitOperatorCA(dir); err != ErrCAExists {
+		t.Errorf("Expected ErrCAExists, got %v", err)
+	}
+
+	certFile, keyFile := filepath.Join(dir, "alice.pem"), filepath.Join(dir, "alice-key.pem")
+	issued, err := ca.Issue("alice", 30, certFile, keyFile)
+	if err != nil {
+		t.Fatalf("Failed to issue certificate: %v", err)
+	}
+
+	// The server only needs the CA certificate and the revocation list
+	server := NewAuthenticator(DefaultAuthenticationOptions())
+	if err := server.AddTrustedCertsFromFile(filepath.Join(dir, OperatorCACertFile)); err != nil {
+		t.Fatalf("Failed to load CA certificate: %v", err)
+	}
+	if err := server.SetRevocationListFile(ca.CRLFile()); err != nil {
+		t.Fatalf("Failed to load revocation list: %v", err)
+	}
+
+	cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+	if err != nil {
+		t.Fatalf("Failed to load issued certificate: %v", err)
+	}
+	if cert.Leaf.Subject.CommonName != "alice" {
+		t.Errorf("Expected common name alice, got %q", cert.Leaf.Subject.CommonName)
+	}
+	if server.IsRevoked(cert.Leaf) {
+		t.Fatal("Certificate should not be revoked yet")
+	}
+
+	// A revocation by another process is picked up without reloading the server
+	reopened, err := OpenOperatorCA(dir)
+	if err != nil {
+		t.Fatalf("Failed to open CA: %v", err)
+	}
+	if err := reopened.Revoke(issued.Serial); err != nil {
+		t.Fatalf("Failed to revoke certificate: %v", err)
+	}
+	if !server.IsRevoked(cert.Leaf) {
+		t.Error("Certificate should be revoked")
+	}
+	if err := reopened.Revoke("ffff"); err != ErrCertificateNotFound {
+		t.Errorf("Expected ErrCertificateNotFound, got %v", err)
+	}
+}
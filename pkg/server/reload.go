@@ -0,0 +1,155 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+
+	"dinoc2/pkg/listener"
+)
+
+// Reload re-reads the configuration file and applies the listeners it defines
+// to the running listener manager. New listeners are created and started,
+// listeners removed from the file or disabled are stopped and removed, and
+// listeners whose type, address, port or options changed are reconfigured.
+// Listeners that did not change are not touched, so the sessions on them stay
+// connected. Other settings only take effect when the server is restarted.
+func (s *Server) Reload() (*listener.ReloadResult, error) {
+	if serverState == nil || serverState.listenerManager == nil {
+		return nil, fmt.Errorf("server not started")
+	}
+
+	serverState.mutex.Lock()
+	defer serverState.mutex.Unlock()
+
+	if serverState.configFile == "" {
+		return nil, errors.New("the server was started without a configuration file")
+	}
+	data, err := os.ReadFile(serverState.configFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read configuration file: %v", err)
+	}
+	reloaded := &ServerConfig{}
+	if err := json.Unmarshal(data, reloaded); err != nil {
+		return nil, fmt.Errorf("failed to parse configuration: %v", err)
+	}
+
+	// Check every listener before changing any, so that a bad file changes nothing
+	enabled := make(map[string]bool)
+	seen := make(map[string]bool)
+	for _, l := range reloaded.Listeners {
+		if l.ID == "" {
+			return nil, errors.New("invalid configuration: a listener has no ID")
+		}
+		if seen[l.ID] {
+			return nil, fmt.Errorf("invalid configuration: listener %s is defined more than once", l.ID)
+		}
+		seen[l.ID] = true
+		if l.Disabled {
+			continue
+		}
+		enabled[l.ID] = true
+
+		config := listener.ListenerConfig{Address: l.Address, Port: l.Port, Options: l.Options, Restart: l.Restart}
+		if err := listener.ValidateListenerConfig(listener.ListenerType(l.Type), config); err != nil {
+			return nil, fmt.Errorf("invalid configuration for listener %s: %w", l.ID, err)
+		}
+	}
+
+	manager := serverState.listenerManager
+	result := &listener.ReloadResult{}
+
+	// Create new listeners and reconfigure the ones that changed
+	for _, l := range reloaded.Listeners {
+		if l.Disabled {
+			continue
+		}
+
+		listenerType := listener.ListenerType(l.Type)
+		config := listener.ListenerConfig{
+			Protocol: l.Address,
+			Address:  l.Address,
+			Port:     l.Port,
+			Options:  l.Options,
+			Restart:  l.Restart,
+		}
+
+		currentType, err := manager.GetListenerType(l.ID)
+		if err != nil {
+			if err := createListener(l.ID, listenerType, config, serverState.apiRouter, true); err != nil {
+				result.Fail(l.ID, err)
+			} else {
+				result.Created = append(result.Created, l.ID)
+			}
+			continue
+		}
+
+		current, err := manager.GetConfig(l.ID)
+		if err != nil {
+			result.Fail(l.ID, err)
+			continue
+		}
+
+		switch {
+		case currentType != listenerType:
+			// Listeners cannot change their type, so they are replaced
+			log.Printf("Replacing listener %s (%s) with a %s listener", l.ID, currentType, listenerType)
+			if err := removeListener(l.ID); err != nil {
+				result.Fail(l.ID, err)
+			} else if err := createListener(l.ID, listenerType, config, serverState.apiRouter, true); err != nil {
+				result.Fail(l.ID, err)
+			} else {
+				result.Reconfigured = append(result.Reconfigured, l.ID)
+			}
+		case !listener.SameConfig(current, config):
+			if err := manager.ReconfigureListener(l.ID, withAPIHandler(listenerType, config, serverState.apiRouter)); err != nil {
+				log.Printf("Failed to reconfigure listener %s: %v", l.ID, err)
+				result.Fail(l.ID, err)
+			} else {
+				log.Printf("Reconfigured listener %s (%s) on %s:%d", l.ID, listenerType, config.Address, config.Port)
+				result.Reconfigured = append(result.Reconfigured, l.ID)
+			}
+		case current.Restart != config.Restart:
+			// Restart policies change without restarting the listener
+			if err := manager.SetRestartConfig(l.ID, config.Restart); err != nil {
+				result.Fail(l.ID, err)
+			} else {
+				result.Reconfigured = append(result.Reconfigured, l.ID)
+			}
+		default:
+			result.Unchanged = append(result.Unchanged, l.ID)
+		}
+	}
+
+	// Remove the listeners that were removed from the file or disabled. Listeners
+	// created through the API were never in the file and are left alone.
+	for _, l := range serverState.config.Listeners {
+		if enabled[l.ID] {
+			continue
+		}
+		if _, err := manager.GetListenerType(l.ID); err != nil {
+			continue
+		}
+		if err := removeListener(l.ID); err != nil {
+			result.Fail(l.ID, err)
+		} else {
+			log.Printf("Removed listener %s", l.ID)
+			result.Removed = append(result.Removed, l.ID)
+		}
+	}
+
+	serverState.config.Listeners = reloaded.Listeners
+	log.Printf("Reloaded listeners from %s: %d created, %d reconfigured, %d removed, %d unchanged, %d failed",
+		serverState.configFile, len(result.Created), len(result.Reconfigured), len(result.Removed), len(result.Unchanged), len(result.Failed))
+	return result, nil
+}
+
+// removeListener stops a listener and removes it from the listener manager
+func removeListener(id string) error {
+	if err := serverState.listenerManager.StopListener(id); err != nil {
+		return fmt.Errorf("failed to stop listener: %w", err)
+	}
+	return serverState.listenerManager.RemoveListener(id)
+}
@@ -113,6 +113,36 @@ func (s *SecurityIntegration) GetTLSConfig() (*tls.Config, error) {
 	return s.securityManager.GetTLSConfig(true)
 }
 
+// NewAPITLSConfig returns the TLS configuration of the API server and the
+// authenticator that verifies client certificates. If a client CA file is
+// given, clients must present a certificate issued by that CA that is not on
+// the revocation list.
+func NewAPITLSConfig(certFile, keyFile, clientCAFile, crlFile string) (*tls.Config, *security.Authenticator, error) {
+	options := security.DefaultAuthenticationOptions()
+	options.RequireMutualAuth = clientCAFile != ""
+	authenticator := security.NewAuthenticator(options)
+
+	if err := authenticator.LoadCertificateFromFile("api", certFile, keyFile); err != nil {
+		return nil, nil, err
+	}
+	if clientCAFile == "" {
+		tlsConfig := authenticator.GetTLSConfig(true)
+		tlsConfig.ClientAuth = tls.NoClientCert
+		return tlsConfig, authenticator, nil
+	}
+
+	if err := authenticator.AddTrustedCertsFromFile(clientCAFile); err != nil {
+		return nil, nil, fmt.Errorf("failed to load client CA: %w", err)
+	}
+	if crlFile != "" {
+		if err := authenticator.SetRevocationListFile(crlFile); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	return authenticator.GetTLSConfig(true), authenticator, nil
+}
+
 // Shutdown shuts down the security integration
 func (s *SecurityIntegration) Shutdown() {
 	s.securityManager.Shutdown()
@@ -1,22 +1,48 @@
 package server
 
 import (
+	"crypto/tls"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
 	"net/http"
 	"os"
+	"strings"
 	"sync"
+	"time"
 
 	"dinoc2/pkg/api"
 	"dinoc2/pkg/api/middleware"
+	"dinoc2/pkg/audit"
 	"dinoc2/pkg/listener"
 	"dinoc2/pkg/auth"
 	"dinoc2/pkg/client"
+	"dinoc2/pkg/crypto"
+	"dinoc2/pkg/engagement"
+	"dinoc2/pkg/events"
+	"dinoc2/pkg/module"
 	"dinoc2/pkg/module/manager"
+	"dinoc2/pkg/scope"
+	"dinoc2/pkg/security"
+	"dinoc2/pkg/store"
 	"dinoc2/pkg/task"
 	
 	"golang.org/x/crypto/bcrypt"
+	
+	// Register the built-in modules, so module commands can be checked against their schemas
+	_ "dinoc2/pkg/module/file"
+	_ "dinoc2/pkg/module/keylogger"
+	_ "dinoc2/pkg/module/process"
+	_ "dinoc2/pkg/module/screenshot"
+	_ "dinoc2/pkg/module/shell"
+	_ "dinoc2/pkg/module/sysinfo"
+	
+	// Register the built-in listener types; TCP is registered by the listener package
+	_ "dinoc2/pkg/listener/dns"
+	_ "dinoc2/pkg/listener/http"
+	_ "dinoc2/pkg/listener/icmp"
+	_ "dinoc2/pkg/listener/websocket"
 )
 
 // APIConfig represents the API configuration
@@ -28,15 +54,50 @@ type APIConfig struct {
 	TLSCertFile string `json:"tls_cert_file,omitempty"`
 	TLSKeyFile  string `json:"tls_key_file,omitempty"`
 	AuthEnabled bool   `json:"auth_enabled"`
-	JWTSecret   string `json:"jwt_secret,omitempty"`
+	JWTSecret   string `json:"jwt_secret,omitempty"`    // only used with the HS256 algorithm
 	TokenExpiry int    `json:"token_expiry,omitempty"` // in minutes
+
+	JWTAlgorithm       string `json:"jwt_algorithm,omitempty"`        // EdDSA (default), RS256 or HS256
+	RefreshTokenExpiry int    `json:"refresh_token_expiry,omitempty"` // in minutes
+	SessionLifetime    int    `json:"session_lifetime,omitempty"`     // in minutes
+
+	// Mutual TLS: clients must present a certificate issued by this CA
+	ClientCAFile  string `json:"client_ca_file,omitempty"`
+	ClientCRLFile string `json:"client_crl_file,omitempty"`
+
+	// Static bearer token that scrapers can use for /metrics
+	MetricsToken string `json:"metrics_token,omitempty"`
 }
 
+// AuditConfig represents the audit log configuration
+type AuditConfig struct {
+	Enabled bool   `json:"enabled"`
+	File    string `json:"file,omitempty"`
+}
+
+// TaskConfig represents the task timeout, queue and approval configuration
+type TaskConfig struct {
+	DefaultTimeout  int            `json:"default_timeout,omitempty"`  // in seconds, 0 for no limit
+	Timeouts        map[string]int `json:"timeouts,omitempty"`         // in seconds, by task type
+	QueueLimit      int            `json:"queue_limit,omitempty"`      // queued tasks per client, 0 for the default
+	ClientWeights   map[string]int `json:"client_weights,omitempty"`   // share of dispatches, by client ID
+	ApprovalTypes   []string       `json:"approval_types,omitempty"`   // task types that need a second operator's approval
+	ApprovalModules []string       `json:"approval_modules,omitempty"` // modules, or module:command pairs, whose module_exec tasks need approval
+	LockMode        string         `json:"lock_mode,omitempty"`        // "reject" (the default) or "flag" other operators' tasks for a locked client
+}
 
 // ServerConfig represents the server configuration
 type ServerConfig struct {
 	API       APIConfig `json:"api"`
 	UserAuth  auth.UserAuth  `json:"user_auth"`
+	Users     []auth.UserAuth `json:"users,omitempty"`
+	UsersFile string          `json:"users_file,omitempty"`
+	Audit     AuditConfig     `json:"audit"`
+	Scope      scope.Config      `json:"scope"`
+	Engagement engagement.Config `json:"engagement"`
+	Store      store.Config      `json:"store"`
+	Tasks      TaskConfig        `json:"tasks"`
+	Clients    client.LifecycleConfig `json:"clients"`
 	Listeners []struct {
 		ID       string                 `json:"id"`
 		Type     string                 `json:"type"`
@@ -44,6 +105,7 @@ type ServerConfig struct {
 		Port     int                    `json:"port"`
 		Options  map[string]interface{} `json:"options"`
 		Disabled bool                   `json:"disabled,omitempty"`
+		Restart  listener.RestartConfig `json:"restart,omitempty"`
 	} `json:"listeners"`
 }
 
@@ -51,8 +113,14 @@ type ServerConfig struct {
 type serverImpl struct {
 	listenerManager *listener.Manager
 	taskManager     *task.Manager
+	clientManager   *client.Manager
 	mutex           sync.RWMutex
 	config          *ServerConfig
+	configFile      string // file the configuration was loaded from, re-read on reload
+	apiRouter       *api.Router
+	auditLogger     *audit.Logger
+	engagement      *engagement.Engagement
+	store           store.Store
 }
 
 // Global server state
@@ -90,9 +158,17 @@ func (s *Server) LoadConfig(configFile string) error {
 
 	// Store the configuration
 	serverState.config = config
+	serverState.configFile = configFile
 
-	// Initialize user auth if it's empty
-	if serverState.config.UserAuth.Username == "" {
+	// Load operator accounts managed through the API
+	userStore := auth.NewUserStore(serverState.config.UsersFile)
+	if err := userStore.Load(); err != nil {
+		return err
+	}
+	auth.SetUserStore(userStore)
+
+	// Initialize user auth if no users are configured anywhere
+	if serverState.config.UserAuth.Username == "" && len(serverState.config.Users) == 0 && userStore.Count() == 0 {
 		serverState.config.UserAuth = auth.UserAuth{
 			Username: "admin",
 			Password: "change_this_in_production",
@@ -100,18 +176,25 @@ func (s *Server) LoadConfig(configFile string) error {
 		}
 	}
 	
-	auth.SetUserAuth(&serverState.config.UserAuth)
-	
-	// Hash the password if provided in plaintext
+	// Hash any passwords provided in plaintext
+	configChanged := false
 	if serverState.config.UserAuth.Password != "" {
-		hashedPassword, err := bcrypt.GenerateFromPassword([]byte(serverState.config.UserAuth.Password), bcrypt.DefaultCost)
-		if err != nil {
-			return fmt.Errorf("failed to hash password: %w", err)
+		if err := hashConfigPassword(&serverState.config.UserAuth); err != nil {
+			return err
 		}
-		serverState.config.UserAuth.PasswordHash = string(hashedPassword)
-		serverState.config.UserAuth.Password = "" // Clear plaintext password
-		
-		// Save the updated configuration with hashed password
+		configChanged = true
+	}
+	for i := range serverState.config.Users {
+		if serverState.config.Users[i].Password != "" {
+			if err := hashConfigPassword(&serverState.config.Users[i]); err != nil {
+				return err
+			}
+			configChanged = true
+		}
+	}
+	
+	if configChanged {
+		// Save the updated configuration with hashed passwords
 		configBytes, err := json.MarshalIndent(serverState.config, "", "  ")
 		if err != nil {
 			return fmt.Errorf("failed to marshal config: %w", err)
@@ -121,10 +204,33 @@ func (s *Server) LoadConfig(configFile string) error {
 			return fmt.Errorf("failed to write config file: %w", err)
 		}
 	}
+	
+	// Add configured users to the store; users already in the store keep their stored settings
+	if serverState.config.UserAuth.Username != "" {
+		if err := auth.SetUserAuth(&serverState.config.UserAuth); err != nil {
+			return fmt.Errorf("invalid user %s: %w", serverState.config.UserAuth.Username, err)
+		}
+	}
+	for _, user := range serverState.config.Users {
+		if err := userStore.AddUser(user); err != nil && err != auth.ErrUserExists {
+			return fmt.Errorf("invalid user %s: %w", user.Username, err)
+		}
+	}
 
 	return nil
 }
 
+// hashConfigPassword replaces a plaintext configuration password with its bcrypt hash
+func hashConfigPassword(user *auth.UserAuth) error {
+	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(user.Password), bcrypt.DefaultCost)
+	if err != nil {
+		return fmt.Errorf("failed to hash password: %w", err)
+	}
+	user.PasswordHash = string(hashedPassword)
+	user.Password = "" // Clear plaintext password
+	return nil
+}
+
 // Start starts the server
 func (s *Server) Start() error {
 	// Ensure server state is initialized
@@ -138,11 +244,178 @@ func (s *Server) Start() error {
 		return fmt.Errorf("failed to initialize module manager: %v", err)
 	}
 	
+	// Open the state store and restore tasks, clients and sessions from it
+	stateStore, err := store.New(serverState.config.Store)
+	if err != nil {
+		return fmt.Errorf("failed to open state store: %v", err)
+	}
+	serverState.store = stateStore
+	crypto.SetSessionStore(stateStore)
+	sessionRecords, err := crypto.LoadSessionRecords()
+	if err != nil {
+		return fmt.Errorf("failed to load sessions: %v", err)
+	}
+	log.Printf("Restored metadata of %d sessions", len(sessionRecords))
+	crypto.StartSessionFlush()
+	
+	// Time out tasks that are not completed in time, such as tasks of clients that went away
+	serverState.taskManager.SetDefaultTimeout(time.Duration(serverState.config.Tasks.DefaultTimeout) * time.Second)
+	for taskType, timeout := range serverState.config.Tasks.Timeouts {
+		serverState.taskManager.SetTypeTimeout(task.TaskType(taskType), time.Duration(timeout)*time.Second)
+	}
+	
+	// Bound each client's queue so a busy client gets queue-full errors instead of starving the rest
+	serverState.taskManager.SetQueueLimit(serverState.config.Tasks.QueueLimit)
+	for clientID, weight := range serverState.config.Tasks.ClientWeights {
+		serverState.taskManager.SetClientWeight(clientID, weight)
+	}
+	
+	// Hold high-risk tasks until a second operator approves them
+	approvalTypes := make([]task.TaskType, len(serverState.config.Tasks.ApprovalTypes))
+	for i, taskType := range serverState.config.Tasks.ApprovalTypes {
+		approvalTypes[i] = task.TaskType(taskType)
+	}
+	// A module:command rule that cannot match any command would silently never apply
+	for _, rule := range serverState.config.Tasks.ApprovalModules {
+		if name, command, ok := strings.Cut(rule, ":"); ok {
+			if err := moduleManager.CheckCommandName(name, command); err != nil {
+				return fmt.Errorf("invalid approval rule %q: %v", rule, err)
+			}
+		}
+	}
+	serverState.taskManager.SetApprovalRules(approvalTypes, serverState.config.Tasks.ApprovalModules)
+	
 	// Initialize client manager
 	clientManager := client.NewManager()
+	if err := clientManager.SetStore(stateStore); err != nil {
+		return err
+	}
+	serverState.clientManager = clientManager
+	
+	// Track whether clients are active, late, stale or lost from their check-ins
+	if err := clientManager.SetLifecycleConfig(serverState.config.Clients); err != nil {
+		return err
+	}
+	clientManager.StartLifecycle()
+	
+	// Publish task, client, listener and module events to operators
+	eventBus := events.NewBus()
+	serverState.taskManager.SetEventBus(eventBus)
+	clientManager.SetEventBus(eventBus)
+	moduleManager.SetEventBus(eventBus)
+	
+	// Enforce the engagement scope on client registration and tasking
+	engagementScope, err := scope.New(serverState.config.Scope)
+	if err != nil {
+		return fmt.Errorf("invalid engagement scope: %v", err)
+	}
+	clientManager.SetScope(engagementScope)
+	if engagementScope.IsEmpty() {
+		log.Printf("Warning: no engagement scope configured, all clients are considered in scope")
+	}
+	serverState.taskManager.AddValidator(func(t *task.Task) error {
+		if reason, quarantined := clientManager.QuarantineReason(t.ClientID); quarantined {
+			return fmt.Errorf("client %s is quarantined as out of scope: %s", t.ClientID, reason)
+		}
+		// A client whose scope is not decided yet is not tasked at all. Its
+		// hostname comes from the handshake of a later session.
+		if clientManager.ScopePending(t.ClientID) {
+			return fmt.Errorf("client %s is pending a scope check until it reports its hostname", t.ClientID)
+		}
+		return nil
+	})
+	
+	// Keep other operators' tasks off clients an operator has locked. Tasks the
+	// server creates itself have no operator and are never held back.
+	lockMode := serverState.config.Tasks.LockMode
+	if lockMode != "" && lockMode != "reject" && lockMode != "flag" {
+		return fmt.Errorf("invalid task lock mode %q, expected reject or flag", lockMode)
+	}
+	serverState.taskManager.AddValidator(func(t *task.Task) error {
+		if t.CreatedBy == "" {
+			return nil
+		}
+		err := clientManager.CheckLock(t.ClientID, t.CreatedBy)
+		if err != nil && lockMode == "flag" {
+			log.Printf("Flagged %s task by %s for client %s: %v", t.Type, t.CreatedBy, t.ClientID, err)
+			t.Flags = append(t.Flags, err.Error())
+			return nil
+		}
+		return err
+	})
+	
+	// Check module commands against the module's declared commands before they are queued
+	serverState.taskManager.AddValidator(func(t *task.Task) error {
+		if t.Type != task.TaskTypeModuleExec {
+			return nil
+		}
+		command, err := task.ParseModuleCommand(t.Data)
+		if err != nil {
+			return fmt.Errorf("%w: %v", module.ErrInvalidCommand, err)
+		}
+		_, err = moduleManager.ValidateCommand(command.Module, command.Command, command.Args)
+		return err
+	})
+	
+	// Keep the inventory of clients up to date with the host details they report
+	serverState.taskManager.AddResultHandler(func(t *task.Task) {
+		if t.Type != task.TaskTypeModuleExec {
+			return
+		}
+		command, err := task.ParseModuleCommand(t.Data)
+		if err != nil || command.Module != "sysinfo" {
+			return
+		}
+		details, err := client.ParseInventory(command.Command, command.Args, t.Result)
+		if err != nil {
+			log.Printf("Failed to read the inventory of client %s from task %d: %v", t.ClientID, t.ID, err)
+			return
+		}
+		if len(details) > 0 {
+			if err := clientManager.UpdateInventory(t.ClientID, details); err != nil {
+				log.Printf("Failed to update the inventory of client %s: %v", t.ClientID, err)
+			}
+		}
+	})
+	
+	// Clients that confirmed an exit_cleanup task have exited on purpose, so they are not reported as lost
+	serverState.taskManager.AddResultHandler(func(t *task.Task) {
+		if t.Type != task.TaskTypeExitCleanup {
+			return
+		}
+		if err := clientManager.MarkExited(t.ClientID, fmt.Sprintf("cleaned up and exited (task %d)", t.ID)); err != nil {
+			log.Printf("Failed to mark client %s as exited: %v", t.ClientID, err)
+		}
+	})
 	
 	// Initialize listener manager with client manager
 	serverState.listenerManager = listener.NewManager(clientManager)
+	storedListeners, err := serverState.listenerManager.SetStore(stateStore)
+	if err != nil {
+		return err
+	}
+	serverState.listenerManager.SetEventBus(eventBus)
+	
+	// Enforce the engagement window: no tasks outside it, and no listeners after it ends
+	eng, err := engagement.New(serverState.config.Engagement)
+	if err != nil {
+		return fmt.Errorf("invalid engagement window: %v", err)
+	}
+	serverState.engagement = eng
+	serverState.taskManager.AddValidator(func(*task.Task) error {
+		return eng.Check()
+	})
+	eng.OnClose(func() {
+		if err := serverState.listenerManager.Disable("engagement has ended"); err != nil {
+			log.Printf("Failed to stop all listeners: %v", err)
+		}
+	})
+	
+	// Restore tasks once every validator is registered, so that the tasks
+	// still waiting are checked again before they are queued
+	if err := serverState.taskManager.SetStore(stateStore); err != nil {
+		return err
+	}
 	
 	// Initialize API if enabled
 	var apiRouter *api.Router
@@ -152,26 +425,81 @@ func (s *Server) Start() error {
 		// Create authentication middleware if auth is enabled
 		if serverState.config.API.AuthEnabled {
 			authConfig := middleware.AuthConfig{
-				Enabled:     serverState.config.API.AuthEnabled,
-				JWTSecret:   serverState.config.API.JWTSecret,
-				TokenExpiry: serverState.config.API.TokenExpiry,
+				Enabled:            serverState.config.API.AuthEnabled,
+				JWTSecret:          serverState.config.API.JWTSecret,
+				Algorithm:          serverState.config.API.JWTAlgorithm,
+				TokenExpiry:        serverState.config.API.TokenExpiry,
+				RefreshTokenExpiry: serverState.config.API.RefreshTokenExpiry,
+				SessionLifetime:    serverState.config.API.SessionLifetime,
+			}
+			authMiddleware, err = middleware.NewAuthMiddleware(authConfig)
+			if err != nil {
+				return fmt.Errorf("failed to create authentication middleware: %v", err)
+			}
+			
+			// Keep signing keys, refresh tokens and revocations across restarts
+			if err := authMiddleware.SetStore(stateStore); err != nil {
+				return fmt.Errorf("failed to load authentication state: %v", err)
 			}
-			authMiddleware = middleware.NewAuthMiddleware(authConfig)
 		}
 		
 		// Create API router
 		apiRouter = api.NewRouter(serverState.listenerManager, moduleManager, serverState.taskManager, clientManager, authMiddleware)
+		apiRouter.SetEngagement(eng)
+		apiRouter.SetEventBus(eventBus)
+		apiRouter.SetConfigReloader(s.Reload)
+		apiRouter.SetMetricsToken(serverState.config.API.MetricsToken)
+		serverState.apiRouter = apiRouter
+		
+		// Only accept requests that come with a verified client certificate
+		if serverState.config.API.ClientCAFile != "" {
+			if !serverState.config.API.TLSEnabled || serverState.config.API.TLSCertFile == "" || serverState.config.API.TLSKeyFile == "" {
+				return fmt.Errorf("client_ca_file requires tls_enabled with a certificate and key")
+			}
+			apiRouter.SetClientCertificateRequired(true)
+		}
+		
+		// Record every API request in the audit log if enabled
+		if serverState.config.Audit.Enabled {
+			auditFile := serverState.config.Audit.File
+			if auditFile == "" {
+				auditFile = "audit.log"
+			}
+			auditLogger, err := audit.Open(auditFile)
+			if err != nil {
+				return fmt.Errorf("failed to open audit log: %v", err)
+			}
+			serverState.auditLogger = auditLogger
+			apiRouter.SetAuditLogger(auditLogger)
+			log.Printf("Audit logging to %s", auditFile)
+		}
 		
 		// Start dedicated API server if configured
 		if serverState.config.API.Port > 0 {
+			useTLS := serverState.config.API.TLSEnabled && serverState.config.API.TLSCertFile != "" && serverState.config.API.TLSKeyFile != ""
+			var tlsConfig *tls.Config
+			if useTLS {
+				var authenticator *security.Authenticator
+				tlsConfig, authenticator, err = NewAPITLSConfig(serverState.config.API.TLSCertFile, serverState.config.API.TLSKeyFile,
+					serverState.config.API.ClientCAFile, serverState.config.API.ClientCRLFile)
+				if err != nil {
+					return fmt.Errorf("failed to configure API TLS: %v", err)
+				}
+				
+				// Check the revocation list on every request too, since a
+				// connection stays open after its certificate is revoked
+				apiRouter.SetRevocationCheck(authenticator.IsRevoked)
+			}
+			
 			go func() {
 				addr := fmt.Sprintf("%s:%d", serverState.config.API.Address, serverState.config.API.Port)
 				var err error
 				
 				log.Printf("Starting API server on %s", addr)
 				
-				if serverState.config.API.TLSEnabled && serverState.config.API.TLSCertFile != "" && serverState.config.API.TLSKeyFile != "" {
-					err = http.ListenAndServeTLS(addr, serverState.config.API.TLSCertFile, serverState.config.API.TLSKeyFile, apiRouter)
+				if useTLS {
+					server := &http.Server{Addr: addr, Handler: apiRouter, TLSConfig: tlsConfig}
+					err = server.ListenAndServeTLS("", "")
 				} else {
 					err = http.ListenAndServe(addr, apiRouter)
 				}
@@ -183,8 +511,17 @@ func (s *Server) Start() error {
 		}
 	}
 	
+	// Never start listeners once the engagement has ended
+	if err := eng.Check(); errors.Is(err, engagement.ErrClosed) {
+		log.Printf("Not starting listeners: %v", err)
+		serverState.listenerManager.Disable(err.Error())
+	}
+	
 	// Start all listeners
+	configured := make(map[string]bool)
 	for _, listenerConfig := range serverState.config.Listeners {
+		configured[listenerConfig.ID] = true
+		
 		// Skip disabled listeners
 		if listenerConfig.Disabled {
 			log.Printf("Skipping disabled listener %s", listenerConfig.ID)
@@ -197,36 +534,69 @@ func (s *Server) Start() error {
 			Address:  listenerConfig.Address,
 			Port:     listenerConfig.Port,
 			Options:  listenerConfig.Options,
+			Restart:  listenerConfig.Restart,
 		}
 		
-		// Pass API router to HTTP and WebSocket listeners if API is enabled
-		if serverState.config.API.Enabled && (listenerConfig.Type == string(listener.ListenerTypeHTTP) || listenerConfig.Type == string(listener.ListenerTypeWebSocket)) {
-			if config.Options == nil {
-				config.Options = make(map[string]interface{})
-			}
-			config.Options["api_handler"] = apiRouter
-		}
-
-		// Create the listener
-		listenerType := listener.ListenerType(listenerConfig.Type)
-		err := serverState.listenerManager.CreateListener(listenerConfig.ID, listenerType, config)
-		if err != nil {
-			log.Printf("Failed to create listener %s: %v", listenerConfig.ID, err)
+		createListener(listenerConfig.ID, listener.ListenerType(listenerConfig.Type), config, apiRouter, true)
+	}
+	
+	// Restore listeners that were created through the API
+	for _, record := range storedListeners {
+		if configured[record.ID] {
 			continue
 		}
+		createListener(record.ID, record.Type, record.Config, apiRouter, record.Running)
+	}
 
-		// Start the listener
-		if err := serverState.listenerManager.StartListener(listenerConfig.ID); err != nil {
-			log.Printf("Failed to start listener %s: %v", listenerConfig.ID, err)
-			continue
-		}
+	// Shut everything down when the engagement ends
+	go eng.Watch()
 
-		log.Printf("Started listener %s (%s) on %s:%d", listenerConfig.ID, listenerConfig.Type, listenerConfig.Address, listenerConfig.Port)
+	return nil
+}
+
+// createListener creates a listener and starts it if requested
+func createListener(id string, listenerType listener.ListenerType, config listener.ListenerConfig, apiRouter *api.Router, start bool) error {
+	config = withAPIHandler(listenerType, config, apiRouter)
+
+	// Create the listener
+	if err := serverState.listenerManager.CreateListener(id, listenerType, config); err != nil {
+		log.Printf("Failed to create listener %s: %v", id, err)
+		return err
+	}
+	if !start {
+		log.Printf("Restored stopped listener %s (%s)", id, listenerType)
+		return nil
 	}
 
+	// Start the listener
+	if err := serverState.listenerManager.StartListener(id); err != nil {
+		log.Printf("Failed to start listener %s: %v", id, err)
+		return err
+	}
+
+	log.Printf("Started listener %s (%s) on %s:%d", id, listenerType, config.Address, config.Port)
 	return nil
 }
 
+// withAPIHandler returns a listener configuration that passes the API router to
+// listener types that can serve it, if the API is enabled
+func withAPIHandler(listenerType listener.ListenerType, config listener.ListenerConfig, apiRouter *api.Router) listener.ListenerConfig {
+	if apiRouter == nil {
+		return config
+	}
+	if registration, err := listener.LookupType(listenerType); err != nil || !registration.Capabilities.APIHandler {
+		return config
+	}
+
+	options := make(map[string]interface{}, len(config.Options)+1)
+	for key, value := range config.Options {
+		options[key] = value
+	}
+	options["api_handler"] = apiRouter
+	config.Options = options
+	return config
+}
+
 // Shutdown stops the server
 func (s *Server) Shutdown() error {
 	// Ensure server state is initialized
@@ -234,10 +604,39 @@ func (s *Server) Shutdown() error {
 		return nil // Nothing to stop
 	}
 	
+	// Stop watching for the end of the engagement
+	if serverState.engagement != nil {
+		serverState.engagement.Stop()
+	}
+	
 	// Stop all listeners
 	if err := serverState.listenerManager.StopAll(); err != nil {
 		log.Printf("Failed to stop all listeners: %v", err)
 	}
+	
+	// Stop updating client lifecycle states
+	if serverState.clientManager != nil {
+		serverState.clientManager.StopLifecycle()
+	}
+	
+	// Close the audit log
+	if serverState.auditLogger != nil {
+		if err := serverState.auditLogger.Close(); err != nil {
+			log.Printf("Failed to close audit log: %v", err)
+		}
+	}
+	
+	// Write the session metadata that is still queued
+	if err := crypto.StopSessionFlush(); err != nil {
+		log.Printf("Failed to flush session records: %v", err)
+	}
+	
+	// Close the state store
+	if serverState.store != nil {
+		if err := serverState.store.Close(); err != nil {
+			log.Printf("Failed to close state store: %v", err)
+		}
+	}
 
 	return nil
 }
@@ -256,12 +655,32 @@ func CreateDefaultConfig(outputPath string) error {
 			AuthEnabled: true,
 			JWTSecret:   "change_this_to_a_secure_secret_in_production", // Default secret, should be changed in production
 			TokenExpiry: 60, // 1 hour
+			JWTAlgorithm:       "EdDSA",
+			RefreshTokenExpiry: 24 * 60, // 1 day
 		},
 		UserAuth: auth.UserAuth{
 			Username: "admin",
 			Password: "change_this_in_production", // Will be hashed during first load
 			Role:     "admin",
 		},
+		UsersFile: "users.json",
+		Audit: AuditConfig{
+			Enabled: true,
+			File:    "audit.log",
+		},
+		Store: store.Config{
+			Type: store.TypeFile,
+			Path: "data",
+		},
+		Clients: client.LifecycleConfig{
+			Thresholds: map[string]client.Thresholds{
+				"default":                        {Late: 90, Stale: 600, Lost: 3600},
+				string(listener.ListenerTypeDNS):  {Late: 300, Stale: 1800, Lost: 7200},
+				string(listener.ListenerTypeICMP): {Late: 300, Stale: 1800, Lost: 7200},
+			},
+			Retention: 7 * 24 * 3600, // 1 week
+			History:   50,
+		},
 		Listeners: []struct {
 			ID       string                 `json:"id"`
 			Type     string                 `json:"type"`
@@ -269,6 +688,7 @@ func CreateDefaultConfig(outputPath string) error {
 			Port     int                    `json:"port"`
 			Options  map[string]interface{} `json:"options"`
 			Disabled bool                   `json:"disabled,omitempty"`
+			Restart  listener.RestartConfig `json:"restart,omitempty"`
 		}{
 			{
 				ID:      "tcp1",
@@ -0,0 +1,164 @@
+package store
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// FileStore keeps each record in its own JSON file, one directory per collection.
+// Records are written to a temporary file, synced and renamed into place, so a
+// crash leaves either the old or the new version of a record, never a partial one.
+type FileStore struct {
+	dir   string
+	mutex sync.RWMutex
+}
+
+// NewFileStore creates a file store rooted at dir
+func NewFileStore(dir string) (*FileStore, error) {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, fmt.Errorf("failed to create store directory: %w", err)
+	}
+	return &FileStore{dir: dir}, nil
+}
+
+// recordPath returns the file that holds a record
+func (s *FileStore) recordPath(collection, key string) string {
+	return filepath.Join(s.dir, url.PathEscape(collection), url.PathEscape(key)+".json")
+}
+
+// Put implements Store
+func (s *FileStore) Put(collection, key string, value interface{}) error {
+	data, err := json.Marshal(value)
+	if err != nil {
+		return fmt.Errorf("failed to marshal %s record %s: %w", collection, key, err)
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	path := s.recordPath(collection, key)
+	dir := filepath.Dir(path)
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return fmt.Errorf("failed to create collection directory: %w", err)
+	}
+
+	tmp, err := os.CreateTemp(dir, ".tmp-*")
+	if err != nil {
+		return fmt.Errorf("failed to create temporary file: %w", err)
+	}
+	tmpPath := tmp.Name()
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		os.Remove(tmpPath)
+		return fmt.Errorf("failed to write %s record %s: %w", collection, key, err)
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		os.Remove(tmpPath)
+		return fmt.Errorf("failed to sync %s record %s: %w", collection, key, err)
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmpPath)
+		return fmt.Errorf("failed to close %s record %s: %w", collection, key, err)
+	}
+
+	if err := os.Rename(tmpPath, path); err != nil {
+		os.Remove(tmpPath)
+		return fmt.Errorf("failed to save %s record %s: %w", collection, key, err)
+	}
+
+	return syncDir(dir)
+}
+
+// Get implements Store
+func (s *FileStore) Get(collection, key string, value interface{}) error {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	data, err := os.ReadFile(s.recordPath(collection, key))
+	if os.IsNotExist(err) {
+		return ErrNotFound
+	}
+	if err != nil {
+		return err
+	}
+
+	return json.Unmarshal(data, value)
+}
+
+// Delete implements Store
+func (s *FileStore) Delete(collection, key string) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	path := s.recordPath(collection, key)
+	if err := os.Remove(path); err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return fmt.Errorf("failed to delete %s record %s: %w", collection, key, err)
+	}
+
+	return syncDir(filepath.Dir(path))
+}
+
+// List implements Store
+func (s *FileStore) List(collection string) ([]json.RawMessage, error) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	dir := filepath.Join(s.dir, url.PathEscape(collection))
+	files, err := os.ReadDir(dir)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	names := make([]string, 0, len(files))
+	for _, file := range files {
+		// Skip temporary files left behind by an interrupted write
+		if file.IsDir() || !strings.HasSuffix(file.Name(), ".json") {
+			continue
+		}
+		names = append(names, file.Name())
+	}
+	sort.Strings(names)
+
+	records := make([]json.RawMessage, 0, len(names))
+	for _, name := range names {
+		data, err := os.ReadFile(filepath.Join(dir, name))
+		if err != nil {
+			return nil, err
+		}
+		records = append(records, json.RawMessage(data))
+	}
+
+	return records, nil
+}
+
+// Close implements Store
+func (s *FileStore) Close() error {
+	return nil
+}
+
+// syncDir flushes a directory so that renames and removals in it are durable
+func syncDir(dir string) error {
+	d, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	defer d.Close()
+
+	// Errors are ignored because some platforms do not support syncing directories
+	d.Sync()
+	return nil
+}
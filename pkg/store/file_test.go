@@ -0,0 +1,62 @@
+package store
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+type testRecord struct {
+	ID     string `json:"id"`
+	Result []byte `json:"result"`
+}
+
+func TestFileStorePersists(t *testing.T) {
+	dir := t.TempDir()
+	s, err := NewFileStore(dir)
+	if err != nil {
+		t.Fatalf("Failed to create store: %v", err)
+	}
+
+	if err := s.Put("tasks", "1", testRecord{ID: "1", Result: []byte("done")}); err != nil {
+		t.Fatalf("Failed to put record: %v", err)
+	}
+	if err := s.Put("tasks", "2", testRecord{ID: "2"}); err != nil {
+		t.Fatalf("Failed to put record: %v", err)
+	}
+	if err := s.Delete("tasks", "2"); err != nil {
+		t.Fatalf("Failed to delete record: %v", err)
+	}
+
+	// Simulate a write interrupted by a crash
+	if err := os.WriteFile(filepath.Join(dir, "tasks", ".tmp-123"), []byte("{"), 0600); err != nil {
+		t.Fatalf("Failed to write temporary file: %v", err)
+	}
+
+	// Reopen the store as a restarted server would
+	s, err = NewFileStore(dir)
+	if err != nil {
+		t.Fatalf("Failed to reopen store: %v", err)
+	}
+
+	records, err := s.List("tasks")
+	if err != nil {
+		t.Fatalf("Failed to list records: %v", err)
+	}
+	if len(records) != 1 {
+		t.Fatalf("Expected 1 record, got %d", len(records))
+	}
+
+	var record testRecord
+	if err := json.Unmarshal(records[0], &record); err != nil {
+		t.Fatalf("Failed to decode record: %v", err)
+	}
+	if record.ID != "1" || string(record.Result) != "done" {
+		t.Errorf("Unexpected record: %+v", record)
+	}
+
+	if err := s.Get("tasks", "2", &record); err != ErrNotFound {
+		t.Errorf("Expected ErrNotFound for a deleted record, got %v", err)
+	}
+}
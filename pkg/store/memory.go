@@ -0,0 +1,81 @@
+package store
+
+import (
+	"encoding/json"
+	"sort"
+	"sync"
+)
+
+// MemoryStore keeps records in memory only. It is used when persistence is disabled.
+type MemoryStore struct {
+	collections map[string]map[string][]byte
+	mutex       sync.RWMutex
+}
+
+// NewMemoryStore creates an empty memory store
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		collections: make(map[string]map[string][]byte),
+	}
+}
+
+// Put implements Store
+func (s *MemoryStore) Put(collection, key string, value interface{}) error {
+	data, err := json.Marshal(value)
+	if err != nil {
+		return err
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if _, exists := s.collections[collection]; !exists {
+		s.collections[collection] = make(map[string][]byte)
+	}
+	s.collections[collection][key] = data
+	return nil
+}
+
+// Get implements Store
+func (s *MemoryStore) Get(collection, key string, value interface{}) error {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	data, exists := s.collections[collection][key]
+	if !exists {
+		return ErrNotFound
+	}
+	return json.Unmarshal(data, value)
+}
+
+// Delete implements Store
+func (s *MemoryStore) Delete(collection, key string) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	delete(s.collections[collection], key)
+	return nil
+}
+
+// List implements Store
+func (s *MemoryStore) List(collection string) ([]json.RawMessage, error) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	keys := make([]string, 0, len(s.collections[collection]))
+	for key := range s.collections[collection] {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	records := make([]json.RawMessage, 0, len(keys))
+	for _, key := range keys {
+		records = append(records, json.RawMessage(s.collections[collection][key]))
+	}
+	return records, nil
+}
+
+// Close implements Store
+func (s *MemoryStore) Close() error {
+	return nil
+}
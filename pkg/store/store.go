@@ -0,0 +1,56 @@
+package store
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+)
+
+// ErrNotFound is returned when a record does not exist
+var ErrNotFound = errors.New("record not found")
+
+// Store persists server state as JSON records grouped into collections
+type Store interface {
+	// Put creates or replaces a record. The record is durable once Put returns.
+	Put(collection, key string, value interface{}) error
+
+	// Get reads a record into value
+	Get(collection, key string, value interface{}) error
+
+	// Delete removes a record. Deleting a missing record is not an error.
+	Delete(collection, key string) error
+
+	// List returns every record in a collection
+	List(collection string) ([]json.RawMessage, error)
+
+	// Close releases the resources held by the store
+	Close() error
+}
+
+// Store types
+const (
+	TypeFile   = "file"
+	TypeMemory = "memory"
+)
+
+// Config selects and configures a store
+type Config struct {
+	Type string `json:"type,omitempty"` // file (default) or memory
+	Path string `json:"path,omitempty"` // directory for the file store
+}
+
+// New creates the store described by the configuration
+func New(config Config) (Store, error) {
+	switch config.Type {
+	case "", TypeFile:
+		path := config.Path
+		if path == "" {
+			path = "data"
+		}
+		return NewFileStore(path)
+	case TypeMemory:
+		return NewMemoryStore(), nil
+	default:
+		return nil, fmt.Errorf("unknown store type: %s", config.Type)
+	}
+}
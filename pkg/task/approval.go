@@ -0,0 +1,166 @@
+package task
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+)
+
+var (
+	// ErrNotAwaitingApproval is returned when approving or rejecting a task that does not require approval
+	ErrNotAwaitingApproval = errors.New("task is not awaiting approval")
+
+	// ErrApprovalDenied is returned when an operator may not approve a task
+	ErrApprovalDenied = errors.New("approval denied")
+)
+
+// ModuleCommand is the data of a module_exec task
+type ModuleCommand struct {
+	Module  string        `json:"module"`
+	Command string        `json:"command"`
+	Args    []interface{} `json:"args,omitempty"`
+}
+
+// ParseModuleCommand parses the data of a module_exec task
+func ParseModuleCommand(data []byte) (ModuleCommand, error) {
+	var command ModuleCommand
+	if err := json.Unmarshal(data, &command); err != nil {
+		return command, fmt.Errorf("module command is not valid JSON: %v", err)
+	}
+	if command.Module == "" || command.Command == "" {
+		return command, errors.New("module and command are required")
+	}
+	return command, nil
+}
+
+// SetApprovalRules sets which tasks wait for a second operator's approval
+// before they run: tasks of the given types, and module_exec tasks for the
+// given modules or module:command pairs, such as shell or file:delete
+func (m *Manager) SetApprovalRules(taskTypes []TaskType, moduleCommands []string) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	m.approvalTypes = make(map[TaskType]bool, len(taskTypes))
+	for _, taskType := range taskTypes {
+		m.approvalTypes[taskType] = true
+	}
+	m.approvalRules = make(map[string]bool, len(moduleCommands))
+	for _, rule := range moduleCommands {
+		m.approvalRules[rule] = true
+	}
+}
+
+// RequiresApproval reports whether a task of the given type and data would wait
+// for approval. The API uses it to refuse operations that run on the server
+// without a task, such as loading and executing modules, when a task doing the
+// same would need a second operator's approval.
+func (m *Manager) RequiresApproval(taskType TaskType, data []byte) bool {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+
+	return m.requiresApproval(&Task{Type: taskType, Data: data})
+}
+
+// requiresApproval reports whether a task must be approved before it runs.
+// Module commands that cannot be parsed require approval if any module
+// command does. The caller must hold the mutex.
+func (m *Manager) requiresApproval(task *Task) bool {
+	if m.approvalTypes[task.Type] {
+		return true
+	}
+	if task.Type != TaskTypeModuleExec || len(m.approvalRules) == 0 {
+		return false
+	}
+
+	command, err := ParseModuleCommand(task.Data)
+	if err != nil {
+		return true
+	}
+	return m.approvalRules[command.Module] || m.approvalRules[command.Module+":"+command.Command]
+}
+
+// ApproveTask approves a task that awaits approval, which starts it once its
+// dependencies have finished. The approver must be a known operator other
+// than the one who created the task.
+func (m *Manager) ApproveTask(id uint32, approver string) (*Task, error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	task, err := m.awaitingApproval(id, approver)
+	if err != nil {
+		return nil, err
+	}
+
+	// Refuse the approval if the task would start but its client's queue is full
+	ready := m.dependenciesMet(task)
+	if ready {
+		if err := m.scheduler.admit(task.ClientID); err != nil {
+			return nil, err
+		}
+	}
+
+	previousStatus := task.Status
+	task.Status = TaskStatusPending
+	task.ApprovedBy = approver
+	task.ApprovedAt = time.Now()
+	if err := m.persist(task); err != nil {
+		return nil, err
+	}
+	m.publishStatus(task, previousStatus)
+	log.Printf("Task %d (%s for client %s) approved by %s", task.ID, task.Type, task.ClientID, approver)
+
+	if ready {
+		m.release(task)
+	}
+	return task, nil
+}
+
+// RejectTask rejects a task that awaits approval, which cancels it
+func (m *Manager) RejectTask(id uint32, approver, reason string) (*Task, error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	task, err := m.awaitingApproval(id, approver)
+	if err != nil {
+		return nil, err
+	}
+
+	message := "rejected by " + approver
+	if reason != "" {
+		message += ": " + reason
+	}
+
+	previousStatus := task.Status
+	task.Status = TaskStatusCancelled
+	task.RejectedBy = approver
+	m.finish(task, nil, message)
+	if err := m.persist(task); err != nil {
+		return nil, err
+	}
+	m.publishStatus(task, previousStatus)
+	log.Printf("Task %d (%s for client %s) %s", task.ID, task.Type, task.ClientID, message)
+
+	m.settle(task)
+	return task, nil
+}
+
+// awaitingApproval returns a task that awaits approval, if the approver may
+// decide on it. The caller must hold the mutex.
+func (m *Manager) awaitingApproval(id uint32, approver string) (*Task, error) {
+	task, exists := m.tasks[id]
+	if !exists {
+		return nil, ErrTaskNotFound
+	}
+	if task.Status != TaskStatusAwaitingApproval {
+		return nil, ErrNotAwaitingApproval
+	}
+	if approver == "" {
+		return nil, fmt.Errorf("%w: the approver must be an authenticated operator", ErrApprovalDenied)
+	}
+	if approver == task.CreatedBy {
+		return nil, fmt.Errorf("%w: task %d must be approved by an operator other than %s, who created it", ErrApprovalDenied, id, approver)
+	}
+	return task, nil
+}
@@ -0,0 +1,65 @@
+package task
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestApprovalWorkflow(t *testing.T) {
+	m := NewManager()
+	m.SetApprovalRules([]TaskType{TaskTypeModuleLoad}, []string{"shell", "file:delete"})
+
+	tests := []struct {
+		taskType TaskType
+		data     string
+		want     TaskStatus
+	}{
+		{TaskTypeCommand, "whoami", TaskStatusPending},
+		{TaskTypeModuleLoad, "keylogger", TaskStatusAwaitingApproval},
+		{TaskTypeModuleExec, `{"module": "shell", "command": "id"}`, TaskStatusAwaitingApproval},
+		{TaskTypeModuleExec, `{"module": "file", "command": "delete", "args": ["/tmp/x"]}`, TaskStatusAwaitingApproval},
+		{TaskTypeModuleExec, `{"module": "file", "command": "list", "args": ["/tmp"]}`, TaskStatusPending},
+		{TaskTypeModuleExec, "not json", TaskStatusAwaitingApproval},
+	}
+	for _, test := range tests {
+		task, err := m.CreateTaskWithOptions(test.taskType, "client1", []byte(test.data), TaskPriorityNormal, nil, TaskOptions{CreatedBy: "alice"})
+		if err != nil {
+			t.Fatalf("Failed to create task: %v", err)
+		}
+		if task.Status != test.want {
+			t.Errorf("%s %s: expected %s, got %s", test.taskType, test.data, test.want, task.Status)
+		}
+	}
+
+	task, _ := m.CreateTaskWithOptions(TaskTypeModuleLoad, "client2", nil, TaskPriorityNormal, nil, TaskOptions{CreatedBy: "alice"})
+	if depth := m.QueueStats().ByClient["client2"]; depth != 0 {
+		t.Errorf("Expected the task awaiting approval not to be queued, got %d", depth)
+	}
+
+	// The operator who created a task cannot approve it
+	if _, err := m.ApproveTask(task.ID, "alice"); !errors.Is(err, ErrApprovalDenied) {
+		t.Errorf("Expected ErrApprovalDenied, got %v", err)
+	}
+	if _, err := m.ApproveTask(task.ID, "bob"); err != nil {
+		t.Fatalf("Failed to approve task: %v", err)
+	}
+	if task.Status != TaskStatusPending || task.ApprovedBy != "bob" || m.QueueStats().ByClient["client2"] != 1 {
+		t.Errorf("Expected the approved task to be queued, got %s approved by %q", task.Status, task.ApprovedBy)
+	}
+	if _, err := m.ApproveTask(task.ID, "bob"); !errors.Is(err, ErrNotAwaitingApproval) {
+		t.Errorf("Expected ErrNotAwaitingApproval, got %v", err)
+	}
+
+	// Rejected tasks are cancelled, and tasks depending on them do not run
+	task, _ = m.CreateTaskWithOptions(TaskTypeModuleLoad, "client2", nil, TaskPriorityNormal, nil, TaskOptions{CreatedBy: "alice"})
+	dependent, _ := m.CreateTask(TaskTypeCommand, "client2", []byte("id"), TaskPriorityNormal, []uint32{task.ID})
+	if _, err := m.RejectTask(task.ID, "bob", "too noisy"); err != nil {
+		t.Fatalf("Failed to reject task: %v", err)
+	}
+	if task.Status != TaskStatusCancelled || task.RejectedBy != "bob" || task.Error != "rejected by bob: too noisy" {
+		t.Errorf("Expected the task to be rejected, got %s (%s)", task.Status, task.Error)
+	}
+	if dependent.Status != TaskStatusPending || m.QueueStats().ByClient["client2"] != 1 {
+		t.Errorf("Expected the dependent task not to be queued, got %s", dependent.Status)
+	}
+}
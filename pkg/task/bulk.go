@@ -0,0 +1,148 @@
+package task
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"time"
+)
+
+// ErrNoClients is returned when creating a bulk task without any clients
+var ErrNoClients = errors.New("no clients to run the task on")
+
+// CreateBulkTask creates a parent task with a child task for each client. The
+// parent is never dispatched itself; its status is aggregated from its
+// children. The task is refused as a whole if the task of any client is
+// refused or any client's queue is full.
+func (m *Manager) CreateBulkTask(taskType TaskType, clientIDs []string, selector string, data []byte, priority TaskPriority, dependsOn []uint32, options TaskOptions) (*Task, error) {
+	if len(clientIDs) == 0 {
+		return nil, ErrNoClients
+	}
+
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	// Build and check every child before accepting any
+	children := make([]*Task, len(clientIDs))
+	for i, clientID := range clientIDs {
+		child, err := m.newTask(taskType, clientID, data, priority, dependsOn, options)
+		if err != nil {
+			return nil, fmt.Errorf("client %s: %w", clientID, err)
+		}
+		children[i] = child
+	}
+	ready := children[0].Status == TaskStatusPending && m.dependenciesMet(children[0])
+	if ready {
+		for _, clientID := range clientIDs {
+			if err := m.scheduler.admit(clientID); err != nil {
+				return nil, fmt.Errorf("client %s: %w", clientID, err)
+			}
+		}
+	}
+
+	parent := &Task{
+		Type:      taskType,
+		Data:      data,
+		Priority:  priority,
+		Status:    TaskStatusPending,
+		CreatedAt: time.Now(),
+		Selector:  selector,
+		Attempt:   1,
+		CreatedBy: options.CreatedBy,
+	}
+	if err := m.addTask(parent); err != nil {
+		return nil, err
+	}
+	for _, child := range children {
+		child.Parent = parent.ID
+		if err := m.addTask(child); err != nil {
+			return nil, err
+		}
+		parent.Children = append(parent.Children, child.ID)
+	}
+	m.updateParent(parent)
+
+	log.Printf("Created bulk %s task %d for %d clients", taskType, parent.ID, len(children))
+	if ready {
+		for _, child := range children {
+			m.release(child)
+		}
+	}
+	return parent, nil
+}
+
+// updateParent aggregates the status of a parent task from its children. The
+// parent is running once any child has started, and finishes when all have:
+// failed if any child failed or timed out, cancelled if any was cancelled, and
+// completed otherwise. The caller must hold the mutex.
+func (m *Manager) updateParent(parent *Task) {
+	if parent.Finished() || len(parent.Children) == 0 {
+		return
+	}
+
+	counts := make(map[TaskStatus]int)
+	finished := 0
+	for _, id := range parent.Children {
+		child, exists := m.tasks[id]
+		if !exists {
+			continue
+		}
+		counts[child.Status]++
+
+		// A failed attempt that is retried has not finished yet
+		if child.Finished() && !m.shouldRetry(child) {
+			finished++
+		}
+	}
+	parent.ChildStatus = counts
+
+	previousStatus := parent.Status
+	switch {
+	case finished < len(parent.Children):
+		if counts[TaskStatusPending]+counts[TaskStatusAwaitingApproval] < len(parent.Children) {
+			parent.Status = TaskStatusRunning
+		}
+	case counts[TaskStatusFailed] > 0 || counts[TaskStatusTimedOut] > 0:
+		parent.Status = TaskStatusFailed
+		parent.Error = fmt.Sprintf("%d of %d child tasks failed", counts[TaskStatusFailed]+counts[TaskStatusTimedOut], len(parent.Children))
+	case counts[TaskStatusCancelled] > 0:
+		parent.Status = TaskStatusCancelled
+	default:
+		parent.Status = TaskStatusCompleted
+	}
+
+	if parent.Status == TaskStatusRunning && parent.StartedAt.IsZero() {
+		parent.StartedAt = time.Now()
+	}
+	if parent.Finished() {
+		parent.CompletedAt = time.Now()
+	}
+	if err := m.persist(parent); err != nil {
+		log.Printf("Failed to persist task %d: %v", parent.ID, err)
+	}
+	if parent.Status != previousStatus {
+		m.publishStatus(parent, previousStatus)
+		m.settle(parent)
+	}
+}
+
+// cancelChildren cancels the children of a parent task that have not finished,
+// which in turn finishes the parent. The caller must hold the mutex.
+func (m *Manager) cancelChildren(parent *Task, reason string) error {
+	for _, id := range parent.Children {
+		child, exists := m.tasks[id]
+		if !exists || child.Finished() {
+			continue
+		}
+
+		previousStatus := child.Status
+		child.Status = TaskStatusCancelled
+		m.finish(child, nil, reason)
+		if err := m.persist(child); err != nil {
+			return err
+		}
+		m.publishStatus(child, previousStatus)
+		m.settle(child)
+	}
+	return nil
+}
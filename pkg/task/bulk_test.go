@@ -0,0 +1,64 @@
+package task
+
+import (
+	"errors"
+	"testing"
+
+	"dinoc2/pkg/store"
+)
+
+func TestBulkTaskAggregatesChildren(t *testing.T) {
+	s := store.NewMemoryStore()
+	m := NewManager()
+	if err := m.SetStore(s); err != nil {
+		t.Fatalf("Failed to set store: %v", err)
+	}
+
+	parent, err := m.CreateBulkTask(TaskTypeCommand, []string{"web1", "web2", "web3"}, "segment=dmz", []byte("id"), TaskPriorityNormal, nil, TaskOptions{})
+	if err != nil {
+		t.Fatalf("Failed to create bulk task: %v", err)
+	}
+	if len(parent.Children) != 3 || parent.Status != TaskStatusPending || parent.ClientID != "" {
+		t.Fatalf("Unexpected parent task: %+v", parent)
+	}
+	if stats := m.QueueStats(); stats.Queued != 3 {
+		t.Errorf("Expected only the children to be queued, got %d queued tasks", stats.Queued)
+	}
+
+	m.UpdateTaskStatus(parent.Children[0], TaskStatusRunning, nil, "")
+	if parent.Status != TaskStatusRunning {
+		t.Errorf("Expected the parent to be running, got %s", parent.Status)
+	}
+	m.UpdateTaskStatus(parent.Children[0], TaskStatusCompleted, []byte("uid=0"), "")
+	m.UpdateTaskStatus(parent.Children[1], TaskStatusFailed, nil, "connection lost")
+	if parent.ChildStatus[TaskStatusCompleted] != 1 || parent.ChildStatus[TaskStatusFailed] != 1 || parent.ChildStatus[TaskStatusPending] != 1 {
+		t.Errorf("Unexpected child status counts: %v", parent.ChildStatus)
+	}
+
+	// Cancelling the parent cancels the children that have not finished
+	if _, err := m.CancelTask(parent.ID, ""); err != nil {
+		t.Fatalf("Failed to cancel bulk task: %v", err)
+	}
+	child, _ := m.GetTask(parent.Children[2])
+	if child.Status != TaskStatusCancelled {
+		t.Errorf("Expected the remaining child to be cancelled, got %s", child.Status)
+	}
+	if parent.Status != TaskStatusFailed || parent.Error != "1 of 3 child tasks failed" {
+		t.Errorf("Expected the parent to fail, got %s (%s)", parent.Status, parent.Error)
+	}
+
+	// A bulk task is refused as a whole if the task of any client is refused
+	m.AddValidator(func(task *Task) error {
+		if task.ClientID == "quarantined" {
+			return errors.New("out of scope")
+		}
+		return nil
+	})
+	before := len(m.ListTasks())
+	if _, err := m.CreateBulkTask(TaskTypeCommand, []string{"web1", "quarantined"}, "", nil, TaskPriorityNormal, nil, TaskOptions{}); !errors.Is(err, ErrTaskRefused) {
+		t.Errorf("Expected ErrTaskRefused, got %v", err)
+	}
+	if after := len(m.ListTasks()); after != before {
+		t.Errorf("Expected no tasks to be created, got %d new tasks", after-before)
+	}
+}
@@ -0,0 +1,123 @@
+package task
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"time"
+
+	"dinoc2/pkg/module"
+)
+
+// CleanupResult is the result of an exit_cleanup task: what the client
+// removed, or failed to remove, before it exited
+type CleanupResult struct {
+	Artifacts []module.Artifact `json:"artifacts"`
+}
+
+// CleanupStatus is where a client is in exiting and cleaning up
+type CleanupStatus string
+
+const (
+	CleanupNotRequested CleanupStatus = "not_requested" // no exit_cleanup task was created for the client
+	CleanupPending      CleanupStatus = "pending"       // the client has not answered yet
+	CleanupConfirmed    CleanupStatus = "confirmed"     // the client removed all its artifacts and exited
+	CleanupIncomplete   CleanupStatus = "incomplete"    // the client exited but could not remove some artifacts
+	CleanupFailed       CleanupStatus = "failed"        // the client reported an error
+	CleanupNoAnswer     CleanupStatus = "no_answer"     // the task timed out before the client answered
+	CleanupCancelled    CleanupStatus = "cancelled"     // the task was cancelled or rejected before it ran
+)
+
+// ClientCleanup describes the exit and cleanup of a single client
+type ClientCleanup struct {
+	ClientID    string            `json:"client_id"`
+	Status      CleanupStatus     `json:"status"`
+	TaskID      uint32            `json:"task_id,omitempty"` // the client's latest exit_cleanup task
+	RequestedBy string            `json:"requested_by,omitempty"`
+	RequestedAt time.Time         `json:"requested_at,omitempty"`
+	AnsweredAt  time.Time         `json:"answered_at,omitempty"`
+	Artifacts   []module.Artifact `json:"artifacts,omitempty"`
+	Error       string            `json:"error,omitempty"`
+}
+
+// CleanupReport describes which clients confirmed that they cleaned up and
+// exited, which did not answer, and the artifacts each one reported
+type CleanupReport struct {
+	GeneratedAt time.Time             `json:"generated_at"`
+	Counts      map[CleanupStatus]int `json:"counts"`
+	Clients     []ClientCleanup       `json:"clients"`
+}
+
+// CleanupReport reports the exit and cleanup of every client that was sent an
+// exit_cleanup task, by the latest such task of each. The given clients that
+// were never sent one are reported as not requested.
+func (m *Manager) CleanupReport(clientIDs []string) CleanupReport {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+
+	latest := make(map[string]*Task)
+	for _, task := range m.tasks {
+		if task.Type != TaskTypeExitCleanup || task.ClientID == "" {
+			continue
+		}
+		if previous, exists := latest[task.ClientID]; !exists || task.ID > previous.ID {
+			latest[task.ClientID] = task
+		}
+	}
+
+	report := CleanupReport{GeneratedAt: time.Now(), Counts: make(map[CleanupStatus]int)}
+	for _, task := range latest {
+		report.Clients = append(report.Clients, cleanupOf(task))
+	}
+	for _, clientID := range clientIDs {
+		if _, exists := latest[clientID]; !exists {
+			report.Clients = append(report.Clients, ClientCleanup{ClientID: clientID, Status: CleanupNotRequested})
+			latest[clientID] = nil // reported once, even if listed twice
+		}
+	}
+
+	sort.Slice(report.Clients, func(i, j int) bool { return report.Clients[i].ClientID < report.Clients[j].ClientID })
+	for _, client := range report.Clients {
+		report.Counts[client.Status]++
+	}
+	return report
+}
+
+// cleanupOf describes a client's exit and cleanup from its exit_cleanup task
+func cleanupOf(task *Task) ClientCleanup {
+	cleanup := ClientCleanup{
+		ClientID:    task.ClientID,
+		TaskID:      task.ID,
+		RequestedBy: task.CreatedBy,
+		RequestedAt: task.CreatedAt,
+		Error:       task.Error,
+	}
+
+	switch task.Status {
+	case TaskStatusCompleted:
+		cleanup.AnsweredAt = task.CompletedAt
+		var result CleanupResult
+		if err := json.Unmarshal(task.Result, &result); err != nil {
+			cleanup.Status = CleanupIncomplete
+			cleanup.Error = fmt.Sprintf("invalid cleanup result: %v", err)
+			break
+		}
+		cleanup.Artifacts = result.Artifacts
+		cleanup.Status = CleanupConfirmed
+		for _, artifact := range result.Artifacts {
+			if !artifact.Removed {
+				cleanup.Status = CleanupIncomplete
+			}
+		}
+	case TaskStatusFailed:
+		cleanup.AnsweredAt = task.CompletedAt
+		cleanup.Status = CleanupFailed
+	case TaskStatusTimedOut:
+		cleanup.Status = CleanupNoAnswer
+	case TaskStatusCancelled, TaskStatusSkipped:
+		cleanup.Status = CleanupCancelled
+	default:
+		cleanup.Status = CleanupPending
+	}
+	return cleanup
+}
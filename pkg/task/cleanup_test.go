@@ -0,0 +1,56 @@
+package task
+
+import (
+	"testing"
+)
+
+func TestCleanupReport(t *testing.T) {
+	m := NewManager()
+
+	statuses := map[string]struct {
+		status TaskStatus
+		result string
+	}{
+		"confirmed":  {TaskStatusCompleted, `{"artifacts": [{"module": "file", "path": "/tmp/a", "removed": true}]}`},
+		"incomplete": {TaskStatusCompleted, `{"artifacts": [{"module": "file", "path": "/tmp/b", "error": "permission denied"}]}`},
+		"failed":     {TaskStatusFailed, ""},
+		"no_answer":  {TaskStatusTimedOut, ""},
+		"pending":    {TaskStatusPending, ""},
+	}
+	for clientID, s := range statuses {
+		task, err := m.CreateTaskWithOptions(TaskTypeExitCleanup, clientID, nil, TaskPriorityHigh, nil, TaskOptions{CreatedBy: "alice"})
+		if err != nil {
+			t.Fatalf("Failed to create task: %v", err)
+		}
+		if s.status != TaskStatusPending {
+			m.UpdateTaskStatus(task.ID, s.status, []byte(s.result), "")
+		}
+	}
+
+	// A newer task supersedes an older one
+	retry, _ := m.CreateTask(TaskTypeExitCleanup, "failed", nil, TaskPriorityHigh, nil)
+	m.UpdateTaskStatus(retry.ID, TaskStatusFailed, nil, "module error")
+
+	report := m.CleanupReport([]string{"confirmed", "never_asked"})
+	if len(report.Clients) != 6 {
+		t.Fatalf("Expected 6 clients in the report, got %+v", report.Clients)
+	}
+	for _, client := range report.Clients {
+		want := CleanupStatus(client.ClientID)
+		if client.ClientID == "never_asked" {
+			want = CleanupNotRequested
+		}
+		if client.Status != want {
+			t.Errorf("Client %s: expected %s, got %s", client.ClientID, want, client.Status)
+		}
+		if client.ClientID == "failed" && (client.TaskID != retry.ID || client.Error != "module error") {
+			t.Errorf("Expected the latest task to be reported, got task %d (%s)", client.TaskID, client.Error)
+		}
+		if client.ClientID == "incomplete" && (len(client.Artifacts) != 1 || client.Artifacts[0].Removed) {
+			t.Errorf("Expected the artifact that was not removed to be reported, got %+v", client.Artifacts)
+		}
+	}
+	if report.Counts[CleanupConfirmed] != 1 || report.Counts[CleanupNotRequested] != 1 {
+		t.Errorf("Unexpected counts %v", report.Counts)
+	}
+}
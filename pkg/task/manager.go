@@ -1,11 +1,38 @@
 package task
 
 import (
+	"encoding/json"
 	"errors"
+	"fmt"
+	"log"
+	"strconv"
 	"sync"
 	"time"
+
+	"dinoc2/pkg/events"
+	"dinoc2/pkg/store"
 )
 
+// taskCollection is the store collection that holds tasks
+const taskCollection = "tasks"
+
+// ErrTaskRefused is returned when a validator refuses to create a task
+var ErrTaskRefused = errors.New("task refused")
+
+// ErrTaskNotFound is returned when a task does not exist
+var ErrTaskNotFound = errors.New("task not found")
+
+// ErrTaskFinished is returned when changing a task that has already finished
+var ErrTaskFinished = errors.New("task has already finished")
+
+// Validator checks whether a task may be created, returning the reason if not.
+// A validator may also accept a task with a warning by adding it to the task's Flags.
+type Validator func(task *Task) error
+
+// ResultHandler is called with every task that completes, with its result.
+// It is called with the manager's mutex held, so it must not call the manager.
+type ResultHandler func(task *Task)
+
 // TaskStatus represents the current status of a task
 type TaskStatus string
 
@@ -15,6 +42,10 @@ const (
 	TaskStatusCompleted TaskStatus = "completed"
 	TaskStatusFailed    TaskStatus = "failed"
 	TaskStatusCancelled TaskStatus = "cancelled"
+	TaskStatusTimedOut  TaskStatus = "timed_out"
+	TaskStatusSkipped   TaskStatus = "skipped"
+
+	TaskStatusAwaitingApproval TaskStatus = "awaiting_approval"
 )
 
 // TaskPriority represents the priority level of a task
@@ -34,6 +65,7 @@ const (
 	TaskTypeModuleLoad     TaskType = "module_load"
 	TaskTypeModuleExec     TaskType = "module_exec"
 	TaskTypeProtocolSwitch TaskType = "protocol_switch"
+	TaskTypeExitCleanup    TaskType = "exit_cleanup" // the client removes its artifacts and exits
 	TaskTypeKeyExchange    TaskType = "key_exchange"
 )
 
@@ -51,6 +83,28 @@ type Task struct {
 	Result      []byte
 	Error       string
 	DependsOn   []uint32 // IDs of tasks that must complete before this one
+
+	Timeout       time.Duration // how long each attempt may take once queued, 0 for no limit
+	Deadline      time.Time     // when the current attempt times out
+	Retry         RetryPolicy   // how failed and timed out attempts are retried
+	Attempt       int           // the current attempt, starting at 1
+	NextAttemptAt time.Time     // when a failed attempt is retried
+
+	Playbook          uint32     // ID of the playbook run the task belongs to, 0 if none
+	Step              string     // ID of the playbook step the task was expanded from
+	Condition         *Condition // must hold for the task to run once its dependencies have finished
+	ContinueOnFailure bool       // tasks that depend on this one run even if it fails
+
+	Parent      uint32             // ID of the bulk task this task is a child of, 0 if none
+	Children    []uint32           // IDs of the child tasks of a bulk task, one per client
+	Selector    string             // tag selector the clients of a bulk task were chosen by
+	ChildStatus map[TaskStatus]int // number of child tasks of a bulk task in each status
+
+	CreatedBy  string    // operator who created the task, empty if unknown
+	ApprovedBy string    // operator who approved a task that requires approval
+	ApprovedAt time.Time // when the task was approved
+	RejectedBy string    // operator who rejected a task that requires approval
+	Flags      []string  // warnings recorded when the task was created, such as a lock on its client held by another operator
 }
 
 // Manager handles task creation, scheduling, and tracking
@@ -58,8 +112,21 @@ type Manager struct {
 	tasks          map[uint32]*Task
 	nextID         uint32
 	mutex          sync.RWMutex
-	pendingChan    chan *Task
-	priorityQueues map[TaskPriority][]*Task // Tasks organized by priority
+	scheduler      *scheduler // Tasks that are ready to be dispatched
+	validators     []Validator
+	resultHandlers []ResultHandler
+	store          store.Store // Optional store that tasks are persisted to
+	events         *events.Bus
+	timers         map[uint32]*time.Timer // Timeout or retry timer of each task
+	defaultTimeout time.Duration
+	typeTimeouts   map[TaskType]time.Duration
+	runs           map[uint32]*PlaybookRun
+	nextRunID      uint32
+	schedules      map[uint32]*Schedule
+	nextScheduleID uint32
+	approvalTypes  map[TaskType]bool
+	approvalRules  map[string]bool // modules, or module:command pairs, of module_exec tasks that require approval
+	outcomes       map[TaskType]map[TaskStatus]uint64 // tasks that reached a final status since the server started
 }
 
 // NewManager creates a new task manager
@@ -67,19 +134,89 @@ func NewManager() *Manager {
 	return &Manager{
 		tasks:          make(map[uint32]*Task),
 		nextID:         1,
-		pendingChan:    make(chan *Task, 100),
-		priorityQueues: make(map[TaskPriority][]*Task),
+		scheduler:      newScheduler(),
+		timers:         make(map[uint32]*time.Timer),
+		typeTimeouts:   make(map[TaskType]time.Duration),
+		runs:           make(map[uint32]*PlaybookRun),
+		nextRunID:      1,
+		schedules:      make(map[uint32]*Schedule),
+		nextScheduleID: 1,
+		approvalTypes:  make(map[TaskType]bool),
+		approvalRules:  make(map[string]bool),
+		outcomes:       make(map[TaskType]map[TaskStatus]uint64),
 	}
 }
 
+// AddValidator adds a check that every new task must pass
+func (m *Manager) AddValidator(validator Validator) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	m.validators = append(m.validators, validator)
+}
+
+// AddResultHandler adds a handler that is called with every task that completes
+func (m *Manager) AddResultHandler(handler ResultHandler) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	m.resultHandlers = append(m.resultHandlers, handler)
+}
+
 // CreateTask creates a new task and adds it to the manager
 func (m *Manager) CreateTask(taskType TaskType, clientID string, data []byte, priority TaskPriority, dependsOn []uint32) (*Task, error) {
+	return m.CreateTaskWithOptions(taskType, clientID, data, priority, dependsOn, TaskOptions{})
+}
+
+// CreateTaskWithOptions creates a new task with a timeout and retry policy and adds it to the manager
+func (m *Manager) CreateTaskWithOptions(taskType TaskType, clientID string, data []byte, priority TaskPriority, dependsOn []uint32, options TaskOptions) (*Task, error) {
 	m.mutex.Lock()
 	defer m.mutex.Unlock()
 
+	return m.createTask(taskType, clientID, data, priority, dependsOn, options)
+}
+
+// createTask creates a task, adds it to the manager and starts it if its
+// dependencies are met. The caller must hold the mutex.
+func (m *Manager) createTask(taskType TaskType, clientID string, data []byte, priority TaskPriority, dependsOn []uint32, options TaskOptions) (*Task, error) {
+	task, err := m.newTask(taskType, clientID, data, priority, dependsOn, options)
+	if err != nil {
+		return nil, err
+	}
+
+	// Refuse the task if it is ready but its client's queue is full
+	ready := task.Status == TaskStatusPending && m.dependenciesMet(task)
+	if ready {
+		if err := m.scheduler.admit(clientID); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := m.addTask(task); err != nil {
+		return nil, err
+	}
+
+	// Start the task unless it waits for dependencies or approval
+	if ready {
+		m.release(task)
+	}
+	return task, nil
+}
+
+// newTask builds a task and checks it against the validators. The caller must hold the mutex.
+func (m *Manager) newTask(taskType TaskType, clientID string, data []byte, priority TaskPriority, dependsOn []uint32, options TaskOptions) (*Task, error) {
+	if options.Timeout < 0 || options.Retry.MaxAttempts < 0 || options.Retry.Backoff < 0 || options.Retry.MaxBackoff < 0 {
+		return nil, fmt.Errorf("%w: timeout and retry settings must not be negative", ErrTaskRefused)
+	}
+
+	// Tasks without a timeout of their own use the timeout of their type
+	timeout := options.Timeout
+	if timeout == 0 {
+		timeout = m.timeoutFor(taskType)
+	}
+
 	// Create the task
 	task := &Task{
-		ID:        m.nextID,
 		Type:      taskType,
 		ClientID:  clientID,
 		Data:      data,
@@ -87,45 +224,50 @@ func (m *Manager) CreateTask(taskType TaskType, clientID string, data []byte, pr
 		Status:    TaskStatusPending,
 		CreatedAt: time.Now(),
 		DependsOn: dependsOn,
+		Timeout:   timeout,
+		Retry:     options.Retry,
+		Attempt:   1,
+		CreatedBy: options.CreatedBy,
 	}
 
-	// Increment the next ID
-	m.nextID++
+	// Refuse the task if any validator rejects it
+	if err := m.validate(task); err != nil {
+		log.Printf("Refused %s task for client %s: %v", taskType, clientID, err)
+		return nil, fmt.Errorf("%w: %w", ErrTaskRefused, err)
+	}
 
-	// Add the task to the manager
-	m.tasks[task.ID] = task
-	
-	// Add the task to the appropriate priority queue
-	if _, exists := m.priorityQueues[priority]; !exists {
-		m.priorityQueues[priority] = make([]*Task, 0)
-	}
-	m.priorityQueues[priority] = append(m.priorityQueues[priority], task)
-
-	// Check if the task can be scheduled immediately
-	if len(dependsOn) == 0 {
-		// No dependencies, can be scheduled immediately
-		go func() {
-			m.pendingChan <- task
-		}()
-	} else {
-		// Check if all dependencies are completed
-		canSchedule := true
-		for _, depID := range dependsOn {
-			depTask, exists := m.tasks[depID]
-			if !exists || depTask.Status != TaskStatusCompleted {
-				canSchedule = false
-				break
-			}
-		}
+	// High-risk tasks wait for a second operator before they can run
+	if m.requiresApproval(task) {
+		task.Status = TaskStatusAwaitingApproval
+	}
+
+	return task, nil
+}
 
-		if canSchedule {
-			go func() {
-				m.pendingChan <- task
-			}()
+// validate checks a task against the validators. The caller must hold the mutex.
+func (m *Manager) validate(task *Task) error {
+	for _, validate := range m.validators {
+		if err := validate(task); err != nil {
+			return err
 		}
 	}
+	return nil
+}
 
-	return task, nil
+// addTask assigns a task its ID, persists it and adds it to the manager. The caller must hold the mutex.
+func (m *Manager) addTask(task *Task) error {
+	// Assign the next ID
+	task.ID = m.nextID
+	m.nextID++
+
+	// Persist the task before accepting it
+	if err := m.persist(task); err != nil {
+		return err
+	}
+	m.publishStatus(task, "")
+
+	m.tasks[task.ID] = task
+	return nil
 }
 
 // GetTask retrieves a task by ID
@@ -135,7 +277,7 @@ func (m *Manager) GetTask(id uint32) (*Task, error) {
 
 	task, exists := m.tasks[id]
 	if !exists {
-		return nil, errors.New("task not found")
+		return nil, ErrTaskNotFound
 	}
 
 	return task, nil
@@ -148,40 +290,304 @@ func (m *Manager) UpdateTaskStatus(id uint32, status TaskStatus, result []byte,
 
 	task, exists := m.tasks[id]
 	if !exists {
-		return errors.New("task not found")
+		return ErrTaskNotFound
+	}
+
+	// Results that arrive after a task was cancelled, timed out or skipped are dropped
+	if task.Finished() {
+		return ErrTaskFinished
+	}
+
+	// The status of a bulk task follows its children
+	if len(task.Children) > 0 {
+		return fmt.Errorf("task %d is a bulk task, its status follows its child tasks", id)
 	}
 
 	// Update the task status
+	previousStatus := task.Status
 	task.Status = status
 	
 	// Update additional fields based on status
 	switch status {
 	case TaskStatusRunning:
 		task.StartedAt = time.Now()
-	case TaskStatusCompleted, TaskStatusFailed, TaskStatusCancelled:
-		task.CompletedAt = time.Now()
-		task.Result = result
-		task.Error = errorMsg
-
-		// Remove the task from the priority queue
-		if queue, exists := m.priorityQueues[task.Priority]; exists {
-			m.priorityQueues[task.Priority] = removeTask(queue, id)
+	case TaskStatusCompleted, TaskStatusFailed, TaskStatusCancelled, TaskStatusTimedOut, TaskStatusSkipped:
+		m.finish(task, result, errorMsg)
+	}
+
+	if err := m.persist(task); err != nil {
+		return err
+	}
+	m.publishStatus(task, previousStatus)
+	if status == TaskStatusCompleted {
+		for _, handle := range m.resultHandlers {
+			handle(task)
+		}
+	}
+
+	// Retry failed attempts if the task's retry policy allows it
+	if m.shouldRetry(task) {
+		return m.scheduleRetry(task)
+	}
+	m.settle(task)
+	return nil
+}
+
+// Finished reports whether the task has reached a final status. A failed
+// task that will be retried is pending again, so it is not finished.
+func (t *Task) Finished() bool {
+	switch t.Status {
+	case TaskStatusCompleted, TaskStatusFailed, TaskStatusCancelled, TaskStatusTimedOut, TaskStatusSkipped:
+		return true
+	}
+	return false
+}
+
+// waiting reports whether the task has not started yet, because it is queued,
+// waits for its dependencies or waits for approval
+func (t *Task) waiting() bool {
+	return t.Status == TaskStatusPending || t.Status == TaskStatusAwaitingApproval
+}
+
+// finish records the outcome of an attempt whose status has been set. The caller must hold the mutex.
+func (m *Manager) finish(task *Task, result []byte, errorMsg string) {
+	task.CompletedAt = time.Now()
+	task.Result = result
+	task.Error = errorMsg
+	m.stopTimer(task.ID)
+	m.scheduler.remove(task)
+}
+
+// settle acts on a task that has reached its final status: the playbook run it
+// belongs to is updated, and tasks that depend on it are started if they can
+// be. Failed attempts that are retried have not settled. The caller must hold the mutex.
+func (m *Manager) settle(task *Task) {
+	if !task.Finished() {
+		return
+	}
+	if task.Playbook != 0 {
+		m.stepFinished(task)
+	}
+	m.checkDependentTasks(task.ID)
+}
+
+// release starts a task whose dependencies have finished, or skips it if its
+// condition does not hold. Tasks awaiting approval are started once they are
+// approved. The caller must hold the mutex.
+func (m *Manager) release(task *Task) {
+	if task.Condition == nil || m.conditionHolds(task.Condition) {
+		if task.Status == TaskStatusPending {
+			m.enqueue(task)
+		}
+		return
+	}
+
+	previousStatus := task.Status
+	task.Status = TaskStatusSkipped
+	m.finish(task, nil, "condition not met")
+	if err := m.persist(task); err != nil {
+		log.Printf("Failed to persist task %d: %v", task.ID, err)
+	}
+	m.publishStatus(task, previousStatus)
+	m.settle(task)
+}
+
+// StatusCounts returns the number of tasks held by the manager in each status
+func (m *Manager) StatusCounts() map[TaskStatus]int {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+
+	counts := make(map[TaskStatus]int)
+	for _, task := range m.tasks {
+		counts[task.Status]++
+	}
+	return counts
+}
+
+// Outcomes returns the number of tasks of each type that reached each final
+// status since the server started
+func (m *Manager) Outcomes() map[TaskType]map[TaskStatus]uint64 {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+
+	outcomes := make(map[TaskType]map[TaskStatus]uint64, len(m.outcomes))
+	for taskType, statuses := range m.outcomes {
+		outcomes[taskType] = make(map[TaskStatus]uint64, len(statuses))
+		for status, count := range statuses {
+			outcomes[taskType][status] = count
+		}
+	}
+	return outcomes
+}
+
+// SetEventBus sets the bus that task status transitions are published to
+func (m *Manager) SetEventBus(bus *events.Bus) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	m.events = bus
+}
+
+// publishStatus publishes a task status transition, and updates the status of
+// the task's parent if it has one. The caller must hold the mutex.
+func (m *Manager) publishStatus(task *Task, previousStatus TaskStatus) {
+	m.events.Publish(events.TypeTaskStatus, events.TaskEvent{
+		TaskID:         task.ID,
+		ClientID:       task.ClientID,
+		TaskType:       string(task.Type),
+		Status:         string(task.Status),
+		PreviousStatus: string(previousStatus),
+		Error:          task.Error,
+		Parent:         task.Parent,
+	})
+
+	// Failed attempts that are retried are not outcomes
+	if task.Finished() && !m.shouldRetry(task) {
+		if m.outcomes[task.Type] == nil {
+			m.outcomes[task.Type] = make(map[TaskStatus]uint64)
+		}
+		m.outcomes[task.Type][task.Status]++
+	}
+
+	if parent, exists := m.tasks[task.Parent]; exists && task.Parent != 0 {
+		m.updateParent(parent)
+	}
+}
+
+// SetStore sets the store that tasks are persisted to and restores the tasks,
+// playbook runs and schedules it holds. Tasks that were running when the server stopped are
+// marked as failed, since their outcome is unknown; pending tasks are queued again.
+func (m *Manager) SetStore(s store.Store) error {
+	records, err := s.List(taskCollection)
+	if err != nil {
+		return fmt.Errorf("failed to load tasks: %w", err)
+	}
+	runRecords, err := s.List(runCollection)
+	if err != nil {
+		return fmt.Errorf("failed to load playbook runs: %w", err)
+	}
+	scheduleRecords, err := s.List(scheduleCollection)
+	if err != nil {
+		return fmt.Errorf("failed to load schedules: %w", err)
+	}
+
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	m.store = s
+	for _, record := range runRecords {
+		run := &PlaybookRun{}
+		if err := json.Unmarshal(record, run); err != nil {
+			return fmt.Errorf("failed to restore playbook run: %w", err)
+		}
+		m.runs[run.ID] = run
+		if run.ID >= m.nextRunID {
+			m.nextRunID = run.ID + 1
+		}
+	}
+
+	var interrupted []*Task
+	for _, record := range records {
+		task := &Task{}
+		if err := json.Unmarshal(record, task); err != nil {
+			return fmt.Errorf("failed to restore task: %w", err)
+		}
+
+		if task.Status == TaskStatusRunning && len(task.Children) == 0 {
+			task.Status = TaskStatusFailed
+			task.Error = "interrupted by server restart"
+			task.CompletedAt = time.Now()
+			if err := m.persist(task); err != nil {
+				return err
+			}
+			interrupted = append(interrupted, task)
+		}
+
+		m.tasks[task.ID] = task
+		if task.ID >= m.nextID {
+			m.nextID = task.ID + 1
+		}
+	}
+
+	// Tasks still waiting are checked against the validators again, since the
+	// scope, the engagement window or a client's quarantine may have changed
+	// since they were created. Refused tasks are cancelled rather than queued.
+	var refused []*Task
+	for _, task := range m.tasks {
+		if !task.waiting() || len(task.Children) > 0 {
+			continue
+		}
+		if err := m.validate(task); err != nil {
+			log.Printf("Cancelled restored %s task %d for client %s: %v", task.Type, task.ID, task.ClientID, err)
+			previousStatus := task.Status
+			task.Status = TaskStatusCancelled
+			task.Error = fmt.Sprintf("refused after server restart: %v", err)
+			task.CompletedAt = time.Now()
+			if err := m.persist(task); err != nil {
+				return err
+			}
+			m.publishStatus(task, previousStatus)
+			refused = append(refused, task)
+		}
+	}
+
+	// Queue pending tasks again once all tasks are known, so dependencies can be checked
+	for _, task := range m.tasks {
+		if !task.waiting() || len(task.Children) > 0 {
+			continue
 		}
 
-		// If completed, check if any dependent tasks can now be scheduled
-		if status == TaskStatusCompleted {
-			m.checkDependentTasks(id)
+		// Tasks waiting to be retried are queued once their backoff has passed
+		if !task.NextAttemptAt.IsZero() {
+			m.armRetry(task)
+			continue
+		}
+		if m.dependenciesMet(task) {
+			m.release(task)
 		}
 	}
 
+	// Interrupted and refused playbook steps end their runs like any other
+	// failure or cancellation, and bulk tasks catch up with children that
+	// were interrupted or refused
+	for _, task := range append(interrupted, refused...) {
+		m.settle(task)
+	}
+	for _, task := range m.tasks {
+		m.updateParent(task)
+	}
+
+	// Schedules are armed last, so their first runs see the restored tasks
+	for _, record := range scheduleRecords {
+		schedule := &Schedule{}
+		if err := json.Unmarshal(record, schedule); err != nil {
+			return fmt.Errorf("failed to restore schedule: %w", err)
+		}
+		if err := m.restoreSchedule(schedule); err != nil {
+			return fmt.Errorf("failed to restore schedule %d: %w", schedule.ID, err)
+		}
+	}
+
+	log.Printf("Restored %d tasks, %d playbook runs and %d schedules", len(records), len(runRecords), len(scheduleRecords))
+	return nil
+}
+
+// persist writes a task to the store, if one is set. The caller must hold the mutex.
+func (m *Manager) persist(task *Task) error {
+	if m.store == nil {
+		return nil
+	}
+	if err := m.store.Put(taskCollection, strconv.FormatUint(uint64(task.ID), 10), task); err != nil {
+		return fmt.Errorf("failed to persist task %d: %w", task.ID, err)
+	}
 	return nil
 }
 
 // checkDependentTasks checks if any tasks that depend on the given task ID can now be scheduled
 func (m *Manager) checkDependentTasks(completedTaskID uint32) {
-	// Find all tasks that depend on the completed task
+	// Find all tasks that depend on the finished task
 	for _, task := range m.tasks {
-		if task.Status == TaskStatusPending {
+		if task.waiting() {
 			// Check if this task depends on the completed task
 			isDependentTask := false
 			for _, depID := range task.DependsOn {
@@ -191,31 +597,46 @@ func (m *Manager) checkDependentTasks(completedTaskID uint32) {
 				}
 			}
 
-			if isDependentTask {
-				// Check if all dependencies are now completed
-				allDepsCompleted := true
-				for _, depID := range task.DependsOn {
-					depTask, exists := m.tasks[depID]
-					if !exists || depTask.Status != TaskStatusCompleted {
-						allDepsCompleted = false
-						break
-					}
-				}
-
-				if allDepsCompleted {
-					// All dependencies are completed, schedule the task
-					go func(t *Task) {
-						m.pendingChan <- t
-					}(task)
-				}
+			// Start the task once all its dependencies have finished
+			if isDependentTask && m.dependenciesMet(task) {
+				m.release(task)
 			}
 		}
 	}
 }
 
-// GetPendingTask returns the next pending task from the queue
+// dependenciesMet reports whether every task a task depends on has completed.
+// Skipped tasks, and failed tasks that allow their dependents to continue,
+// count as well. The caller must hold the mutex.
+func (m *Manager) dependenciesMet(task *Task) bool {
+	for _, depID := range task.DependsOn {
+		depTask, exists := m.tasks[depID]
+		if !exists || !depTask.Finished() || m.shouldRetry(depTask) {
+			return false
+		}
+		if depTask.Status != TaskStatusCompleted && depTask.Status != TaskStatusSkipped && !depTask.ContinueOnFailure {
+			return false
+		}
+	}
+	return true
+}
+
+// GetPendingTask returns the next task to dispatch, waiting until one is
+// queued. Higher priorities come first, and clients with tasks of the same
+// priority take turns, so one busy client cannot starve the others. Tasks that
+// were cancelled or timed out while they were queued are skipped.
 func (m *Manager) GetPendingTask() *Task {
-	return <-m.pendingChan
+	for {
+		task := m.scheduler.pop()
+
+		m.mutex.RLock()
+		pending := task.Status == TaskStatusPending
+		m.mutex.RUnlock()
+
+		if pending {
+			return task
+		}
+	}
 }
 
 // ListTasks returns a list of all tasks
@@ -245,59 +666,3 @@ func (m *Manager) ListClientTasks(clientID string) []*Task {
 
 	return tasks
 }
-
-// ScheduleTasks schedules tasks based on priority
-func (m *Manager) ScheduleTasks() {
-	m.mutex.Lock()
-	defer m.mutex.Unlock()
-	
-	// Process high priority tasks first
-	m.scheduleTasksWithPriority(TaskPriorityHigh)
-	
-	// Then normal priority
-	m.scheduleTasksWithPriority(TaskPriorityNormal)
-	
-	// Then low priority
-	m.scheduleTasksWithPriority(TaskPriorityLow)
-}
-
-// scheduleTasksWithPriority schedules tasks with a specific priority
-func (m *Manager) scheduleTasksWithPriority(priority TaskPriority) {
-	tasks, exists := m.priorityQueues[priority]
-	if !exists || len(tasks) == 0 {
-		return
-	}
-	
-	for _, task := range tasks {
-		// Check if all dependencies are completed
-		canSchedule := true
-		for _, depID := range task.DependsOn {
-			depTask, exists := m.tasks[depID]
-			if !exists || depTask.Status != TaskStatusCompleted {
-				canSchedule = false
-				break
-			}
-		}
-		
-		if canSchedule {
-			go func(t *Task) {
-				m.pendingChan <- t
-			}(task)
-			
-			// Remove the task from the priority queue
-			m.priorityQueues[priority] = removeTask(m.priorityQueues[priority], task.ID)
-		}
-	}
-}
-
-// removeTask removes a task from a slice of tasks
-func removeTask(tasks []*Task, id uint32) []*Task {
-	for i, task := range tasks {
-		if task.ID == id {
-			// Remove the task by replacing it with the last element and truncating
-			tasks[i] = tasks[len(tasks)-1]
-			return tasks[:len(tasks)-1]
-		}
-	}
-	return tasks
-}
@@ -0,0 +1,173 @@
+package task
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"dinoc2/pkg/store"
+)
+
+func TestManagerRestoresTasks(t *testing.T) {
+	s := store.NewMemoryStore()
+
+	m := NewManager()
+	if err := m.SetStore(s); err != nil {
+		t.Fatalf("Failed to set store: %v", err)
+	}
+
+	completed, err := m.CreateTask(TaskTypeCommand, "client-1", []byte("whoami"), TaskPriorityNormal, nil)
+	if err != nil {
+		t.Fatalf("Failed to create task: %v", err)
+	}
+	if err := m.UpdateTaskStatus(completed.ID, TaskStatusCompleted, []byte("root"), ""); err != nil {
+		t.Fatalf("Failed to update task: %v", err)
+	}
+
+	running, err := m.CreateTask(TaskTypeCommand, "client-1", []byte("sleep 60"), TaskPriorityNormal, nil)
+	if err != nil {
+		t.Fatalf("Failed to create task: %v", err)
+	}
+	if err := m.UpdateTaskStatus(running.ID, TaskStatusRunning, nil, ""); err != nil {
+		t.Fatalf("Failed to update task: %v", err)
+	}
+
+	// A new manager stands in for a restarted server
+	restored := NewManager()
+	if err := restored.SetStore(s); err != nil {
+		t.Fatalf("Failed to restore tasks: %v", err)
+	}
+
+	task, err := restored.GetTask(completed.ID)
+	if err != nil {
+		t.Fatalf("Completed task was not restored: %v", err)
+	}
+	if task.Status != TaskStatusCompleted || string(task.Result) != "root" {
+		t.Errorf("Completed task restored as %s with result %q", task.Status, task.Result)
+	}
+
+	task, err = restored.GetTask(running.ID)
+	if err != nil {
+		t.Fatalf("Running task was not restored: %v", err)
+	}
+	if task.Status != TaskStatusFailed {
+		t.Errorf("Expected interrupted task to be failed, got %s", task.Status)
+	}
+
+	next, err := restored.CreateTask(TaskTypeCommand, "client-1", nil, TaskPriorityNormal, nil)
+	if err != nil {
+		t.Fatalf("Failed to create task: %v", err)
+	}
+	if next.ID <= running.ID {
+		t.Errorf("Expected new task ID after %d, got %d", running.ID, next.ID)
+	}
+}
+
+func TestManagerRevalidatesRestoredTasks(t *testing.T) {
+	s := store.NewMemoryStore()
+
+	m := NewManager()
+	if err := m.SetStore(s); err != nil {
+		t.Fatalf("Failed to set store: %v", err)
+	}
+	allowed, err := m.CreateTask(TaskTypeCommand, "client-1", []byte("whoami"), TaskPriorityNormal, nil)
+	if err != nil {
+		t.Fatalf("Failed to create task: %v", err)
+	}
+	quarantined, err := m.CreateTask(TaskTypeCommand, "client-2", []byte("whoami"), TaskPriorityNormal, nil)
+	if err != nil {
+		t.Fatalf("Failed to create task: %v", err)
+	}
+
+	// After the restart, client-2 is no longer allowed to be tasked
+	restored := NewManager()
+	restored.AddValidator(func(task *Task) error {
+		if task.ClientID == "client-2" {
+			return errors.New("client is quarantined")
+		}
+		return nil
+	})
+	if err := restored.SetStore(s); err != nil {
+		t.Fatalf("Failed to restore tasks: %v", err)
+	}
+
+	task, _ := restored.GetTask(quarantined.ID)
+	if task.Status != TaskStatusCancelled || !strings.Contains(task.Error, "client is quarantined") {
+		t.Errorf("Expected the refused task to be cancelled with the reason, got %s (%q)", task.Status, task.Error)
+	}
+
+	// Only the allowed task is queued
+	stats := restored.QueueStats()
+	if stats.Queued != 1 || stats.ByClient["client-1"] != 1 {
+		t.Errorf("Expected only the allowed task to be queued, got %+v", stats)
+	}
+	if task := restored.GetPendingTask(); task.ID != allowed.ID {
+		t.Errorf("Expected task %d to be dispatched, got %d", allowed.ID, task.ID)
+	}
+}
+
+func TestManagerCancelsTasks(t *testing.T) {
+	m := NewManager()
+
+	task, err := m.CreateTask(TaskTypeCommand, "client-1", []byte("whoami"), TaskPriorityNormal, nil)
+	if err != nil {
+		t.Fatalf("Failed to create task: %v", err)
+	}
+	if _, err := m.CancelTask(task.ID, "operator changed plans"); err != nil {
+		t.Fatalf("Failed to cancel task: %v", err)
+	}
+	if task.Status != TaskStatusCancelled || task.Error != "operator changed plans" {
+		t.Errorf("Expected cancelled task, got %s (%q)", task.Status, task.Error)
+	}
+
+	// A late result does not overwrite the cancellation
+	if err := m.UpdateTaskStatus(task.ID, TaskStatusCompleted, []byte("root"), ""); err != ErrTaskFinished {
+		t.Errorf("Expected ErrTaskFinished, got %v", err)
+	}
+	if _, err := m.CancelTask(task.ID, ""); err != ErrTaskFinished {
+		t.Errorf("Expected ErrTaskFinished, got %v", err)
+	}
+	if _, err := m.CancelTask(42, ""); err != ErrTaskNotFound {
+		t.Errorf("Expected ErrTaskNotFound, got %v", err)
+	}
+}
+
+func TestManagerTimesOutAndRetriesTasks(t *testing.T) {
+	m := NewManager()
+	m.SetTypeTimeout(TaskTypeCommand, 20*time.Millisecond)
+
+	task, err := m.CreateTaskWithOptions(TaskTypeCommand, "client-1", []byte("whoami"), TaskPriorityNormal, nil,
+		TaskOptions{Retry: RetryPolicy{MaxAttempts: 2, Backoff: 10 * time.Millisecond}})
+	if err != nil {
+		t.Fatalf("Failed to create task: %v", err)
+	}
+	if task.Timeout != 20*time.Millisecond {
+		t.Errorf("Expected the type's timeout, got %s", task.Timeout)
+	}
+
+	// Both attempts time out, and the task stays timed out after the last one
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		m.mutex.RLock()
+		status, attempt := task.Status, task.Attempt
+		m.mutex.RUnlock()
+
+		if status == TaskStatusTimedOut && attempt == 2 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("Expected the second attempt to time out, got %s on attempt %d", status, attempt)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestRetryPolicyBackoff(t *testing.T) {
+	policy := RetryPolicy{MaxAttempts: 5, Backoff: time.Second, MaxBackoff: 3 * time.Second}
+	for attempt, expected := range map[int]time.Duration{2: time.Second, 3: 2 * time.Second, 4: 3 * time.Second, 5: 3 * time.Second} {
+		if delay := policy.delay(attempt); delay != expected {
+			t.Errorf("Attempt %d: expected %s, got %s", attempt, expected, delay)
+		}
+	}
+}
@@ -0,0 +1,488 @@
+package task
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"dinoc2/pkg/events"
+)
+
+// runCollection is the store collection that holds playbook runs
+const runCollection = "playbook_runs"
+
+// Ways a playbook step can handle failure
+const (
+	OnFailureAbort    = "abort"    // cancel the remaining steps and fail the run
+	OnFailureContinue = "continue" // run the steps that depend on it anyway
+)
+
+var (
+	// ErrInvalidPlaybook is returned when a playbook cannot be expanded into tasks
+	ErrInvalidPlaybook = errors.New("invalid playbook")
+
+	// ErrRunNotFound is returned when a playbook run does not exist
+	ErrRunNotFound = errors.New("playbook run not found")
+
+	// ErrRunFinished is returned when cancelling a playbook run that has already finished
+	ErrRunFinished = errors.New("playbook run has already finished")
+)
+
+// paramPattern matches the {{name}} placeholders in the data of a playbook step
+var paramPattern = regexp.MustCompile(`\{\{\s*([A-Za-z0-9_]+)\s*\}\}`)
+
+// Playbook is a repeatable procedure: a DAG of steps that is expanded into
+// dependent tasks for one client each time it is run
+type Playbook struct {
+	Name        string            `json:"name"`
+	Description string            `json:"description,omitempty"`
+	Params      map[string]string `json:"params,omitempty"` // default parameter values
+	Steps       []PlaybookStep    `json:"steps"`
+}
+
+// PlaybookStep is one task of a playbook
+type PlaybookStep struct {
+	ID           string         `json:"id"`
+	Type         TaskType       `json:"type"`
+	Data         string         `json:"data,omitempty"` // {{name}} is replaced with the parameter's value
+	Priority     TaskPriority   `json:"priority,omitempty"`
+	DependsOn    []string       `json:"depends_on,omitempty"`
+	When         *StepCondition `json:"when,omitempty"`
+	OnFailure    string         `json:"on_failure,omitempty"`    // abort (the default) or continue
+	Timeout      int            `json:"timeout,omitempty"`       // in seconds
+	MaxAttempts  int            `json:"max_attempts,omitempty"`  // total number of attempts
+	RetryBackoff int            `json:"retry_backoff,omitempty"` // in seconds
+}
+
+// StepCondition decides whether a step runs, based on the outcome of an earlier step
+type StepCondition struct {
+	Step     string     `json:"step"`
+	Status   TaskStatus `json:"status,omitempty"`   // defaults to completed
+	Contains string     `json:"contains,omitempty"` // text the step's result must contain
+	Negate   bool       `json:"negate,omitempty"`   // run the step if the condition does not hold
+}
+
+// Condition decides whether a task runs once its dependencies have finished
+type Condition struct {
+	TaskID   uint32
+	Status   TaskStatus
+	Contains string
+	Negate   bool
+}
+
+// RunStatus represents the status of a playbook run
+type RunStatus string
+
+const (
+	RunStatusRunning   RunStatus = "running"
+	RunStatusCompleted RunStatus = "completed"
+	RunStatusFailed    RunStatus = "failed"
+	RunStatusCancelled RunStatus = "cancelled"
+)
+
+// PlaybookRun tracks the tasks of one run of a playbook as a unit
+type PlaybookRun struct {
+	ID          uint32            `json:"id"`
+	Playbook    string            `json:"playbook"`
+	ClientID    string            `json:"client_id"`
+	CreatedBy   string            `json:"created_by,omitempty"`
+	Params      map[string]string `json:"params,omitempty"`
+	Status      RunStatus         `json:"status"`
+	Error       string            `json:"error,omitempty"`
+	Steps       []RunStep         `json:"steps"`
+	Finished    int               `json:"finished"` // steps that have finished
+	CreatedAt   time.Time         `json:"created_at"`
+	CompletedAt time.Time         `json:"completed_at,omitempty"`
+}
+
+// RunStep is the task a playbook step was expanded into
+type RunStep struct {
+	Step   string     `json:"step"`
+	TaskID uint32     `json:"task_id"`
+	Status TaskStatus `json:"status"`
+}
+
+// RunPlaybook expands a playbook into dependent tasks for a client and starts
+// them on behalf of an operator. Params override the playbook's default
+// parameter values. The playbook is refused as a whole if any of its tasks is refused.
+func (m *Manager) RunPlaybook(playbook Playbook, clientID string, params map[string]string, createdBy string) (*PlaybookRun, error) {
+	order, err := playbook.sortSteps()
+	if err != nil {
+		return nil, err
+	}
+
+	values := make(map[string]string, len(playbook.Params)+len(params))
+	for name, value := range playbook.Params {
+		values[name] = value
+	}
+	for name, value := range params {
+		values[name] = value
+	}
+
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	// Build every task before accepting any, so a refused step refuses the playbook
+	tasks := make([]*Task, len(order))
+	for i, step := range order {
+		data, err := expandParams(step.Data, values)
+		if err != nil {
+			return nil, fmt.Errorf("%w: step %s: %v", ErrInvalidPlaybook, step.ID, err)
+		}
+		options := TaskOptions{
+			Timeout: time.Duration(step.Timeout) * time.Second,
+			Retry: RetryPolicy{
+				MaxAttempts: step.MaxAttempts,
+				Backoff:     time.Duration(step.RetryBackoff) * time.Second,
+			},
+			CreatedBy: createdBy,
+		}
+		task, err := m.newTask(step.Type, clientID, []byte(data), step.Priority, nil, options)
+		if err != nil {
+			return nil, fmt.Errorf("step %s: %w", step.ID, err)
+		}
+		task.Step = step.ID
+		task.ContinueOnFailure = step.OnFailure == OnFailureContinue
+		tasks[i] = task
+	}
+	if err := m.scheduler.admit(clientID); err != nil {
+		return nil, err
+	}
+
+	run := &PlaybookRun{
+		ID:        m.nextRunID,
+		Playbook:  playbook.Name,
+		ClientID:  clientID,
+		CreatedBy: createdBy,
+		Params:    params,
+		Status:    RunStatusRunning,
+		CreatedAt: time.Now(),
+	}
+	m.nextRunID++
+
+	// Steps come in dependency order, so the tasks of a step's dependencies already have IDs
+	taskIDs := make(map[string]uint32, len(order))
+	for i, step := range order {
+		task := tasks[i]
+		task.Playbook = run.ID
+		for _, dep := range step.DependsOn {
+			task.DependsOn = append(task.DependsOn, taskIDs[dep])
+		}
+		if step.When != nil {
+			task.Condition = &Condition{
+				TaskID:   taskIDs[step.When.Step],
+				Status:   step.When.Status,
+				Contains: step.When.Contains,
+				Negate:   step.When.Negate,
+			}
+			task.DependsOn = appendMissing(task.DependsOn, task.Condition.TaskID)
+		}
+
+		if err := m.addTask(task); err != nil {
+			m.discardTasks(tasks[:i])
+			return nil, err
+		}
+		taskIDs[step.ID] = task.ID
+		run.Steps = append(run.Steps, RunStep{Step: step.ID, TaskID: task.ID})
+	}
+
+	// The run is only added once all of its tasks have been accepted
+	if err := m.persistRun(run); err != nil {
+		m.discardTasks(tasks)
+		return nil, err
+	}
+	m.runs[run.ID] = run
+	m.publishRun(run)
+	log.Printf("Started playbook %s as run %d with %d steps for client %s", playbook.Name, run.ID, len(run.Steps), clientID)
+
+	// Start the steps without dependencies once the run knows all of its tasks;
+	// the others start as the steps they depend on finish
+	for _, task := range tasks {
+		if len(task.DependsOn) == 0 {
+			m.release(task)
+		}
+	}
+	return m.snapshotRun(run), nil
+}
+
+// GetPlaybookRun returns a playbook run with the current status of its steps
+func (m *Manager) GetPlaybookRun(id uint32) (*PlaybookRun, error) {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+
+	run, exists := m.runs[id]
+	if !exists {
+		return nil, ErrRunNotFound
+	}
+	return m.snapshotRun(run), nil
+}
+
+// ListPlaybookRuns returns all playbook runs, oldest first
+func (m *Manager) ListPlaybookRuns() []*PlaybookRun {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+
+	runs := make([]*PlaybookRun, 0, len(m.runs))
+	for _, run := range m.runs {
+		runs = append(runs, m.snapshotRun(run))
+	}
+	sort.Slice(runs, func(i, j int) bool { return runs[i].ID < runs[j].ID })
+	return runs
+}
+
+// CancelPlaybookRun cancels the steps of a playbook run that have not finished
+func (m *Manager) CancelPlaybookRun(id uint32) (*PlaybookRun, error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	run, exists := m.runs[id]
+	if !exists {
+		return nil, ErrRunNotFound
+	}
+	if run.Status != RunStatusRunning {
+		return nil, ErrRunFinished
+	}
+
+	run.Status = RunStatusCancelled
+	m.cancelRemainingSteps(run, "playbook run cancelled")
+	if err := m.finishRun(run); err != nil {
+		return nil, err
+	}
+	return m.snapshotRun(run), nil
+}
+
+// sortSteps validates a playbook and returns its steps so that every step
+// comes after the steps it depends on
+func (p Playbook) sortSteps() ([]PlaybookStep, error) {
+	if p.Name == "" {
+		return nil, fmt.Errorf("%w: name is required", ErrInvalidPlaybook)
+	}
+	if len(p.Steps) == 0 {
+		return nil, fmt.Errorf("%w: at least one step is required", ErrInvalidPlaybook)
+	}
+
+	steps := make(map[string]PlaybookStep, len(p.Steps))
+	for _, step := range p.Steps {
+		if step.ID == "" {
+			return nil, fmt.Errorf("%w: every step needs an id", ErrInvalidPlaybook)
+		}
+		if _, exists := steps[step.ID]; exists {
+			return nil, fmt.Errorf("%w: duplicate step %s", ErrInvalidPlaybook, step.ID)
+		}
+		if step.Type == "" {
+			return nil, fmt.Errorf("%w: step %s has no type", ErrInvalidPlaybook, step.ID)
+		}
+		if step.OnFailure != "" && step.OnFailure != OnFailureAbort && step.OnFailure != OnFailureContinue {
+			return nil, fmt.Errorf("%w: step %s: on_failure must be %s or %s", ErrInvalidPlaybook, step.ID, OnFailureAbort, OnFailureContinue)
+		}
+		steps[step.ID] = step
+	}
+
+	// Depth-first search, rejecting dependencies on unknown steps and cycles
+	const (
+		visiting = 1
+		visited  = 2
+	)
+	state := make(map[string]int, len(p.Steps))
+	order := make([]PlaybookStep, 0, len(p.Steps))
+	var visit func(id, from string) error
+	visit = func(id, from string) error {
+		step, exists := steps[id]
+		if !exists {
+			return fmt.Errorf("%w: step %s depends on unknown step %s", ErrInvalidPlaybook, from, id)
+		}
+		switch state[id] {
+		case visiting:
+			return fmt.Errorf("%w: steps %s and %s depend on each other", ErrInvalidPlaybook, from, id)
+		case visited:
+			return nil
+		}
+
+		state[id] = visiting
+		for _, dep := range step.dependencies() {
+			if err := visit(dep, id); err != nil {
+				return err
+			}
+		}
+		state[id] = visited
+		order = append(order, step)
+		return nil
+	}
+	for _, step := range p.Steps {
+		if err := visit(step.ID, step.ID); err != nil {
+			return nil, err
+		}
+	}
+	return order, nil
+}
+
+// dependencies returns the steps that must finish before a step can start,
+// including the step its condition refers to
+func (s PlaybookStep) dependencies() []string {
+	if s.When == nil {
+		return s.DependsOn
+	}
+	return append(append([]string(nil), s.DependsOn...), s.When.Step)
+}
+
+// expandParams replaces the {{name}} placeholders in step data
+func expandParams(data string, values map[string]string) (string, error) {
+	var missing []string
+	expanded := paramPattern.ReplaceAllStringFunc(data, func(placeholder string) string {
+		name := paramPattern.FindStringSubmatch(placeholder)[1]
+		value, exists := values[name]
+		if !exists {
+			missing = append(missing, name)
+		}
+		return value
+	})
+	if len(missing) > 0 {
+		return "", fmt.Errorf("missing parameter %s", strings.Join(missing, ", "))
+	}
+	return expanded, nil
+}
+
+// appendMissing adds an ID to a list unless it is already there
+func appendMissing(ids []uint32, id uint32) []uint32 {
+	for _, existing := range ids {
+		if existing == id {
+			return ids
+		}
+	}
+	return append(ids, id)
+}
+
+// conditionHolds reports whether a task's condition allows it to run. The caller must hold the mutex.
+func (m *Manager) conditionHolds(condition *Condition) bool {
+	status := condition.Status
+	if status == "" {
+		status = TaskStatusCompleted
+	}
+
+	holds := false
+	if task, exists := m.tasks[condition.TaskID]; exists {
+		holds = task.Status == status && strings.Contains(string(task.Result), condition.Contains)
+	}
+	return holds != condition.Negate
+}
+
+// stepFinished updates the run of a playbook step that has reached its final
+// status, aborting the run if the step failed. The caller must hold the mutex.
+func (m *Manager) stepFinished(task *Task) {
+	run, exists := m.runs[task.Playbook]
+	if !exists || run.Status != RunStatusRunning {
+		return
+	}
+
+	switch task.Status {
+	case TaskStatusFailed, TaskStatusTimedOut, TaskStatusCancelled:
+		if !task.ContinueOnFailure {
+			run.Status = RunStatusFailed
+			run.Error = fmt.Sprintf("step %s %s", task.Step, task.Status)
+			if task.Error != "" {
+				run.Error += ": " + task.Error
+			}
+			m.cancelRemainingSteps(run, "playbook aborted: "+run.Error)
+		}
+	}
+
+	for _, step := range run.Steps {
+		if step, exists := m.tasks[step.TaskID]; exists && !step.Finished() {
+			return
+		}
+	}
+	if run.Status == RunStatusRunning {
+		run.Status = RunStatusCompleted
+	}
+	if err := m.finishRun(run); err != nil {
+		log.Printf("Failed to persist playbook run %d: %v", run.ID, err)
+	}
+}
+
+// cancelRemainingSteps cancels the tasks of a run that have not finished. The caller must hold the mutex.
+func (m *Manager) cancelRemainingSteps(run *PlaybookRun, reason string) {
+	for _, step := range run.Steps {
+		task, exists := m.tasks[step.TaskID]
+		if !exists || task.Finished() {
+			continue
+		}
+
+		previousStatus := task.Status
+		task.Status = TaskStatusCancelled
+		m.finish(task, nil, reason)
+		if err := m.persist(task); err != nil {
+			log.Printf("Failed to persist task %d: %v", task.ID, err)
+		}
+		m.publishStatus(task, previousStatus)
+	}
+}
+
+// finishRun records that a run has finished. The caller must hold the mutex.
+func (m *Manager) finishRun(run *PlaybookRun) error {
+	run.CompletedAt = time.Now()
+	log.Printf("Playbook run %d (%s) %s", run.ID, run.Playbook, run.Status)
+
+	if err := m.persistRun(run); err != nil {
+		return err
+	}
+	m.publishRun(run)
+	return nil
+}
+
+// snapshotRun returns a copy of a run with the current status of its steps. The caller must hold the mutex.
+func (m *Manager) snapshotRun(run *PlaybookRun) *PlaybookRun {
+	snapshot := *run
+	snapshot.Steps = make([]RunStep, len(run.Steps))
+	snapshot.Finished = 0
+	for i, step := range run.Steps {
+		if task, exists := m.tasks[step.TaskID]; exists {
+			step.Status = task.Status
+			if task.Finished() {
+				snapshot.Finished++
+			}
+		}
+		snapshot.Steps[i] = step
+	}
+	return &snapshot
+}
+
+// publishRun publishes the status of a playbook run. The caller must hold the mutex.
+func (m *Manager) publishRun(run *PlaybookRun) {
+	m.events.Publish(events.TypePlaybookStatus, events.PlaybookEvent{
+		RunID:    run.ID,
+		Playbook: run.Playbook,
+		ClientID: run.ClientID,
+		Status:   string(run.Status),
+		Error:    run.Error,
+	})
+}
+
+// discardTasks removes the tasks of a playbook run that could not be started,
+// which have not been released yet. The caller must hold the mutex.
+func (m *Manager) discardTasks(tasks []*Task) {
+	for _, task := range tasks {
+		delete(m.tasks, task.ID)
+		if m.store == nil {
+			continue
+		}
+		if err := m.store.Delete(taskCollection, strconv.FormatUint(uint64(task.ID), 10)); err != nil {
+			log.Printf("Failed to delete task %d of a playbook that could not be started: %v", task.ID, err)
+		}
+	}
+}
+
+// persistRun writes a playbook run to the store, if one is set. The caller must hold the mutex.
+func (m *Manager) persistRun(run *PlaybookRun) error {
+	if m.store == nil {
+		return nil
+	}
+	if err := m.store.Put(runCollection, strconv.FormatUint(uint64(run.ID), 10), run); err != nil {
+		return fmt.Errorf("failed to persist playbook run %d: %w", run.ID, err)
+	}
+	return nil
+}
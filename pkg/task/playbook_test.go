@@ -0,0 +1,168 @@
+package task
+
+import (
+	"errors"
+	"testing"
+
+	"dinoc2/pkg/store"
+)
+
+// failingStore fails every write once it has accepted a number of them
+type failingStore struct {
+	store.Store
+	writes int
+}
+
+func (s *failingStore) Put(collection, key string, value interface{}) error {
+	if s.writes == 0 {
+		return errors.New("disk full")
+	}
+	s.writes--
+	return s.Store.Put(collection, key, value)
+}
+
+// runSteps maps the step IDs of a run to their tasks
+func runSteps(t *testing.T, m *Manager, run *PlaybookRun) map[string]*Task {
+	steps := make(map[string]*Task)
+	for _, step := range run.Steps {
+		task, err := m.GetTask(step.TaskID)
+		if err != nil {
+			t.Fatalf("Failed to get task of step %s: %v", step.Step, err)
+		}
+		steps[step.Step] = task
+	}
+	return steps
+}
+
+func TestPlaybookRun(t *testing.T) {
+	m := NewManager()
+	if err := m.SetStore(store.NewMemoryStore()); err != nil {
+		t.Fatalf("Failed to set store: %v", err)
+	}
+
+	playbook := Playbook{
+		Name:   "recon",
+		Params: map[string]string{"dir": "/tmp"},
+		Steps: []PlaybookStep{
+			{ID: "cleanup", Type: TaskTypeCommand, Data: "rm -rf {{dir}}/out", DependsOn: []string{"report"}},
+			{ID: "whoami", Type: TaskTypeCommand, Data: "whoami"},
+			{ID: "sudo", Type: TaskTypeCommand, Data: "sudo -l", DependsOn: []string{"whoami"}, OnFailure: OnFailureContinue},
+			{ID: "root", Type: TaskTypeCommand, Data: "id", When: &StepCondition{Step: "whoami", Contains: "root"}},
+			{ID: "report", Type: TaskTypeCommand, Data: "ls {{ dir }}", DependsOn: []string{"sudo", "root"}},
+		},
+	}
+	run, err := m.RunPlaybook(playbook, "client1", map[string]string{"dir": "/var/tmp"}, "")
+	if err != nil {
+		t.Fatalf("Failed to run playbook: %v", err)
+	}
+	steps := runSteps(t, m, run)
+
+	if got := string(steps["cleanup"].Data); got != "rm -rf /var/tmp/out" {
+		t.Errorf("Expected parameters to be replaced, got %q", got)
+	}
+	if steps["sudo"].Status != TaskStatusPending || len(steps["sudo"].DependsOn) != 1 {
+		t.Fatalf("Expected sudo to wait for whoami, got %+v", steps["sudo"])
+	}
+
+	// whoami does not return root, so the root step is skipped, and the failed
+	// sudo step lets the report run anyway
+	m.UpdateTaskStatus(steps["whoami"].ID, TaskStatusCompleted, []byte("alice"), "")
+	if steps["root"].Status != TaskStatusSkipped {
+		t.Errorf("Expected root to be skipped, got %s", steps["root"].Status)
+	}
+	m.UpdateTaskStatus(steps["sudo"].ID, TaskStatusFailed, nil, "not allowed")
+	if steps["report"].Status != TaskStatusPending || m.QueueStats().ByClient["client1"] != 1 {
+		t.Errorf("Expected report to be queued, got %s", steps["report"].Status)
+	}
+	m.UpdateTaskStatus(steps["report"].ID, TaskStatusCompleted, nil, "")
+	m.UpdateTaskStatus(steps["cleanup"].ID, TaskStatusCompleted, nil, "")
+
+	run, _ = m.GetPlaybookRun(run.ID)
+	if run.Status != RunStatusCompleted || run.Finished != 5 {
+		t.Errorf("Expected the run to complete, got %s with %d steps finished", run.Status, run.Finished)
+	}
+
+	// A failed step aborts the run and cancels the steps that have not run
+	run, _ = m.RunPlaybook(playbook, "client1", nil, "")
+	steps = runSteps(t, m, run)
+	m.UpdateTaskStatus(steps["whoami"].ID, TaskStatusFailed, nil, "lost")
+
+	run, _ = m.GetPlaybookRun(run.ID)
+	if run.Status != RunStatusFailed || run.Error != "step whoami failed: lost" {
+		t.Errorf("Expected the run to fail, got %s (%s)", run.Status, run.Error)
+	}
+	if steps["report"].Status != TaskStatusCancelled {
+		t.Errorf("Expected the remaining steps to be cancelled, got %s", steps["report"].Status)
+	}
+}
+
+func TestPlaybookValidation(t *testing.T) {
+	m := NewManager()
+
+	invalid := []Playbook{
+		{Name: "empty"},
+		{Name: "cycle", Steps: []PlaybookStep{
+			{ID: "a", Type: TaskTypeCommand, DependsOn: []string{"b"}},
+			{ID: "b", Type: TaskTypeCommand, DependsOn: []string{"a"}},
+		}},
+		{Name: "unknown", Steps: []PlaybookStep{{ID: "a", Type: TaskTypeCommand, DependsOn: []string{"missing"}}}},
+		{Name: "param", Steps: []PlaybookStep{{ID: "a", Type: TaskTypeCommand, Data: "cat {{file}}"}}},
+	}
+	for _, playbook := range invalid {
+		if _, err := m.RunPlaybook(playbook, "client1", nil, ""); !errors.Is(err, ErrInvalidPlaybook) {
+			t.Errorf("Playbook %s: expected ErrInvalidPlaybook, got %v", playbook.Name, err)
+		}
+	}
+
+	// A step refused by a validator refuses the whole playbook
+	m.AddValidator(func(task *Task) error {
+		if string(task.Data) == "forbidden" {
+			return errors.New("not allowed")
+		}
+		return nil
+	})
+	playbook := Playbook{Name: "refused", Steps: []PlaybookStep{
+		{ID: "a", Type: TaskTypeCommand, Data: "allowed"},
+		{ID: "b", Type: TaskTypeCommand, Data: "forbidden", DependsOn: []string{"a"}},
+	}}
+	if _, err := m.RunPlaybook(playbook, "client1", nil, ""); !errors.Is(err, ErrTaskRefused) {
+		t.Errorf("Expected ErrTaskRefused, got %v", err)
+	}
+	if tasks := m.ListTasks(); len(tasks) != 0 {
+		t.Errorf("Expected no tasks to be created, got %d", len(tasks))
+	}
+}
+
+func TestPlaybookRunRollsBackWhenATaskIsNotAccepted(t *testing.T) {
+	s := &failingStore{Store: store.NewMemoryStore(), writes: 2}
+	m := NewManager()
+	if err := m.SetStore(s); err != nil {
+		t.Fatalf("Failed to set store: %v", err)
+	}
+
+	playbook := Playbook{
+		Name: "recon",
+		Steps: []PlaybookStep{
+			{ID: "whoami", Type: TaskTypeCommand, Data: "whoami"},
+			{ID: "id", Type: TaskTypeCommand, Data: "id", DependsOn: []string{"whoami"}},
+			{ID: "ls", Type: TaskTypeCommand, Data: "ls", DependsOn: []string{"id"}},
+		},
+	}
+
+	// The third task cannot be written, so neither the run nor the tasks accepted before it are kept
+	if _, err := m.RunPlaybook(playbook, "client1", nil, ""); err == nil {
+		t.Fatal("Expected the playbook to be refused when a task cannot be written")
+	}
+	if runs := m.ListPlaybookRuns(); len(runs) != 0 {
+		t.Errorf("Expected no playbook run, got %d", len(runs))
+	}
+	if tasks := m.ListTasks(); len(tasks) != 0 {
+		t.Errorf("Expected no tasks, got %d", len(tasks))
+	}
+	if records, _ := s.List(taskCollection); len(records) != 0 {
+		t.Errorf("Expected no task records, got %d", len(records))
+	}
+	if stats := m.QueueStats(); stats.ByClient["client1"] != 0 {
+		t.Errorf("Expected no queued tasks, got %d", stats.ByClient["client1"])
+	}
+}
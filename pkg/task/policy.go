@@ -0,0 +1,205 @@
+package task
+
+import (
+	"fmt"
+	"log"
+	"time"
+)
+
+// RetryPolicy describes how often a failed or timed out task is attempted
+// again, and how long to wait between attempts
+type RetryPolicy struct {
+	MaxAttempts int           // total number of attempts, 0 or 1 for no retries
+	Backoff     time.Duration // wait before the second attempt, doubled for each later one
+	MaxBackoff  time.Duration // upper limit of the wait, 0 for no limit
+}
+
+// TaskOptions holds the optional settings of a new task
+type TaskOptions struct {
+	Timeout   time.Duration // 0 to use the timeout of the task's type
+	Retry     RetryPolicy
+	CreatedBy string // operator who creates the task
+}
+
+// delay returns how long to wait before the given attempt
+func (p RetryPolicy) delay(attempt int) time.Duration {
+	delay := p.Backoff
+	for i := 2; i < attempt; i++ {
+		delay *= 2
+		if p.MaxBackoff > 0 && delay >= p.MaxBackoff {
+			break
+		}
+	}
+	if p.MaxBackoff > 0 && delay > p.MaxBackoff {
+		delay = p.MaxBackoff
+	}
+	return delay
+}
+
+// SetDefaultTimeout sets the timeout of tasks whose type has no timeout of its own
+func (m *Manager) SetDefaultTimeout(timeout time.Duration) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	m.defaultTimeout = timeout
+}
+
+// SetTypeTimeout sets the timeout of tasks of a type that do not set their own
+func (m *Manager) SetTypeTimeout(taskType TaskType, timeout time.Duration) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	m.typeTimeouts[taskType] = timeout
+}
+
+// timeoutFor returns the timeout of a task type. The caller must hold the mutex.
+func (m *Manager) timeoutFor(taskType TaskType) time.Duration {
+	if timeout, exists := m.typeTimeouts[taskType]; exists {
+		return timeout
+	}
+	return m.defaultTimeout
+}
+
+// CancelTask cancels a pending or running task. A task that is running on a
+// client is not interrupted there, but its result is dropped.
+func (m *Manager) CancelTask(id uint32, reason string) (*Task, error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	task, exists := m.tasks[id]
+	if !exists {
+		return nil, ErrTaskNotFound
+	}
+	if task.Finished() {
+		return nil, ErrTaskFinished
+	}
+
+	if reason == "" {
+		reason = "cancelled"
+	}
+
+	// Cancelling a bulk task cancels its children, which finishes it
+	if len(task.Children) > 0 {
+		if err := m.cancelChildren(task, reason); err != nil {
+			return nil, err
+		}
+		return task, nil
+	}
+
+	previousStatus := task.Status
+	task.Status = TaskStatusCancelled
+	m.finish(task, nil, reason)
+
+	if err := m.persist(task); err != nil {
+		return nil, err
+	}
+	m.publishStatus(task, previousStatus)
+	m.settle(task)
+	return task, nil
+}
+
+// enqueue makes a task available to GetPendingTask and starts the timeout of
+// its current attempt. The caller must hold the mutex.
+func (m *Manager) enqueue(task *Task) {
+	if task.Timeout > 0 {
+		if task.Deadline.IsZero() {
+			task.Deadline = time.Now().Add(task.Timeout)
+			if err := m.persist(task); err != nil {
+				log.Printf("Failed to persist task %d: %v", task.ID, err)
+			}
+		}
+
+		id, attempt := task.ID, task.Attempt
+		m.setTimer(id, time.AfterFunc(time.Until(task.Deadline), func() {
+			m.expire(id, attempt)
+		}))
+	}
+
+	m.scheduler.push(task)
+}
+
+// expire times out an attempt that has not finished by its deadline
+func (m *Manager) expire(id uint32, attempt int) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	task, exists := m.tasks[id]
+	if !exists || task.Attempt != attempt || task.Finished() {
+		return
+	}
+
+	previousStatus := task.Status
+	task.Status = TaskStatusTimedOut
+	m.finish(task, nil, fmt.Sprintf("timed out after %s", task.Timeout))
+
+	if err := m.persist(task); err != nil {
+		log.Printf("Failed to persist task %d: %v", task.ID, err)
+	}
+	m.publishStatus(task, previousStatus)
+
+	if m.shouldRetry(task) {
+		if err := m.scheduleRetry(task); err != nil {
+			log.Printf("Failed to retry task %d: %v", task.ID, err)
+		}
+		return
+	}
+	m.settle(task)
+}
+
+// shouldRetry reports whether a finished attempt is retried. The caller must hold the mutex.
+func (m *Manager) shouldRetry(task *Task) bool {
+	return (task.Status == TaskStatusFailed || task.Status == TaskStatusTimedOut) &&
+		task.Attempt < task.Retry.MaxAttempts
+}
+
+// scheduleRetry returns a failed task to pending and queues it again once its
+// backoff has passed. The caller must hold the mutex.
+func (m *Manager) scheduleRetry(task *Task) error {
+	previousStatus := task.Status
+	task.Attempt++
+	task.Status = TaskStatusPending
+	task.NextAttemptAt = time.Now().Add(task.Retry.delay(task.Attempt))
+	task.Deadline = time.Time{}
+	task.StartedAt = time.Time{}
+	task.CompletedAt = time.Time{}
+
+	if err := m.persist(task); err != nil {
+		return err
+	}
+	m.publishStatus(task, previousStatus)
+
+	log.Printf("Retrying task %d (attempt %d of %d) at %s", task.ID, task.Attempt, task.Retry.MaxAttempts,
+		task.NextAttemptAt.Format(time.RFC3339))
+	m.armRetry(task)
+	return nil
+}
+
+// armRetry queues a task waiting to be retried once its backoff has passed. The caller must hold the mutex.
+func (m *Manager) armRetry(task *Task) {
+	id, attempt := task.ID, task.Attempt
+	m.setTimer(id, time.AfterFunc(time.Until(task.NextAttemptAt), func() {
+		m.mutex.Lock()
+		defer m.mutex.Unlock()
+
+		task, exists := m.tasks[id]
+		if !exists || task.Attempt != attempt || task.Status != TaskStatusPending {
+			return
+		}
+		task.NextAttemptAt = time.Time{}
+		m.enqueue(task)
+	}))
+}
+
+// setTimer replaces the timer of a task. The caller must hold the mutex.
+func (m *Manager) setTimer(id uint32, timer *time.Timer) {
+	m.stopTimer(id)
+	m.timers[id] = timer
+}
+
+// stopTimer stops the timer of a task, if it has one. The caller must hold the mutex.
+func (m *Manager) stopTimer(id uint32) {
+	if timer, exists := m.timers[id]; exists {
+		timer.Stop()
+		delete(m.timers, id)
+	}
+}
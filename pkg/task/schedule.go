@@ -0,0 +1,322 @@
+package task
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"sort"
+	"strconv"
+	"time"
+)
+
+// scheduleCollection is the store collection that holds schedules
+const scheduleCollection = "schedules"
+
+var (
+	// ErrInvalidSchedule is returned when a schedule cannot be created
+	ErrInvalidSchedule = errors.New("invalid schedule")
+
+	// ErrScheduleNotFound is returned when a schedule does not exist
+	ErrScheduleNotFound = errors.New("schedule not found")
+)
+
+// Schedule creates a task for a client at recurring times, either on a cron
+// expression or at a fixed interval
+type Schedule struct {
+	ID          uint32       `json:"id"`
+	Name        string       `json:"name,omitempty"`
+	ClientID    string       `json:"client_id"`
+	Type        TaskType     `json:"type"`
+	Data        string       `json:"data,omitempty"`
+	Priority    TaskPriority `json:"priority,omitempty"`
+	Timeout     int          `json:"timeout,omitempty"`  // in seconds, for each task
+	Cron        string       `json:"cron,omitempty"`     // minute hour day month weekday, or @daily and the like
+	Interval    int          `json:"interval,omitempty"` // in seconds, instead of a cron expression
+	Timezone    string       `json:"timezone,omitempty"` // that the cron expression is in, defaults to the server's
+	Paused      bool         `json:"paused"`
+	NextRun     time.Time    `json:"next_run,omitempty"`
+	LastRun     time.Time    `json:"last_run,omitempty"`
+	LastTaskID  uint32       `json:"last_task_id,omitempty"`
+	LastError   string       `json:"last_error,omitempty"` // why the last run did not create a task
+	Runs        int          `json:"runs"`                 // tasks created
+	SkippedRuns int          `json:"skipped_runs"`         // runs that did not create a task
+	CreatedBy   string       `json:"created_by,omitempty"` // operator the tasks are created on behalf of
+	CreatedAt   time.Time    `json:"created_at"`
+
+	cron     *cronSchedule
+	location *time.Location
+	timer    *time.Timer
+}
+
+// CreateSchedule validates a schedule, persists it and arms it for its first run
+func (m *Manager) CreateSchedule(schedule Schedule) (*Schedule, error) {
+	if err := schedule.prepare(); err != nil {
+		return nil, err
+	}
+	schedule.CreatedAt = time.Now()
+	schedule.NextRun = time.Time{}
+	schedule.LastRun = time.Time{}
+	schedule.LastTaskID = 0
+	schedule.LastError = ""
+	schedule.Runs = 0
+	schedule.SkippedRuns = 0
+
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	s := &schedule
+	s.ID = m.nextScheduleID
+	m.nextScheduleID++
+	if !s.Paused {
+		s.NextRun = s.next(s.CreatedAt)
+	}
+	if err := m.persistSchedule(s); err != nil {
+		return nil, err
+	}
+	m.schedules[s.ID] = s
+	m.armSchedule(s)
+
+	log.Printf("Created schedule %d for %s tasks on client %s, next run at %s", s.ID, s.Type, s.ClientID,
+		s.NextRun.Format(time.RFC3339))
+	return s.snapshot(), nil
+}
+
+// GetSchedule returns a copy of a schedule
+func (m *Manager) GetSchedule(id uint32) (*Schedule, error) {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+
+	s, exists := m.schedules[id]
+	if !exists {
+		return nil, ErrScheduleNotFound
+	}
+	return s.snapshot(), nil
+}
+
+// ListSchedules returns copies of all schedules, ordered by ID
+func (m *Manager) ListSchedules() []*Schedule {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+
+	schedules := make([]*Schedule, 0, len(m.schedules))
+	for _, s := range m.schedules {
+		schedules = append(schedules, s.snapshot())
+	}
+	sort.Slice(schedules, func(i, j int) bool {
+		return schedules[i].ID < schedules[j].ID
+	})
+	return schedules
+}
+
+// PauseSchedule stops a schedule from creating tasks until it is resumed
+func (m *Manager) PauseSchedule(id uint32) (*Schedule, error) {
+	return m.setSchedulePaused(id, true)
+}
+
+// ResumeSchedule lets a paused schedule create tasks again, starting with its
+// next run from now. Runs missed while it was paused are not made up.
+func (m *Manager) ResumeSchedule(id uint32) (*Schedule, error) {
+	return m.setSchedulePaused(id, false)
+}
+
+// setSchedulePaused pauses or resumes a schedule
+func (m *Manager) setSchedulePaused(id uint32, paused bool) (*Schedule, error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	s, exists := m.schedules[id]
+	if !exists {
+		return nil, ErrScheduleNotFound
+	}
+	if s.Paused == paused {
+		return s.snapshot(), nil
+	}
+
+	s.Paused = paused
+	s.NextRun = time.Time{}
+	if !paused {
+		s.NextRun = s.next(time.Now())
+	}
+	if err := m.persistSchedule(s); err != nil {
+		return nil, err
+	}
+	m.armSchedule(s)
+	return s.snapshot(), nil
+}
+
+// DeleteSchedule deletes a schedule. Tasks it has already created are not affected.
+func (m *Manager) DeleteSchedule(id uint32) error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	s, exists := m.schedules[id]
+	if !exists {
+		return ErrScheduleNotFound
+	}
+	if m.store != nil {
+		if err := m.store.Delete(scheduleCollection, strconv.FormatUint(uint64(id), 10)); err != nil {
+			return fmt.Errorf("failed to delete schedule %d: %w", id, err)
+		}
+	}
+
+	if s.timer != nil {
+		s.timer.Stop()
+	}
+	delete(m.schedules, id)
+	return nil
+}
+
+// prepare checks a schedule and parses its cron expression and time zone
+func (s *Schedule) prepare() error {
+	if s.ClientID == "" {
+		return fmt.Errorf("%w: client_id is required", ErrInvalidSchedule)
+	}
+	if s.Type == "" {
+		return fmt.Errorf("%w: type is required", ErrInvalidSchedule)
+	}
+	if s.Timeout < 0 {
+		return fmt.Errorf("%w: timeout must not be negative", ErrInvalidSchedule)
+	}
+	if (s.Cron == "") == (s.Interval == 0) {
+		return fmt.Errorf("%w: either cron or interval is required", ErrInvalidSchedule)
+	}
+	if s.Interval < 0 {
+		return fmt.Errorf("%w: interval must be positive", ErrInvalidSchedule)
+	}
+
+	s.location = time.Local
+	if s.Timezone != "" {
+		location, err := time.LoadLocation(s.Timezone)
+		if err != nil {
+			return fmt.Errorf("%w: unknown timezone %q", ErrInvalidSchedule, s.Timezone)
+		}
+		s.location = location
+	}
+	if s.Cron != "" {
+		cron, err := parseCron(s.Cron)
+		if err != nil {
+			return fmt.Errorf("%w: %v", ErrInvalidSchedule, err)
+		}
+		if cron.next(time.Now().In(s.location)).IsZero() {
+			return fmt.Errorf("%w: cron expression %q never matches", ErrInvalidSchedule, s.Cron)
+		}
+		s.cron = cron
+	}
+	return nil
+}
+
+// next returns the time of the first run after t
+func (s *Schedule) next(t time.Time) time.Time {
+	if s.cron != nil {
+		return s.cron.next(t.In(s.location))
+	}
+	return t.Add(time.Duration(s.Interval) * time.Second)
+}
+
+// snapshot returns a copy of the schedule that is safe to use without the mutex
+func (s *Schedule) snapshot() *Schedule {
+	c := *s
+	c.timer = nil
+	return &c
+}
+
+// armSchedule sets the timer of a schedule for its next run, or stops it if
+// the schedule is paused. The caller must hold the mutex.
+func (m *Manager) armSchedule(s *Schedule) {
+	if s.timer != nil {
+		s.timer.Stop()
+		s.timer = nil
+	}
+	if s.Paused || s.NextRun.IsZero() {
+		return
+	}
+
+	id, at := s.ID, s.NextRun
+	s.timer = time.AfterFunc(time.Until(at), func() {
+		m.mutex.Lock()
+		defer m.mutex.Unlock()
+
+		m.runSchedule(id, at)
+	})
+}
+
+// runSchedule creates the task of a schedule's run at the given time and arms
+// the schedule for its next run. No task is created while the task of the
+// previous run has not finished, or if a validator refuses it, such as outside
+// the engagement window. The caller must hold the mutex.
+func (m *Manager) runSchedule(id uint32, at time.Time) {
+	s, exists := m.schedules[id]
+	if !exists || s.Paused || !s.NextRun.Equal(at) {
+		return
+	}
+
+	// Interval schedules keep their rhythm, unless runs were missed
+	now := time.Now()
+	s.NextRun = s.next(at)
+	if !s.NextRun.After(now) {
+		s.NextRun = s.next(now)
+	}
+	s.LastRun = now
+
+	if err := m.runScheduledTask(s); err != nil {
+		s.LastError = err.Error()
+		s.SkippedRuns++
+		log.Printf("Skipped run of schedule %d: %v", s.ID, err)
+	} else {
+		s.LastError = ""
+		s.Runs++
+	}
+
+	if err := m.persistSchedule(s); err != nil {
+		log.Printf("Failed to persist schedule %d: %v", s.ID, err)
+	}
+	m.armSchedule(s)
+}
+
+// runScheduledTask creates the task of a schedule's run. The caller must hold the mutex.
+func (m *Manager) runScheduledTask(s *Schedule) error {
+	if previous, exists := m.tasks[s.LastTaskID]; exists && (!previous.Finished() || m.shouldRetry(previous)) {
+		return fmt.Errorf("task %d of the previous run has not finished", previous.ID)
+	}
+
+	options := TaskOptions{Timeout: time.Duration(s.Timeout) * time.Second, CreatedBy: s.CreatedBy}
+	task, err := m.createTask(s.Type, s.ClientID, []byte(s.Data), s.Priority, nil, options)
+	if err != nil {
+		return err
+	}
+	s.LastTaskID = task.ID
+	return nil
+}
+
+// restoreSchedule prepares a schedule loaded from the store and arms it for
+// its next run from now. Runs missed while the server was down are not made
+// up. The caller must hold the mutex.
+func (m *Manager) restoreSchedule(s *Schedule) error {
+	if err := s.prepare(); err != nil {
+		return err
+	}
+	if !s.Paused && !s.NextRun.After(time.Now()) {
+		s.NextRun = s.next(time.Now())
+		if err := m.persistSchedule(s); err != nil {
+			return err
+		}
+	}
+
+	m.schedules[s.ID] = s
+	if s.ID >= m.nextScheduleID {
+		m.nextScheduleID = s.ID + 1
+	}
+	m.armSchedule(s)
+	return nil
+}
+
+// persistSchedule writes a schedule to the store, if one is set. The caller must hold the mutex.
+func (m *Manager) persistSchedule(s *Schedule) error {
+	if m.store == nil {
+		return nil
+	}
+	if err := m.store.Put(scheduleCollection, strconv.FormatUint(uint64(s.ID), 10), s); err != nil {
+		return fmt.Errorf("failed to persist schedule %d: %w", s.ID, err)
+	}
+	return nil
+}
@@ -0,0 +1,103 @@
+package task
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"dinoc2/pkg/store"
+)
+
+func TestCronNext(t *testing.T) {
+	from := time.Date(2026, time.March, 14, 9, 30, 0, 0, time.UTC) // a Saturday
+
+	tests := []struct {
+		expr string
+		want time.Time
+	}{
+		{"0 8 * * *", time.Date(2026, time.March, 15, 8, 0, 0, 0, time.UTC)},
+		{"*/15 * * * *", time.Date(2026, time.March, 14, 9, 45, 0, 0, time.UTC)},
+		{"0 8 * * mon-fri", time.Date(2026, time.March, 16, 8, 0, 0, 0, time.UTC)},
+		{"30 9 1,15 * *", time.Date(2026, time.March, 15, 9, 30, 0, 0, time.UTC)},
+		{"0 0 1 jan *", time.Date(2027, time.January, 1, 0, 0, 0, 0, time.UTC)},
+		{"0 12 13 * 5", time.Date(2026, time.March, 20, 12, 0, 0, 0, time.UTC)}, // the 13th or a Friday
+		{"0 6 * * 7", time.Date(2026, time.March, 15, 6, 0, 0, 0, time.UTC)},
+		{"@hourly", time.Date(2026, time.March, 14, 10, 0, 0, 0, time.UTC)},
+	}
+	for _, test := range tests {
+		cron, err := parseCron(test.expr)
+		if err != nil {
+			t.Errorf("Failed to parse %q: %v", test.expr, err)
+			continue
+		}
+		if got := cron.next(from); !got.Equal(test.want) {
+			t.Errorf("%q: expected next run at %s, got %s", test.expr, test.want, got)
+		}
+	}
+
+	for _, expr := range []string{"", "* * * *", "60 * * * *", "* * * * 8", "5-1 * * * *", "*/0 * * * *", "0 0 * foo *"} {
+		if _, err := parseCron(expr); err == nil {
+			t.Errorf("Expected %q to be invalid", expr)
+		}
+	}
+}
+
+func TestScheduleRuns(t *testing.T) {
+	m := NewManager()
+	s := store.NewMemoryStore()
+	if err := m.SetStore(s); err != nil {
+		t.Fatalf("Failed to set store: %v", err)
+	}
+
+	schedule, err := m.CreateSchedule(Schedule{ClientID: "client1", Type: TaskTypeModuleExec, Data: "sysinfo", Interval: 3600})
+	if err != nil {
+		t.Fatalf("Failed to create schedule: %v", err)
+	}
+	defer m.DeleteSchedule(schedule.ID)
+
+	// run triggers the schedule's next run as its timer would
+	run := func() *Schedule {
+		m.mutex.Lock()
+		m.runSchedule(schedule.ID, m.schedules[schedule.ID].NextRun)
+		m.mutex.Unlock()
+		schedule, _ = m.GetSchedule(schedule.ID)
+		return schedule
+	}
+
+	first := run()
+	if first.Runs != 1 || first.LastTaskID == 0 {
+		t.Fatalf("Expected the first run to create a task, got %+v", first)
+	}
+
+	// The previous task is still pending, so no duplicate is queued
+	if second := run(); second.Runs != 1 || second.SkippedRuns != 1 {
+		t.Errorf("Expected the second run to be skipped, got %d runs and %d skipped", second.Runs, second.SkippedRuns)
+	}
+	if depth := m.QueueStats().ByClient["client1"]; depth != 1 {
+		t.Errorf("Expected 1 queued task, got %d", depth)
+	}
+
+	m.UpdateTaskStatus(first.LastTaskID, TaskStatusCompleted, nil, "")
+	if third := run(); third.Runs != 2 || third.LastTaskID == first.LastTaskID {
+		t.Errorf("Expected the third run to create a task, got %+v", third)
+	}
+
+	// Runs refused by a validator, such as outside the engagement window, are skipped
+	m.AddValidator(func(*Task) error { return errors.New("engagement has not started") })
+	m.UpdateTaskStatus(schedule.LastTaskID, TaskStatusCompleted, nil, "")
+	if refused := run(); refused.Runs != 2 || refused.LastError == "" {
+		t.Errorf("Expected the refused run to be skipped, got %+v", refused)
+	}
+
+	// Paused schedules survive a restart and are not armed
+	if _, err := m.PauseSchedule(schedule.ID); err != nil {
+		t.Fatalf("Failed to pause schedule: %v", err)
+	}
+	restored := NewManager()
+	if err := restored.SetStore(s); err != nil {
+		t.Fatalf("Failed to restore: %v", err)
+	}
+	if got, err := restored.GetSchedule(schedule.ID); err != nil || !got.Paused || got.Runs != 2 {
+		t.Errorf("Expected the paused schedule to be restored, got %+v (%v)", got, err)
+	}
+}
@@ -0,0 +1,315 @@
+package task
+
+import (
+	"container/heap"
+	"errors"
+	"sort"
+	"sync"
+)
+
+// DefaultQueueLimit is the number of tasks that can be queued for one client
+const DefaultQueueLimit = 1000
+
+// strideScale is divided by a client's weight to get how far it advances each
+// time one of its tasks is dispatched
+const strideScale = 1 << 20
+
+// ErrQueueFull is returned when a client already has as many queued tasks as its queue holds
+var ErrQueueFull = errors.New("task queue is full")
+
+// QueueStats describes the tasks waiting to be dispatched
+type QueueStats struct {
+	Queued     int                  `json:"queued"`      // tasks waiting to be dispatched
+	Clients    int                  `json:"clients"`     // clients with queued tasks
+	Limit      int                  `json:"limit"`       // tasks that can be queued per client
+	ByPriority map[TaskPriority]int `json:"by_priority"` // queued tasks by priority
+	ByClient   map[string]int       `json:"by_client"`   // queued tasks by client
+	Dispatched uint64               `json:"dispatched"`  // tasks dispatched since the server started
+	Rejected   uint64               `json:"rejected"`    // tasks refused because a queue was full
+}
+
+// clientQueue holds the tasks queued for one client at one priority
+type clientQueue struct {
+	clientID string
+	tasks    []*Task
+	pass     uint64 // virtual time of the client's next dispatch
+	index    int    // position in the priority's heap, -1 if not in it
+}
+
+// clientHeap orders the clients with queued tasks at one priority by pass
+type clientHeap []*clientQueue
+
+func (h clientHeap) Len() int { return len(h) }
+func (h clientHeap) Less(i, j int) bool {
+	if h[i].pass != h[j].pass {
+		return h[i].pass < h[j].pass
+	}
+	return h[i].clientID < h[j].clientID
+}
+func (h clientHeap) Swap(i, j int) {
+	h[i], h[j] = h[j], h[i]
+	h[i].index = i
+	h[j].index = j
+}
+func (h *clientHeap) Push(x interface{}) {
+	queue := x.(*clientQueue)
+	queue.index = len(*h)
+	*h = append(*h, queue)
+}
+func (h *clientHeap) Pop() interface{} {
+	old := *h
+	queue := old[len(old)-1]
+	old[len(old)-1] = nil
+	queue.index = -1
+	*h = old[:len(old)-1]
+	return queue
+}
+
+// priorityLevel holds the queued tasks of one priority
+type priorityLevel struct {
+	clients map[string]*clientQueue
+	ready   clientHeap
+	vtime   uint64 // pass of the last dispatched client, where newly active clients start
+	queued  int
+}
+
+// scheduler queues tasks that are ready to be dispatched. Higher priorities are
+// always dispatched first; within a priority, clients take turns in proportion
+// to their weight (stride scheduling), so a client with many tasks cannot
+// starve the others. Each client's queue is bounded.
+type scheduler struct {
+	levels     map[TaskPriority]*priorityLevel
+	priorities []TaskPriority // priorities with queued tasks, highest first
+	queued     map[uint32]bool
+	depth      map[string]int
+	weights    map[string]int
+	limit      int
+	dispatched uint64
+	rejected   uint64
+	mutex      sync.Mutex
+	cond       *sync.Cond
+}
+
+// newScheduler creates an empty scheduler
+func newScheduler() *scheduler {
+	s := &scheduler{
+		levels:  make(map[TaskPriority]*priorityLevel),
+		queued:  make(map[uint32]bool),
+		depth:   make(map[string]int),
+		weights: make(map[string]int),
+		limit:   DefaultQueueLimit,
+	}
+	s.cond = sync.NewCond(&s.mutex)
+	return s
+}
+
+// admit reports whether a new task for the client fits in its queue,
+// counting it as rejected if not
+func (s *scheduler) admit(clientID string) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if s.depth[clientID] >= s.limit {
+		s.rejected++
+		return ErrQueueFull
+	}
+	return nil
+}
+
+// push queues a task. Tasks that are already queued are ignored. The limit is
+// checked by admit for new tasks only, so tasks that become ready later, such
+// as retries and tasks whose dependencies completed, are never dropped.
+func (s *scheduler) push(task *Task) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if s.queued[task.ID] {
+		return
+	}
+	s.queued[task.ID] = true
+	s.depth[task.ClientID]++
+
+	level, exists := s.levels[task.Priority]
+	if !exists {
+		level = &priorityLevel{clients: make(map[string]*clientQueue)}
+		s.levels[task.Priority] = level
+	}
+	if level.queued == 0 {
+		s.addPriority(task.Priority)
+	}
+	level.queued++
+
+	queue, exists := level.clients[task.ClientID]
+	if !exists {
+		queue = &clientQueue{clientID: task.ClientID, index: -1}
+		level.clients[task.ClientID] = queue
+	}
+	queue.tasks = append(queue.tasks, task)
+
+	// A client that becomes active starts at the current virtual time, so time
+	// spent idle does not let it take more than its share afterwards
+	if queue.index < 0 {
+		if queue.pass < level.vtime {
+			queue.pass = level.vtime
+		}
+		heap.Push(&level.ready, queue)
+	}
+
+	s.cond.Signal()
+}
+
+// pop removes and returns the next task to dispatch, waiting until one is queued
+func (s *scheduler) pop() *Task {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	for len(s.priorities) == 0 {
+		s.cond.Wait()
+	}
+
+	priority := s.priorities[0]
+	level := s.levels[priority]
+
+	queue := level.ready[0]
+	task := queue.tasks[0]
+	queue.tasks[0] = nil
+	queue.tasks = queue.tasks[1:]
+
+	level.vtime = queue.pass
+	queue.pass += uint64(strideScale / s.weight(queue.clientID))
+	if len(queue.tasks) == 0 {
+		heap.Pop(&level.ready)
+		delete(level.clients, queue.clientID)
+	} else {
+		heap.Fix(&level.ready, 0)
+	}
+
+	s.dequeued(task, level)
+	s.dispatched++
+	return task
+}
+
+// remove takes a task out of the queue, if it is queued
+func (s *scheduler) remove(task *Task) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if !s.queued[task.ID] {
+		return
+	}
+
+	level := s.levels[task.Priority]
+	queue := level.clients[task.ClientID]
+	for i, queued := range queue.tasks {
+		if queued.ID == task.ID {
+			queue.tasks = append(queue.tasks[:i], queue.tasks[i+1:]...)
+			break
+		}
+	}
+	if len(queue.tasks) == 0 {
+		heap.Remove(&level.ready, queue.index)
+		delete(level.clients, queue.clientID)
+	}
+
+	s.dequeued(task, level)
+}
+
+// dequeued updates the counters of a task that left the queue. The caller must hold the mutex.
+func (s *scheduler) dequeued(task *Task, level *priorityLevel) {
+	delete(s.queued, task.ID)
+	if s.depth[task.ClientID]--; s.depth[task.ClientID] == 0 {
+		delete(s.depth, task.ClientID)
+	}
+	if level.queued--; level.queued == 0 {
+		s.removePriority(task.Priority)
+	}
+}
+
+// addPriority records that a priority has queued tasks. The caller must hold the mutex.
+func (s *scheduler) addPriority(priority TaskPriority) {
+	i := sort.Search(len(s.priorities), func(i int) bool { return s.priorities[i] <= priority })
+	s.priorities = append(s.priorities, 0)
+	copy(s.priorities[i+1:], s.priorities[i:])
+	s.priorities[i] = priority
+}
+
+// removePriority records that a priority has no queued tasks left. The caller must hold the mutex.
+func (s *scheduler) removePriority(priority TaskPriority) {
+	for i, p := range s.priorities {
+		if p == priority {
+			s.priorities = append(s.priorities[:i], s.priorities[i+1:]...)
+			return
+		}
+	}
+}
+
+// weight returns the weight of a client. The caller must hold the mutex.
+func (s *scheduler) weight(clientID string) int {
+	if weight, exists := s.weights[clientID]; exists {
+		return weight
+	}
+	return 1
+}
+
+// setWeight sets the share of dispatches a client gets relative to other clients
+func (s *scheduler) setWeight(clientID string, weight int) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if weight <= 1 {
+		delete(s.weights, clientID)
+		return
+	}
+	s.weights[clientID] = weight
+}
+
+// setLimit sets how many tasks can be queued per client
+func (s *scheduler) setLimit(limit int) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.limit = limit
+}
+
+// stats describes the queued tasks
+func (s *scheduler) stats() QueueStats {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	stats := QueueStats{
+		Queued:     len(s.queued),
+		Clients:    len(s.depth),
+		Limit:      s.limit,
+		ByPriority: make(map[TaskPriority]int, len(s.priorities)),
+		ByClient:   make(map[string]int, len(s.depth)),
+		Dispatched: s.dispatched,
+		Rejected:   s.rejected,
+	}
+	for _, priority := range s.priorities {
+		stats.ByPriority[priority] = s.levels[priority].queued
+	}
+	for clientID, depth := range s.depth {
+		stats.ByClient[clientID] = depth
+	}
+	return stats
+}
+
+// SetQueueLimit sets how many tasks can be queued for one client before new
+// tasks are refused with ErrQueueFull
+func (m *Manager) SetQueueLimit(limit int) {
+	if limit <= 0 {
+		limit = DefaultQueueLimit
+	}
+	m.scheduler.setLimit(limit)
+}
+
+// SetClientWeight sets the share of dispatches a client gets relative to other
+// clients with tasks of the same priority. The default weight is 1.
+func (m *Manager) SetClientWeight(clientID string, weight int) {
+	m.scheduler.setWeight(clientID, weight)
+}
+
+// QueueStats describes the tasks waiting to be dispatched
+func (m *Manager) QueueStats() QueueStats {
+	return m.scheduler.stats()
+}
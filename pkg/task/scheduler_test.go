@@ -0,0 +1,128 @@
+package task
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+)
+
+func TestSchedulerFairness(t *testing.T) {
+	m := NewManager()
+	m.SetClientWeight("heavy", 2)
+
+	// A busy client queues many tasks before two others queue a few
+	for i := 0; i < 20; i++ {
+		m.CreateTask(TaskTypeCommand, "busy", nil, TaskPriorityNormal, nil)
+	}
+	for i := 0; i < 4; i++ {
+		m.CreateTask(TaskTypeCommand, "quiet", nil, TaskPriorityNormal, nil)
+		m.CreateTask(TaskTypeCommand, "heavy", nil, TaskPriorityNormal, nil)
+		m.CreateTask(TaskTypeCommand, "heavy", nil, TaskPriorityNormal, nil)
+	}
+	urgent, _ := m.CreateTask(TaskTypeCommand, "busy", nil, TaskPriorityHigh, nil)
+
+	if task := m.GetPendingTask(); task.ID != urgent.ID {
+		t.Fatalf("Expected the high priority task first, got task %d", task.ID)
+	}
+
+	// Over the next 12 dispatches each client gets its share: 1 for busy and
+	// quiet for every 2 of heavy
+	counts := make(map[string]int)
+	for i := 0; i < 12; i++ {
+		counts[m.GetPendingTask().ClientID]++
+	}
+	if counts["busy"] != 3 || counts["quiet"] != 3 || counts["heavy"] != 6 {
+		t.Errorf("Unfair dispatch order: %v", counts)
+	}
+
+	stats := m.QueueStats()
+	if stats.Queued != 20 || stats.ByClient["busy"] != 17 || stats.ByClient["quiet"] != 1 || stats.Dispatched != 13 {
+		t.Errorf("Unexpected queue stats: %+v", stats)
+	}
+}
+
+func TestSchedulerQueueLimit(t *testing.T) {
+	m := NewManager()
+	m.SetQueueLimit(2)
+
+	first, _ := m.CreateTask(TaskTypeCommand, "client", nil, TaskPriorityNormal, nil)
+	m.CreateTask(TaskTypeCommand, "client", nil, TaskPriorityNormal, nil)
+
+	if _, err := m.CreateTask(TaskTypeCommand, "client", nil, TaskPriorityNormal, nil); !errors.Is(err, ErrQueueFull) {
+		t.Fatalf("Expected ErrQueueFull, got %v", err)
+	}
+	if _, err := m.CreateTask(TaskTypeCommand, "other", nil, TaskPriorityNormal, nil); err != nil {
+		t.Errorf("Other clients should not be affected by a full queue: %v", err)
+	}
+
+	// Cancelling a queued task makes room for another
+	if _, err := m.CancelTask(first.ID, ""); err != nil {
+		t.Fatalf("Failed to cancel task: %v", err)
+	}
+	if _, err := m.CreateTask(TaskTypeCommand, "client", nil, TaskPriorityNormal, nil); err != nil {
+		t.Errorf("Expected room in the queue after cancelling, got %v", err)
+	}
+
+	if stats := m.QueueStats(); stats.Rejected != 1 || stats.ByClient["client"] != 2 {
+		t.Errorf("Unexpected queue stats: %+v", stats)
+	}
+}
+
+func benchmarkScheduler(b *testing.B, clients int) {
+	m := NewManager()
+	clientIDs := make([]string, clients)
+	for i := range clientIDs {
+		clientIDs[i] = fmt.Sprintf("client-%d", i)
+	}
+	priorities := []TaskPriority{TaskPriorityLow, TaskPriorityNormal, TaskPriorityHigh}
+
+	// Start with every client holding a few tasks
+	for i := 0; i < clients*4; i++ {
+		m.CreateTask(TaskTypeCommand, clientIDs[i%clients], nil, priorities[i%len(priorities)], nil)
+	}
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := m.CreateTask(TaskTypeCommand, clientIDs[i%clients], nil, priorities[i%len(priorities)], nil); err != nil {
+			b.Fatal(err)
+		}
+		m.GetPendingTask()
+	}
+}
+
+func BenchmarkScheduler1000Clients(b *testing.B)  { benchmarkScheduler(b, 1000) }
+func BenchmarkScheduler10000Clients(b *testing.B) { benchmarkScheduler(b, 10000) }
+
+func BenchmarkSchedulerParallel(b *testing.B) {
+	m := NewManager()
+	const clients = 5000
+
+	// One goroutine dispatches while the benchmark creates tasks in parallel
+	done := make(chan struct{})
+	go func() {
+		for {
+			if m.GetPendingTask().ClientID == "" {
+				close(done)
+				return
+			}
+		}
+	}()
+
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		i := 0
+		for pb.Next() {
+			clientID := fmt.Sprintf("client-%d", i%clients)
+			if _, err := m.CreateTask(TaskTypeCommand, clientID, nil, TaskPriorityNormal, nil); err != nil && !errors.Is(err, ErrQueueFull) {
+				b.Error(err)
+			}
+			i++
+		}
+	})
+	b.StopTimer()
+
+	// A task without a client stops the dispatcher once the queue is drained
+	m.CreateTask(TaskTypeCommand, "", nil, TaskPriorityLow, nil)
+	<-done
+}